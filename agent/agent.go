@@ -0,0 +1,122 @@
+// Package agent keeps an OTR private key in a separate process, and signs for clients that connect to it.
+//
+// A chat client that uses a Client as the key of its conversations never holds the long-term key itself. Every
+// signature is made by the Server, which can ask for confirmation before it signs. The Server and the Client talk over
+// any stream connection, usually a Unix domain socket that only the owner can open.
+//
+// Every request is a byte with the operation followed by the length of its data as a 32 bit big endian number and the
+// data itself. Every response is a byte with the status, followed by its data in the same way. The data of a signing
+// request is the account and the peer, each as a 32 bit big endian length followed by the string, and then the 32
+// bytes to sign.
+//
+// The agent only signs what OTR signs: the SHA-256 HMACs of the AKE, which are 32 bytes long. It can't be used to sign
+// arbitrary data.
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	opPublicKey byte = 0x01
+	opSign      byte = 0x02
+
+	statusOK      byte = 0x00
+	statusRefused byte = 0x01
+	statusFailed  byte = 0x02
+
+	// maxDataLength is much more than any key or hash needs, and stops a peer from making us allocate a lot of memory
+	maxDataLength = 4096
+
+	// signedLength is the length of the only data the agent signs, the SHA-256 HMACs of the AKE
+	signedLength = sha256.Size
+)
+
+var (
+	// ErrRefused is returned by Client.Sign when the agent refused to sign
+	ErrRefused = errors.New("agent: the signing request was refused")
+	// ErrCorruptMessage is returned when a request or response can't be parsed
+	ErrCorruptMessage = errors.New("agent: corrupt message")
+	// ErrNotSignable is returned by Client.Sign for data that isn't the SHA-256 HMAC that the AKE signs
+	ErrNotSignable = errors.New("agent: only the 32 byte MACs of the AKE can be signed")
+)
+
+// Context is who a signature is for, as the client tells the agent. The agent can't check it - it is only there so
+// that the confirmation can show it.
+type Context struct {
+	// Account is our account in the conversation
+	Account string
+	// Peer is the account of the other side of the conversation
+	Peer string
+}
+
+// Request is a signing request
+type Request struct {
+	Context
+	// Hashed is the data to sign, the SHA-256 HMAC of the AKE
+	Hashed []byte
+}
+
+func (r Request) serialize() []byte {
+	data := appendString(nil, r.Account)
+	data = appendString(data, r.Peer)
+	return append(data, r.Hashed...)
+}
+
+func parseRequest(data []byte) (r Request, ok bool) {
+	if r.Account, data, ok = extractString(data); !ok {
+		return r, false
+	}
+	if r.Peer, data, ok = extractString(data); !ok {
+		return r, false
+	}
+	r.Hashed = data
+	return r, true
+}
+
+func appendString(l []byte, s string) []byte {
+	l = binary.BigEndian.AppendUint32(l, uint32(len(s)))
+	return append(l, s...)
+}
+
+func extractString(data []byte) (string, []byte, bool) {
+	if len(data) < 4 {
+		return "", nil, false
+	}
+	length := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	if uint32(len(data)) < length {
+		return "", nil, false
+	}
+	return string(data[:length]), data[length:], true
+}
+
+func writeMessage(w io.Writer, kind byte, data []byte) error {
+	msg := make([]byte, 5, 5+len(data))
+	msg[0] = kind
+	binary.BigEndian.PutUint32(msg[1:], uint32(len(data)))
+	_, err := w.Write(append(msg, data...))
+	return err
+}
+
+func readMessage(r io.Reader) (kind byte, data []byte, err error) {
+	header := make([]byte, 5)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > maxDataLength {
+		return 0, nil, ErrCorruptMessage
+	}
+
+	data = make([]byte, length)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+
+	return header[0], data, nil
+}
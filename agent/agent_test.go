@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/twstrike/otr3"
+)
+
+const alicePrivateKeyHex = "000000000080c81c2cb2eb729b7e6fd48e975a932c638b3a9055478583afa46755683e30102447f6da2d8bec9f386bbb5da6403b0040fee8650b6ab2d7f32c55ab017ae9b6aec8c324ab5844784e9a80e194830d548fb7f09a0410df2c4d5c8bc2b3e9ad484e65412be689cf0834694e0839fb2954021521ffdffb8f5c32c14dbf2020b3ce7500000014da4591d58def96de61aea7b04a8405fe1609308d000000808ddd5cb0b9d66956e3dea5a915d9aba9d8a6e7053b74dadb2fc52f9fe4e5bcc487d2305485ed95fed026ad93f06ebb8c9e8baf693b7887132c7ffdd3b0f72f4002ff4ed56583ca7c54458f8c068ca3e8a4dfa309d1dd5d34e2a4b68e6f4338835e5e0fb4317c9e4c7e4806dafda3ef459cd563775a586dd91b1319f72621bf3f00000080b8147e74d8c45e6318c37731b8b33b984a795b3653c2cd1d65cc99efe097cb7eb2fa49569bab5aab6e8a1c261a27d0f7840a5e80b317e6683042b59b6dceca2879c6ffc877a465be690c15e4a42f9a7588e79b10faac11b1ce3741fcef7aba8ce05327a2c16d279ee1b3d77eb783fb10e3356caa25635331e26dd42b8396c4d00000001420bec691fea37ecea58a5c717142f0b804452f57"
+
+const bobPrivateKeyHex = "000000000080a5138eb3d3eb9c1d85716faecadb718f87d31aaed1157671d7fee7e488f95e8e0ba60ad449ec732710a7dec5190f7182af2e2f98312d98497221dff160fd68033dd4f3a33b7c078d0d9f66e26847e76ca7447d4bab35486045090572863d9e4454777f24d6706f63e02548dfec2d0a620af37bbc1d24f884708a212c343b480d00000014e9c58f0ea21a5e4dfd9f44b6a9f7f6a9961a8fa9000000803c4d111aebd62d3c50c2889d420a32cdf1e98b70affcc1fcf44d59cca2eb019f6b774ef88153fb9b9615441a5fe25ea2d11b74ce922ca0232bd81b3c0fcac2a95b20cb6e6c0c5c1ace2e26f65dc43c751af0edbb10d669890e8ab6beea91410b8b2187af1a8347627a06ecea7e0f772c28aae9461301e83884860c9b656c722f0000008065af8625a555ea0e008cd04743671a3cda21162e83af045725db2eb2bb52712708dc0cc1a84c08b3649b88a966974bde27d8612c2861792ec9f08786a246fcadd6d8d3a81a32287745f309238f47618c2bd7612cb8b02d940571e0f30b96420bcd462ff542901b46109b1e5ad6423744448d20a57818a8cbb1647d0fea3b664e0000001440f9f2eb554cb00d45a5826b54bfa419b6980e48"
+
+func parseKey(t *testing.T, s string) *otr3.PrivateKey {
+	data, _ := hex.DecodeString(s)
+	key := &otr3.PrivateKey{}
+	if _, ok := key.Parse(data); !ok {
+		t.Fatal("failed to parse the key")
+	}
+	return key
+}
+
+// listen starts s on a Unix domain socket in a temporary directory, and returns the path of the socket
+func listen(t *testing.T, s *Server) string {
+	dir, err := os.MkdirTemp("", "otr3-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "agent.sock")
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+
+	t.Cleanup(func() {
+		l.Close()
+		os.RemoveAll(dir)
+	})
+
+	return path
+}
+
+func hashOf(s string) []byte {
+	h := sha256.Sum256([]byte(s))
+	return h[:]
+}
+
+func TestClientReturnsThePublicKeyOfTheAgent(t *testing.T) {
+	key := parseKey(t, alicePrivateKeyHex)
+	c, err := Dial(listen(t, &Server{Key: key}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if string(c.Public().Serialize()) != string(key.Public().Serialize()) {
+		t.Error("expected the public key of the agent")
+	}
+}
+
+func TestClientSignsWithTheKeyOfTheAgent(t *testing.T) {
+	key := parseKey(t, alicePrivateKeyHex)
+	c, _ := Dial(listen(t, &Server{Key: key}))
+	defer c.Close()
+
+	hashed := hashOf("hello")
+	sig, err := c.Sign(nil, hashed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := key.Public().Verify(hashed, sig); !ok {
+		t.Error("expected the signature to verify with the key of the agent")
+	}
+}
+
+func TestServerAsksForConfirmationOfEveryRequest(t *testing.T) {
+	var requests []Request
+	s := &Server{Key: parseKey(t, alicePrivateKeyHex), Confirm: func(r Request) bool {
+		requests = append(requests, r)
+		return len(requests) == 1
+	}}
+	c, _ := Dial(listen(t, s))
+	defer c.Close()
+
+	if _, err := c.Sign(nil, hashOf("first")); err != nil {
+		t.Errorf("expected the first request to be signed, got %v", err)
+	}
+
+	if _, err := c.Sign(nil, hashOf("second")); err != ErrRefused {
+		t.Errorf("expected the second request to be refused, got %v", err)
+	}
+
+	if len(requests) != 2 || string(requests[1].Hashed) != string(hashOf("second")) {
+		t.Error("expected to be asked to confirm both requests")
+	}
+}
+
+func TestServerShowsTheContextOfTheRequestWhenItAsksForConfirmation(t *testing.T) {
+	var request Request
+	s := &Server{Key: parseKey(t, alicePrivateKeyHex), Confirm: func(r Request) bool {
+		request = r
+		return true
+	}}
+	c, _ := Dial(listen(t, s))
+	defer c.Close()
+
+	ctx := Context{Account: "alice@example.com", Peer: "bob@example.com"}
+	if _, err := c.WithContext(ctx).Sign(nil, hashOf("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	if request.Context != ctx || string(request.Hashed) != string(hashOf("hello")) {
+		t.Errorf("expected the request to have the context %+v, got %+v", ctx, request)
+	}
+}
+
+func TestClientDoesntAskToSignAnythingButTheMACsOfTheAKE(t *testing.T) {
+	confirmed := false
+	s := &Server{Key: parseKey(t, alicePrivateKeyHex), Confirm: func(r Request) bool {
+		confirmed = true
+		return true
+	}}
+	c, _ := Dial(listen(t, s))
+	defer c.Close()
+
+	for _, data := range [][]byte{nil, []byte("hello"), make([]byte, 20), make([]byte, 33)} {
+		if _, err := c.Sign(nil, data); err != ErrNotSignable {
+			t.Errorf("expected %d bytes not to be signed, got %v", len(data), err)
+		}
+	}
+
+	if confirmed {
+		t.Error("didn't expect to be asked to confirm")
+	}
+}
+
+func TestServerRefusesToSignAnythingButTheMACsOfTheAKE(t *testing.T) {
+	confirmed := false
+	s := &Server{Key: parseKey(t, alicePrivateKeyHex), Confirm: func(r Request) bool {
+		confirmed = true
+		return true
+	}}
+	client, server := net.Pipe()
+	go s.ServeConn(server)
+	defer client.Close()
+
+	writeMessage(client, opSign, Request{Hashed: make([]byte, 4000)}.serialize())
+	if status, _, _ := readMessage(client); status != statusRefused {
+		t.Errorf("expected the request to be refused, got status %d", status)
+	}
+
+	if confirmed {
+		t.Error("didn't expect to be asked to confirm")
+	}
+}
+
+func TestServerFailsForACorruptSigningRequest(t *testing.T) {
+	client, server := net.Pipe()
+	go (&Server{Key: parseKey(t, alicePrivateKeyHex)}).ServeConn(server)
+	defer client.Close()
+
+	writeMessage(client, opSign, []byte{0x00, 0x00, 0x00, 0x05, 'a'})
+	if status, _, _ := readMessage(client); status != statusFailed {
+		t.Errorf("expected the request to fail, got status %d", status)
+	}
+}
+
+func TestClientReturnsTheErrorsOfTheAgent(t *testing.T) {
+	s := &Server{Key: failingSigner{parseKey(t, alicePrivateKeyHex)}}
+	c, _ := Dial(listen(t, s))
+	defer c.Close()
+
+	if _, err := c.Sign(nil, hashOf("hello")); err == nil || err.Error() != "agent: failed to sign" {
+		t.Errorf("expected the error of the agent, got %v", err)
+	}
+}
+
+func TestServerClosesTheConnectionOnACorruptRequest(t *testing.T) {
+	client, server := net.Pipe()
+	go (&Server{Key: parseKey(t, alicePrivateKeyHex)}).ServeConn(server)
+
+	client.Write([]byte{opSign, 0xFF, 0xFF, 0xFF, 0xFF})
+	if _, _, err := readMessage(client); err == nil {
+		t.Error("expected the connection to be closed")
+	}
+}
+
+func TestDialFailsWithoutAnAgent(t *testing.T) {
+	if _, err := Dial(filepath.Join(os.TempDir(), "no-otr3-agent-here.sock")); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestConversationsAuthenticateWithAKeyInTheAgent(t *testing.T) {
+	c, _ := Dial(listen(t, &Server{Key: parseKey(t, bobPrivateKeyHex)}))
+	defer c.Close()
+
+	alice := &otr3.Conversation{Rand: rand.Reader}
+	alice.Policies.AllowV3()
+	alice.SetKeys(parseKey(t, alicePrivateKeyHex), nil)
+
+	bob := &otr3.Conversation{Rand: rand.Reader}
+	bob.Policies.AllowV3()
+	bob.SetKeys(c.WithContext(Context{Account: "bob@example.com", Peer: "alice@example.com"}), nil)
+
+	toBob := []otr3.ValidMessage{alice.QueryMessage()}
+	for len(toBob) > 0 {
+		var toAlice []otr3.ValidMessage
+		for _, m := range toBob {
+			_, msgs, err := bob.Receive(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			toAlice = append(toAlice, msgs...)
+		}
+
+		toBob = nil
+		for _, m := range toAlice {
+			_, msgs, err := alice.Receive(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			toBob = append(toBob, msgs...)
+		}
+	}
+
+	if !alice.IsEncrypted() || !bob.IsEncrypted() {
+		t.Fatal("expected both conversations to be encrypted")
+	}
+
+	if string(alice.GetTheirKey().Serialize()) != string(c.Public().Serialize()) {
+		t.Error("expected alice to see the key of the agent")
+	}
+}
+
+// failingSigner has the public key of a key, but fails to sign
+type failingSigner struct {
+	*otr3.PrivateKey
+}
+
+func (failingSigner) Sign(io.Reader, []byte) ([]byte, error) {
+	return nil, errors.New("failed to sign")
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/twstrike/otr3"
+)
+
+// Client is an otr3.Signer that asks a Server to sign. It is safe for concurrent use.
+type Client struct {
+	mu   sync.Mutex
+	conn io.ReadWriteCloser
+	pub  *otr3.PublicKey
+}
+
+// Dial connects to the agent listening on the Unix domain socket at path
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// NewClient returns a Client that talks to an agent over conn. It asks the agent for its public key right away.
+func NewClient(conn io.ReadWriteCloser) (*Client, error) {
+	c := &Client{conn: conn}
+
+	data, err := c.request(opPublicKey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	pub := &otr3.PublicKey{}
+	if rest, ok := pub.Parse(data); !ok || len(rest) > 0 {
+		return nil, ErrCorruptMessage
+	}
+	c.pub = pub
+
+	return c, nil
+}
+
+// Public returns the public key of the agent
+func (c *Client) Public() *otr3.PublicKey {
+	return c.pub
+}
+
+// Sign asks the agent to sign hashed, without telling it who the signature is for. rand is not used, since the
+// agent has its own source of randomness. It returns ErrNotSignable if hashed is not a MAC of the AKE, and
+// ErrRefused if the agent didn't confirm the request.
+func (c *Client) Sign(rand io.Reader, hashed []byte) ([]byte, error) {
+	return c.sign(Request{Hashed: hashed})
+}
+
+// WithContext returns a Signer that asks the agent to sign in the same way as c, but also tells it the account and
+// the peer of the conversation, so they can be shown when the agent asks for confirmation. It is what should be
+// used as the key of a conversation.
+func (c *Client) WithContext(ctx Context) otr3.Signer {
+	return contextSigner{c, ctx}
+}
+
+func (c *Client) sign(r Request) ([]byte, error) {
+	if len(r.Hashed) != signedLength {
+		return nil, ErrNotSignable
+	}
+	return c.request(opSign, r.serialize())
+}
+
+// Close closes the connection to the agent
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+type contextSigner struct {
+	c   *Client
+	ctx Context
+}
+
+func (s contextSigner) Public() *otr3.PublicKey {
+	return s.c.Public()
+}
+
+func (s contextSigner) Sign(rand io.Reader, hashed []byte) ([]byte, error) {
+	return s.c.sign(Request{Context: s.ctx, Hashed: hashed})
+}
+
+func (c *Client) request(op byte, data []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := writeMessage(c.conn, op, data); err != nil {
+		return nil, err
+	}
+
+	status, reply, err := readMessage(c.conn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch status {
+	case statusOK:
+		return reply, nil
+	case statusRefused:
+		return nil, ErrRefused
+	case statusFailed:
+		return nil, errors.New("agent: " + string(reply))
+	default:
+		return nil, ErrCorruptMessage
+	}
+}
@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"crypto/rand"
+	"io"
+	"net"
+
+	"github.com/twstrike/otr3"
+)
+
+// Server signs with a private key for the clients that connect to it
+type Server struct {
+	// Key is the key used to sign, usually an *otr3.PrivateKey
+	Key otr3.Signer
+	// Rand is the source of randomness for the signatures. If it is nil, crypto/rand.Reader is used
+	Rand io.Reader
+	// Confirm is called for every signing request before the key is used, with the account and the peer the client
+	// says the signature is for, and the data that would be signed. Requests for anything else than the MACs of the
+	// AKE are refused before Confirm is called. The request is refused if it returns false. Every request is signed
+	// if it is nil. It can be called from many goroutines at the same time, one for every connection.
+	Confirm func(r Request) bool
+}
+
+// Serve accepts connections on l and serves every one of them on its own goroutine.
+// It returns when l fails to accept, for example because it was closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn answers the requests that come on conn until it is closed or sends something that can't be parsed.
+// It closes conn before returning.
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
+	defer conn.Close()
+
+	for {
+		op, data, err := readMessage(conn)
+		if err != nil {
+			return
+		}
+
+		status, reply := s.handle(op, data)
+		if writeMessage(conn, status, reply) != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(op byte, data []byte) (status byte, reply []byte) {
+	switch op {
+	case opPublicKey:
+		return statusOK, s.Key.Public().Serialize()
+	case opSign:
+		r, ok := parseRequest(data)
+		if !ok {
+			return statusFailed, []byte("corrupt signing request")
+		}
+		if len(r.Hashed) != signedLength {
+			return statusRefused, nil
+		}
+		if s.Confirm != nil && !s.Confirm(r) {
+			return statusRefused, nil
+		}
+
+		sig, err := s.Key.Sign(s.rand(), r.Hashed)
+		if err != nil {
+			return statusFailed, []byte(err.Error())
+		}
+		return statusOK, sig
+	default:
+		return statusFailed, []byte("unknown operation")
+	}
+}
+
+func (s *Server) rand() io.Reader {
+	if s.Rand != nil {
+		return s.Rand
+	}
+	return rand.Reader
+}
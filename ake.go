@@ -18,8 +18,7 @@ type ake struct {
 	encryptedGx []byte
 	hashedGx    [sha256.Size]byte
 
-	revealKey akeKeys
-	sigKey    akeKeys
+	akeKeys lockedAKEKeys
 
 	state authState
 	keys  keyManagementContext
@@ -40,7 +39,24 @@ func (c *Conversation) initAKE() {
 }
 
 func (c *Conversation) calcAKEKeys(s *big.Int) {
-	c.ssid, c.ake.revealKey, c.ake.sigKey = calculateAKEKeys(s)
+	c.ake.akeKeys.wipe()
+	c.ake.akeKeys = newLockedAKEKeys()
+	c.ssid = calculateAKEKeys(s, c.ake.akeKeys.revealSigKeys, c.ake.akeKeys.signatureKeys)
+}
+
+// revealKey and sigKey return the keys of the AKE, which are all zeroes until they are calculated
+func (a *ake) revealKey() *akeKeys {
+	if a.akeKeys.revealSigKeys == nil {
+		return &akeKeys{}
+	}
+	return a.akeKeys.revealSigKeys
+}
+
+func (a *ake) sigKey() *akeKeys {
+	if a.akeKeys.signatureKeys == nil {
+		return &akeKeys{}
+	}
+	return a.akeKeys.signatureKeys
 }
 
 func (c *Conversation) setSecretExponent(val *big.Int) {
@@ -53,7 +69,7 @@ func (c *Conversation) calcDHSharedSecret() *big.Int {
 }
 
 func (c *Conversation) generateEncryptedSignature(key *akeKeys) ([]byte, error) {
-	verifyData := appendAll(c.ake.ourPublicValue, c.ake.theirPublicValue, &c.ourKey.PublicKey, c.ake.keys.ourKeyID)
+	verifyData := appendAll(c.ake.ourPublicValue, c.ake.theirPublicValue, c.ourKey.Public(), c.ake.keys.ourKeyID)
 
 	mb := sumHMAC(key.m1[:], verifyData)
 	xb, err := c.calcXb(key, mb)
@@ -69,7 +85,7 @@ func appendAll(one, two *big.Int, publicKey *PublicKey, keyID uint32) []byte {
 }
 
 func (c *Conversation) calcXb(key *akeKeys, mb []byte) ([]byte, error) {
-	xb := c.ourKey.PublicKey.serialize()
+	xb := c.ourKey.Public().serialize()
 	xb = appendWord(xb, c.ake.keys.ourKeyID)
 
 	sigb, err := c.ourKey.Sign(c.rand(), mb)
@@ -78,7 +94,7 @@ func (c *Conversation) calcXb(key *akeKeys, mb []byte) ([]byte, error) {
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, c.randomnessError(err)
 	}
 
 	// this error can't happen, since key.c is fixed to the correct size
@@ -146,15 +162,19 @@ func (c *Conversation) serializeDHKey() []byte {
 // revealSigMessage = bob = x
 // Bob ---- Reveal Signature ----> Alice
 func (c *Conversation) revealSigMessage() ([]byte, error) {
+	if err := c.ensureOurKey(); err != nil {
+		return nil, err
+	}
+
 	c.calcAKEKeys(c.calcDHSharedSecret())
 	c.ake.keys.ourKeyID++
 
-	encryptedSig, err := c.generateEncryptedSignature(&c.ake.revealKey)
+	encryptedSig, err := c.generateEncryptedSignature(c.ake.revealKey())
 	if err != nil {
 		return nil, err
 	}
 
-	macSig := sumHMAC(c.ake.revealKey.m2[:], encryptedSig)
+	macSig := sumHMAC(c.ake.revealKey().m2[:], encryptedSig)
 	revealSigMsg := revealSig{
 		r:            c.ake.r,
 		encryptedSig: encryptedSig,
@@ -167,14 +187,18 @@ func (c *Conversation) revealSigMessage() ([]byte, error) {
 // sigMessage = alice = y
 // Alice -- Signature -----------> Bob
 func (c *Conversation) sigMessage() ([]byte, error) {
+	if err := c.ensureOurKey(); err != nil {
+		return nil, err
+	}
+
 	c.ake.keys.ourKeyID++
 
-	encryptedSig, err := c.generateEncryptedSignature(&c.ake.sigKey)
+	encryptedSig, err := c.generateEncryptedSignature(c.ake.sigKey())
 	if err != nil {
 		return nil, err
 	}
 
-	macSig := sumHMAC(c.ake.sigKey.m2[:], encryptedSig)
+	macSig := sumHMAC(c.ake.sigKey().m2[:], encryptedSig)
 	sigMsg := sig{
 		encryptedSig: encryptedSig,
 		macSig:       macSig,
@@ -248,8 +272,8 @@ func (c *Conversation) processRevealSig(msg []byte) (err error) {
 	}
 
 	c.calcAKEKeys(c.calcDHSharedSecret())
-	if err = c.processEncryptedSig(encryptedSig, theirMAC, &c.ake.revealKey); err != nil {
-		return newOtrError("in reveal signature message: " + err.Error())
+	if err = c.processEncryptedSig(encryptedSig, theirMAC, c.ake.revealKey()); err != nil {
+		return wrapOtrError("in reveal signature message", err)
 	}
 
 	return nil
@@ -267,8 +291,8 @@ func (c *Conversation) processSig(msg []byte) (err error) {
 	theirMAC := sigMsg.macSig
 	encryptedSig := sigMsg.encryptedSig
 
-	if err := c.processEncryptedSig(encryptedSig, theirMAC, &c.ake.sigKey); err != nil {
-		return newOtrError("in signature message: " + err.Error())
+	if err := c.processEncryptedSig(encryptedSig, theirMAC, c.ake.sigKey()); err != nil {
+		return wrapOtrError("in signature message", err)
 	}
 
 	return nil
@@ -315,7 +339,15 @@ func (c *Conversation) expectedMessageHMAC(keyID uint32, keys *akeKeys) []byte {
 	return sumHMAC(keys.m1[:], verifyData)
 }
 
-func (c *Conversation) processEncryptedSig(encryptedSig []byte, theirMAC []byte, keys *akeKeys) error {
+func (c *Conversation) processEncryptedSig(encryptedSig []byte, theirMAC []byte, keys *akeKeys) (err error) {
+	// parseTheirKey replaces our view of their key, which has to be undone if the key isn't accepted
+	previousKey := c.theirKey
+	defer func() {
+		if err != nil {
+			c.theirKey = previousKey
+		}
+	}()
+
 	if err := verifyEncryptedSignatureMAC(encryptedSig, theirMAC, keys); err != nil {
 		return err
 	}
@@ -330,11 +362,19 @@ func (c *Conversation) processEncryptedSig(encryptedSig []byte, theirMAC []byte,
 		return err
 	}
 
+	if err := c.theirKey.validate(); err != nil {
+		return err
+	}
+
 	mb := c.expectedMessageHMAC(keyID, keys)
 	if err := c.checkedSignatureVerification(mb, sig); err != nil {
 		return err
 	}
 
+	if err := c.checkPinnedKey(); err != nil {
+		return err
+	}
+
 	c.ake.keys.theirKeyID = keyID
 
 	return nil
@@ -0,0 +1,502 @@
+package otr3
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/twstrike/otr3/internal/modeltest"
+)
+
+// The model of this file is the AKE state machine of the OTRv3 spec, written as plainly as possible. It doesn't do
+// any cryptography: a D-H Commit is known by its hashed gx and a D-H Key by its gy, both taken from the wire, and the
+// model tracks which of them a Reveal Signature or a Signature message was computed from, since that is what decides
+// whether the message can be verified.
+
+const (
+	akeStateNone              = "AUTHSTATE_NONE"
+	akeStateAwaitingDHKey     = "AUTHSTATE_AWAITING_DHKEY"
+	akeStateAwaitingRevealSig = "AUTHSTATE_AWAITING_REVEALSIG"
+	akeStateAwaitingSig       = "AUTHSTATE_AWAITING_SIG"
+)
+
+// akeQuery is the type the model gives to query messages, which are not encoded messages
+const akeQuery = byte(0)
+
+// akeFresh stands for a new gx or gy. The runner replaces it with the value the conversation actually sent.
+const akeFresh = "fresh"
+
+type akeModelMessage struct {
+	typ    byte
+	commit string
+	y      string
+}
+
+type akeModelParty struct {
+	state     string
+	encrypted bool
+	// ourCommit is the hashed gx of the D-H Commit we sent, and theirCommit the one of the D-H Commit we answered
+	ourCommit, theirCommit string
+	// ourY is the gy of the D-H Key we sent, and theirY the one of the D-H Key we answered
+	ourY, theirY string
+}
+
+type akeModelResult struct {
+	sent   []akeModelMessage
+	event  string
+	accept bool
+}
+
+type akeModel struct {
+	cover func(string)
+}
+
+func (m *akeModel) newAKE(p *akeModelParty, state string) {
+	*p = akeModelParty{state: state, encrypted: p.encrypted}
+}
+
+func (m *akeModel) finish(p *akeModelParty, transition string, r *akeModelResult) {
+	m.cover(transition)
+	r.event, r.accept = "GoneSecure", true
+	if p.encrypted {
+		r.event = "StillSecure"
+	}
+	m.newAKE(p, akeStateNone)
+	p.encrypted = true
+}
+
+// answerCommit replies to a D-H Commit with a new D-H Key, as in AUTHSTATE_NONE
+func (m *akeModel) answerCommit(p *akeModelParty, msg akeModelMessage, transition string) (r akeModelResult) {
+	m.cover(transition)
+	m.newAKE(p, akeStateAwaitingRevealSig)
+	p.theirCommit, p.ourY = msg.commit, akeFresh
+	r.sent, r.accept = []akeModelMessage{{typ: msgTypeDHKey, y: akeFresh}}, true
+	return
+}
+
+func (m *akeModel) receive(p *akeModelParty, msg akeModelMessage) (r akeModelResult) {
+	switch msg.typ {
+	case akeQuery:
+		m.cover("receive a query")
+		m.newAKE(p, akeStateAwaitingDHKey)
+		p.ourCommit = akeFresh
+		r.sent, r.accept = []akeModelMessage{{typ: msgTypeDHCommit, commit: akeFresh}}, true
+
+	case msgTypeDHCommit:
+		switch p.state {
+		case akeStateNone:
+			return m.answerCommit(p, msg, "NONE receives a D-H Commit")
+		case akeStateAwaitingDHKey:
+			// The hashes have the same length, so comparing them in hexadecimal compares them as numbers
+			if p.ourCommit > msg.commit {
+				m.cover("AWAITING_DHKEY receives a D-H Commit with a lower hash")
+				r.sent, r.accept = []akeModelMessage{{typ: msgTypeDHCommit, commit: p.ourCommit}}, true
+				return
+			}
+			return m.answerCommit(p, msg, "AWAITING_DHKEY receives a D-H Commit with a higher hash")
+		case akeStateAwaitingRevealSig:
+			m.cover("AWAITING_REVEALSIG receives a D-H Commit")
+			p.theirCommit = msg.commit
+			r.sent, r.accept = []akeModelMessage{{typ: msgTypeDHKey, y: p.ourY}}, true
+		case akeStateAwaitingSig:
+			return m.answerCommit(p, msg, "AWAITING_SIG receives a D-H Commit")
+		}
+
+	case msgTypeDHKey:
+		switch {
+		case p.state == akeStateAwaitingDHKey:
+			m.cover("AWAITING_DHKEY receives a D-H Key")
+			p.state, p.theirY = akeStateAwaitingSig, msg.y
+			r.sent, r.accept = []akeModelMessage{{typ: msgTypeRevealSig, commit: p.ourCommit, y: p.theirY}}, true
+		case p.state == akeStateAwaitingSig && msg.y == p.theirY:
+			m.cover("AWAITING_SIG receives the same D-H Key")
+			r.sent, r.accept = []akeModelMessage{{typ: msgTypeRevealSig, commit: p.ourCommit, y: p.theirY}}, true
+		case p.state == akeStateAwaitingSig:
+			m.cover("AWAITING_SIG receives another D-H Key")
+		default:
+			m.cover("a D-H Key is ignored")
+		}
+
+	case msgTypeRevealSig:
+		switch {
+		case p.state == akeStateAwaitingRevealSig && msg.commit == p.theirCommit && msg.y == p.ourY:
+			r.sent = []akeModelMessage{{typ: msgTypeSig, commit: p.theirCommit, y: p.ourY}}
+			m.finish(p, "AWAITING_REVEALSIG receives a Reveal Signature", &r)
+		case p.state == akeStateAwaitingRevealSig:
+			m.cover("AWAITING_REVEALSIG receives a Reveal Signature of another AKE")
+		default:
+			m.cover("a Reveal Signature is ignored")
+		}
+
+	case msgTypeSig:
+		switch {
+		case p.state == akeStateAwaitingSig && msg.commit == p.ourCommit && msg.y == p.theirY:
+			m.finish(p, "AWAITING_SIG receives a Signature", &r)
+		case p.state == akeStateAwaitingSig:
+			m.cover("AWAITING_SIG receives a Signature of another AKE")
+		default:
+			m.cover("a Signature is ignored")
+		}
+	}
+	return
+}
+
+var akeModelTransitions = []string{
+	"receive a query",
+	"NONE receives a D-H Commit",
+	"AWAITING_DHKEY receives a D-H Commit with a lower hash",
+	"AWAITING_DHKEY receives a D-H Commit with a higher hash",
+	"AWAITING_REVEALSIG receives a D-H Commit",
+	"AWAITING_SIG receives a D-H Commit",
+	"AWAITING_DHKEY receives a D-H Key",
+	"AWAITING_SIG receives the same D-H Key",
+	"AWAITING_SIG receives another D-H Key",
+	"a D-H Key is ignored",
+	"AWAITING_REVEALSIG receives a Reveal Signature",
+	"AWAITING_REVEALSIG receives a Reveal Signature of another AKE",
+	"a Reveal Signature is ignored",
+	"AWAITING_SIG receives a Signature",
+	"AWAITING_SIG receives a Signature of another AKE",
+	"a Signature is ignored",
+}
+
+type akeOpKind int
+
+const (
+	akeOpQuery akeOpKind = iota
+	akeOpDeliver
+	akeOpReplay
+	akeOpDrop
+)
+
+// akeOp is something that happens to one of the peers, or to the messages between them. Deliveries and losses pick
+// the message in flight at index, and replays the message the peer received index messages ago, modulo how many
+// there are, so they still make sense when the sequence is shrunk.
+type akeOp struct {
+	kind  akeOpKind
+	bob   bool
+	index int
+}
+
+func (op akeOp) String() string {
+	name := "alice"
+	if op.bob {
+		name = "bob"
+	}
+
+	switch op.kind {
+	case akeOpQuery:
+		return fmt.Sprintf("%s sends a query", name)
+	case akeOpDeliver:
+		return fmt.Sprintf("message %d in flight arrives", op.index)
+	case akeOpReplay:
+		return fmt.Sprintf("%s receives again the message received %d messages ago", name, op.index)
+	default:
+		return fmt.Sprintf("message %d in flight is lost", op.index)
+	}
+}
+
+func generateAKEOp(r *rand.Rand) modeltest.Op {
+	// Most operations deliver messages in order, so that many AKEs get to the end
+	op := akeOp{bob: r.Intn(2) == 1}
+	if r.Intn(2) == 0 {
+		op.index = 1 + r.Intn(2)
+	}
+
+	switch n := r.Intn(20); {
+	case n < 3:
+		op.kind = akeOpQuery
+	case n < 16:
+		op.kind = akeOpDeliver
+	case n < 18:
+		op.kind = akeOpReplay
+	default:
+		op.kind = akeOpDrop
+	}
+	return op
+}
+
+type akeInFlight struct {
+	to    *akeModelPeer
+	wire  ValidMessage
+	model akeModelMessage
+}
+
+type akeModelPeer struct {
+	*transcriptPeer
+	model    akeModelParty
+	received []akeInFlight
+}
+
+type akeModelRunner struct {
+	model      akeModel
+	alice, bob *akeModelPeer
+	inFlight   []akeInFlight
+	// seen has every gx hash and gy sent so far, to check that fresh ones are new
+	seen map[string]bool
+}
+
+func newAKEModelRunner(cover func(string)) *akeModelRunner {
+	tr := newTranscriptRecorder("", "otr3 AKE model")
+	tr.policies((*policies).AllowV3)
+	return &akeModelRunner{
+		model: akeModel{cover: cover},
+		alice: &akeModelPeer{transcriptPeer: tr.alice, model: akeModelParty{state: akeStateNone}},
+		bob:   &akeModelPeer{transcriptPeer: tr.bob, model: akeModelParty{state: akeStateNone}},
+		seen:  map[string]bool{},
+	}
+}
+
+func (r *akeModelRunner) other(p *akeModelPeer) *akeModelPeer {
+	if p == r.alice {
+		return r.bob
+	}
+	return r.alice
+}
+
+// take returns the message op picks, and removes it from the messages in flight unless it's a replay
+func (r *akeModelRunner) take(op akeOp) (akeInFlight, bool) {
+	if op.kind == akeOpReplay {
+		p := r.alice
+		if op.bob {
+			p = r.bob
+		}
+		if len(p.received) == 0 {
+			return akeInFlight{}, false
+		}
+		return p.received[len(p.received)-1-op.index%len(p.received)], true
+	}
+
+	if len(r.inFlight) == 0 {
+		return akeInFlight{}, false
+	}
+	j := op.index % len(r.inFlight)
+	msg := r.inFlight[j]
+	r.inFlight = append(r.inFlight[:j], r.inFlight[j+1:]...)
+	return msg, true
+}
+
+func (r *akeModelRunner) do(op akeOp) error {
+	if op.kind == akeOpQuery {
+		p := r.alice
+		if op.bob {
+			p = r.bob
+		}
+		r.inFlight = append(r.inFlight, akeInFlight{to: r.other(p), wire: p.conv.QueryMessage(), model: akeModelMessage{typ: akeQuery}})
+		return nil
+	}
+
+	msg, ok := r.take(op)
+	if !ok || op.kind == akeOpDrop {
+		return nil
+	}
+
+	p := msg.to
+	p.received = append(p.received, msg)
+	p.events = nil
+
+	expected := r.model.receive(&p.model, msg.model)
+	_, toSend, err := p.conv.Receive(msg.wire)
+
+	if err != nil && expected.accept {
+		return fmt.Errorf("%s returned the error %v, but the model expects the message to be accepted", p.name, err)
+	}
+	sent, err := r.compareSent(p, expected.sent, toSend)
+	if err != nil {
+		return err
+	}
+	if err := r.compareState(p, expected.event); err != nil {
+		return err
+	}
+
+	for _, m := range sent {
+		r.inFlight = append(r.inFlight, m)
+	}
+	return nil
+}
+
+// compareSent checks that toSend are the messages the model expects, and fills in the fresh values of the model
+func (r *akeModelRunner) compareSent(p *akeModelPeer, expected []akeModelMessage, toSend []ValidMessage) ([]akeInFlight, error) {
+	if len(toSend) != len(expected) {
+		return nil, fmt.Errorf("%s sent %d messages, but the model expects %d", p.name, len(toSend), len(expected))
+	}
+
+	var result []akeInFlight
+	for i, wire := range toSend {
+		actual, err := parseAKEModelMessage(wire)
+		if err != nil {
+			return nil, fmt.Errorf("%s sent a message that can't be parsed: %v", p.name, err)
+		}
+
+		exp := expected[i]
+		if actual.typ != exp.typ {
+			return nil, fmt.Errorf("%s sent a %s, but the model expects a %s", p.name, messageTypeName(actual.typ), messageTypeName(exp.typ))
+		}
+
+		switch {
+		case exp.commit == akeFresh || exp.y == akeFresh:
+			value := actual.commit + actual.y
+			if r.seen[value] {
+				return nil, fmt.Errorf("%s sent a %s that was sent before, but the model expects a new one", p.name, messageTypeName(exp.typ))
+			}
+			r.seen[value] = true
+			if exp.commit == akeFresh {
+				exp.commit, p.model.ourCommit = actual.commit, actual.commit
+			} else {
+				exp.y, p.model.ourY = actual.y, actual.y
+			}
+		case exp.typ == msgTypeDHCommit && actual.commit != exp.commit, exp.typ == msgTypeDHKey && actual.y != exp.y:
+			return nil, fmt.Errorf("%s sent a new %s, but the model expects it to resend the one it sent before", p.name, messageTypeName(exp.typ))
+		}
+
+		result = append(result, akeInFlight{to: r.other(p), wire: wire, model: exp})
+	}
+	return result, nil
+}
+
+func (r *akeModelRunner) compareState(p *akeModelPeer, expectedEvent string) error {
+	state := akeStateNone
+	if p.conv.ake != nil {
+		state = p.conv.ake.state.(fmt.Stringer).String()
+	}
+	if state != p.model.state {
+		return fmt.Errorf("%s is in %s, but the model expects %s", p.name, state, p.model.state)
+	}
+
+	if p.conv.IsEncrypted() != p.model.encrypted {
+		return fmt.Errorf("%s is encrypted: %v, but the model expects %v", p.name, p.conv.IsEncrypted(), p.model.encrypted)
+	}
+
+	var events []string
+	for _, ev := range p.events {
+		if ev == "GoneSecure" || ev == "StillSecure" || ev == "GoneInsecure" {
+			events = append(events, ev)
+		}
+	}
+	if fmt.Sprint(events) != fmt.Sprint(appendNonEmptyString(nil, expectedEvent)) {
+		return fmt.Errorf("%s signaled %v, but the model expects %q", p.name, events, expectedEvent)
+	}
+	return nil
+}
+
+func appendNonEmptyString(l []string, s string) []string {
+	if s == "" {
+		return l
+	}
+	return append(l, s)
+}
+
+func messageTypeName(typ byte) string {
+	switch typ {
+	case msgTypeDHCommit:
+		return "D-H Commit"
+	case msgTypeDHKey:
+		return "D-H Key"
+	case msgTypeRevealSig:
+		return "Reveal Signature"
+	case msgTypeSig:
+		return "Signature"
+	case akeQuery:
+		return "query"
+	default:
+		return fmt.Sprintf("message of type %d", typ)
+	}
+}
+
+// parseAKEModelMessage returns the type of an encoded AKE message, with the hashed gx of a D-H Commit or the gy of a
+// D-H Key
+func parseAKEModelMessage(wire ValidMessage) (akeModelMessage, error) {
+	if !bytes.HasPrefix(wire, msgMarker) || !bytes.HasSuffix(wire, []byte(".")) {
+		return akeModelMessage{}, fmt.Errorf("%q is not an encoded message", wire)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(wire[len(msgMarker) : len(wire)-1]))
+	if err != nil || len(decoded) < messageHeaderPrefix+8 {
+		return akeModelMessage{}, fmt.Errorf("%q is not an encoded message", wire)
+	}
+
+	m := akeModelMessage{typ: decoded[2]}
+	body := decoded[messageHeaderPrefix+8:]
+	switch m.typ {
+	case msgTypeDHCommit:
+		var c dhCommit
+		if err := c.deserialize(body); err != nil {
+			return m, err
+		}
+		m.commit = hex.EncodeToString(c.hashedGx[:])
+	case msgTypeDHKey:
+		var k dhKey
+		if err := k.deserialize(body); err != nil {
+			return m, err
+		}
+		m.y = k.gy.Text(16)
+	}
+	return m, nil
+}
+
+func runAKEModel(ops []modeltest.Op, cover func(string)) error {
+	r := newAKEModelRunner(cover)
+	for i, op := range ops {
+		if err := r.do(op.(akeOp)); err != nil {
+			return fmt.Errorf("after operation %d, %s: %v", i+1, op, err)
+		}
+	}
+	return nil
+}
+
+// akeModelExamples are the AKEs that the spec describes: one started by a query, one in which both peers send a
+// D-H Commit at the same time, and the one with the lower hash gives way, and one in which the messages of an AKE
+// arrive in the middle of the next one
+var akeModelExamples = [][]modeltest.Op{
+	{
+		akeOp{kind: akeOpQuery},
+		akeOp{kind: akeOpDeliver},
+		akeOp{kind: akeOpDeliver},
+		akeOp{kind: akeOpDeliver},
+		akeOp{kind: akeOpDeliver},
+		akeOp{kind: akeOpDeliver},
+	},
+	{
+		akeOp{kind: akeOpQuery},
+		akeOp{kind: akeOpQuery, bob: true},
+		akeOp{kind: akeOpDeliver},
+		akeOp{kind: akeOpDeliver},
+		akeOp{kind: akeOpDeliver},
+		akeOp{kind: akeOpDeliver},
+		akeOp{kind: akeOpDeliver},
+		akeOp{kind: akeOpDeliver},
+		akeOp{kind: akeOpDeliver},
+		akeOp{kind: akeOpDeliver},
+	},
+	{
+		akeOp{kind: akeOpQuery},
+		akeOp{kind: akeOpQuery},
+		akeOp{kind: akeOpDeliver},
+		akeOp{kind: akeOpDeliver, index: 1},
+		akeOp{kind: akeOpDeliver, index: 1},
+		akeOp{kind: akeOpDeliver, index: 1},
+		// alice answers the D-H Commit of the finished AKE again, with a D-H Key that bob doesn't expect
+		akeOp{kind: akeOpReplay, index: 1},
+		akeOp{kind: akeOpDeliver, index: 2},
+		// bob starts the next AKE, and gets the Signature of the finished one in the middle of it
+		akeOp{kind: akeOpDeliver},
+		akeOp{kind: akeOpDeliver, index: 1},
+		akeOp{kind: akeOpDeliver, index: 1},
+		akeOp{kind: akeOpDeliver},
+		akeOp{kind: akeOpDeliver},
+		akeOp{kind: akeOpDeliver},
+	},
+}
+
+func Test_AKE_followsTheStateMachineOfTheSpec(t *testing.T) {
+	modeltest.Check(t, modeltest.Config{
+		Sequences:   40,
+		Length:      25,
+		Generate:    generateAKEOp,
+		Run:         runAKEModel,
+		Transitions: akeModelTransitions,
+		Examples:    akeModelExamples,
+	})
+}
@@ -8,7 +8,7 @@ import (
 const minimumMessageLength = 3 // length of protocol version (SHORT) and message type (BYTE)
 
 func (c *Conversation) generateNewDHKeyPair() error {
-	return c.keys.generateNewDHKeyPair(c.rand())
+	return c.randomnessError(c.keys.generateNewDHKeyPair(c.rand()))
 }
 
 func (c *Conversation) akeHasFinished() error {
@@ -21,7 +21,7 @@ func (c *Conversation) akeHasFinished() error {
 	defer c.signalSecurityEventIf(previousMsgState != encrypted, GoneSecure)
 	defer c.signalSecurityEventIf(previousMsgState == encrypted, StillSecure)
 
-	if c.ourKey.PublicKey == *c.theirKey {
+	if *c.ourKey.Public() == *c.theirKey {
 		c.messageEvent(MessageEventMessageReflected)
 	}
 
@@ -121,17 +121,18 @@ func (s authStateAwaitingDHKey) receiveDHCommitMessage(c *Conversation, msg []by
 		return s, nil, errInvalidOTRMessage
 	}
 
-	gxMPI := appendMPI(nil, c.ake.theirPublicValue)
+	//Compare the hashed gx you sent in your D-H Commit Message with the value you received
+	gxMPI := appendMPI(nil, c.ake.ourPublicValue)
 	hashedGx := sha256.Sum256(gxMPI)
 	//If yours is the higher hash value:
 	//Ignore the incoming D-H Commit message, but resend your D-H Commit message.
 	if bytes.Compare(hashedGx[:], theirHashedGx) == 1 {
-		dhCommitMsg, err := c.wrapMessageHeader(msgTypeDHCommit, c.serializeDHCommit(c.ake.theirPublicValue))
+		dhCommitMsg, err := c.wrapMessageHeader(msgTypeDHCommit, c.serializeDHCommit(c.ake.ourPublicValue))
 		if err != nil {
 			return s, nil, err
 		}
 
-		return authStateAwaitingRevealSig{}, dhCommitMsg, nil
+		return s, dhCommitMsg, nil
 	}
 
 	//Otherwise:
@@ -91,7 +91,7 @@ func Test_receiveDHCommit_AtAwaitingDHKeyIgnoreIncomingMsgAndResendOurDHCommitMs
 	c := newConversation(otrV3{}, fixtureRand())
 	c.initAKE()
 	c.ake.encryptedGx = ourDHCommitAKE.ake.encryptedGx
-	c.ake.theirPublicValue = ourDHCommitAKE.ake.ourPublicValue
+	c.ake.ourPublicValue = ourDHCommitAKE.ake.ourPublicValue
 
 	// force their hashedGx to be lower than ours
 	msg := fixtureDHCommitMsgBody()
@@ -100,7 +100,7 @@ func Test_receiveDHCommit_AtAwaitingDHKeyIgnoreIncomingMsgAndResendOurDHCommitMs
 
 	state, newMsg, err := authStateAwaitingDHKey{}.receiveDHCommitMessage(c, msg)
 	assertDeepEquals(t, err, nil)
-	assertEquals(t, state, authStateAwaitingRevealSig{})
+	assertEquals(t, state, authStateAwaitingDHKey{})
 	assertDeepEquals(t, newMsg, ourDHMsg)
 }
 
@@ -111,7 +111,7 @@ func Test_receiveDHCommit_AtAwaitingDHKeyForgetOurGxAndSendDHKeyMsgAndGoToAwaiti
 	//make sure we store the same values when creating the DH commit
 	c := newConversation(otrV3{}, fixtureRand())
 	c.initAKE()
-	c.ake.theirPublicValue = ourDHCommitAKE.ake.ourPublicValue
+	c.ake.ourPublicValue = ourDHCommitAKE.ake.ourPublicValue
 
 	// force their hashedGx to be higher than ours
 	msg := fixtureDHCommitMsgBody()
@@ -171,9 +171,9 @@ func Test_receiveDHKey_AtAwaitingDHKeyStoresGyAndSigKey(t *testing.T) {
 
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, c.ake.theirPublicValue, fixedGY())
-	assertDeepEquals(t, c.ake.sigKey.c[:], expectedC)
-	assertDeepEquals(t, c.ake.sigKey.m1[:], expectedM1)
-	assertDeepEquals(t, c.ake.sigKey.m2[:], expectedM2)
+	assertDeepEquals(t, c.ake.sigKey().c[:], expectedC)
+	assertDeepEquals(t, c.ake.sigKey().m1[:], expectedM1)
+	assertDeepEquals(t, c.ake.sigKey().m2[:], expectedM2)
 }
 
 func Test_receiveDHKey_AtAwaitingDHKey_storesOursAndTheirDHKeys(t *testing.T) {
@@ -641,13 +641,14 @@ func Test_akeHasFinished_wipesAKEKeys(t *testing.T) {
 	c.ourKey = bobPrivateKey
 	c.theirKey = &bobPrivateKey.PublicKey
 
-	revKey := akeKeys{
+	keys := newLockedAKEKeys()
+	*keys.revealSigKeys = akeKeys{
 		c:  [aes.BlockSize]byte{1, 2, 3},
 		m1: [sha256.Size]byte{4, 5, 6},
 		m2: [sha256.Size]byte{7, 8, 9},
 	}
 
-	sigKey := akeKeys{
+	*keys.signatureKeys = akeKeys{
 		c:  [aes.BlockSize]byte{3, 2, 1},
 		m1: [sha256.Size]byte{6, 5, 4},
 		m2: [sha256.Size]byte{9, 8, 7},
@@ -657,8 +658,7 @@ func Test_akeHasFinished_wipesAKEKeys(t *testing.T) {
 		secretExponent:   big.NewInt(1),
 		ourPublicValue:   big.NewInt(2),
 		theirPublicValue: big.NewInt(2),
-		revealKey:        revKey,
-		sigKey:           sigKey,
+		akeKeys:          keys,
 		r:                [16]byte{1, 2, 3},
 		encryptedGx:      []byte{1, 2, 3},
 		hashedGx:         [sha256.Size]byte{1, 2, 3},
@@ -1,17 +1,34 @@
 package otr3
 
+import "github.com/twstrike/otr3/smp"
+
 // StartAuthenticate should be called when the user wants to initiate authentication with a peer.
 // The authentication uses an optional question message and a shared secret. The authentication will proceed
 // until the event handler reports that SMP is complete, that a secret is needed or that SMP has failed.
 func (c *Conversation) StartAuthenticate(question string, mutualSecret []byte) ([]ValidMessage, error) {
-	c.smp.ensureSMP()
+	if !c.IsEncrypted() {
+		return nil, errCantAuthenticateWithoutEncryption
+	}
+
+	if c.smp.async != nil {
+		c.startSMPAsync(question, mutualSecret)
+		return nil, nil
+	}
 
-	tlvs, err := c.smp.state.startAuthenticate(c, question, mutualSecret)
+	toSend, err := c.smpEngine().Start(c.smpInputs(), question, c.smp.normalization.apply(mutualSecret))
+	if err != nil {
+		return nil, c.smpError(err)
+	}
 
+	tlvs, err := smpTLVs(toSend)
 	if err != nil {
 		return nil, err
 	}
 
+	tlvs = c.announceSMPNormalization(c.smp.normalization, tlvs)
+
+	c.updateLastSMPActivity()
+
 	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, tlvs)
 	return msgs, err
 }
@@ -24,6 +41,35 @@ func (c *Conversation) ProvideAuthenticationSecret(mutualSecret []byte) ([]Valid
 		return nil, err
 	}
 
+	c.updateLastSMPActivity()
+	if t == nil {
+		return nil, nil
+	}
+
+	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{*t})
+	return msgs, err
+}
+
+// AbortAuthentication should be called when the user wants to cancel an authentication in progress, for example
+// because the authentication dialog was closed. The SMP state machine is restarted and the return is the potential
+// messages to send in order to let the peer know the authentication was aborted.
+func (c *Conversation) AbortAuthentication() ([]ValidMessage, error) {
+	cancelled := c.smp.cancelComputations()
+	toSend := c.smp.Abort()
+	if toSend == nil && cancelled {
+		// The peer might be waiting for the message we were computing
+		toSend = smp.AbortMessage()
+	}
+
+	if toSend == nil || !c.IsEncrypted() {
+		return nil, nil
+	}
+
+	t, err := smpTLV(toSend)
+	if err != nil {
+		return nil, err
+	}
+
 	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{*t})
 	return msgs, err
 }
@@ -23,15 +23,14 @@ func Test_StartAuthenticate_failsIfThereIsntEnoughRandomness(t *testing.T) {
 }
 
 func Test_StartAuthenticate_generatesAnSMPSecretFromTheSharedSecret(t *testing.T) {
-	c := bobContextAfterAKE()
-	c.msgState = encrypted
-	c.ssid = [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
-	c.ourKey = alicePrivateKey
-	c.theirKey = &bobPrivateKey.PublicKey
+	v := fixtureSMPVector(t)
+	c := v.asAlice(bobContextAfterAKE())
 
-	_, e := c.StartAuthenticate("", []byte("hello world"))
+	_, e := c.StartAuthenticate(v.Question, []byte(v.AliceSecret))
 	assertEquals(t, e, nil)
-	assertDeepEquals(t, c.smp.secret, bnFromHex("3D7264BD983B8CA53CB365444844816F7D2453580B552EEE45CD09CA13614A5"))
+
+	toSend, _ := c.receiveSMP(v.tlv(1))
+	assertDeepEquals(t, *toSend, v.tlv(2))
 }
 
 func Test_StartAuthenticate_generatesAndReturnsTheFirstSMPMessageToSend(t *testing.T) {
@@ -43,40 +42,24 @@ func Test_StartAuthenticate_generatesAndReturnsTheFirstSMPMessageToSend(t *testi
 
 	msg, e := c.StartAuthenticate("", []byte("hello world"))
 	assertEquals(t, e, nil)
-	assertEquals(t, c.smp.state, smpStateExpect2{})
+	assertEquals(t, c.SMPStatus(), SMPStatusExpect2)
 
 	dec, _ := c.decode(encodedMessage(msg[0]))
 	_, messageBody, _ := c.parseMessageHeader(dec)
 	assertDeepEquals(t, len(messageBody), 1361)
 }
 
-func Test_StartAuthenticate_generatesAndSetsTheFirstMessageOnTheConversation(t *testing.T) {
-	c := bobContextAfterAKE()
-	c.msgState = encrypted
-	c.ssid = [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
-	c.ourKey = bobPrivateKey
-	c.theirKey = &alicePrivateKey.PublicKey
-	c.smp.s1 = nil
-
-	c.StartAuthenticate("", []byte("hello world"))
-
-	assertNotNil(t, c.smp.s1)
-	assertEquals(t, c.smp.s1.msg.hasQuestion, false)
-}
-
 func Test_StartAuthenticate_generatesAn1QMessageIfAQuestionIsGiven(t *testing.T) {
-	c := bobContextAfterAKE()
-	c.msgState = encrypted
-	c.ssid = [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
-	c.ourKey = bobPrivateKey
-	c.theirKey = &alicePrivateKey.PublicKey
-	c.smp.s1 = nil
+	v := fixtureSMPVector(t)
+	c := v.asAlice(newConversation(otrV3{}, nil))
+	_, c.keys = fixtureDataMsg(plainDataMsg{})
 
-	c.StartAuthenticate("Where did we meet?", []byte("hello world"))
+	msg, _ := c.StartAuthenticate(v.Question, []byte(v.AliceSecret))
 
-	assertEquals(t, c.smp.s1.msg.hasQuestion, true)
-	assertEquals(t, c.smp.s1.msg.question, "Where did we meet?")
-	assertEquals(t, c.smp.s1.msg.tlv().tlvType, tlvTypeSMP1WithQuestion)
+	dec, _ := c.decode(encodedMessage(msg[0]))
+	tlvs := fixtureDecryptDataMsg(dec).tlvs
+	assertEquals(t, tlvs[0].tlvType, tlvTypeSMP1WithQuestion)
+	assertDeepEquals(t, tlvs[0], v.tlv(0))
 }
 
 func Test_StartAuthenticate_generatesAnAbortMessageTLVIfWeAreInAnSMPStateAlready(t *testing.T) {
@@ -85,8 +68,7 @@ func Test_StartAuthenticate_generatesAnAbortMessageTLVIfWeAreInAnSMPStateAlready
 	c.ssid = [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
 	c.ourKey = bobPrivateKey
 	c.theirKey = &alicePrivateKey.PublicKey
-	c.smp.s1 = nil
-	c.smp.state = smpStateExpect3{}
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusExpect3)
 
 	msg, e := c.StartAuthenticate("", []byte("hello world"))
 	assertEquals(t, e, nil)
@@ -101,23 +83,23 @@ func Test_ProvideAuthenticationSecret_failsIfWeAreNotCurrentlyEncrypted(t *testi
 	c.ssid = [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
 	c.ourKey = bobPrivateKey
 	c.theirKey = &alicePrivateKey.PublicKey
-	c.smp.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusWaitingForSecret)
 
 	_, e := c.ProvideAuthenticationSecret([]byte("hello world"))
 	assertEquals(t, e, errCantAuthenticateWithoutEncryption)
 }
 
 func Test_ProvideAuthenticationSecret_generatesAnSMPSecretFromTheSharedSecret(t *testing.T) {
-	c := bobContextAfterAKE()
-	c.msgState = encrypted
-	c.ssid = [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
-	c.ourKey = bobPrivateKey
-	c.theirKey = &alicePrivateKey.PublicKey
-	c.smp.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
+	v := fixtureSMPVector(t)
+	c := v.asBob(newConversation(otrV3{}, nil))
+	_, c.keys = fixtureDataMsg(plainDataMsg{})
+	v.moveSMPTo(c, SMPStatusWaitingForSecret)
 
-	_, e := c.ProvideAuthenticationSecret([]byte("hello world"))
+	msg, e := c.ProvideAuthenticationSecret([]byte(v.BobSecret))
 	assertEquals(t, e, nil)
-	assertDeepEquals(t, c.smp.secret, bnFromHex("3D7264BD983B8CA53CB365444844816F7D2453580B552EEE45CD09CA13614A5"))
+
+	dec, _ := c.decode(encodedMessage(msg[0]))
+	assertDeepEquals(t, fixtureDecryptDataMsg(dec).tlvs[0], v.tlv(1))
 }
 
 func Test_ProvideAuthenticationSecret_failsAndAbortsIfWeAreNotWaitingForASecret(t *testing.T) {
@@ -126,7 +108,14 @@ func Test_ProvideAuthenticationSecret_failsAndAbortsIfWeAreNotWaitingForASecret(
 	c.ssid = [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
 	c.ourKey = bobPrivateKey
 	c.theirKey = &alicePrivateKey.PublicKey
-	c.smp.state = smpStateExpect3{}
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusExpect3)
+
+	_, e := c.ProvideAuthenticationSecret([]byte("hello world"))
+	assertEquals(t, e, errNotWaitingForSMPSecret)
+}
+
+func Test_ProvideAuthenticationSecret_failsIfTheConversationHasntStarted(t *testing.T) {
+	c := &Conversation{}
 
 	_, e := c.ProvideAuthenticationSecret([]byte("hello world"))
 	assertEquals(t, e, errNotWaitingForSMPSecret)
@@ -138,7 +127,7 @@ func Test_ProvideAuthenticationSecret_continuesWithMessageProcessingIfInTheRight
 	c.ssid = [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
 	c.ourKey = bobPrivateKey
 	c.theirKey = &alicePrivateKey.PublicKey
-	c.smp.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusWaitingForSecret)
 
 	msg, e := c.ProvideAuthenticationSecret([]byte("hello world"))
 	assertNil(t, e)
@@ -153,12 +142,12 @@ func Test_ProvideAuthenticationSecret_setsTheNextMessageState(t *testing.T) {
 	c.ssid = [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
 	c.ourKey = bobPrivateKey
 	c.theirKey = &alicePrivateKey.PublicKey
-	c.smp.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusWaitingForSecret)
 
 	_, e := c.ProvideAuthenticationSecret([]byte("hello world"))
 	assertNil(t, e)
 
-	assertDeepEquals(t, c.smp.state, smpStateExpect3{})
+	assertEquals(t, c.SMPStatus(), SMPStatusExpect3)
 }
 
 func Test_ProvideAuthenticationSecret_returnsFailureFromContinueSMP(t *testing.T) {
@@ -167,8 +156,56 @@ func Test_ProvideAuthenticationSecret_returnsFailureFromContinueSMP(t *testing.T
 	c.ssid = [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
 	c.ourKey = bobPrivateKey
 	c.theirKey = &alicePrivateKey.PublicKey
-	c.smp.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusWaitingForSecret)
 
 	_, e := c.ProvideAuthenticationSecret([]byte("hello world"))
 	assertEquals(t, e, errCantAuthenticateWithoutEncryption)
 }
+
+func Test_AbortAuthentication_doesNothingIfThereIsNoAuthenticationInProgress(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+
+	msgs, e := c.AbortAuthentication()
+	assertNil(t, e)
+	assertNil(t, msgs)
+	assertEquals(t, c.SMPStatus(), SMPStatusExpect1)
+}
+
+func Test_AbortAuthentication_restartsTheStateMachineAndForgetsTheQuestion(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusExpect3)
+
+	c.AbortAuthentication()
+
+	_, ok := c.SMPQuestion()
+	assertEquals(t, c.SMPStatus(), SMPStatusExpect1)
+	assertEquals(t, ok, false)
+}
+
+func Test_AbortAuthentication_generatesAnAbortMessageForThePeer(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusExpect2)
+
+	msgs, e := c.AbortAuthentication()
+	assertNil(t, e)
+
+	stub := bobContextAfterAKE()
+	stub.msgState = encrypted
+	expectedMsgs, _, _ := stub.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{tlv{tlvType: tlvTypeSMPAbort, tlvLength: 4, tlvValue: []byte{0x00, 0x00, 0x00, 0x00}}})
+
+	assertDeepEquals(t, msgs, expectedMsgs)
+}
+
+func Test_AbortAuthentication_doesNotGenerateMessagesIfWeAreNotEncrypted(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = finished
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusWaitingForSecret)
+
+	msgs, e := c.AbortAuthentication()
+	assertNil(t, e)
+	assertNil(t, msgs)
+	assertEquals(t, c.SMPStatus(), SMPStatusExpect1)
+}
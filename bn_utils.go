@@ -1,40 +1,20 @@
 package otr3
 
-import "math/big"
+import (
+	"math/big"
 
-func modExp(g, x *big.Int) *big.Int {
-	return new(big.Int).Exp(g, x, p)
-}
-
-func modInverse(g, x *big.Int) *big.Int {
-	return new(big.Int).ModInverse(g, x)
-}
+	"github.com/twstrike/otr3/internal/modp"
+)
 
-func mul(l, r *big.Int) *big.Int {
-	return new(big.Int).Mul(l, r)
+// modExp is constant time for the secret exponents and values of the group, see the modp package
+func modExp(g, x *big.Int) *big.Int {
+	return modp.P.Exp(g, x)
 }
 
 func sub(l, r *big.Int) *big.Int {
 	return new(big.Int).Sub(l, r)
 }
 
-func mulMod(l, r, m *big.Int) *big.Int {
-	res := mul(l, r)
-	res.Mod(res, m)
-	return res
-}
-
-// Fast division over a modular field, without using division
-func divMod(l, r, m *big.Int) *big.Int {
-	return mulMod(l, modInverse(r, m), m)
-}
-
-func subMod(l, r, m *big.Int) *big.Int {
-	res := sub(l, r)
-	res.Mod(res, m)
-	return res
-}
-
 func mod(l, m *big.Int) *big.Int {
 	return new(big.Int).Mod(l, m)
 }
@@ -0,0 +1,99 @@
+// Package capture records what a Conversation receives and sends, so that an interoperability problem that only
+// happens with somebody else's client can be attached to a bug report and reproduced.
+//
+// A Recorder wraps a conversation. The application calls the methods of the Recorder instead of the ones of the
+// conversation, and writes the Capture to a file when the user wants to report a problem:
+//
+//	r, err := capture.NewRecorder(conversation, capture.Options{Redact: true})
+//	...
+//	plain, toSend, err := r.Receive(message)
+//	...
+//	err := r.Capture().Write(file)
+//
+// A capture made in debug mode also has the random bytes the conversation read, and the SMP secrets. Replay uses
+// them to drive a fresh conversation with the same keys and policies through exactly the same states, and checks
+// that it sends the same messages at every step. Signatures made with otr3.RandomNonces read a random number of
+// bytes, so the keys of a conversation that is recorded to be replayed must use DeterministicNonces or HedgedNonces:
+//
+//	c, err := capture.Read(file)
+//	...
+//	err = capture.Replay(conversation, c)
+//
+// With Redact, the plaintexts, the SMP questions and the non-OTR messages are replaced with placeholders of the same
+// length, so what the users wrote is not in the capture. The random bytes of a debug capture are enough to work out
+// the keys of the conversation, so a capture that is both redacted and in debug mode also has its data messages
+// replaced with copies that are encrypted with the same keys, but with the placeholders as plaintexts. Such a capture
+// replays like the original conversation, until the first event that sent or received SMP messages: their values and
+// the SMP secrets are left out, and without them the conversation can't go through the same states. Replay returns
+// ErrRedactedSMP for that event. The random bytes still decrypt the data messages that were actually sent, so a
+// capture in debug mode should only be given to somebody who may read the conversation, or who can't get hold of
+// those messages.
+package capture
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// Version is the version of the format of the captures written by this package
+const Version = 1
+
+var errUnknownVersion = errors.New("capture: unknown version of the capture format")
+
+// Capture is everything that was recorded about a conversation
+type Capture struct {
+	Version int
+	// Redacted is true when the plaintexts were replaced with placeholders
+	Redacted bool
+	// Debug is true when the random bytes and the SMP secrets were recorded
+	Debug  bool
+	Events []Event
+}
+
+// Event is one call to a method of a Recorder, with everything that came out of it
+type Event struct {
+	// Time is the time of the conversation during the call
+	Time time.Time
+	// Action is the method that was called: receive, send, query, end, start-smp, answer-smp or abort-smp
+	Action string
+	// Input is the message received, or the plaintext sent
+	Input    string `json:",omitempty"`
+	Question string `json:",omitempty"`
+	// Secret is the SMP secret. It is only recorded in debug mode.
+	Secret string `json:",omitempty"`
+	// Plain is the plaintext that came out of a received message
+	Plain string `json:",omitempty"`
+	Error string `json:",omitempty"`
+	// Wire are the messages the conversation returned to be sent
+	Wire []string `json:",omitempty"`
+	// Random are the random bytes the conversation read during the call, in hexadecimal. They are only recorded in
+	// debug mode.
+	Random string `json:",omitempty"`
+	// SMP is true when the call received or sent SMP messages. It is only recorded in a capture that is both
+	// redacted and in debug mode, where the values of these messages are zeroed.
+	SMP bool `json:",omitempty"`
+}
+
+// Read reads a capture written by Capture.Write
+func Read(r io.Reader) (*Capture, error) {
+	c := &Capture{}
+	if err := json.NewDecoder(r).Decode(c); err != nil {
+		return nil, err
+	}
+	if c.Version != Version {
+		return nil, errUnknownVersion
+	}
+	return c, nil
+}
+
+// Write writes c as indented JSON, so it can be read and edited by hand
+func (c *Capture) Write(w io.Writer) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,258 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twstrike/otr3"
+)
+
+const alicePrivateKeyHex = "000000000080c81c2cb2eb729b7e6fd48e975a932c638b3a9055478583afa46755683e30102447f6da2d8bec9f386bbb5da6403b0040fee8650b6ab2d7f32c55ab017ae9b6aec8c324ab5844784e9a80e194830d548fb7f09a0410df2c4d5c8bc2b3e9ad484e65412be689cf0834694e0839fb2954021521ffdffb8f5c32c14dbf2020b3ce7500000014da4591d58def96de61aea7b04a8405fe1609308d000000808ddd5cb0b9d66956e3dea5a915d9aba9d8a6e7053b74dadb2fc52f9fe4e5bcc487d2305485ed95fed026ad93f06ebb8c9e8baf693b7887132c7ffdd3b0f72f4002ff4ed56583ca7c54458f8c068ca3e8a4dfa309d1dd5d34e2a4b68e6f4338835e5e0fb4317c9e4c7e4806dafda3ef459cd563775a586dd91b1319f72621bf3f00000080b8147e74d8c45e6318c37731b8b33b984a795b3653c2cd1d65cc99efe097cb7eb2fa49569bab5aab6e8a1c261a27d0f7840a5e80b317e6683042b59b6dceca2879c6ffc877a465be690c15e4a42f9a7588e79b10faac11b1ce3741fcef7aba8ce05327a2c16d279ee1b3d77eb783fb10e3356caa25635331e26dd42b8396c4d00000001420bec691fea37ecea58a5c717142f0b804452f57"
+
+const bobPrivateKeyHex = "000000000080a5138eb3d3eb9c1d85716faecadb718f87d31aaed1157671d7fee7e488f95e8e0ba60ad449ec732710a7dec5190f7182af2e2f98312d98497221dff160fd68033dd4f3a33b7c078d0d9f66e26847e76ca7447d4bab35486045090572863d9e4454777f24d6706f63e02548dfec2d0a620af37bbc1d24f884708a212c343b480d00000014e9c58f0ea21a5e4dfd9f44b6a9f7f6a9961a8fa9000000803c4d111aebd62d3c50c2889d420a32cdf1e98b70affcc1fcf44d59cca2eb019f6b774ef88153fb9b9615441a5fe25ea2d11b74ce922ca0232bd81b3c0fcac2a95b20cb6e6c0c5c1ace2e26f65dc43c751af0edbb10d669890e8ab6beea91410b8b2187af1a8347627a06ecea7e0f772c28aae9461301e83884860c9b656c722f0000008065af8625a555ea0e008cd04743671a3cda21162e83af045725db2eb2bb52712708dc0cc1a84c08b3649b88a966974bde27d8612c2861792ec9f08786a246fcadd6d8d3a81a32287745f309238f47618c2bd7612cb8b02d940571e0f30b96420bcd462ff542901b46109b1e5ad6423744448d20a57818a8cbb1647d0fea3b664e0000001440f9f2eb554cb00d45a5826b54bfa419b6980e48"
+
+func newConversation(t *testing.T, key string) *otr3.Conversation {
+	data, _ := hex.DecodeString(key)
+	k := &otr3.PrivateKey{Nonces: otr3.DeterministicNonces}
+	if _, ok := k.Parse(data); !ok {
+		t.Fatal("failed to parse the key")
+	}
+
+	c := &otr3.Conversation{}
+	c.Policies.AllowV2()
+	c.Policies.AllowV3()
+	c.SetKeys(k, nil)
+	return c
+}
+
+type receiver interface {
+	Receive(otr3.ValidMessage) (otr3.MessagePlaintext, []otr3.ValidMessage, error)
+}
+
+// exchange delivers messages from one peer to the other, and everything they send each other in reply, until they
+// are done. It returns the plaintexts every peer received.
+func exchange(from, to receiver, messages []otr3.ValidMessage) map[receiver][]string {
+	received := map[receiver][]string{}
+	for len(messages) > 0 {
+		var replies []otr3.ValidMessage
+		for _, m := range messages {
+			plain, toSend, _ := to.Receive(m)
+			if len(plain) > 0 {
+				received[to] = append(received[to], string(plain))
+			}
+			replies = append(replies, toSend...)
+		}
+		from, to, messages = to, from, replies
+	}
+	return received
+}
+
+// clock returns a clock that moves forward a second every time it is read
+func clock() func() time.Time {
+	now := time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+}
+
+// recordConversation records alice in a conversation with bob, where they go encrypted, talk, authenticate with SMP
+// and bob ends the conversation
+func recordConversation(t *testing.T, options Options) *Capture {
+	options.Clock = clock()
+	alice, err := NewRecorder(newConversation(t, alicePrivateKeyHex), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := newConversation(t, bobPrivateKeyHex)
+
+	exchange(alice, bob, []otr3.ValidMessage{alice.QueryMessage()})
+	if !alice.IsEncrypted() {
+		t.Fatal("expected alice to be encrypted")
+	}
+
+	toSend, _ := alice.Send(otr3.ValidMessage("hello bob"))
+	exchange(alice, bob, toSend)
+	toSend, _ = bob.Send(otr3.ValidMessage("hello alice"))
+	if received := exchange(bob, alice, toSend); len(received[alice]) != 1 {
+		t.Fatalf("expected alice to receive a message, but got %q", received[alice])
+	}
+
+	toSend, _ = alice.StartAuthenticate("the name of our cat?", []byte("tom"))
+	exchange(alice, bob, toSend)
+	toSend, _ = bob.ProvideAuthenticationSecret([]byte("tom"))
+	exchange(bob, alice, toSend)
+
+	toSend, _ = bob.End()
+	exchange(bob, alice, toSend)
+	if _, err := alice.Send(otr3.ValidMessage("are you still there?")); err == nil {
+		t.Fatal("expected alice to fail to send after bob ended the conversation")
+	}
+
+	return alice.Capture()
+}
+
+func writeAndRead(t *testing.T, c *Capture) *Capture {
+	var b bytes.Buffer
+	if err := c.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return read
+}
+
+func TestReplayDrivesAConversationThroughTheRecordedEvents(t *testing.T) {
+	c := writeAndRead(t, recordConversation(t, Options{Debug: true}))
+
+	if len(c.Events) < 10 {
+		t.Fatalf("expected the whole conversation to be recorded, but got %d events", len(c.Events))
+	}
+	if err := Replay(newConversation(t, alicePrivateKeyHex), c); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRecorderRedactsWhatTheUsersWrote(t *testing.T) {
+	c := recordConversation(t, Options{Redact: true})
+
+	var b bytes.Buffer
+	c.Write(&b)
+	for _, text := range []string{"hello bob", "hello alice", "the name of our cat?", "are you still there?"} {
+		if strings.Contains(b.String(), text) {
+			t.Errorf("expected %q to be redacted", text)
+		}
+	}
+	if !c.Redacted || c.Debug {
+		t.Errorf("expected a redacted capture that isn't in debug mode, got Redacted %v and Debug %v", c.Redacted, c.Debug)
+	}
+}
+
+func TestReplayDrivesAConversationThroughARedactedCaptureUntilSMP(t *testing.T) {
+	c := writeAndRead(t, recordConversation(t, Options{Redact: true, Debug: true}))
+
+	var b bytes.Buffer
+	c.Write(&b)
+	for _, text := range []string{"hello bob", "hello alice", "the name of our cat?", "are you still there?"} {
+		if strings.Contains(b.String(), text) {
+			t.Errorf("expected %q to be redacted", text)
+		}
+	}
+	for _, e := range c.Events {
+		if e.Secret != "" {
+			t.Errorf("expected the SMP secret to be left out, but got %+v", e)
+		}
+	}
+
+	err := Replay(newConversation(t, alicePrivateKeyHex), c)
+	if !errors.Is(err, ErrRedactedSMP) || !strings.Contains(err.Error(), "(start-smp)") {
+		t.Errorf("expected ErrRedactedSMP when alice starts SMP, but got %v", err)
+	}
+}
+
+// recordFragmentedConversation records alice in a conversation with bob, where they go encrypted and talk in
+// fragments, and bob ends the conversation
+func recordFragmentedConversation(t *testing.T, options Options) *Capture {
+	options.Clock = clock()
+	aliceConversation := newConversation(t, alicePrivateKeyHex)
+	aliceConversation.SetFragmentSize(120)
+	alice, err := NewRecorder(aliceConversation, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := newConversation(t, bobPrivateKeyHex)
+	bob.SetFragmentSize(100)
+
+	exchange(alice, bob, []otr3.ValidMessage{alice.QueryMessage()})
+	for _, text := range []string{"hello bob", "how are you?"} {
+		toSend, _ := alice.Send(otr3.ValidMessage(text))
+		exchange(alice, bob, toSend)
+		toSend, _ = bob.Send(otr3.ValidMessage(text + " alice"))
+		if received := exchange(bob, alice, toSend); len(received[alice]) != 1 {
+			t.Fatalf("expected alice to receive a message, but got %q", received[alice])
+		}
+	}
+
+	toSend, _ := bob.End()
+	exchange(bob, alice, toSend)
+	return alice.Capture()
+}
+
+// The replayed conversation encrypts the placeholders it sends into the recorded wire messages, and decrypts the
+// recorded messages it receives into the placeholders, so the data messages of the capture only have placeholders
+func TestReplayDrivesAConversationThroughARedactedCaptureOfFragments(t *testing.T) {
+	c := writeAndRead(t, recordFragmentedConversation(t, Options{Redact: true, Debug: true}))
+
+	for _, e := range c.Events {
+		if strings.Contains(e.Input, "hello") || strings.Contains(e.Plain, "hello") {
+			t.Errorf("expected the plaintexts to be redacted, but got %+v", e)
+		}
+	}
+	alice := newConversation(t, alicePrivateKeyHex)
+	alice.SetFragmentSize(120)
+	if err := Replay(alice, c); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReplayReportsTheFirstEventThatIsDifferent(t *testing.T) {
+	c := recordConversation(t, Options{Debug: true})
+	c.Events[3].Plain = "hello eve"
+
+	err := Replay(newConversation(t, alicePrivateKeyHex), c)
+
+	mismatch, ok := err.(*MismatchError)
+	if !ok || mismatch.Event != 4 || mismatch.What != "plaintext" || mismatch.Replayed == "hello eve" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestReplayReportsAConversationThatReadsOtherRandomBytes(t *testing.T) {
+	c := recordConversation(t, Options{Debug: true})
+	first := 0
+	for c.Events[first].Random == "" {
+		first++
+	}
+	c.Events[first].Random = ""
+
+	err := Replay(newConversation(t, alicePrivateKeyHex), c)
+
+	mismatch, ok := err.(*MismatchError)
+	if !ok || mismatch.Event != first+1 || mismatch.What != "number of random bytes read" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestReplayNeedsACaptureMadeInDebugMode(t *testing.T) {
+	c := recordConversation(t, Options{})
+
+	if err := Replay(newConversation(t, alicePrivateKeyHex), c); err != ErrNotDebug {
+		t.Errorf("expected ErrNotDebug, but got %v", err)
+	}
+}
+
+func TestRecorderOnlyRecordsRandomBytesAndSecretsInDebugMode(t *testing.T) {
+	for _, e := range recordConversation(t, Options{}).Events {
+		if e.Random != "" || e.Secret != "" {
+			t.Errorf("expected no random bytes or secrets, but got %+v", e)
+		}
+	}
+}
+
+func TestRedactKeepsTheLengthAndTheWhitespace(t *testing.T) {
+	if r := redact("héllo \t world \t  \t\t\t\t \t \t \t  "); r != "xxxxxx \t xxxxx \t  \t\t\t\t \t \t \t  " {
+		t.Errorf("unexpected redaction %q", r)
+	}
+}
+
+func TestReadRejectsOtherVersions(t *testing.T) {
+	if _, err := Read(strings.NewReader(`{"Version": 2}`)); err != errUnknownVersion {
+		t.Errorf("expected errUnknownVersion, but got %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package capture
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"time"
+
+	"github.com/twstrike/otr3"
+)
+
+// Options changes what a Recorder records
+type Options struct {
+	// Redact replaces the plaintexts, the SMP questions and the non-OTR messages received with placeholders.
+	// Together with Debug, it also replaces the data messages with copies encrypted with placeholders, and leaves
+	// out the SMP secrets.
+	Redact bool
+	// Debug records the random bytes the conversation reads and the SMP secrets, so the capture can be replayed.
+	// The key of the conversation must not use otr3.RandomNonces for that. Anybody who has a capture made in debug
+	// mode can work out the keys of the conversation from it.
+	Debug bool
+	// Clock tells the time of the conversation, instead of time.Now. It replaces the clock given to
+	// Conversation.SetClock, which can't be read back.
+	Clock func() time.Time
+}
+
+// Recorder records the calls to the conversation it wraps. Only the calls to the methods of the Recorder itself
+// are recorded, so a conversation that is recorded should not be used in any other way to receive or send messages.
+// The other methods of the conversation, like IsEncrypted, can be called through the Recorder.
+type Recorder struct {
+	*otr3.Conversation
+
+	options   Options
+	capture   Capture
+	random    *recordingReader
+	now       time.Time
+	fragments []pendingFragment
+}
+
+// NewRecorder starts recording the calls to c. It replaces the source of randomness and the clock of c with ones
+// that record what c reads from them.
+func NewRecorder(c *otr3.Conversation, options Options) (*Recorder, error) {
+	r := &Recorder{
+		Conversation: c,
+		options:      options,
+		capture:      Capture{Version: Version, Redacted: options.Redact, Debug: options.Debug},
+	}
+	if r.options.Clock == nil {
+		r.options.Clock = time.Now
+	}
+
+	if options.Debug {
+		source := c.Rand
+		if source == nil {
+			source = rand.Reader
+		}
+		r.random = &recordingReader{r: source}
+		c.Rand = r.random
+	}
+	c.SetClock(func() time.Time { return r.now })
+
+	return r, nil
+}
+
+// Capture returns what has been recorded so far
+func (r *Recorder) Capture() *Capture {
+	c := r.capture
+	c.Events = append([]Event(nil), r.capture.Events...)
+	return &c
+}
+
+// Receive receives message, like Conversation.Receive
+func (r *Recorder) Receive(message otr3.ValidMessage) (otr3.MessagePlaintext, []otr3.ValidMessage, error) {
+	e := r.start("receive")
+	if r.reencrypts() {
+		e.Input, e.SMP = r.redactReceived(string(message))
+	} else {
+		e.Input = r.redactUnlessOTR(string(message))
+	}
+	plain, toSend, err := r.Conversation.Receive(message)
+	e.Plain = r.redact(string(plain))
+	r.finish(e, toSend, err)
+	return plain, toSend, err
+}
+
+// Send sends message, like Conversation.Send
+func (r *Recorder) Send(message otr3.ValidMessage) ([]otr3.ValidMessage, error) {
+	e := r.start("send")
+	e.Input = r.redact(string(message))
+	toSend, err := r.Conversation.Send(message)
+	r.finish(e, toSend, err)
+	return toSend, err
+}
+
+// QueryMessage returns a query message, like Conversation.QueryMessage
+func (r *Recorder) QueryMessage() otr3.ValidMessage {
+	e := r.start("query")
+	query := r.Conversation.QueryMessage()
+	r.finish(e, []otr3.ValidMessage{query}, nil)
+	return query
+}
+
+// End ends the private conversation, like Conversation.End
+func (r *Recorder) End() ([]otr3.ValidMessage, error) {
+	e := r.start("end")
+	toSend, err := r.Conversation.End()
+	r.finish(e, toSend, err)
+	return toSend, err
+}
+
+// StartAuthenticate starts an SMP authentication, like Conversation.StartAuthenticate
+func (r *Recorder) StartAuthenticate(question string, mutualSecret []byte) ([]otr3.ValidMessage, error) {
+	e := r.start("start-smp")
+	e.Question = r.redact(question)
+	e.Secret = r.secret(mutualSecret)
+	toSend, err := r.Conversation.StartAuthenticate(question, mutualSecret)
+	r.finish(e, toSend, err)
+	return toSend, err
+}
+
+// ProvideAuthenticationSecret answers an SMP authentication, like Conversation.ProvideAuthenticationSecret
+func (r *Recorder) ProvideAuthenticationSecret(mutualSecret []byte) ([]otr3.ValidMessage, error) {
+	e := r.start("answer-smp")
+	e.Secret = r.secret(mutualSecret)
+	toSend, err := r.Conversation.ProvideAuthenticationSecret(mutualSecret)
+	r.finish(e, toSend, err)
+	return toSend, err
+}
+
+// AbortAuthentication aborts an SMP authentication, like Conversation.AbortAuthentication
+func (r *Recorder) AbortAuthentication() ([]otr3.ValidMessage, error) {
+	e := r.start("abort-smp")
+	toSend, err := r.Conversation.AbortAuthentication()
+	r.finish(e, toSend, err)
+	return toSend, err
+}
+
+// start stops the clock of the conversation at the time of the call, so it is the same every time the conversation
+// looks at it, and the same when the call is replayed
+func (r *Recorder) start(action string) *Event {
+	r.now = r.options.Clock()
+	return &Event{Time: r.now, Action: action}
+}
+
+func (r *Recorder) finish(e *Event, toSend []otr3.ValidMessage, err error) {
+	if r.reencrypts() {
+		var smp bool
+		e.Wire, smp = r.redactSent(toSend)
+		e.SMP = e.SMP || smp
+	} else {
+		for _, m := range toSend {
+			e.Wire = append(e.Wire, r.redactUnlessOTR(string(m)))
+		}
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if r.random != nil {
+		e.Random = hex.EncodeToString(r.random.take())
+	}
+	r.capture.Events = append(r.capture.Events, *e)
+}
+
+func (r *Recorder) secret(s []byte) string {
+	if !r.options.Debug || r.options.Redact {
+		return ""
+	}
+	return string(s)
+}
+
+func (r *Recorder) redact(s string) string {
+	if !r.options.Redact {
+		return s
+	}
+	return redact(s)
+}
+
+// redactUnlessOTR redacts messages that are sent as they were written, instead of being encoded by OTR
+func (r *Recorder) redactUnlessOTR(s string) string {
+	if isOTR(s) {
+		return s
+	}
+	return r.redact(s)
+}
+
+// redact replaces everything but spaces and tabs with x. It keeps the length of s, and the whitespace tag at the end
+// of a plaintext message, so a redacted message goes through the same states as the original one.
+func redact(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c != ' ' && c != '\t' {
+			b[i] = 'x'
+		}
+	}
+	return string(b)
+}
+
+func isOTR(s string) bool {
+	return len(s) >= 4 && s[:4] == "?OTR"
+}
+
+// recordingReader keeps every byte read from r, until they are taken
+type recordingReader struct {
+	r    io.Reader
+	read []byte
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.read = append(r.read, p[:n]...)
+	return n, err
+}
+
+func (r *recordingReader) take() []byte {
+	read := r.read
+	r.read = nil
+	return read
+}
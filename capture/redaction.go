@@ -0,0 +1,136 @@
+package capture
+
+import "github.com/twstrike/otr3"
+
+// A capture that is both redacted and in debug mode has the random bytes the conversation read, and with them anybody
+// can work out the keys of its data messages. So that the keys don't decrypt what the users wrote, the data messages
+// of such a capture are replaced with copies that Conversation.RedactDataMessage encrypts again with the same keys,
+// with placeholders of the same length as plaintexts. The copies are as long as the originals, so a fragmented data
+// message is put together, redacted, and cut again at the same places.
+
+// pendingFragment is a fragment received before the last fragment of its message
+type pendingFragment struct {
+	// event is the index of the event that received the fragment
+	event   int
+	message string
+}
+
+// reencrypts tells whether the data messages have to be encrypted again with placeholders
+func (r *Recorder) reencrypts() bool {
+	return r.options.Redact && r.options.Debug
+}
+
+// redactReceived redacts message before it is received. A fragment is replaced with a placeholder until the last
+// fragment of its message is received, and then the events of all the fragments are updated with the redacted
+// pieces. It also tells whether message had SMP messages.
+func (r *Recorder) redactReceived(message string) (string, bool) {
+	m, err := otr3.ParseMessage([]byte(message))
+	if m.Kind != otr3.MessageKindFragment {
+		return r.redactWhole(message, false)
+	}
+	if err != nil {
+		return redact(message), false
+	}
+
+	if m.Fragment.Index == 1 {
+		r.fragments = nil
+	}
+	r.fragments = append(r.fragments, pendingFragment{event: len(r.capture.Events), message: message})
+	if m.Fragment.Index < m.Fragment.Total {
+		return redact(message), false
+	}
+
+	pending := r.fragments
+	r.fragments = nil
+	if len(pending) != m.Fragment.Total {
+		return redact(message), false
+	}
+
+	fragments := make([]string, len(pending))
+	for i, f := range pending {
+		fragments[i] = f.message
+	}
+	redacted, hadSMP := r.redactFragments(fragments, false)
+	for i, f := range pending[:len(pending)-1] {
+		r.capture.Events[f.event].Input = redacted[i]
+	}
+	return redacted[len(redacted)-1], hadSMP
+}
+
+// redactSent redacts the messages a conversation returned to be sent, and tells whether they had SMP messages
+func (r *Recorder) redactSent(toSend []otr3.ValidMessage) ([]string, bool) {
+	var wire, fragments []string
+	smp := false
+	for _, message := range toSend {
+		m, err := otr3.ParseMessage(message)
+		if err != nil || m.Kind != otr3.MessageKindFragment {
+			redacted, hadSMP := r.redactWhole(string(message), true)
+			wire, smp = append(wire, redacted), smp || hadSMP
+			continue
+		}
+
+		fragments = append(fragments, string(message))
+		if m.Fragment.Index == m.Fragment.Total {
+			redacted, hadSMP := r.redactFragments(fragments, true)
+			wire, smp = append(wire, redacted...), smp || hadSMP
+			fragments = nil
+		}
+	}
+
+	for _, f := range fragments {
+		wire = append(wire, redact(f))
+	}
+	return wire, smp
+}
+
+// redactWhole redacts a message that is not a fragment
+func (r *Recorder) redactWhole(message string, sent bool) (string, bool) {
+	if !isOTR(message) {
+		return redact(message), false
+	}
+
+	if m, _ := otr3.ParseMessage([]byte(message)); m.Kind != otr3.MessageKindData {
+		return message, false
+	}
+
+	redacted, hadSMP, err := r.Conversation.RedactDataMessage(otr3.ValidMessage(message), sent, func(b []byte) []byte {
+		return []byte(redact(string(b)))
+	})
+	if err != nil {
+		// The conversation doesn't have the keys of the message anymore, but they can be worked out from the random
+		// bytes, so nothing of it is kept
+		return redact(message), false
+	}
+	return string(redacted), hadSMP
+}
+
+// redactFragments puts together the message of fragments, redacts it, and cuts it again in pieces of the same lengths
+func (r *Recorder) redactFragments(fragments []string, sent bool) ([]string, bool) {
+	pieces := make([]string, len(fragments))
+	whole := ""
+	for i, f := range fragments {
+		m, err := otr3.ParseMessage([]byte(f))
+		if err != nil {
+			return redactAll(fragments), false
+		}
+		pieces[i] = m.Fragment.Piece
+		whole += pieces[i]
+	}
+
+	redacted, hadSMP := r.redactWhole(whole, sent)
+	result := make([]string, len(fragments))
+	for i, f := range fragments {
+		prefix := f[:len(f)-len(pieces[i])-1]
+		result[i] = prefix + redacted[:len(pieces[i])] + ","
+		redacted = redacted[len(pieces[i]):]
+	}
+	return result, hadSMP
+}
+
+func redactAll(messages []string) []string {
+	redacted := make([]string, len(messages))
+	for i, m := range messages {
+		redacted[i] = redact(m)
+	}
+	return redacted
+}
@@ -0,0 +1,162 @@
+package capture
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/twstrike/otr3"
+)
+
+var (
+	// ErrNotDebug is returned by Replay for captures that were not made in debug mode, since the conversation can't
+	// go through the same states without the same random bytes
+	ErrNotDebug = errors.New("capture: only captures made in debug mode can be replayed")
+	// ErrUnknownAction is returned by Replay for an event with an action it doesn't know
+	ErrUnknownAction = errors.New("capture: unknown action")
+	// ErrRedactedSMP is returned by Replay, wrapped with the event, for the first event of a redacted capture that
+	// received or sent SMP messages, since their values and the SMP secrets are not in the capture
+	ErrRedactedSMP = errors.New("capture: the SMP messages of a redacted capture can't be replayed")
+)
+
+// MismatchError is returned by Replay for the first event where the conversation didn't do what the recorded
+// conversation did
+type MismatchError struct {
+	// Event is the index of the event in the capture, starting at 1
+	Event  int
+	Action string
+	// What is what was different, like the second wire message or the error
+	What     string
+	Recorded string
+	Replayed string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("capture: event %d (%s): the %s was %q instead of %q", e.Event, e.Action, e.What, e.Replayed, e.Recorded)
+}
+
+// Replay drives c through the events of capture, and returns a *MismatchError for the first event where it does
+// something else than the recorded conversation did. c has to be a new conversation with the same keys, policies
+// and fragment size as the recorded one. Replay replaces its source of randomness and its clock. It returns
+// ErrNotDebug for a capture that wasn't made in debug mode.
+func Replay(c *otr3.Conversation, capture *Capture) error {
+	if !capture.Debug {
+		return ErrNotDebug
+	}
+
+	random := &replayReader{}
+	c.Rand = random
+	var now time.Time
+	c.SetClock(func() time.Time { return now })
+
+	for i, e := range capture.Events {
+		if capture.Redacted && e.SMP {
+			return fmt.Errorf("capture: event %d (%s): %w", i+1, e.Action, ErrRedactedSMP)
+		}
+
+		data, err := hex.DecodeString(e.Random)
+		if err != nil {
+			return fmt.Errorf("capture: event %d (%s): bad random bytes: %v", i+1, e.Action, err)
+		}
+		random.data, random.exhausted = data, false
+		now = e.Time
+
+		replayed, err := replayEvent(c, e)
+		if err != nil {
+			return fmt.Errorf("capture: event %d (%s): %v", i+1, e.Action, err)
+		}
+
+		if random.exhausted {
+			return &MismatchError{Event: i + 1, Action: e.Action, What: "number of random bytes read",
+				Recorded: fmt.Sprint(len(data)), Replayed: "more"}
+		}
+		if len(random.data) > 0 {
+			return &MismatchError{Event: i + 1, Action: e.Action, What: "number of random bytes read",
+				Recorded: fmt.Sprint(len(data)), Replayed: fmt.Sprint(len(data) - len(random.data))}
+		}
+		if err := compare(e, replayed); err != nil {
+			err.Event = i + 1
+			return err
+		}
+	}
+	return nil
+}
+
+func replayEvent(c *otr3.Conversation, e Event) (Event, error) {
+	replayed := Event{Action: e.Action}
+	var toSend []otr3.ValidMessage
+	var err error
+
+	switch e.Action {
+	case "receive":
+		var plain otr3.MessagePlaintext
+		plain, toSend, err = c.Receive(otr3.ValidMessage(e.Input))
+		replayed.Plain = string(plain)
+	case "send":
+		toSend, err = c.Send(otr3.ValidMessage(e.Input))
+	case "query":
+		toSend = []otr3.ValidMessage{c.QueryMessage()}
+	case "end":
+		toSend, err = c.End()
+	case "start-smp":
+		toSend, err = c.StartAuthenticate(e.Question, []byte(e.Secret))
+	case "answer-smp":
+		toSend, err = c.ProvideAuthenticationSecret([]byte(e.Secret))
+	case "abort-smp":
+		toSend, err = c.AbortAuthentication()
+	default:
+		return replayed, ErrUnknownAction
+	}
+
+	for _, m := range toSend {
+		replayed.Wire = append(replayed.Wire, string(m))
+	}
+	if err != nil {
+		replayed.Error = err.Error()
+	}
+	return replayed, nil
+}
+
+// compare returns how replayed differs from recorded
+func compare(recorded, replayed Event) *MismatchError {
+	mismatch := func(what, rec, rep string) *MismatchError {
+		return &MismatchError{Action: recorded.Action, What: what, Recorded: rec, Replayed: rep}
+	}
+
+	if replayed.Error != recorded.Error {
+		return mismatch("error", recorded.Error, replayed.Error)
+	}
+
+	if replayed.Plain != recorded.Plain {
+		return mismatch("plaintext", recorded.Plain, replayed.Plain)
+	}
+
+	if len(replayed.Wire) != len(recorded.Wire) {
+		return mismatch("number of wire messages", fmt.Sprint(len(recorded.Wire)), fmt.Sprint(len(replayed.Wire)))
+	}
+	for i, m := range replayed.Wire {
+		if m != recorded.Wire[i] {
+			return mismatch(fmt.Sprintf("wire message %d", i+1), recorded.Wire[i], m)
+		}
+	}
+	return nil
+}
+
+// replayReader gives the conversation the random bytes that were recorded for an event
+type replayReader struct {
+	data      []byte
+	exhausted bool
+}
+
+func (r *replayReader) Read(p []byte) (int, error) {
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	if n < len(p) {
+		r.exhausted = true
+		return n, errRandomExhausted
+	}
+	return n, nil
+}
+
+var errRandomExhausted = errors.New("capture: the conversation read more random bytes than were recorded")
@@ -0,0 +1,17 @@
+package otr3
+
+import "time"
+
+// SetClock sets the function the conversation uses to tell the time, instead of time.Now. The time decides when
+// heartbeats are sent, when the last message is sent again after the AKE and when authentications time out, so
+// tests can use a virtual clock to check all of that without waiting.
+func (c *Conversation) SetClock(now func() time.Time) {
+	c.clock = now
+}
+
+func (c *Conversation) now() time.Time {
+	if c.clock != nil {
+		return c.clock()
+	}
+	return time.Now()
+}
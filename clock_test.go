@@ -0,0 +1,65 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func Test_now_usesTheRealTimeByDefault(t *testing.T) {
+	c := &Conversation{}
+	before := time.Now()
+
+	assertFalse(t, c.now().Before(before))
+}
+
+func Test_now_usesTheClockOfTheConversation(t *testing.T) {
+	c := &Conversation{}
+	tt := time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c.SetClock(func() time.Time { return tt })
+
+	assertEquals(t, c.now(), tt)
+}
+
+func Test_potentialHeartbeat_isSentWhenTheClockOfTheConversationSaysSo(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	tt := time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c.heartbeat.lastSent = tt
+	c.SetClock(func() time.Time { return tt.Add(heartbeatInterval + time.Second) })
+
+	ret, err := c.potentialHeartbeat([]byte("Foo plain"))
+
+	assertNil(t, err)
+	assertNotNil(t, ret)
+	assertEquals(t, c.heartbeat.lastSent, tt.Add(heartbeatInterval+time.Second))
+}
+
+func Test_potentialSMPTimeout_usesTheClockOfTheConversation(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusExpect3)
+	c.SetSMPTimeout(time.Minute)
+	tt := time.Now()
+	c.SetClock(func() time.Time { return tt })
+	c.updateLastSMPActivity()
+
+	tt = tt.Add(2 * time.Minute)
+	c.potentialSMPTimeout()
+
+	assertEquals(t, c.SMPStatus(), SMPStatusExpect1)
+}
+
+func Test_shouldRetransmit_usesTheClockOfTheConversation(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	tt := time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c.SetClock(func() time.Time { return tt })
+	c.updateLastSent()
+	c.lastMessage(MessagePlaintext("hello"))
+	c.updateMayRetransmitTo(retransmitExact)
+
+	assertTrue(t, c.shouldRetransmit())
+
+	tt = tt.Add(resendInterval + time.Second)
+	assertFalse(t, c.shouldRetransmit())
+}
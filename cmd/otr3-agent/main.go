@@ -0,0 +1,142 @@
+// Command otr3-agent keeps an OTR private key and signs with it for the clients that connect to its socket.
+//
+// The key is read from a private key file in the format used by libotr. Clients connect with agent.Dial and use
+// the signer that the WithContext method of the agent.Client they get returns as the key of their conversations:
+//
+//	otr3-agent -keys ~/.otr/otr.private_key -account alice@example.com -socket /run/user/1000/otr3-agent.sock
+//
+// Only the owner can connect to the socket. Its directory is created if it doesn't exist, and the agent refuses to
+// start if other users can open it.
+//
+// With -confirm, the given command is run for every signing request, with the MAC to sign in hexadecimal in the
+// OTR3_AGENT_HASH environment variable, and the account and the peer the client says it is for in OTR3_AGENT_ACCOUNT
+// and OTR3_AGENT_PEER. The request is only signed if the command exits successfully.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/twstrike/otr3"
+	"github.com/twstrike/otr3/agent"
+)
+
+func main() {
+	keys := flag.String("keys", "", "the private key file in libotr format")
+	account := flag.String("account", "", "the account whose key is used, the first one in the file by default")
+	protocol := flag.String("protocol", "", "the protocol of the account, any protocol by default")
+	socket := flag.String("socket", "otr3-agent/agent.sock", "the path of the Unix domain socket to listen on")
+	confirm := flag.String("confirm", "", "a command that has to succeed before every signature")
+	flag.Parse()
+
+	if err := run(*keys, *account, *protocol, *socket, *confirm); err != nil {
+		fmt.Fprintln(os.Stderr, "otr3-agent:", err)
+		os.Exit(1)
+	}
+}
+
+func run(keys, account, protocol, socket, confirm string) error {
+	if keys == "" {
+		return errors.New("a private key file has to be given with -keys")
+	}
+
+	key, err := findKey(keys, account, protocol)
+	if err != nil {
+		return err
+	}
+
+	l, err := listen(socket)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		l.Close()
+	}()
+
+	s := &agent.Server{Key: key}
+	if confirm != "" {
+		s.Confirm = confirmWithCommand(confirm)
+	}
+
+	fmt.Fprintf(os.Stderr, "otr3-agent: signing with %X on %s\n", key.Public().DefaultFingerprint(), socket)
+	s.Serve(l)
+	return nil
+}
+
+// listen listens on a socket that only the owner can connect to
+func listen(socket string) (net.Listener, error) {
+	if err := privateDirectory(filepath.Dir(socket)); err != nil {
+		return nil, err
+	}
+
+	// The socket is created with the permissions the umask leaves, so it is never accessible to anybody else, not
+	// even for a moment. Nothing else is running yet that could create files with this umask.
+	old := syscall.Umask(0177)
+	l, err := net.Listen("unix", socket)
+	syscall.Umask(old)
+	return l, err
+}
+
+// privateDirectory creates dir if it doesn't exist, and fails if somebody else than us owns it or can open it
+func privateDirectory(dir string) error {
+	info, err := os.Lstat(dir)
+	if os.IsNotExist(err) {
+		return os.Mkdir(dir, 0700)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return errors.New(dir + " is not a directory")
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return errors.New(dir + " belongs to another user")
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("other users can open %s (mode %v), the socket has to be in a directory only the owner can open", dir, info.Mode().Perm())
+	}
+	return nil
+}
+
+func findKey(keys, account, protocol string) (*otr3.PrivateKey, error) {
+	accounts, err := otr3.ImportKeysFromFile(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range accounts {
+		if (account == "" || a.Name() == account) && (protocol == "" || a.Protocol() == protocol) {
+			return a.Key(), nil
+		}
+	}
+
+	return nil, errors.New("no matching account in " + keys)
+}
+
+func confirmWithCommand(command string) func(r agent.Request) bool {
+	return func(r agent.Request) bool {
+		cmd := exec.Command("/bin/sh", "-c", command)
+		cmd.Env = append(os.Environ(),
+			"OTR3_AGENT_HASH="+hex.EncodeToString(r.Hashed),
+			"OTR3_AGENT_ACCOUNT="+r.Account,
+			"OTR3_AGENT_PEER="+r.Peer,
+		)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		return cmd.Run() == nil
+	}
+}
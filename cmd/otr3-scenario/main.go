@@ -0,0 +1,58 @@
+// Command otr3-scenario runs scripted conversations between OTR peers, and reports the first step of every scenario
+// that didn't pass. The format of the scenarios is described in the documentation of the scenario package.
+//
+//	otr3-scenario scenario/testdata/*.scenario
+//
+// With -v, every step is printed as it runs, with the messages it delivered, received or lost.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/twstrike/otr3/scenario"
+)
+
+func main() {
+	verbose := flag.Bool("v", false, "print every step, and every message delivered in it")
+	flag.Parse()
+
+	if err := run(flag.Args(), *verbose, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "otr3-scenario:", err)
+		os.Exit(1)
+	}
+}
+
+func run(files []string, verbose bool, out io.Writer) error {
+	if len(files) == 0 {
+		return errors.New("no scenario files were given")
+	}
+
+	r := &scenario.Runner{}
+	if verbose {
+		r.Trace = out
+	}
+
+	failed := 0
+	for _, file := range files {
+		s, err := scenario.ParseFile(file)
+		if err == nil {
+			err = r.Run(s)
+		}
+
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "FAIL %s\n  %v\n", file, err)
+			continue
+		}
+		fmt.Fprintf(out, "ok   %s\n", file)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d scenarios failed", failed, len(files))
+	}
+	return nil
+}
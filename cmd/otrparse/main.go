@@ -0,0 +1,64 @@
+// Command otrparse prints the fields of OTR messages, like the otr_parse tool of libotr.
+//
+// The messages are given as arguments, or read from the standard input, one on every line:
+//
+//	otrparse '?OTRv23?'
+//	grep '?OTR' chat.log | otrparse
+//
+// Every line is parsed as a message, so the lines of a log should be cut to the messages first. otrparse exits with
+// an error when some message couldn't be parsed.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/twstrike/otr3/inspect"
+)
+
+// maxLineLength is the length of the longest line read. Messages are rarely longer than a few kilobytes.
+const maxLineLength = 1 << 20
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "otrparse:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, in io.Reader, out io.Writer) error {
+	failed := 0
+	parse := func(msg string) {
+		m, err := inspect.Parse([]byte(msg))
+		fmt.Fprint(out, m)
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "\tError: %v\n", err)
+		}
+		fmt.Fprintln(out)
+	}
+
+	if len(args) > 0 {
+		for _, msg := range args {
+			parse(msg)
+		}
+	} else {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(nil, maxLineLength)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				parse(line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d messages could not be parsed", failed)
+	}
+	return nil
+}
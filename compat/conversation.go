@@ -1,6 +1,13 @@
+// Package compat implements the API of golang.org/x/crypto/otr on top of otr3, so it can be used as a drop-in
+// replacement for it.
 package compat
 
-import "github.com/twstrike/otr3"
+import (
+	"bytes"
+	"math"
+
+	"github.com/twstrike/otr3"
+)
 
 var (
 	// QueryMessage can be sent to a peer to start an OTR conversation.
@@ -11,6 +18,8 @@ var (
 	ErrorPrefix = "?OTR Error:"
 
 	minFragmentSize = 18
+
+	queryMarker = []byte("?OTR")
 )
 
 // SecurityChange describes a change in the security state of a Conversation.
@@ -48,12 +57,14 @@ type Conversation struct {
 
 	eventHandler
 	initialized bool
+	lastChanges []SecurityChange
 }
 
 type eventHandler struct {
-	smpQuestion      string
-	securityChange   SecurityChange
-	waitingForSecret bool
+	smpQuestion         string
+	securityChanges     []SecurityChange
+	waitingForSecret    bool
+	receivedUnencrypted bool
 }
 
 func (eventHandler) WishToHandleErrorMessage() bool {
@@ -67,70 +78,151 @@ func (eventHandler) HandleErrorMessage(error otr3.ErrorCode) []byte {
 func (e *eventHandler) HandleSecurityEvent(event otr3.SecurityEvent) {
 	switch event {
 	case otr3.GoneSecure, otr3.StillSecure:
-		e.securityChange = NewKeys
+		e.securityChange(NewKeys)
+	case otr3.GoneInsecure:
+		e.securityChange(ConversationEnded)
 	}
 }
 
 func (e *eventHandler) HandleSMPEvent(event otr3.SMPEvent, progressPercent int, question string) {
 	switch event {
 	case otr3.SMPEventAskForSecret, otr3.SMPEventAskForAnswer:
-		e.securityChange = SMPSecretNeeded
+		e.securityChange(SMPSecretNeeded)
 		e.smpQuestion = question
 		e.waitingForSecret = true
 	case otr3.SMPEventSuccess:
 		if progressPercent == 100 {
-			e.securityChange = SMPComplete
+			e.securityChange(SMPComplete)
 		}
 	case otr3.SMPEventAbort, otr3.SMPEventFailure, otr3.SMPEventCheated:
-		e.securityChange = SMPFailed
+		e.securityChange(SMPFailed)
+		e.waitingForSecret = false
 	}
 }
 
 func (e *eventHandler) HandleMessageEvent(event otr3.MessageEvent, message []byte, err error) {
-	if event == otr3.MessageEventConnectionEnded {
-		e.securityChange = ConversationEnded
+	if event == otr3.MessageEventReceivedMessageUnencrypted {
+		e.receivedUnencrypted = true
+	}
+}
+
+func (e *eventHandler) securityChange(change SecurityChange) {
+	e.securityChanges = append(e.securityChanges, change)
+}
+
+func (e *eventHandler) hasSecurityChange(change SecurityChange) bool {
+	for _, c := range e.securityChanges {
+		if c == change {
+			return true
+		}
 	}
+	return false
 }
 
-func (e *eventHandler) consumeSecurityChange() SecurityChange {
-	ret := e.securityChange
-	e.securityChange = NoChange
+func (e *eventHandler) consumeSecurityChanges() []SecurityChange {
+	ret := e.securityChanges
+	e.securityChanges = nil
 	return ret
 }
 
+// SecurityChanges returns every change in the security state that the last call to Receive noticed, in the order they
+// happened. x/crypto/otr can only report one change for every message, so Receive returns the last of them, and the
+// others are only available here.
+func (c *Conversation) SecurityChanges() []SecurityChange {
+	return c.lastChanges
+}
+
 // SMPQuestion returns the human readable challenge question from the peer.
 // It's only valid after Receive has returned SMPSecretNeeded.
 func (c *Conversation) SMPQuestion() string {
 	return c.eventHandler.smpQuestion
 }
 
+// isQuery returns the greatest version of OTR offered by the query message in msg that we support, which can only be 2
+// like in x/crypto/otr, or 0 if there is none
+func isQuery(msg []byte) (greatestCommonVersion int) {
+	pos := bytes.Index(msg, queryMarker)
+	if pos == -1 {
+		return 0
+	}
+
+	for i, c := range msg[pos+len(queryMarker):] {
+		if i == 0 {
+			if c == '?' {
+				// Indicates support for version 1, which isn't implemented
+				continue
+			}
+
+			if c != 'v' {
+				// Invalid message
+				return 0
+			}
+
+			continue
+		}
+
+		if c == '?' {
+			// End of message
+			return greatestCommonVersion
+		}
+
+		if c == ' ' || c == '\t' {
+			// Probably an invalid message
+			return 0
+		}
+
+		if c == '2' {
+			greatestCommonVersion = 2
+		}
+	}
+
+	return 0
+}
+
+// isQueryMessage returns true if otr3 would take msg as a query message
+func isQueryMessage(msg []byte) bool {
+	return bytes.HasPrefix(msg, []byte("?OTR?")) || bytes.HasPrefix(msg, []byte("?OTRv"))
+}
+
 func (c *Conversation) compatInit() {
-	if c.initialized {
-		return
+	if !c.initialized {
+		c.Conversation.Policies.AllowV2()
+		c.SetSMPEventHandler(&c.eventHandler)
+		c.SetErrorMessageHandler(&c.eventHandler)
+		c.SetMessageEventHandler(&c.eventHandler)
+		c.SetSecurityEventHandler(&c.eventHandler)
+		c.initialized = true
 	}
 
-	c.Conversation.Policies.AllowV2()
-	c.SetSMPEventHandler(&c.eventHandler)
-	c.SetErrorMessageHandler(&c.eventHandler)
-	c.SetMessageEventHandler(&c.eventHandler)
-	c.SetSecurityEventHandler(&c.eventHandler)
+	c.updateSettings()
+}
+
+// updateSettings hands the exported fields to the otr3 conversation, since they can change between calls
+func (c *Conversation) updateSettings() {
+	// Without a private key, plaintext messages still work. x/crypto/otr would only fail in the key exchange too
+	var ourKey otr3.Signer
+	if c.PrivateKey != nil {
+		ourKey = &c.PrivateKey.PrivateKey
+	}
+	c.Conversation.SetKeys(ourKey, c.Conversation.GetTheirKey())
 
 	// x/crypto/otr has a minimum size for fragmentation
-	if c.FragmentSize >= minFragmentSize {
+	switch {
+	case c.FragmentSize < minFragmentSize:
+		c.SetFragmentSize(0)
+	case c.FragmentSize > math.MaxUint16:
+		c.SetFragmentSize(math.MaxUint16)
+	default:
 		c.SetFragmentSize(uint16(c.FragmentSize))
 	}
-
-	c.initialized = true
 }
 
 func (c *Conversation) updateValues() {
-	if c.Conversation.GetTheirKey() != nil {
-		c.TheirPublicKey.PublicKey = *c.Conversation.GetTheirKey()
+	if theirKey := c.Conversation.GetTheirKey(); theirKey != nil {
+		c.TheirPublicKey.PublicKey = *theirKey
 	}
 
-	c.Conversation.SetKeys(&c.PrivateKey.PrivateKey, &c.TheirPublicKey.PublicKey)
-
-	if c.eventHandler.securityChange == NewKeys {
+	if c.eventHandler.hasSecurityChange(NewKeys) {
 		c.SSID = c.GetSSID()
 	}
 }
@@ -139,19 +231,39 @@ func (c *Conversation) updateValues() {
 // an indicator of whether that message was encrypted, a hint about the
 // encryption state and zero or more messages to send back to the peer.
 // These messages do not need to be passed to Send before transmission.
+// Like in x/crypto/otr, encrypted is only true when in was an encrypted message, and not just sent while the
+// conversation is encrypted. Encrypted messages that carry no text, like heartbeats, are not marked as encrypted.
+// When in causes more than one change, change is the last of them, and SecurityChanges returns all of them.
 func (c *Conversation) Receive(in []byte) (out []byte, encrypted bool, change SecurityChange, toSend [][]byte, err error) {
 	c.compatInit()
 
+	if isQueryMessage(in) && isQuery(in) == 0 {
+		// x/crypto/otr takes a query message without a version it supports as plaintext
+		c.lastChanges = nil
+		return in, false, NoChange, nil, nil
+	}
+
+	wasEncrypted := c.IsEncrypted()
+	c.eventHandler.receivedUnencrypted = false
+
 	var ret []otr3.ValidMessage
 	out, ret, err = c.Conversation.Receive(in)
-	encrypted = c.IsEncrypted()
 
 	if ret != nil {
 		toSend = otr3.Bytes(ret)
 	}
 
 	c.updateValues()
-	change = c.eventHandler.consumeSecurityChange()
+
+	// Only an encrypted message can end the conversation, and the peer can't send anything else encrypted
+	// without us noticing it is unencrypted
+	ended := c.eventHandler.hasSecurityChange(ConversationEnded)
+	encrypted = wasEncrypted && (ended || len(out) > 0 && !c.eventHandler.receivedUnencrypted)
+
+	c.lastChanges = c.eventHandler.consumeSecurityChanges()
+	if len(c.lastChanges) > 0 {
+		change = c.lastChanges[len(c.lastChanges)-1]
+	}
 	return
 }
 
@@ -176,6 +288,7 @@ func (c *Conversation) Send(in []byte) (toSend [][]byte, err error) {
 func (c *Conversation) End() (toSend [][]byte) {
 	c.compatInit()
 
+	pending := len(c.eventHandler.securityChanges)
 	ret, _ := c.Conversation.End()
 
 	if ret != nil {
@@ -183,6 +296,8 @@ func (c *Conversation) End() (toSend [][]byte) {
 	}
 
 	c.updateValues()
+	// Only the peer ending the conversation is a change that Receive reports
+	c.eventHandler.securityChanges = c.eventHandler.securityChanges[:pending]
 	return
 }
 
@@ -205,3 +320,16 @@ func (c *Conversation) Authenticate(question string, mutualSecret []byte) (toSen
 	c.updateValues()
 	return otr3.Bytes(ret), err
 }
+
+// AbortAuthentication cancels an authentication in progress, for example
+// because the user closed the authentication dialog. It returns zero or more
+// messages to send to the peer in order to tell it about the abort.
+func (c *Conversation) AbortAuthentication() (toSend [][]byte, err error) {
+	c.compatInit()
+
+	c.eventHandler.waitingForSecret = false
+	ret, err := c.Conversation.AbortAuthentication()
+
+	c.updateValues()
+	return otr3.Bytes(ret), err
+}
@@ -0,0 +1,437 @@
+package compat
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/twstrike/otr3"
+	"github.com/twstrike/otr3/otrtest"
+)
+
+func newEncryptedConversations(t *testing.T) (alice, bob *Conversation) {
+	alicePrivateKey, _ := hex.DecodeString(alicePrivateKeyHex)
+	bobPrivateKey, _ := hex.DecodeString(bobPrivateKeyHex)
+
+	alice, bob = &Conversation{}, &Conversation{}
+	alice.PrivateKey = new(PrivateKey)
+	bob.PrivateKey = new(PrivateKey)
+	alice.PrivateKey.Parse(alicePrivateKey)
+	bob.PrivateKey.Parse(bobPrivateKey)
+
+	alicesMessage := [][]byte{[]byte(QueryMessage)}
+	var bobsMessage [][]byte
+	for len(alicesMessage) > 0 || len(bobsMessage) > 0 {
+		bobsMessage = deliver(t, bob, alicesMessage)
+		alicesMessage = deliver(t, alice, bobsMessage)
+	}
+
+	if !alice.IsEncrypted() || !bob.IsEncrypted() {
+		t.Fatal("failed to establish an encrypted conversation")
+	}
+
+	return alice, bob
+}
+
+func deliver(t *testing.T, to *Conversation, msgs [][]byte) (toSend [][]byte) {
+	for _, msg := range msgs {
+		_, _, _, ts, err := to.Receive(msg)
+		if err != nil {
+			t.Fatalf("unexpected error while receiving %s: %s", msg, err)
+		}
+		toSend = append(toSend, ts...)
+	}
+	return
+}
+
+func TestAbortAuthentication(t *testing.T) {
+	alice, bob := newEncryptedConversations(t)
+
+	toSend, err := alice.Authenticate("", []byte("secret"))
+	if err != nil {
+		t.Fatalf("failed to start authentication: %s", err)
+	}
+
+	_, _, change, _, _ := bob.Receive(toSend[0])
+	if change != SMPSecretNeeded {
+		t.Fatalf("expected SMPSecretNeeded, got %d", change)
+	}
+
+	toSend, err = bob.AbortAuthentication()
+	if err != nil {
+		t.Fatalf("failed to abort authentication: %s", err)
+	}
+	if len(toSend) != 1 {
+		t.Fatalf("expected one message to send, got %d", len(toSend))
+	}
+	if bob.waitingForSecret {
+		t.Error("bob is still waiting for a secret after aborting")
+	}
+
+	_, _, change, _, _ = alice.Receive(toSend[0])
+	if change != SMPFailed {
+		t.Errorf("expected SMPFailed, got %d", change)
+	}
+	if alice.SMPStatus() != otr3.SMPStatusExpect1 {
+		t.Errorf("expected alice to have restarted SMP, got %s", alice.SMPStatus())
+	}
+}
+
+func TestReceivePlaintextWithoutAPrivateKey(t *testing.T) {
+	var conv Conversation
+
+	out, encrypted, change, toSend, err := conv.Receive([]byte("hello"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(out) != "hello" || encrypted || change != NoChange || len(toSend) != 0 {
+		t.Errorf("unexpected result: %q %t %d %q", out, encrypted, change, toSend)
+	}
+}
+
+func TestSendPlaintextWithoutAPrivateKey(t *testing.T) {
+	var conv Conversation
+
+	toSend, err := conv.Send([]byte("hello"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(toSend) != 1 || string(toSend[0]) != "hello" {
+		t.Errorf("expected the message to be sent in the clear, got %q", toSend)
+	}
+}
+
+func TestKeyExchangeWithoutAPrivateKeyReturnsAnError(t *testing.T) {
+	bobPrivateKey, _ := hex.DecodeString(bobPrivateKeyHex)
+	alice, bob := &Conversation{}, &Conversation{PrivateKey: new(PrivateKey)}
+	bob.PrivateKey.Parse(bobPrivateKey)
+
+	var err error
+	alicesMessage := [][]byte{[]byte(QueryMessage)}
+	for len(alicesMessage) > 0 && err == nil {
+		var bobsMessage [][]byte
+		_, _, _, bobsMessage, _ = bob.Receive(alicesMessage[0])
+		alicesMessage = nil
+		if len(bobsMessage) > 0 {
+			_, _, _, alicesMessage, err = alice.Receive(bobsMessage[0])
+		}
+	}
+
+	if err == nil {
+		t.Error("expected an error when there is no private key")
+	}
+	if alice.IsEncrypted() {
+		t.Error("expected the conversation not to be encrypted")
+	}
+}
+
+func TestReceiveTakesAQueryWithoutVersion2AsPlaintext(t *testing.T) {
+	var conv Conversation
+
+	out, _, _, toSend, err := conv.Receive([]byte("?OTR?"))
+	if err != nil || string(out) != "?OTR?" || len(toSend) != 0 {
+		t.Errorf("unexpected result: %q %q %v", out, toSend, err)
+	}
+}
+
+func TestReceiveMarksOnlyEncryptedMessagesAsEncrypted(t *testing.T) {
+	alice, bob := newEncryptedConversations(t)
+
+	out, encrypted, _, _, err := bob.Receive([]byte("in the clear"))
+	if err != nil || string(out) != "in the clear" {
+		t.Fatalf("unexpected result: %q %s", out, err)
+	}
+	if encrypted {
+		t.Error("a plaintext message was marked as encrypted")
+	}
+
+	toSend, _ := alice.Send([]byte("secret"))
+	out, encrypted, _, _, _ = bob.Receive(toSend[0])
+	if string(out) != "secret" || !encrypted {
+		t.Errorf("expected an encrypted message, got %q %t", out, encrypted)
+	}
+}
+
+func TestKeyExchangeMessagesAreNotMarkedAsEncrypted(t *testing.T) {
+	alice, bob := newEncryptedConversations(t)
+
+	alicesMessage := [][]byte{[]byte(QueryMessage)}
+	for len(alicesMessage) > 0 {
+		var bobsMessage [][]byte
+		for _, msg := range alicesMessage {
+			_, encrypted, _, ts, _ := bob.Receive(msg)
+			if encrypted {
+				t.Errorf("a key exchange message was marked as encrypted: %s", msg)
+			}
+			bobsMessage = append(bobsMessage, ts...)
+		}
+
+		alicesMessage = nil
+		for _, msg := range bobsMessage {
+			_, encrypted, _, ts, _ := alice.Receive(msg)
+			if encrypted {
+				t.Errorf("a key exchange message was marked as encrypted: %s", msg)
+			}
+			alicesMessage = append(alicesMessage, ts...)
+		}
+	}
+}
+
+func TestRenegotiatingKeysSignalsNewKeys(t *testing.T) {
+	alice, bob := newEncryptedConversations(t)
+	oldSSID := alice.SSID
+
+	var aliceChange, bobChange SecurityChange
+	alicesMessage := [][]byte{[]byte(QueryMessage)}
+	for len(alicesMessage) > 0 {
+		var bobsMessage [][]byte
+		for _, msg := range alicesMessage {
+			_, _, change, ts, _ := bob.Receive(msg)
+			if change != NoChange {
+				bobChange = change
+			}
+			bobsMessage = append(bobsMessage, ts...)
+		}
+
+		alicesMessage = nil
+		for _, msg := range bobsMessage {
+			_, _, change, ts, _ := alice.Receive(msg)
+			if change != NoChange {
+				aliceChange = change
+			}
+			alicesMessage = append(alicesMessage, ts...)
+		}
+	}
+
+	if aliceChange != NewKeys || bobChange != NewKeys {
+		t.Errorf("expected both to signal new keys, got %d and %d", aliceChange, bobChange)
+	}
+	if alice.SSID == oldSSID || alice.SSID != bob.SSID {
+		t.Errorf("expected a new shared SSID, got %x and %x", alice.SSID, bob.SSID)
+	}
+}
+
+func TestReceivingTheEndOfTheConversationSignalsConversationEnded(t *testing.T) {
+	alice, bob := newEncryptedConversations(t)
+
+	toSend := alice.End()
+	if alice.IsEncrypted() {
+		t.Error("alice is still encrypted after ending the conversation")
+	}
+
+	_, encrypted, change, _, err := bob.Receive(toSend[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if change != ConversationEnded {
+		t.Errorf("expected ConversationEnded, got %d", change)
+	}
+	if !encrypted {
+		t.Error("the message that ended the conversation was not marked as encrypted")
+	}
+	if bob.IsEncrypted() {
+		t.Error("bob is still encrypted after the peer ended the conversation")
+	}
+
+	if _, err := bob.Send([]byte("hello?")); err == nil {
+		t.Error("expected an error sending after the peer ended the conversation")
+	}
+
+	_, _, change, _, _ = bob.Receive([]byte("plain"))
+	if change != NoChange {
+		t.Errorf("expected no change after the conversation ended, got %d", change)
+	}
+
+	if toSend := bob.End(); len(toSend) != 0 {
+		t.Errorf("expected nothing to send when ending a finished conversation, got %q", toSend)
+	}
+	if toSend, _ := bob.Send([]byte("plain")); len(toSend) != 1 || string(toSend[0]) != "plain" {
+		t.Errorf("expected to send in the clear after ending, got %q", toSend)
+	}
+}
+
+func TestEndingOurselvesDoesntSignalAChange(t *testing.T) {
+	alice, _ := newEncryptedConversations(t)
+
+	alice.End()
+
+	_, _, change, _, _ := alice.Receive([]byte("hello"))
+	if change != NoChange {
+		t.Errorf("expected no change, got %d", change)
+	}
+}
+
+func TestEndOnAPlaintextConversationSendsNothing(t *testing.T) {
+	var conv Conversation
+
+	if toSend := conv.End(); len(toSend) != 0 {
+		t.Errorf("expected nothing to send, got %q", toSend)
+	}
+}
+
+func TestFragmentSizeCanBeChangedAfterTheFirstMessage(t *testing.T) {
+	alice, bob := newEncryptedConversations(t)
+
+	alice.FragmentSize = 100
+	toSend, _ := alice.Send([]byte("hello"))
+	if len(toSend) < 2 {
+		t.Fatalf("expected the message to be fragmented, got %d messages", len(toSend))
+	}
+	for _, m := range toSend {
+		if len(m) > 100 {
+			t.Errorf("fragment of %d bytes is larger than the fragment size", len(m))
+		}
+	}
+	deliver(t, bob, toSend)
+
+	alice.FragmentSize = 0
+	if toSend, _ = alice.Send([]byte("hello")); len(toSend) != 1 {
+		t.Errorf("expected the message not to be fragmented, got %d messages", len(toSend))
+	}
+}
+
+func TestTheirPublicKeyIsSetAfterTheKeyExchange(t *testing.T) {
+	alice, bob := newEncryptedConversations(t)
+
+	if !bytes.Equal(alice.TheirPublicKey.Fingerprint(), bob.PrivateKey.Fingerprint()) {
+		t.Error("alice doesn't have bob's public key")
+	}
+	if !bytes.Equal(bob.TheirPublicKey.Fingerprint(), alice.PrivateKey.Fingerprint()) {
+		t.Error("bob doesn't have alice's public key")
+	}
+}
+
+func TestReceiveDoesntPanicWithCorruptMessages(t *testing.T) {
+	alice, bob := newEncryptedConversations(t)
+	toSend, _ := alice.Send([]byte("hello"))
+
+	for _, msg := range [][]byte{
+		[]byte("?OTR:"),
+		[]byte("?OTR:AAID"),
+		[]byte("?OTR:AAMD.."),
+		[]byte("?OTR,1,2,a,"),
+		[]byte("?OTR,2,1,a,"),
+		toSend[0][:len(toSend[0])-10],
+	} {
+		bob.Receive(msg)
+	}
+}
+
+func assertSecurityChanges(t *testing.T, conv *Conversation, change SecurityChange, expected ...SecurityChange) {
+	if change != expected[len(expected)-1] {
+		t.Errorf("expected Receive to return the last change, %d, got %d", expected[len(expected)-1], change)
+	}
+	if !reflect.DeepEqual(conv.SecurityChanges(), expected) {
+		t.Errorf("expected changes %v, got %v", expected, conv.SecurityChanges())
+	}
+}
+
+// injectionReady is an otr3.SMPInjectionHandler that tells when the SMP computations running in the background have
+// finished, so the next Receive signals what they caused
+type injectionReady chan struct{}
+
+func (r injectionReady) HandleSMPInjection() {
+	r <- struct{}{}
+}
+
+func TestSecurityChangesKeepsEveryChangeOfAReceive(t *testing.T) {
+	alice, bob := newEncryptedConversations(t)
+	clock := otrtest.NewClock(time.Now())
+	bob.SetClock(clock.Now)
+	bob.SetSMPTimeout(time.Minute)
+
+	toSend, _ := alice.Authenticate("", []byte("secret"))
+	_, _, change, _, _ := bob.Receive(toSend[0])
+	assertSecurityChanges(t, bob, change, SMPSecretNeeded)
+
+	clock.Advance(2 * time.Minute)
+
+	// The first authentication timed out before the second one arrives
+	alice.AbortAuthentication()
+	toSend, _ = alice.Authenticate("", []byte("secret"))
+	_, _, change, _, _ = bob.Receive(toSend[0])
+	assertSecurityChanges(t, bob, change, SMPFailed, SMPSecretNeeded)
+}
+
+func TestSecurityChangesKeepsAFailedAuthenticationBeforeTheEndOfTheConversation(t *testing.T) {
+	alice, bob := newEncryptedConversations(t)
+	clock := otrtest.NewClock(time.Now())
+	alice.SetClock(clock.Now)
+	alice.SetSMPTimeout(time.Minute)
+
+	alice.Authenticate("", []byte("secret"))
+	clock.Advance(2 * time.Minute)
+
+	_, _, change, _, _ := alice.Receive(bob.End()[0])
+	assertSecurityChanges(t, alice, change, SMPFailed, ConversationEnded)
+}
+
+func TestSecurityChangesKeepsACompletedAuthenticationBeforeTheEndOfTheConversation(t *testing.T) {
+	alice, bob := newEncryptedConversations(t)
+
+	toSend, _ := alice.Authenticate("", []byte("secret"))
+	bob.Receive(toSend[0])
+	toSend, _ = bob.Authenticate("", []byte("secret"))
+	_, _, _, toSend, _ = alice.Receive(toSend[0])
+	_, _, _, toSend, _ = bob.Receive(toSend[0])
+
+	// Alice checks the last message of the authentication in the background, and only notices it completed
+	// when she receives the next message
+	ready := make(injectionReady, 1)
+	alice.EnableAsyncSMP(ready)
+	alice.Receive(toSend[0])
+	<-ready
+
+	_, _, change, _, _ := alice.Receive(bob.End()[0])
+	assertSecurityChanges(t, alice, change, SMPComplete, ConversationEnded)
+}
+
+func TestSecurityChangesKeepsAnAuthenticationStartedBeforeNewKeys(t *testing.T) {
+	alice, bob := newEncryptedConversations(t)
+
+	_, _, _, dhCommit, _ := alice.Receive([]byte(QueryMessage))
+	_, _, _, dhKey, _ := bob.Receive(dhCommit[0])
+	toSend, _ := bob.Authenticate("", []byte("secret"))
+	_, _, _, revealSig, _ := alice.Receive(dhKey[0])
+
+	// Alice checks the first message of the authentication in the background, and only asks for the secret
+	// when she receives the message that finishes the key exchange
+	ready := make(injectionReady, 1)
+	alice.EnableAsyncSMP(ready)
+	alice.Receive(toSend[0])
+	<-ready
+
+	_, _, _, sig, _ := bob.Receive(revealSig[0])
+	_, _, change, _, _ := alice.Receive(sig[0])
+	assertSecurityChanges(t, alice, change, SMPSecretNeeded, NewKeys)
+}
+
+func TestSecurityChangesIsEmptyWhenNothingChanged(t *testing.T) {
+	alice, bob := newEncryptedConversations(t)
+
+	toSend, _ := alice.Send([]byte("hello"))
+	_, _, change, _, _ := bob.Receive(toSend[0])
+
+	if change != NoChange || len(bob.SecurityChanges()) != 0 {
+		t.Errorf("expected no changes, got %d and %v", change, bob.SecurityChanges())
+	}
+}
+
+func TestEndKeepsTheChangesThatHappenedBefore(t *testing.T) {
+	alice, _ := newEncryptedConversations(t)
+	clock := otrtest.NewClock(time.Now())
+	alice.SetClock(clock.Now)
+	alice.SetSMPTimeout(time.Minute)
+
+	// Sending notices that the authentication timed out
+	alice.Authenticate("", []byte("secret"))
+	clock.Advance(2 * time.Minute)
+	alice.Send([]byte("hello"))
+
+	alice.End()
+
+	_, _, change, _, _ := alice.Receive([]byte("hello"))
+	assertSecurityChanges(t, alice, change, SMPFailed)
+}
@@ -1,6 +1,7 @@
 package compat
 
 import (
+	"context"
 	"io"
 
 	"github.com/twstrike/otr3"
@@ -17,13 +18,24 @@ type PrivateKey struct {
 	PublicKey
 }
 
-// Generate will generate a new Private Key using the provided randomness
+// Generate will generate a new Private Key using the provided randomness. It panics if the key can't be generated,
+// GenerateContext returns the error instead.
 func (priv *PrivateKey) Generate(rand io.Reader) {
-	if err := priv.PrivateKey.Generate(rand); err != nil {
+	if err := priv.GenerateContext(context.Background(), rand, nil); err != nil {
 		panic(err.Error())
 	}
 }
 
+// GenerateContext will generate a new Private Key using the provided randomness, see otr3.PrivateKey.GenerateContext
+func (priv *PrivateKey) GenerateContext(ctx context.Context, rand io.Reader, opts *otr3.GenerateOptions) error {
+	if err := priv.PrivateKey.GenerateContext(ctx, rand, opts); err != nil {
+		return err
+	}
+
+	priv.PublicKey = PublicKey{priv.PrivateKey.PublicKey}
+	return nil
+}
+
 // Serialize will serialize the private key
 func (priv *PrivateKey) Serialize(in []byte) []byte {
 	return append(in, priv.PrivateKey.Serialize()...)
@@ -39,6 +51,16 @@ func (priv *PrivateKey) Sign(rand io.Reader, hashed []byte) []byte {
 	return ret
 }
 
+// Serialize appends the serialization of the public key to in
+func (pub *PublicKey) Serialize(in []byte) []byte {
+	return append(in, pub.PublicKey.Serialize()...)
+}
+
+// Verify will verify a signature of a hashed data using dsa Verify. It returns the rest of sig after the signature.
+func (pub *PublicKey) Verify(hashed, sig []byte) ([]byte, bool) {
+	return pub.PublicKey.Verify(hashed, sig)
+}
+
 // Fingerprint will generate a new SHA-1 fingerprint of the serialization of the public key
 func (pub *PublicKey) Fingerprint() []byte {
 	return pub.PublicKey.DefaultFingerprint()
@@ -58,3 +80,13 @@ func (priv *PrivateKey) Parse(in []byte) (index []byte, ok bool) {
 
 	return rest, ok
 }
+
+// Import parses the contents of a libotr private key file, and returns true if it succeeded
+func (priv *PrivateKey) Import(in []byte) bool {
+	if !priv.PrivateKey.Import(in) {
+		return false
+	}
+
+	priv.PublicKey = PublicKey{priv.PrivateKey.PublicKey}
+	return true
+}
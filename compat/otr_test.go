@@ -6,9 +6,14 @@ package compat
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"math/big"
+	"reflect"
 	"testing"
+
+	"github.com/twstrike/otr3"
 )
 
 var isQueryTests = []struct {
@@ -108,7 +113,69 @@ func TestSignVerify(t *testing.T) {
 	}
 }
 
+func TestIsQuery(t *testing.T) {
+	for i, test := range isQueryTests {
+		version := isQuery([]byte(test.msg))
+		if version != test.expectedVersion {
+			t.Errorf("#%d: got %d, want %d", i, version, test.expectedVersion)
+		}
+	}
+}
+
+func TestReceiveOnlyAnswersQueriesForVersion2(t *testing.T) {
+	for i, test := range isQueryTests {
+		var conv Conversation
+		conv.PrivateKey = new(PrivateKey)
+		alicePrivateKey, _ := hex.DecodeString(alicePrivateKeyHex)
+		conv.PrivateKey.Parse(alicePrivateKey)
+
+		_, _, _, toSend, err := conv.Receive([]byte(test.msg))
+		if err != nil {
+			t.Errorf("#%d: unexpected error receiving %q: %s", i, test.msg, err)
+			continue
+		}
+
+		isQuery := len(toSend) == 1 && bytes.HasPrefix(toSend[0], []byte("?OTR:AAIC"))
+		if isQuery != (test.expectedVersion == 2) {
+			t.Errorf("#%d: %q was taken as a query message: %t, expected version %d", i, test.msg, isQuery, test.expectedVersion)
+		}
+	}
+}
+
+func TestPublicKeySerialization(t *testing.T) {
+	var priv PrivateKey
+	alicePrivateKey, _ := hex.DecodeString(alicePrivateKeyHex)
+	priv.Parse(alicePrivateKey)
+
+	serialized := priv.PublicKey.Serialize([]byte{0x01})
+	if serialized[0] != 0x01 {
+		t.Error("the public key was not appended to the given data")
+	}
+
+	var pub PublicKey
+	rest, ok := pub.Parse(serialized[1:])
+	if !ok {
+		t.Fatal("failed to parse public key")
+	}
+	if len(rest) > 0 {
+		t.Error("data remaining after parsing public key")
+	}
+
+	aliceFingerprint, _ := hex.DecodeString(aliceFingerprintHex)
+	if !bytes.Equal(pub.Fingerprint(), aliceFingerprint) {
+		t.Errorf("fingerprint (%x) is not equal to expected value (%x)", pub.Fingerprint(), aliceFingerprint)
+	}
+}
+
 func TestConversation(t *testing.T) {
+	testConversation(t, 0)
+}
+
+func TestConversationWithFragmentation(t *testing.T) {
+	testConversation(t, 100)
+}
+
+func testConversation(t *testing.T, fragmentSize int) {
 	alicePrivateKey, _ := hex.DecodeString(alicePrivateKeyHex)
 	bobPrivateKey, _ := hex.DecodeString(bobPrivateKeyHex)
 
@@ -117,8 +184,8 @@ func TestConversation(t *testing.T) {
 	bob.PrivateKey = new(PrivateKey)
 	alice.PrivateKey.Parse(alicePrivateKey)
 	bob.PrivateKey.Parse(bobPrivateKey)
-	alice.FragmentSize = 100
-	bob.FragmentSize = 100
+	alice.FragmentSize = fragmentSize
+	bob.FragmentSize = fragmentSize
 
 	var alicesMessage, bobsMessage [][]byte
 	var out []byte
@@ -181,23 +248,189 @@ func TestConversation(t *testing.T) {
 		t.Error("Bob doesn't believe that the conversation is secure")
 	}
 
-	var testMessage = []byte("hello Bob")
-	alicesMessage, err = alice.Send(testMessage)
-	for i, msg := range alicesMessage {
-		out, encrypted, _, _, err := bob.Receive(msg)
+	var testMessages = [][]byte{
+		[]byte("hello"), []byte("bye"),
+	}
+
+	for j, testMessage := range testMessages {
+		alicesMessage, err = alice.Send(testMessage)
 		if err != nil {
-			t.Errorf("Error generated while processing test message: %s", err.Error())
+			t.Fatalf("Error generated while sending test message: %s", err.Error())
+		}
+		if fragmentSize > 0 && len(alicesMessage) < 2 {
+			t.Errorf("Test message %d was not fragmented", j)
 		}
-		if len(out) > 0 {
-			if i != len(alicesMessage)-1 {
-				t.Fatal("Bob produced a message while processing a fragment of Alice's")
+
+		for i, msg := range alicesMessage {
+			out, encrypted, _, _, err := bob.Receive(msg)
+			if err != nil {
+				t.Errorf("Error generated while processing test message: %s", err.Error())
 			}
-			if !encrypted {
-				t.Errorf("Message was not marked as encrypted")
+			if len(out) > 0 {
+				if i != len(alicesMessage)-1 {
+					t.Fatal("Bob produced a message while processing a fragment of Alice's")
+				}
+				if !encrypted {
+					t.Errorf("Message was not marked as encrypted")
+				}
+				if !bytes.Equal(out, testMessage) {
+					t.Errorf("Message corrupted: got %x, want %x", out, testMessage)
+				}
 			}
-			if !bytes.Equal(out, testMessage) {
-				t.Errorf("Message corrupted: got %x, want %x", out, testMessage)
+		}
+
+		if j == 0 {
+			// Bob answers, so Alice gets a new key of his and has to use it for the next message
+			bobsMessage, err = bob.Send(testMessage)
+			if err != nil {
+				t.Fatalf("Error generated while sending test message: %s", err.Error())
+			}
+			for _, msg := range bobsMessage {
+				if _, _, _, _, err = alice.Receive(msg); err != nil {
+					t.Errorf("Error generated while processing test message: %s", err.Error())
+				}
 			}
 		}
 	}
 }
+
+func TestParseLibOTRPrivateKeySetsThePublicKey(t *testing.T) {
+	var priv PrivateKey
+
+	if !priv.Import([]byte(libOTRPrivateKey)) {
+		t.Fatalf("Failed to import sample private key")
+	}
+
+	if !bytes.Equal(priv.Fingerprint(), priv.PrivateKey.PublicKey.DefaultFingerprint()) {
+		t.Error("expected the compat public key to be the imported one")
+	}
+}
+
+func TestSignVerifyThroughThePrivateKey(t *testing.T) {
+	var priv PrivateKey
+	alicePrivateKey, _ := hex.DecodeString(alicePrivateKeyHex)
+	priv.Parse(alicePrivateKey)
+
+	var msg [20]byte
+	sig := priv.Sign(rand.Reader, msg[:])
+	if _, ok := priv.Verify(msg[:], sig); !ok {
+		t.Errorf("signature (%x) of %x failed to verify", sig, msg[:])
+	}
+}
+
+func TestSignPanicsWhenItFails(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected Sign to panic")
+		}
+	}()
+
+	var priv PrivateKey
+	alicePrivateKey, _ := hex.DecodeString(alicePrivateKeyHex)
+	priv.Parse(alicePrivateKey)
+	// A private value of zero is not a valid key, so nothing can be signed with it
+	priv.PrivateKey.PrivateKey.X = new(big.Int)
+	priv.Sign(rand.Reader, make([]byte, 20))
+}
+
+func TestGenerateContextReturnsErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var priv PrivateKey
+	if err := priv.GenerateContext(ctx, rand.Reader, nil); err != context.Canceled {
+		t.Errorf("expected the generation to be cancelled, got %v", err)
+	}
+}
+
+func TestGenerateContextSetsThePublicKey(t *testing.T) {
+	var params PrivateKey
+	alicePrivateKey, _ := hex.DecodeString(alicePrivateKeyHex)
+	params.Parse(alicePrivateKey)
+
+	var priv PrivateKey
+	opts := &otr3.GenerateOptions{Parameters: &params.PrivateKey.PrivateKey.Parameters}
+	if err := priv.GenerateContext(context.Background(), rand.Reader, opts); err != nil {
+		t.Fatalf("failed to generate a key: %s", err)
+	}
+
+	if !bytes.Equal(priv.PublicKey.Fingerprint(), priv.PrivateKey.PublicKey.DefaultFingerprint()) {
+		t.Error("expected the compat public key to be the generated one")
+	}
+}
+
+// authenticate runs an authentication that alice starts with aliceSecret to the end, with bob answering with
+// bobSecret, and returns the changes that every Receive of alice and bob returned
+func authenticate(t *testing.T, alice, bob *Conversation, aliceSecret, bobSecret []byte) (aliceChanges, bobChanges []SecurityChange) {
+	const question = "the name of our cat?"
+
+	toBob, err := alice.Authenticate(question, aliceSecret)
+	if err != nil {
+		t.Fatalf("failed to start authentication: %s", err)
+	}
+
+	for len(toBob) > 0 {
+		var toAlice [][]byte
+		for _, msg := range toBob {
+			_, _, change, toSend, err := bob.Receive(msg)
+			if err != nil {
+				t.Fatalf("Bob returned an error while receiving %s: %s", msg, err)
+			}
+			bobChanges = append(bobChanges, change)
+			toAlice = append(toAlice, toSend...)
+
+			if change == SMPSecretNeeded {
+				if q := bob.SMPQuestion(); q != question {
+					t.Errorf("expected the question %q, got %q", question, q)
+				}
+				if toSend, err = bob.Authenticate("", bobSecret); err != nil {
+					t.Fatalf("failed to provide the secret: %s", err)
+				}
+				toAlice = append(toAlice, toSend...)
+			}
+		}
+
+		toBob = nil
+		for _, msg := range toAlice {
+			_, _, change, toSend, err := alice.Receive(msg)
+			if err != nil {
+				t.Fatalf("Alice returned an error while receiving %s: %s", msg, err)
+			}
+			aliceChanges = append(aliceChanges, change)
+			toBob = append(toBob, toSend...)
+		}
+	}
+	return
+}
+
+func TestAuthenticationWithTheSameSecretCompletes(t *testing.T) {
+	alice, bob := newEncryptedConversations(t)
+
+	aliceChanges, bobChanges := authenticate(t, alice, bob, []byte("tom"), []byte("tom"))
+
+	if !reflect.DeepEqual(bobChanges, []SecurityChange{SMPSecretNeeded, SMPComplete}) {
+		t.Errorf("unexpected changes for Bob: %v", bobChanges)
+	}
+	if !reflect.DeepEqual(aliceChanges, []SecurityChange{NoChange, SMPComplete}) {
+		t.Errorf("unexpected changes for Alice: %v", aliceChanges)
+	}
+	if !alice.IsEncrypted() || !bob.IsEncrypted() {
+		t.Error("expected the conversation to stay encrypted")
+	}
+}
+
+func TestAuthenticationWithDifferentSecretsFails(t *testing.T) {
+	alice, bob := newEncryptedConversations(t)
+
+	aliceChanges, bobChanges := authenticate(t, alice, bob, []byte("tom"), []byte("felix"))
+
+	if !reflect.DeepEqual(bobChanges, []SecurityChange{SMPSecretNeeded, SMPFailed}) {
+		t.Errorf("unexpected changes for Bob: %v", bobChanges)
+	}
+	if !reflect.DeepEqual(aliceChanges, []SecurityChange{NoChange, SMPFailed}) {
+		t.Errorf("unexpected changes for Alice: %v", aliceChanges)
+	}
+	if !alice.IsEncrypted() || !bob.IsEncrypted() {
+		t.Error("expected the conversation to stay encrypted")
+	}
+}
@@ -1,6 +1,9 @@
 package otr3
 
-import "io"
+import (
+	"io"
+	"time"
+)
 
 type msgState int
 
@@ -29,11 +32,14 @@ type Conversation struct {
 	theirInstanceTag uint32
 
 	ssid     [8]byte
-	ourKey   *PrivateKey
+	ourKey   Signer
 	theirKey *PublicKey
 
+	keyProvider        KeyProvider
+	pinnedFingerprints [][]byte
+
 	ake        *ake
-	smp        smp
+	smp        smpContext
 	keys       keyManagementContext
 	Policies   policies
 	heartbeat  heartbeatContext
@@ -48,6 +54,9 @@ type Conversation struct {
 	messageEventHandler  MessageEventHandler
 	securityEventHandler SecurityEventHandler
 	receivedKeyHandler   ReceivedKeyHandler
+	keyTransitionHandler KeyTransitionHandler
+
+	clock func() time.Time
 
 	debug         bool
 	sentRevealSig bool
@@ -90,10 +99,12 @@ func (c *Conversation) IsEncrypted() bool {
 
 // End ends a secure conversation by generating a termination message for
 // the peer and switches to unencrypted communication.
+// The keys of the conversation, and of an AKE that hasn't finished, are wiped and their locked memory is released.
+// A Conversation that is dropped without End has that memory released by the garbage collector instead.
 func (c *Conversation) End() (toSend []ValidMessage, err error) {
 	previousMsgState := c.msgState
 	if c.msgState == encrypted {
-		c.smp.wipe()
+		c.smp.Wipe()
 		// Error can only happen when Rand reader is broken
 		toSend, _, err = c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{tlv{tlvType: tlvTypeDisconnected}})
 	}
@@ -103,11 +114,20 @@ func (c *Conversation) End() (toSend []ValidMessage, err error) {
 	c.keys.ourCurrentDHKeys.wipe()
 	c.keys.ourPreviousDHKeys.wipe()
 	wipeBigInt(c.keys.theirCurrentDHPubKey)
+
+	// An AKE that hasn't finished is abandoned, and its keys released
+	c.ake.wipe(true)
+	c.ake = nil
 	return
 }
 
-// SetKeys assigns ourKey (private) and theirKey (public) to the Conversation
-func (c *Conversation) SetKeys(ourKey *PrivateKey, theirKey *PublicKey) {
+// SetKeys assigns ourKey (private) and theirKey (public) to the Conversation.
+// ourKey is usually a *PrivateKey, but any Signer can be used, for example one that asks another process to sign.
+// theirKey is replaced by the key the peer presents in the next AKE. Use PinKeys to refuse any other key.
+func (c *Conversation) SetKeys(ourKey Signer, theirKey *PublicKey) {
+	if priv, ok := ourKey.(*PrivateKey); ok && priv == nil {
+		ourKey = nil
+	}
 	c.ourKey = ourKey
 	c.theirKey = theirKey
 }
@@ -4,6 +4,8 @@ import (
 	"crypto/rand"
 	"math/big"
 	"testing"
+
+	"github.com/twstrike/otr3/internal/securemem"
 )
 
 func Test_receive_OTRQueryMsgRepliesWithDHCommitMessage(t *testing.T) {
@@ -302,23 +304,14 @@ func Test_End_whenStateIsEncrypted(t *testing.T) {
 func Test_End_wipesSMPStateWhenGoingFromEncrypted(t *testing.T) {
 	c := bobContextAfterAKE()
 	c.msgState = encrypted
-	c.smp.state = smpStateExpect2{}
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
-	c.smp.s1 = fixtureSmp1()
-	c.smp.s2 = fixtureSmp2()
-	c.smp.s3 = fixtureSmp3()
-	q := "Hello"
-	c.smp.question = &q
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusExpect3)
 
 	_, e := c.End()
 
 	assertNil(t, e)
-	assertNil(t, c.smp.state)
-	assertNil(t, c.smp.question)
-	assertNil(t, c.smp.secret)
-	assertNil(t, c.smp.s1)
-	assertNil(t, c.smp.s2)
-	assertNil(t, c.smp.s3)
+	_, ok := c.SMPQuestion()
+	assertEquals(t, c.SMPStatus(), SMPStatusExpect1)
+	assertEquals(t, ok, false)
 }
 
 func Test_End_whenStateIsEncrypted_willSignalSecurityEvent(t *testing.T) {
@@ -360,6 +353,25 @@ func Test_End_wipesKeys(t *testing.T) {
 	assertDeepEquals(t, eq(bob.keys.theirCurrentDHPubKey, big.NewInt(0)), true)
 }
 
+func Test_End_releasesTheKeysOfAnAKEThatHasntFinished(t *testing.T) {
+	alice := &Conversation{Rand: rand.Reader, Policies: policies(allowV3)}
+	alice.SetKeys(alicePrivateKey, nil)
+	bob := &Conversation{Rand: rand.Reader, Policies: policies(allowV3)}
+	bob.SetKeys(bobPrivateKey, nil)
+	before := collectGarbage()
+
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	_, dhKey, _ := alice.Receive(dhCommit[0])
+	bob.Receive(dhKey[0])
+	// The keys of the AKE, and our D-H keys for the session it is going to start
+	assertEquals(t, securemem.Live(), before+2)
+
+	bob.End()
+
+	assertNil(t, bob.ake)
+	assertEquals(t, collectGarbage(), before)
+}
+
 func Test_receive_canDecodeOTRMessagesWithoutFragments(t *testing.T) {
 	c := newConversation(otrV2{}, rand.Reader)
 	c.Policies.add(allowV2)
@@ -456,3 +468,11 @@ func Test_Conversation_SetSecurityEventHandler_setsSecurityEventHandler(t *testi
 	c.SetSecurityEventHandler(ev)
 	assertDeepEquals(t, c.securityEventHandler, ev)
 }
+
+func Test_SetKeys_treatsANilPrivateKeyAsNoKey(t *testing.T) {
+	c := &Conversation{}
+	var key *PrivateKey
+	c.SetKeys(key, nil)
+
+	assertEquals(t, c.ourKey == nil, true)
+}
@@ -19,6 +19,7 @@ func (c *Conversation) genDataMsgWithFlag(message []byte, flag byte, tlvs ...tlv
 	if err != nil {
 		return dataMsg{}, dataMessageExtra{}, err
 	}
+	defer keys.wipe()
 
 	topHalfCtr := [8]byte{}
 	counter := c.keys.counterHistory.findCounterFor(c.keys.ourKeyID-1, c.keys.theirKeyID)
@@ -55,7 +56,7 @@ func (c *Conversation) genDataMsgWithFlag(message []byte, flag byte, tlvs ...tlv
 	c.updateMayRetransmitTo(noRetransmit)
 	c.lastMessage(message)
 
-	x := dataMessageExtra{keys.extraKey[:]}
+	x := dataMessageExtra{makeCopy(keys.extraKey[:])}
 
 	return dataMessage, x, nil
 }
@@ -122,6 +123,7 @@ func (c *Conversation) processDataMessageWithRawErrors(header, msg []byte) (plai
 	if err != nil {
 		return
 	}
+	defer sessionKeys.wipe()
 
 	if err = dataMessage.checkSign(sessionKeys.receivingMACKey, header); err != nil {
 		return
@@ -144,7 +146,7 @@ func (c *Conversation) processDataMessageWithRawErrors(header, msg []byte) (plai
 
 	var tlvs []tlv
 
-	tlvs, err = c.processTLVs(p.tlvs, dataMessageExtra{sessionKeys.extraKey[:]})
+	tlvs, err = c.processTLVs(p.tlvs, dataMessageExtra{makeCopy(sessionKeys.extraKey[:])})
 	if err != nil {
 		return
 	}
@@ -177,14 +179,16 @@ func decideFlagFrom(tlvs []tlv) byte {
 }
 
 func (c *Conversation) processSMPTLV(t tlv, x dataMessageExtra) (toSend *tlv, err error) {
-	c.smp.ensureSMP()
-
-	smpMessage, ok := t.smpMessage()
-	if !ok {
-		return nil, newOtrError("corrupt data message")
+	if t.tlvType == tlvTypeSMP1 || t.tlvType == tlvTypeSMP1WithQuestion {
+		c.smp.receivedSMP1()
 	}
 
-	return c.receiveSMP(smpMessage)
+	c.updateLastSMPActivity()
+	if c.smp.async != nil {
+		c.receiveSMPAsync(t)
+		return nil, nil
+	}
+	return c.receiveSMP(t)
 }
 
 func (c *Conversation) processTLVs(tlvs []tlv, x dataMessageExtra) ([]tlv, error) {
@@ -9,9 +9,9 @@ import (
 func Test_processTLVs_ignoresInvalidTLVMessageTypes(t *testing.T) {
 	var nilT []tlv
 	tlvs := []tlv{
-		fixtureMessage1().tlv(),
+		fixtureSMPVector(t).tlv(0),
 		tlv{
-			tlvType:   9,
+			tlvType:   99,
 			tlvLength: 1,
 			tlvValue:  []byte{0x01},
 		},
@@ -154,7 +154,6 @@ func Test_processDataMessage_deserializeAndDecryptDataMsg(t *testing.T) {
 	bob.msgState = encrypted
 	bob.Policies.add(allowV3)
 	bob.ourKey = bobPrivateKey
-	bob.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
 	plain := plainDataMsg{
 		message: []byte("hello"),
@@ -174,7 +173,6 @@ func Test_processDataMessage_willGenerateAHeartBeatEventForAnEmptyMessage(t *tes
 	bob := newConversation(otrV3{}, rand.Reader)
 	bob.Policies.add(allowV3)
 	bob.ourKey = bobPrivateKey
-	bob.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
 	plain := plainDataMsg{
 		message: []byte(""),
@@ -196,13 +194,12 @@ func Test_processDataMessage_processSMPMessage(t *testing.T) {
 	bob.Policies.add(allowV3)
 	bob.ourKey = bobPrivateKey
 
-	bob.smp.state = smpStateExpect2{}
-	bob.smp.s1 = fixtureSmp1()
-	bob.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	v := fixtureSMPVector(t)
+	v.moveSMPTo(bob, SMPStatusExpect2)
 
 	plain := plainDataMsg{
 		tlvs: []tlv{
-			fixtureMessage2().tlv(),
+			v.tlv(1),
 		},
 	}
 
@@ -416,20 +413,18 @@ func Test_processDataMessage_ignoresTLVsWhenFailsToRotateKeys(t *testing.T) {
 	bob.ourKey = bobPrivateKey
 
 	// setup state for receiving a SMP message 2
-	bob.smp.state = smpStateExpect2{}
-	bob.smp.s1 = fixtureSmp1()
-	bob.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	v := fixtureSMPVector(t)
+	v.moveSMPTo(bob, SMPStatusExpect2)
 
 	var msg []byte
 	plain := plainDataMsg{}
-	plain.tlvs = append(plain.tlvs, fixtureMessage2().tlv())
+	plain.tlvs = append(plain.tlvs, v.tlv(1))
 	msg, bob.keys = fixtureDataMsg(plain)
 
 	bob.keys.theirKeyID = 1 //forces our key rotation
 	bobCurrentDHKeys := bob.keys.ourCurrentDHKeys
 
 	bob.msgState = encrypted
-	bob.smp.state = smpStateExpect1{}
 	bob.keys.ourKeyID = 1
 	_, toSend, err := bob.receiveDecoded(msg)
 
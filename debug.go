@@ -72,12 +72,11 @@ func (c *Conversation) dumpAKE(w *bufio.Writer) {
 func (c *Conversation) dumpSMP(w *bufio.Writer) {
 	w.WriteString("  SM state:\n")
 
-	if c.smp.state != nil {
-		w.WriteString(fmt.Sprintf("    Next expected: %d (%s)\n", c.smp.state.identity(), c.smp.state.identityString()))
-	}
+	status := c.SMPStatus()
+	w.WriteString(fmt.Sprintf("    Next expected: %d (%s)\n", status.identity(), status.identityString()))
 
 	receivedQ := 0
-	if c.smp.question != nil {
+	if _, ok := c.smp.Question(); ok {
 		receivedQ = 1
 	}
 	w.WriteString(fmt.Sprintf("    Received_Q: %d\n", receivedQ))
@@ -85,44 +84,34 @@ func (c *Conversation) dumpSMP(w *bufio.Writer) {
 	w.Flush()
 }
 
-func (smpStateExpect1) identity() int {
-	return 0
-}
-
-func (smpStateExpect2) identity() int {
-	return 2
-}
-
-func (smpStateExpect3) identity() int {
-	return 3
-}
-
-func (smpStateExpect4) identity() int {
-	return 4
-}
-
-func (smpStateWaitingForSecret) identity() int {
-	return 1
-}
-
-func (smpStateExpect1) identityString() string {
-	return "EXPECT1"
-}
-
-func (smpStateExpect2) identityString() string {
-	return "EXPECT2"
-}
-
-func (smpStateExpect3) identityString() string {
-	return "EXPECT3"
-}
-
-func (smpStateExpect4) identityString() string {
-	return "EXPECT4"
+func (s SMPStatus) identity() int {
+	switch s {
+	case SMPStatusWaitingForSecret:
+		return 1
+	case SMPStatusExpect2:
+		return 2
+	case SMPStatusExpect3:
+		return 3
+	case SMPStatusExpect4:
+		return 4
+	default:
+		return 0
+	}
 }
 
-func (smpStateWaitingForSecret) identityString() string {
-	return "EXPECT1_WQ"
+func (s SMPStatus) identityString() string {
+	switch s {
+	case SMPStatusWaitingForSecret:
+		return "EXPECT1_WQ"
+	case SMPStatusExpect2:
+		return "EXPECT2"
+	case SMPStatusExpect3:
+		return "EXPECT3"
+	case SMPStatusExpect4:
+		return "EXPECT4"
+	default:
+		return "EXPECT1"
+	}
 }
 
 func (authStateNone) identity() int {
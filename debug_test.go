@@ -8,25 +8,19 @@ import (
 
 func Test_dumpSMP_dumpsTheCurrentSMPState(t *testing.T) {
 	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.state = smpStateExpect2{}
-	c.smp.s1 = fixtureSmp1()
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
-	q := "Blarg"
-	c.smp.question = &q
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusWaitingForSecret)
 
 	bt := bytes.NewBuffer(make([]byte, 0, 200))
 	c.dumpSMP(bufio.NewWriter(bt))
 	assertDeepEquals(t, bt.String(), `  SM state:
-    Next expected: 2 (EXPECT2)
+    Next expected: 1 (EXPECT1_WQ)
     Received_Q: 1
 `)
 }
 
 func Test_dumpSMP_dumpsTheCurrentSMPStateWithQuestion(t *testing.T) {
 	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.state = smpStateExpect2{}
-	c.smp.s1 = fixtureSmp1()
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusExpect2)
 
 	bt := bytes.NewBuffer(make([]byte, 0, 200))
 	c.dumpSMP(bufio.NewWriter(bt))
@@ -37,19 +31,19 @@ func Test_dumpSMP_dumpsTheCurrentSMPStateWithQuestion(t *testing.T) {
 }
 
 func Test_identity_isCorrectForAllSMPStates(t *testing.T) {
-	assertEquals(t, smpStateExpect1{}.identity(), 0)
-	assertEquals(t, smpStateWaitingForSecret{}.identity(), 1)
-	assertEquals(t, smpStateExpect2{}.identity(), 2)
-	assertEquals(t, smpStateExpect3{}.identity(), 3)
-	assertEquals(t, smpStateExpect4{}.identity(), 4)
+	assertEquals(t, SMPStatusExpect1.identity(), 0)
+	assertEquals(t, SMPStatusWaitingForSecret.identity(), 1)
+	assertEquals(t, SMPStatusExpect2.identity(), 2)
+	assertEquals(t, SMPStatusExpect3.identity(), 3)
+	assertEquals(t, SMPStatusExpect4.identity(), 4)
 }
 
 func Test_identityString_isCorrectForAllSMPStates(t *testing.T) {
-	assertEquals(t, smpStateExpect1{}.identityString(), "EXPECT1")
-	assertEquals(t, smpStateWaitingForSecret{}.identityString(), "EXPECT1_WQ")
-	assertEquals(t, smpStateExpect2{}.identityString(), "EXPECT2")
-	assertEquals(t, smpStateExpect3{}.identityString(), "EXPECT3")
-	assertEquals(t, smpStateExpect4{}.identityString(), "EXPECT4")
+	assertEquals(t, SMPStatusExpect1.identityString(), "EXPECT1")
+	assertEquals(t, SMPStatusWaitingForSecret.identityString(), "EXPECT1_WQ")
+	assertEquals(t, SMPStatusExpect2.identityString(), "EXPECT2")
+	assertEquals(t, SMPStatusExpect3.identityString(), "EXPECT3")
+	assertEquals(t, SMPStatusExpect4.identityString(), "EXPECT4")
 }
 
 func Test_dumpAKE_dumpsTheCurrentAKEState(t *testing.T) {
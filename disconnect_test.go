@@ -60,20 +60,11 @@ func Test_processDisconnectedTLV_doesntSignalsASecurityEventIfWeAreInFinished(t
 
 func Test_processDisconnectedTLV_wipesSMPState(t *testing.T) {
 	c := &Conversation{}
-	c.smp.state = smpStateExpect2{}
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
-	c.smp.s1 = fixtureSmp1()
-	c.smp.s2 = fixtureSmp2()
-	c.smp.s3 = fixtureSmp3()
-	q := "Hello"
-	c.smp.question = &q
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusExpect3)
 
 	c.processDisconnectedTLV(tlv{}, dataMessageExtra{})
 
-	assertNil(t, c.smp.state)
-	assertNil(t, c.smp.question)
-	assertNil(t, c.smp.secret)
-	assertNil(t, c.smp.s1)
-	assertNil(t, c.smp.s2)
-	assertNil(t, c.smp.s3)
+	_, ok := c.SMPQuestion()
+	assertEquals(t, c.SMPStatus(), SMPStatusExpect1)
+	assertEquals(t, ok, false)
 }
@@ -3,6 +3,7 @@ package otr3
 import "fmt"
 
 var errCantAuthenticateWithoutEncryption = newOtrError("can't authenticate a peer without a secure conversation established")
+var errCorruptDataMessage = newOtrError("corrupt data message")
 var errCorruptEncryptedSignature = newOtrError("corrupt encrypted signature")
 var errEncryptedMessageWithNoSecureChannel = newOtrError("encrypted message received without encrypted session established")
 var errUnexpectedPlainMessage = newOtrError("plain message received when encryption was required")
@@ -19,6 +20,8 @@ var errWrongProtocolVersion = newOtrError("wrong protocol version")
 type OtrError struct {
 	msg      string
 	conflict bool
+	// cause is the error that made this one happen, if any
+	cause error
 }
 
 func newOtrError(s string) error {
@@ -33,10 +36,20 @@ func newOtrErrorf(format string, a ...interface{}) error {
 	return OtrError{msg: fmt.Sprintf(format, a...), conflict: false}
 }
 
+// wrapOtrError returns an error that describes what failed, and still matches cause with errors.Is and errors.As
+func wrapOtrError(s string, cause error) error {
+	return OtrError{msg: s + ": " + cause.Error(), conflict: false, cause: cause}
+}
+
 func (oe OtrError) Error() string {
 	return "otr: " + oe.msg
 }
 
+// Unwrap returns the error that made this one happen, if any
+func (oe OtrError) Unwrap() error {
+	return oe.cause
+}
+
 func firstError(es ...error) error {
 	for _, e := range es {
 		if e != nil {
@@ -149,9 +149,10 @@ func bobContextAtReceiveDHKey() *Conversation {
 	c := bobContextAtAwaitingDHKey()
 	c.ake.theirPublicValue = fixedGY() // stored at receiveDHKey
 
-	copy(c.ake.sigKey.c[:], bytesFromHex("d942cc80b66503414c05e3752d9ba5c4"))
-	copy(c.ake.sigKey.m1[:], bytesFromHex("b6254b8eab0ad98152949454d23c8c9b08e4e9cf423b27edc09b1975a76eb59c"))
-	copy(c.ake.sigKey.m2[:], bytesFromHex("954be27015eeb0455250144d906e83e7d329c49581aea634c4189a3c981184f5"))
+	c.ake.akeKeys = newLockedAKEKeys()
+	copy(c.ake.sigKey().c[:], bytesFromHex("d942cc80b66503414c05e3752d9ba5c4"))
+	copy(c.ake.sigKey().m1[:], bytesFromHex("b6254b8eab0ad98152949454d23c8c9b08e4e9cf423b27edc09b1975a76eb59c"))
+	copy(c.ake.sigKey().m2[:], bytesFromHex("954be27015eeb0455250144d906e83e7d329c49581aea634c4189a3c981184f5"))
 
 	return c
 }
@@ -7,7 +7,7 @@ import (
 
 func Test_conversation_SMPStateMachineStartsAtSmpExpect1(t *testing.T) {
 	c := newConversation(otrV3{}, fixtureRand())
-	assertEquals(t, c.smp.state, smpStateExpect1{})
+	assertEquals(t, c.SMPStatus(), SMPStatusExpect1)
 }
 
 func Test_receive_generatesErrorIfDoesNotHaveASecureChannel(t *testing.T) {
@@ -16,8 +16,7 @@ func Test_receive_generatesErrorIfDoesNotHaveASecureChannel(t *testing.T) {
 	}
 	c := bobContextAfterAKE()
 	c.msgState = encrypted
-	smpMsg := fixtureMessage1()
-	dataMsg, _, _ := c.genDataMsg(nil, smpMsg.tlv())
+	dataMsg, _, _ := c.genDataMsg(nil, fixtureSMPVector(t).tlv(0))
 	m := dataMsg.serialize()
 	m, _ = c.wrapMessageHeader(msgTypeData, m)
 	for _, s := range states {
@@ -35,8 +34,7 @@ func Test_receive_doesntGenerateErrorIfThereIsNoSecureChannelButTheMessageIsIGNO
 	}
 	c := bobContextAfterAKE()
 	c.msgState = encrypted
-	smpMsg := fixtureMessage1()
-	dataMsg, _, _ := c.genDataMsgWithFlag(nil, messageFlagIgnoreUnreadable, smpMsg.tlv())
+	dataMsg, _, _ := c.genDataMsgWithFlag(nil, messageFlagIgnoreUnreadable, fixtureSMPVector(t).tlv(0))
 	m, _ := c.wrapMessageHeader(msgTypeData, dataMsg.serialize())
 
 	for _, s := range states {
@@ -0,0 +1,410 @@
+package otr3
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// The fuzz targets in this file only run their seeds with go test. To really fuzz one of them, run for example
+//
+//	go test -run '^$' -fuzz FuzzReceive
+//
+// or make fuzz to run all of them for a while.
+// The seeds are the messages of the golden transcripts, so the fuzzer starts from real conversations.
+
+// transcriptWire returns every message sent in the golden transcripts
+func transcriptWire(f *testing.F) []ValidMessage {
+	files, err := filepath.Glob(filepath.Join(transcriptsDir, "*.json"))
+	if err != nil || len(files) == 0 {
+		f.Fatalf("no golden transcripts in %s", transcriptsDir)
+	}
+
+	var result []ValidMessage
+	for _, file := range files {
+		var tr transcript
+		if err := json.Unmarshal(readFuzzResource(f, file), &tr); err != nil {
+			f.Fatal(err)
+		}
+		for _, s := range tr.Steps {
+			for _, w := range s.Wire {
+				result = append(result, ValidMessage(w))
+			}
+		}
+	}
+	return result
+}
+
+func readFuzzResource(f *testing.F, path string) []byte {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		f.Fatal(err)
+	}
+	return data
+}
+
+type transcriptMessage struct {
+	msgType byte
+	body    []byte
+}
+
+// transcriptMessages returns the type and the body after the header of every encoded message in the golden
+// transcripts that was not fragmented
+func transcriptMessages(f *testing.F) []transcriptMessage {
+	var result []transcriptMessage
+	for _, w := range transcriptWire(f) {
+		if !bytes.HasPrefix(w, msgMarker) || !bytes.HasSuffix(w, []byte(".")) {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(string(w[len(msgMarker) : len(w)-1]))
+		if err != nil || len(decoded) < messageHeaderPrefix {
+			continue
+		}
+
+		headerLen := messageHeaderPrefix
+		if binary.BigEndian.Uint16(decoded) == (otrV3{}).protocolVersion() {
+			headerLen += 8
+		}
+		result = append(result, transcriptMessage{decoded[2], decoded[headerLen:]})
+	}
+	return result
+}
+
+func transcriptBodies(f *testing.F, msgType byte) [][]byte {
+	var result [][]byte
+	for _, m := range transcriptMessages(f) {
+		if m.msgType == msgType {
+			result = append(result, m.body)
+		}
+	}
+	if len(result) == 0 {
+		f.Fatalf("no messages of type %d in the golden transcripts", msgType)
+	}
+	return result
+}
+
+func FuzzGuessMessageType(f *testing.F) {
+	for _, w := range transcriptWire(f) {
+		f.Add([]byte(w))
+	}
+	f.Add([]byte("?OTR Error:You are wrong"))
+	f.Add([]byte("Hello" + string(whitespaceTagHeader)))
+
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		guess := guessMessageType(msg)
+		if guess != msgGuessNotOTR && guess != msgGuessTaggedPlaintext && !bytes.HasPrefix(msg, []byte("?OTR")) {
+			t.Errorf("%q was taken for an OTR message of type %d", msg, guess)
+		}
+	})
+}
+
+func FuzzParseFragment(f *testing.F) {
+	for _, w := range transcriptWire(f) {
+		if guessMessageType(w) == msgGuessFragment {
+			f.Add(bytes.SplitN(w, fragmentSeparator, 2)[1])
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		resultData, _, _, ok := parseFragment(data)
+		if ok && bytes.Contains(resultData, fragmentSeparator) {
+			t.Errorf("the data of the fragment %q contains a separator", data)
+		}
+	})
+}
+
+func FuzzTLVDeserialize(f *testing.F) {
+	f.Add(tlv{tlvType: tlvTypePadding, tlvLength: 3, tlvValue: []byte{0, 0, 0}}.serialize())
+	f.Add(tlv{tlvType: tlvTypeDisconnected}.serialize())
+	f.Add(tlv{tlvType: tlvTypeSMPAbort}.serialize())
+	f.Add(tlv{tlvType: tlvTypeExtraSymmetricKey, tlvLength: 6, tlvValue: []byte{0, 0, 0, 1, 'a', 'b'}}.serialize())
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var atlv tlv
+		if atlv.deserialize(data) != nil {
+			return
+		}
+		if !bytes.HasPrefix(data, atlv.serialize()) {
+			t.Errorf("%q was deserialized into a different TLV: %#v", data, atlv)
+		}
+	})
+}
+
+func FuzzPlainDataMsgDeserialize(f *testing.F) {
+	f.Add(plainDataMsg{message: []byte("Hello Bob")}.serialize())
+	f.Add(plainDataMsg{tlvs: []tlv{{tlvType: tlvTypeDisconnected}}}.serialize())
+	f.Add(plainDataMsg{
+		message: []byte("with padding"),
+		tlvs:    []tlv{{tlvType: tlvTypePadding, tlvLength: 2, tlvValue: []byte{0, 0}}, {tlvType: tlvTypeSMPAbort}},
+	}.serialize())
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var m plainDataMsg
+		m.deserialize(data)
+	})
+}
+
+func FuzzDataMsgDeserialize(f *testing.F) {
+	for _, body := range transcriptBodies(f, msgTypeData) {
+		f.Add(body)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var m dataMsg
+		if m.deserialize(data) != nil {
+			return
+		}
+
+		var again dataMsg
+		m.serializeUnsignedCache = nil
+		if err := again.deserialize(m.serialize()); err != nil {
+			t.Fatalf("a serialized data message can't be deserialized: %v", err)
+		}
+		again.serializeUnsignedCache = nil
+		assertDeepEquals(t, again, m)
+	})
+}
+
+func FuzzAKEMessageDeserialize(f *testing.F) {
+	for _, msgType := range []byte{msgTypeDHCommit, msgTypeDHKey, msgTypeRevealSig, msgTypeSig} {
+		for _, body := range transcriptBodies(f, msgType) {
+			f.Add(msgType, body)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, msgType byte, data []byte) {
+		var m message
+		switch msgType % 4 {
+		case 0:
+			m = &dhCommit{}
+		case 1:
+			m = &dhKey{}
+		case 2:
+			m = &revealSig{}
+		case 3:
+			m = &sig{}
+		}
+
+		m.deserialize(data)
+	})
+}
+
+func FuzzParseOTRQueryMessage(f *testing.F) {
+	for _, w := range transcriptWire(f) {
+		if isQueryMessage(w) {
+			f.Add([]byte(w))
+		}
+	}
+	f.Add([]byte("?OTR?v23?"))
+	f.Add([]byte("?OTR?"))
+
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		for _, v := range parseOTRQueryMessage(msg) {
+			if v < 0 || v > 9 {
+				t.Errorf("%q was taken for a query of version %d", msg, v)
+			}
+		}
+	})
+}
+
+func FuzzExtractWhitespaceTag(f *testing.F) {
+	var p policies
+	p.AllowV2()
+	p.AllowV3()
+	f.Add([]byte("Hello" + string(genWhitespaceTag(p))))
+	f.Add([]byte(string(whitespaceTagHeader) + "\t\t  \t\t  in the middle"))
+	f.Add([]byte(string(genWhitespaceTag(p)) + string(genWhitespaceTag(p))))
+
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		// Only messages that have a tag are given to extractWhitespaceTag
+		if !bytes.Contains(msg, whitespaceTagHeader) {
+			return
+		}
+
+		plain, versions := extractWhitespaceTag(msg)
+		if len(plain) > len(msg)-len(whitespaceTagHeader) {
+			t.Errorf("the tag of %q wasn't removed", msg)
+		}
+		if versions&^(1<<2|1<<3) != 0 {
+			t.Errorf("%q was taken for a tag with versions %b", msg, versions)
+		}
+	})
+}
+
+func FuzzImportKeys(f *testing.F) {
+	f.Add(readFuzzResource(f, "test_resources/valid_key.asc"))
+	f.Add(readFuzzResource(f, "test_resources/invalid_key.asc"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ImportKeys(bytes.NewReader(data))
+	})
+}
+
+// FuzzReceive gives every message to a conversation that hasn't started yet. FuzzConversation covers the other states.
+func FuzzReceive(f *testing.F) {
+	for _, w := range transcriptWire(f) {
+		f.Add([]byte(w))
+	}
+
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		c := &Conversation{Rand: seededRand("fuzz receive")}
+		c.Policies.AllowV2()
+		c.Policies.AllowV3()
+		c.SetKeys(alicePrivateKey, nil)
+		c.Receive(msg)
+	})
+}
+
+// conversationFuzzer drives two conversations with the operations the fuzzer comes up with
+type conversationFuzzer struct {
+	*transcriptRecorder
+	t      *testing.T
+	sent   int
+	secret map[*transcriptPeer][]string
+}
+
+func newConversationFuzzer(t *testing.T, alicePolicies, bobPolicies byte) *conversationFuzzer {
+	cf := &conversationFuzzer{
+		transcriptRecorder: newTranscriptRecorder("", "fuzz conversation"),
+		t:                  t,
+		secret:             make(map[*transcriptPeer][]string),
+	}
+	cf.alice.conv.Policies = fuzzedPolicies(alicePolicies)
+	cf.bob.conv.Policies = fuzzedPolicies(bobPolicies)
+	return cf
+}
+
+// fuzzedPolicies always allows some version of OTR, since everything is sent in the clear otherwise
+func fuzzedPolicies(b byte) policies {
+	var p policies
+	if b&1 == 1 {
+		p.AllowV2()
+	}
+	if b&2 == 2 || !p.isOTREnabled() {
+		p.AllowV3()
+	}
+	if b&4 == 4 {
+		p.RequireEncryption()
+	}
+	if b&8 == 8 {
+		p.SendWhitespaceTag()
+	}
+	if b&16 == 16 {
+		p.WhitespaceStartAKE()
+	}
+	if b&32 == 32 {
+		p.ErrorStartAKE()
+	}
+	return p
+}
+
+// do runs the operation op for one of the peers. arg is used by the operations that change a message in transit.
+func (cf *conversationFuzzer) do(op, arg byte) {
+	p := cf.alice
+	if op&1 == 1 {
+		p = cf.bob
+	}
+
+	switch (op >> 1) % 10 {
+	case 0:
+		cf.send(p)
+	case 1:
+		if len(p.inbox) > 0 {
+			cf.receive(p)
+		}
+	case 2:
+		cf.deliverAll()
+	case 3:
+		cf.query(p)
+	case 4:
+		cf.end(p)
+	case 5:
+		cf.authenticate(p, "question", "secret")
+	case 6:
+		cf.provideSecret(p, fmt.Sprintf("secret %d", arg%2))
+	case 7:
+		cf.record(p, transcriptStep{}, func(*transcriptStep) ([]ValidMessage, error) {
+			return p.conv.AbortAuthentication()
+		})
+	case 8:
+		if len(p.inbox) > 0 {
+			p.inbox = p.inbox[1:]
+		}
+	case 9:
+		if len(p.inbox) > 0 {
+			corrupted := makeCopy(p.inbox[0])
+			corrupted[int(arg)%len(corrupted)] ^= 1 << (arg % 8)
+			p.inbox[0] = corrupted
+		}
+	}
+}
+
+// deliverAll is like exchange, but gives up when the peers don't stop answering each other
+func (cf *conversationFuzzer) deliverAll() {
+	for i := 0; i < 100 && (len(cf.alice.inbox) > 0 || len(cf.bob.inbox) > 0); i++ {
+		if len(cf.bob.inbox) > 0 {
+			cf.receive(cf.bob)
+		}
+		if len(cf.alice.inbox) > 0 {
+			cf.receive(cf.alice)
+		}
+	}
+}
+
+func (cf *conversationFuzzer) send(p *transcriptPeer) {
+	cf.sent++
+	text := fmt.Sprintf("fuzzed message %d from %s", cf.sent, p.name)
+	if p.conv.Policies.has(requireEncryption) {
+		cf.secret[p] = append(cf.secret[p], text)
+	}
+	cf.transcriptRecorder.send(p, text)
+}
+
+// checkNoPlaintextLeaked fails if anything a peer sent has one of the messages it was only allowed to send encrypted
+func (cf *conversationFuzzer) checkNoPlaintextLeaked() {
+	for _, s := range cf.Steps {
+		p := cf.alice
+		if s.Peer == cf.bob.name {
+			p = cf.bob
+		}
+		for _, w := range s.Wire {
+			for _, secret := range cf.secret[p] {
+				if bytes.Contains([]byte(w), []byte(secret)) {
+					cf.t.Fatalf("%s requires encryption but sent %q in the clear: %q", p.name, secret, w)
+				}
+			}
+		}
+	}
+}
+
+// FuzzConversation drives two conversations through any interleaving of sending, receiving, ending and SMP, with
+// messages that get lost or corrupted on the way. It checks that nothing panics, and that a peer that requires
+// encryption never sends a message in the clear.
+func FuzzConversation(f *testing.F) {
+	// alice queries, both exchange, and alice and bob send
+	f.Add(byte(2), byte(2), []byte{6, 0, 4, 0, 0, 0, 1, 0, 4, 0})
+	// alice sends before there is an encrypted conversation, and after bob ends it
+	f.Add(byte(4), byte(0), []byte{0, 0, 4, 0, 9, 0, 4, 0, 0, 0, 4, 0})
+	// SMP with different secrets
+	f.Add(byte(3), byte(3), []byte{6, 0, 4, 0, 10, 0, 3, 0, 13, 1, 4, 0})
+	// a corrupted message in the middle of the AKE
+	f.Add(byte(6), byte(6), []byte{6, 0, 3, 0, 18, 77, 2, 0, 4, 0, 0, 0, 4, 0})
+
+	f.Fuzz(func(t *testing.T, alicePolicies, bobPolicies byte, ops []byte) {
+		if len(ops) > 200 {
+			return
+		}
+
+		cf := newConversationFuzzer(t, alicePolicies, bobPolicies)
+		for i := 0; i+1 < len(ops); i += 2 {
+			cf.do(ops[i], ops[i+1])
+		}
+		cf.deliverAll()
+		cf.checkNoPlaintextLeaked()
+	})
+}
@@ -0,0 +1,371 @@
+package otr3
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Golden transcripts are complete conversations between alice and bob, with fixed keys and seeded randomness.
+// Replaying them has to produce exactly the same wire messages, plaintexts, events and SSID, so a change to the wire
+// format fails here even when both peers still understand each other. When such a change is intended, run
+//
+//	go test -run Test_goldenTranscripts -update-transcripts
+//
+// and review the diff of test_resources/transcripts.
+var updateTranscripts = flag.Bool("update-transcripts", false, "write the golden transcripts in test_resources/transcripts")
+
+const transcriptsDir = "test_resources/transcripts"
+
+type transcript struct {
+	Description string
+	Seed        string
+	Steps       []transcriptStep
+	SSID        string
+}
+
+// transcriptStep is one thing a peer did, with everything that came out of it.
+// Messages are delivered in the order they were sent, so the messages a peer receives are the Wire of the steps of
+// the other peer.
+type transcriptStep struct {
+	Peer   string
+	Action string
+	Input  string   `json:",omitempty"`
+	Plain  string   `json:",omitempty"`
+	Key    string   `json:",omitempty"`
+	Error  string   `json:",omitempty"`
+	Events []string `json:",omitempty"`
+	Wire   []string `json:",omitempty"`
+}
+
+// seededRand returns an endless stream of bytes that only depends on seed, however it is read
+func seededRand(seed string) io.Reader {
+	key := sha256.Sum256([]byte(seed))
+	block, _ := aes.NewCipher(key[:])
+	return cipher.StreamReader{S: cipher.NewCTR(block, make([]byte, aes.BlockSize)), R: zeroReader{}}
+}
+
+// deterministicKey returns a copy of key whose signatures only depend on what is signed
+func deterministicKey(key *PrivateKey) *PrivateKey {
+	k := &PrivateKey{}
+	k.Parse(key.Serialize())
+	k.Nonces = DeterministicNonces
+	return k
+}
+
+type transcriptPeer struct {
+	name   string
+	conv   *Conversation
+	inbox  []ValidMessage
+	events []string
+	other  *transcriptPeer
+}
+
+func (p *transcriptPeer) HandleSecurityEvent(event SecurityEvent) {
+	p.events = append(p.events, event.String())
+}
+
+func (p *transcriptPeer) HandleSMPEvent(event SMPEvent, progressPercent int, question string) {
+	p.events = append(p.events, fmt.Sprintf("%s %d%% %q", event, progressPercent, question))
+}
+
+func (p *transcriptPeer) HandleMessageEvent(event MessageEvent, message []byte, err error) {
+	ev := event.String()
+	if message != nil {
+		ev += fmt.Sprintf(" %q", message)
+	}
+	if err != nil {
+		ev += " " + err.Error()
+	}
+	p.events = append(p.events, ev)
+}
+
+func (p *transcriptPeer) ReceivedSymmetricKey(usage uint32, usageData []byte, symkey []byte) {
+	p.events = append(p.events, fmt.Sprintf("ReceivedSymmetricKey %d %x %x", usage, usageData, symkey))
+}
+
+type transcriptRecorder struct {
+	transcript
+	alice, bob *transcriptPeer
+}
+
+func newTranscriptRecorder(description, seed string) *transcriptRecorder {
+	r := &transcriptRecorder{transcript: transcript{Description: description, Seed: seed}}
+	r.alice = r.newPeer("alice", deterministicKey(alicePrivateKey))
+	r.bob = r.newPeer("bob", deterministicKey(bobPrivateKey))
+	r.alice.other, r.bob.other = r.bob, r.alice
+	return r
+}
+
+func (r *transcriptRecorder) newPeer(name string, key *PrivateKey) *transcriptPeer {
+	p := &transcriptPeer{name: name, conv: &Conversation{Rand: seededRand(r.Seed + " " + name)}}
+	p.conv.SetKeys(key, nil)
+	p.conv.SetSecurityEventHandler(p)
+	p.conv.SetSMPEventHandler(p)
+	p.conv.SetMessageEventHandler(p)
+	p.conv.receivedKeyHandler = p
+	return p
+}
+
+func (r *transcriptRecorder) policies(f func(p *policies)) {
+	f(&r.alice.conv.Policies)
+	f(&r.bob.conv.Policies)
+}
+
+// record runs action for p, and adds a step with everything it did. action can fill in more of the step.
+func (r *transcriptRecorder) record(p *transcriptPeer, step transcriptStep, action func(step *transcriptStep) ([]ValidMessage, error)) {
+	p.events = nil
+	toSend, err := action(&step)
+
+	step.Peer = p.name
+	step.Events = p.events
+	if err != nil {
+		step.Error = err.Error()
+	}
+	for _, m := range toSend {
+		step.Wire = append(step.Wire, string(m))
+		p.other.inbox = append(p.other.inbox, m)
+	}
+
+	r.Steps = append(r.Steps, step)
+}
+
+func (r *transcriptRecorder) query(p *transcriptPeer) {
+	r.record(p, transcriptStep{Action: "query"}, func(*transcriptStep) ([]ValidMessage, error) {
+		return []ValidMessage{p.conv.QueryMessage()}, nil
+	})
+}
+
+func (r *transcriptRecorder) send(p *transcriptPeer, text string) {
+	r.record(p, transcriptStep{Action: "send", Input: text}, func(*transcriptStep) ([]ValidMessage, error) {
+		return p.conv.Send(ValidMessage(text))
+	})
+}
+
+func (r *transcriptRecorder) receive(p *transcriptPeer) {
+	msg := p.inbox[0]
+	p.inbox = p.inbox[1:]
+
+	r.record(p, transcriptStep{Action: "receive"}, func(step *transcriptStep) ([]ValidMessage, error) {
+		plain, toSend, err := p.conv.Receive(msg)
+		step.Plain = string(plain)
+		return toSend, err
+	})
+}
+
+// exchange delivers every message, until both peers have nothing more to say
+func (r *transcriptRecorder) exchange() {
+	for len(r.alice.inbox) > 0 || len(r.bob.inbox) > 0 {
+		if len(r.bob.inbox) > 0 {
+			r.receive(r.bob)
+		}
+		if len(r.alice.inbox) > 0 {
+			r.receive(r.alice)
+		}
+	}
+}
+
+func (r *transcriptRecorder) ake() {
+	r.query(r.alice)
+	r.exchange()
+}
+
+func (r *transcriptRecorder) end(p *transcriptPeer) {
+	r.record(p, transcriptStep{Action: "end"}, func(*transcriptStep) ([]ValidMessage, error) {
+		return p.conv.End()
+	})
+}
+
+func (r *transcriptRecorder) authenticate(p *transcriptPeer, question, secret string) {
+	r.record(p, transcriptStep{Action: "authenticate", Input: question}, func(*transcriptStep) ([]ValidMessage, error) {
+		return p.conv.StartAuthenticate(question, []byte(secret))
+	})
+}
+
+func (r *transcriptRecorder) provideSecret(p *transcriptPeer, secret string) {
+	r.record(p, transcriptStep{Action: "provide secret"}, func(*transcriptStep) ([]ValidMessage, error) {
+		return p.conv.ProvideAuthenticationSecret([]byte(secret))
+	})
+}
+
+func (r *transcriptRecorder) extraSymmetricKey(p *transcriptPeer, usage uint32, usageData string) {
+	step := transcriptStep{Action: "extra symmetric key", Input: fmt.Sprintf("%d %x", usage, usageData)}
+	r.record(p, step, func(step *transcriptStep) ([]ValidMessage, error) {
+		key, toSend, err := p.conv.UseExtraSymmetricKey(usage, []byte(usageData))
+		step.Key = hex.EncodeToString(key)
+		return toSend, err
+	})
+}
+
+// heartbeatDue makes p behave as if it hadn't sent anything for longer than the heartbeat interval
+func (r *transcriptRecorder) heartbeatDue(p *transcriptPeer) {
+	r.record(p, transcriptStep{Action: "heartbeat due"}, func(*transcriptStep) ([]ValidMessage, error) {
+		p.conv.heartbeat.lastSent = time.Now().Add(-2 * heartbeatInterval)
+		return nil, nil
+	})
+}
+
+func (r *transcriptRecorder) finish(t *testing.T) transcript {
+	if len(r.alice.inbox) > 0 || len(r.bob.inbox) > 0 {
+		t.Fatalf("the transcript ended with undelivered messages")
+	}
+
+	aliceSSID, bobSSID := r.alice.conv.GetSSID(), r.bob.conv.GetSSID()
+	if aliceSSID != bobSSID {
+		t.Fatalf("alice and bob have different SSIDs: %x and %x", aliceSSID, bobSSID)
+	}
+	r.SSID = hex.EncodeToString(aliceSSID[:])
+
+	return r.transcript
+}
+
+func (r *transcriptRecorder) chat() {
+	r.send(r.alice, "Hello Bob")
+	r.exchange()
+	r.send(r.bob, "Hi Alice, are we private?")
+	r.exchange()
+	r.send(r.alice, "Yes, with new keys every time one of us answers")
+	r.exchange()
+}
+
+var goldenTranscripts = []struct {
+	name        string
+	description string
+	run         func(r *transcriptRecorder)
+}{
+	{"v2_ake", "AKE and messages in both directions with version 2", func(r *transcriptRecorder) {
+		r.policies((*policies).AllowV2)
+		r.ake()
+		r.chat()
+	}},
+	{"v3_ake", "AKE and messages in both directions with version 3", func(r *transcriptRecorder) {
+		r.policies(func(p *policies) { p.AllowV2(); p.AllowV3() })
+		r.ake()
+		r.chat()
+	}},
+	{"simultaneous_ake", "Both peers start the AKE at the same time", func(r *transcriptRecorder) {
+		r.policies((*policies).AllowV3)
+		r.query(r.alice)
+		r.query(r.bob)
+		r.receive(r.alice)
+		r.receive(r.bob)
+		r.exchange()
+		r.chat()
+	}},
+	{"fragmentation", "AKE and messages fragmented in pieces of at most 150 bytes", func(r *transcriptRecorder) {
+		r.policies((*policies).AllowV3)
+		r.alice.conv.SetFragmentSize(150)
+		r.bob.conv.SetFragmentSize(150)
+		r.ake()
+		r.chat()
+	}},
+	{"smp_with_question", "Successful SMP where alice asks a question", func(r *transcriptRecorder) {
+		r.policies((*policies).AllowV3)
+		r.ake()
+		r.authenticate(r.alice, "Where did we meet?", "the library")
+		r.receive(r.bob)
+		r.provideSecret(r.bob, "the library")
+		r.exchange()
+	}},
+	{"smp_without_question", "SMP without a question, where the secrets don't match", func(r *transcriptRecorder) {
+		r.policies((*policies).AllowV3)
+		r.ake()
+		r.authenticate(r.bob, "", "our secret")
+		r.receive(r.alice)
+		r.provideSecret(r.alice, "another secret")
+		r.exchange()
+	}},
+	{"extra_symmetric_key", "alice asks bob to use the extra symmetric key for a file transfer", func(r *transcriptRecorder) {
+		r.policies((*policies).AllowV3)
+		r.ake()
+		r.send(r.bob, "I have the file")
+		r.exchange()
+		r.extraSymmetricKey(r.alice, 1, "file.txt")
+		r.exchange()
+	}},
+	{"heartbeat", "bob answers with a heartbeat when he hasn't sent anything for a while", func(r *transcriptRecorder) {
+		r.policies((*policies).AllowV3)
+		r.ake()
+		r.send(r.alice, "Are you there?")
+		r.exchange()
+		r.send(r.alice, "He just sent a heartbeat, so there is no other one now")
+		r.exchange()
+		r.heartbeatDue(r.bob)
+		r.send(r.alice, "Are you still there?")
+		r.exchange()
+	}},
+	{"disconnect", "alice ends the conversation, and bob can only talk in the clear after ending it too", func(r *transcriptRecorder) {
+		r.policies((*policies).AllowV3)
+		r.ake()
+		r.chat()
+		r.end(r.alice)
+		r.exchange()
+		r.send(r.bob, "Are you still there?")
+		r.end(r.bob)
+		r.send(r.bob, "Are you still there?")
+		r.exchange()
+	}},
+}
+
+func Test_goldenTranscripts(t *testing.T) {
+	for _, g := range goldenTranscripts {
+		g := g
+		t.Run(g.name, func(t *testing.T) {
+			r := newTranscriptRecorder(g.description, "otr3 golden transcript "+g.name)
+			g.run(r)
+			checkTranscript(t, filepath.Join(transcriptsDir, g.name+".json"), r.finish(t))
+		})
+	}
+}
+
+func checkTranscript(t *testing.T, path string, actual transcript) {
+	if *updateTranscripts {
+		data, err := json.MarshalIndent(actual, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("couldn't read the golden transcript, run with -update-transcripts to create it: %s", err)
+	}
+
+	var expected transcript
+	if err := json.Unmarshal(data, &expected); err != nil {
+		t.Fatalf("corrupt golden transcript %s: %s", path, err)
+	}
+
+	if expected.Seed != actual.Seed || expected.Description != actual.Description {
+		t.Fatalf("the transcript is for another scenario: %q with seed %q", expected.Description, expected.Seed)
+	}
+
+	for i := 0; i < len(expected.Steps) || i < len(actual.Steps); i++ {
+		if i >= len(expected.Steps) || i >= len(actual.Steps) {
+			t.Fatalf("the transcript has %d steps, but the replay has %d", len(expected.Steps), len(actual.Steps))
+		}
+
+		e, _ := json.MarshalIndent(expected.Steps[i], "", "  ")
+		a, _ := json.MarshalIndent(actual.Steps[i], "", "  ")
+		if string(e) != string(a) {
+			t.Fatalf("step %d differs from the golden transcript\nexpected: %s\nactual:   %s", i, e, a)
+		}
+	}
+
+	if expected.SSID != actual.SSID {
+		t.Fatalf("expected SSID %s, got %s", expected.SSID, actual.SSID)
+	}
+}
@@ -10,7 +10,7 @@ type heartbeatContext struct {
 }
 
 func (c *Conversation) updateLastSent() {
-	c.heartbeat.lastSent = time.Now()
+	c.heartbeat.lastSent = c.now()
 }
 
 func (c *Conversation) maybeHeartbeat(plain MessagePlaintext, toSend messageWithHeader, err error) (MessagePlaintext, []messageWithHeader, error) {
@@ -26,7 +26,7 @@ func (c *Conversation) potentialHeartbeat(plain MessagePlaintext) (toSend messag
 		return
 	}
 
-	now := time.Now()
+	now := c.now()
 	if !c.heartbeat.lastSent.Before(now.Add(-heartbeatInterval)) {
 		return
 	}
@@ -1,11 +1,16 @@
 package otr3
 
 import (
+	"crypto/rand"
 	"encoding/hex"
 	"io"
 	"math/big"
 	"reflect"
+	"runtime"
 	"testing"
+	"time"
+
+	"github.com/twstrike/otr3/internal/securemem"
 )
 
 func assertEquals(t *testing.T, actual, expected interface{}) {
@@ -110,11 +115,8 @@ func newConversation(v otrVersion, rand io.Reader) *Conversation {
 	akeNotStarted.state = authStateNone{}
 
 	return &Conversation{
-		version: v,
-		Rand:    rand,
-		smp: smp{
-			state: smpStateExpect1{},
-		},
+		version:          v,
+		Rand:             rand,
 		ake:              akeNotStarted,
 		Policies:         policies(p),
 		fragmentSize:     65535, //we are not testing fragmentation by default
@@ -161,6 +163,14 @@ func (c *Conversation) expectSMPEvent(t *testing.T, f func(), expectedEvent SMPE
 	assertEquals(t, called, true)
 }
 
+func (c *Conversation) doesntExpectSMPEvent(t *testing.T, f func()) {
+	c.smpEventHandler = dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		t.Errorf("Didn't expect an SMP event, but got: %v", event)
+	}}
+
+	f()
+}
+
 func (c *Conversation) expectSecurityEvent(t *testing.T, f func(), expectedEvent SecurityEvent) {
 	called := false
 
@@ -181,3 +191,53 @@ func (c *Conversation) doesntExpectSecurityEvent(t *testing.T, f func()) {
 
 	f()
 }
+
+// encryptedConversations returns alice and bob after they have gone through the AKE with each other
+func encryptedConversations(t *testing.T) (alice, bob *Conversation) {
+	return encryptedConversationsWithKeys(t, alicePrivateKey, bobPrivateKey)
+}
+
+func encryptedConversationsWithKeys(t *testing.T, aliceKey, bobKey *PrivateKey) (alice, bob *Conversation) {
+	alice = &Conversation{Rand: rand.Reader}
+	alice.ourKey = aliceKey
+	alice.Policies = policies(allowV3)
+	alice.theirKey = &bobKey.PublicKey
+
+	bob = &Conversation{Rand: rand.Reader}
+	bob.ourKey = bobKey
+	bob.Policies = policies(allowV3)
+	bob.theirKey = &aliceKey.PublicKey
+
+	aliceMessages := []ValidMessage{alice.QueryMessage()}
+	var bobMessages []ValidMessage
+	var err error
+	for len(aliceMessages) > 0 {
+		bobMessages = nil
+		for _, m := range aliceMessages {
+			_, bobMessages, err = bob.Receive(m)
+			assertNil(t, err)
+		}
+
+		aliceMessages = nil
+		for _, m := range bobMessages {
+			_, aliceMessages, err = alice.Receive(m)
+			assertNil(t, err)
+		}
+	}
+
+	return alice, bob
+}
+
+// collectGarbage runs the garbage collector until the finalizers stop releasing locked memory, and returns how much
+// of it is still in use. Tests that count the locked memory in use call it first, so memory dropped by earlier tests
+// isn't released in the middle of the count.
+func collectGarbage() int {
+	for {
+		live := securemem.Live()
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+		if securemem.Live() == live {
+			return live
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Package inspect parses OTR messages into their fields and prints them, like the otr_parse tool of libotr. It
+// reads every message a conversation can receive: plaintexts with or without a whitespace tag, query messages,
+// error messages, fragments of version 2 and 3, and the encoded AKE and data messages.
+//
+// The messages are parsed by otr3.ParseMessage, with the same functions the otr3 package uses for the messages a
+// conversation receives, so a message that inspect can't parse is also rejected by a conversation.
+//
+// Nothing is decrypted. The fields of a data message that are encrypted, like the message itself, are only printed
+// by their length.
+package inspect
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/twstrike/otr3"
+)
+
+// Kind is the kind of an OTR message
+type Kind = otr3.MessageKind
+
+// The kinds of messages that can be received
+const (
+	Plaintext = otr3.MessageKindPlaintext
+	// TaggedPlaintext is a plaintext with a whitespace tag
+	TaggedPlaintext = otr3.MessageKindTaggedPlaintext
+	Query           = otr3.MessageKindQuery
+	Error           = otr3.MessageKindError
+	Fragment        = otr3.MessageKindFragment
+	DHCommit        = otr3.MessageKindDHCommit
+	DHKey           = otr3.MessageKindDHKey
+	RevealSig       = otr3.MessageKindRevealSig
+	Signature       = otr3.MessageKindSignature
+	Data            = otr3.MessageKindData
+	// V1KeyExchange is the key exchange message of version 1, which is not supported
+	V1KeyExchange = otr3.MessageKindV1KeyExchange
+	// Unknown is a message that starts with ?OTR, but is of no known kind
+	Unknown = otr3.MessageKindUnknown
+)
+
+// kindName returns the name otr_parse prints for the kind of message
+func kindName(k Kind) string {
+	switch k {
+	case Plaintext:
+		return "Plaintext"
+	case TaggedPlaintext:
+		return "Tagged plaintext"
+	case Query:
+		return "Query message"
+	case Error:
+		return "Error message"
+	case Fragment:
+		return "Fragment"
+	case DHCommit:
+		return "D-H Commit message"
+	case DHKey:
+		return "D-H Key message"
+	case RevealSig:
+		return "Reveal Signature message"
+	case Signature:
+		return "Signature message"
+	case Data:
+		return "Data message"
+	case V1KeyExchange:
+		return "Version 1 Key Exchange message"
+	default:
+		return "Unknown message"
+	}
+}
+
+// Message is a parsed message. Only the fields of its Kind are set.
+type Message struct {
+	otr3.ParsedMessage
+}
+
+// Parse parses msg with otr3.ParseMessage. When msg is malformed, it returns the error a conversation would fail
+// with, and the fields that could be parsed before the error.
+func Parse(msg []byte) (*Message, error) {
+	m, err := otr3.ParseMessage(msg)
+	return &Message{*m}, err
+}
+
+// String prints the fields of m, one on every line, in the same way as otr_parse
+func (m *Message) String() string {
+	p := &printer{}
+	p.title(kindName(m.Kind))
+
+	switch m.Kind {
+	case Plaintext:
+		p.field("Text", "%q", m.Text)
+	case TaggedPlaintext, Query:
+		p.field("Versions", "%s", versions(m.Versions))
+		p.field("Text", "%q", m.Text)
+	case Error:
+		p.field("Error", "%q", m.Text)
+	}
+
+	if m.Version != 0 {
+		p.field("Version", "%d", m.Version)
+	}
+	if m.Version >= 3 {
+		p.field("Sender instance", "%08x", m.SenderInstanceTag)
+		p.field("Receiver instance", "%08x", m.ReceiverInstanceTag)
+	}
+
+	if f := m.Fragment; f != nil {
+		p.field("Fragment", "%d/%d", f.Index, f.Total)
+		p.field("Piece", "%q", f.Piece)
+	}
+	if c := m.DHCommit; c != nil {
+		p.field("Encrypted Key", "%X", c.EncryptedGx)
+		p.field("Hashed Key", "%X", c.HashedGx)
+	}
+	if k := m.DHKey; k != nil {
+		p.field("D-H Key", "%X", k.Gy)
+	}
+	if r := m.RevealSig; r != nil {
+		p.field("Key", "%X", r.R)
+		p.field("Encrypted Signature", "%X", r.EncryptedSig)
+		p.field("MAC", "%X", r.MAC)
+	}
+	if s := m.Signature; s != nil {
+		p.field("Encrypted Signature", "%X", s.EncryptedSig)
+		p.field("MAC", "%X", s.MAC)
+	}
+	if d := m.Data; d != nil {
+		p.field("Flags", "%02x", d.Flags)
+		p.field("Sender keyid", "%d", d.SenderKeyID)
+		p.field("Rcpt keyid", "%d", d.RecipientKeyID)
+		p.field("D-H y", "%X", d.Y)
+		p.field("Counter", "%X", d.Counter)
+		p.field("Encrypted message", "%d bytes", len(d.EncryptedMessage))
+		p.field("MAC", "%X", d.Authenticator)
+		if len(d.OldMACKeys) == 0 {
+			p.field("Revealed MAC keys", "none")
+		}
+		for _, k := range d.OldMACKeys {
+			p.field("Revealed MAC key", "%X", k)
+		}
+	}
+
+	return p.String()
+}
+
+func versions(vs []int) string {
+	if len(vs) == 0 {
+		return "none"
+	}
+	s := make([]string, len(vs))
+	for i, v := range vs {
+		s[i] = fmt.Sprint(v)
+	}
+	return strings.Join(s, ", ")
+}
+
+type printer struct {
+	strings.Builder
+}
+
+func (p *printer) title(t string) {
+	p.WriteString(t + ":\n")
+}
+
+func (p *printer) field(name, format string, args ...interface{}) {
+	fmt.Fprintf(p, "\t%s: %s\n", name, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,170 @@
+package inspect
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/twstrike/otr3"
+)
+
+const alicePrivateKeyHex = "000000000080c81c2cb2eb729b7e6fd48e975a932c638b3a9055478583afa46755683e30102447f6da2d8bec9f386bbb5da6403b0040fee8650b6ab2d7f32c55ab017ae9b6aec8c324ab5844784e9a80e194830d548fb7f09a0410df2c4d5c8bc2b3e9ad484e65412be689cf0834694e0839fb2954021521ffdffb8f5c32c14dbf2020b3ce7500000014da4591d58def96de61aea7b04a8405fe1609308d000000808ddd5cb0b9d66956e3dea5a915d9aba9d8a6e7053b74dadb2fc52f9fe4e5bcc487d2305485ed95fed026ad93f06ebb8c9e8baf693b7887132c7ffdd3b0f72f4002ff4ed56583ca7c54458f8c068ca3e8a4dfa309d1dd5d34e2a4b68e6f4338835e5e0fb4317c9e4c7e4806dafda3ef459cd563775a586dd91b1319f72621bf3f00000080b8147e74d8c45e6318c37731b8b33b984a795b3653c2cd1d65cc99efe097cb7eb2fa49569bab5aab6e8a1c261a27d0f7840a5e80b317e6683042b59b6dceca2879c6ffc877a465be690c15e4a42f9a7588e79b10faac11b1ce3741fcef7aba8ce05327a2c16d279ee1b3d77eb783fb10e3356caa25635331e26dd42b8396c4d00000001420bec691fea37ecea58a5c717142f0b804452f57"
+
+const bobPrivateKeyHex = "000000000080a5138eb3d3eb9c1d85716faecadb718f87d31aaed1157671d7fee7e488f95e8e0ba60ad449ec732710a7dec5190f7182af2e2f98312d98497221dff160fd68033dd4f3a33b7c078d0d9f66e26847e76ca7447d4bab35486045090572863d9e4454777f24d6706f63e02548dfec2d0a620af37bbc1d24f884708a212c343b480d00000014e9c58f0ea21a5e4dfd9f44b6a9f7f6a9961a8fa9000000803c4d111aebd62d3c50c2889d420a32cdf1e98b70affcc1fcf44d59cca2eb019f6b774ef88153fb9b9615441a5fe25ea2d11b74ce922ca0232bd81b3c0fcac2a95b20cb6e6c0c5c1ace2e26f65dc43c751af0edbb10d669890e8ab6beea91410b8b2187af1a8347627a06ecea7e0f772c28aae9461301e83884860c9b656c722f0000008065af8625a555ea0e008cd04743671a3cda21162e83af045725db2eb2bb52712708dc0cc1a84c08b3649b88a966974bde27d8612c2861792ec9f08786a246fcadd6d8d3a81a32287745f309238f47618c2bd7612cb8b02d940571e0f30b96420bcd462ff542901b46109b1e5ad6423744448d20a57818a8cbb1647d0fea3b664e0000001440f9f2eb554cb00d45a5826b54bfa419b6980e48"
+
+func newConversation(t *testing.T, key string, v3 bool) *otr3.Conversation {
+	data, _ := hex.DecodeString(key)
+	k := &otr3.PrivateKey{}
+	if _, ok := k.Parse(data); !ok {
+		t.Fatal("failed to parse the key")
+	}
+
+	c := &otr3.Conversation{}
+	c.Policies.AllowV2()
+	if v3 {
+		c.Policies.AllowV3()
+	}
+	c.SetKeys(k, nil)
+	return c
+}
+
+// akeMessages returns the messages alice and bob send each other to go encrypted, and a data message from alice
+func akeMessages(t *testing.T, v3 bool) []otr3.ValidMessage {
+	alice, bob := newConversation(t, alicePrivateKeyHex, v3), newConversation(t, bobPrivateKeyHex, v3)
+
+	var all []otr3.ValidMessage
+	toSend := []otr3.ValidMessage{alice.QueryMessage()}
+	from, to := alice, bob
+	for len(toSend) > 0 {
+		var replies []otr3.ValidMessage
+		for _, m := range toSend {
+			all = append(all, m)
+			_, r, err := to.Receive(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			replies = append(replies, r...)
+		}
+		from, to, toSend = to, from, replies
+	}
+
+	data, err := alice.Send(otr3.ValidMessage("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(all, data...)
+}
+
+func parse(t *testing.T, msg string) *Message {
+	m, err := Parse([]byte(msg))
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", msg, err)
+	}
+	return m
+}
+
+func TestParseReadsTheMessagesOfAVersion3AKE(t *testing.T) {
+	var kinds []Kind
+	var tags [][2]uint32
+	var data *Message
+	for _, msg := range akeMessages(t, true)[1:] {
+		m := parse(t, string(msg))
+		kinds = append(kinds, m.Kind)
+		tags = append(tags, [2]uint32{m.SenderInstanceTag, m.ReceiverInstanceTag})
+		if m.Version != 3 {
+			t.Errorf("expected version 3, but got %d", m.Version)
+		}
+		data = m
+	}
+
+	if expected := []Kind{DHCommit, DHKey, RevealSig, Signature, Data}; !reflect.DeepEqual(kinds, expected) {
+		t.Fatalf("expected %v, but got %v", expected, kinds)
+	}
+	alice, bob := tags[0][0], tags[1][0]
+	if alice < 0x100 || bob < 0x100 || tags[1][1] != alice || tags[2] != [2]uint32{alice, bob} || tags[3] != [2]uint32{bob, alice} {
+		t.Errorf("unexpected instance tags %x", tags)
+	}
+
+	d := data.Data
+	if d.SenderKeyID != 1 || d.RecipientKeyID != 1 || d.Y == nil || len(d.Counter) != 8 || len(d.Authenticator) != 20 || len(d.EncryptedMessage) == 0 {
+		t.Errorf("unexpected data message %+v", d)
+	}
+}
+
+func TestParseReadsTheBodiesOfTheAKEMessages(t *testing.T) {
+	messages := akeMessages(t, true)
+
+	commit := parse(t, string(messages[1])).DHCommit
+	if len(commit.HashedGx) != 32 || len(commit.EncryptedGx) == 0 {
+		t.Errorf("unexpected DH commit %+v", commit)
+	}
+	if key := parse(t, string(messages[2])).DHKey; key.Gy == nil || key.Gy.BitLen() < 1000 {
+		t.Errorf("unexpected DH key %+v", key)
+	}
+	if reveal := parse(t, string(messages[3])).RevealSig; len(reveal.R) != 16 || len(reveal.MAC) != 20 || len(reveal.EncryptedSig) == 0 {
+		t.Errorf("unexpected reveal signature %+v", reveal)
+	}
+	if sig := parse(t, string(messages[4])).Signature; len(sig.MAC) != 20 || len(sig.EncryptedSig) == 0 {
+		t.Errorf("unexpected signature %+v", sig)
+	}
+}
+
+func TestParseReadsVersion2MessagesWithoutInstanceTags(t *testing.T) {
+	for _, msg := range akeMessages(t, false)[1:] {
+		m := parse(t, string(msg))
+		if m.Version != 2 || m.SenderInstanceTag != 0 || m.ReceiverInstanceTag != 0 {
+			t.Errorf("unexpected header of %v: version %d, instance tags %x and %x", m.Kind, m.Version, m.SenderInstanceTag, m.ReceiverInstanceTag)
+		}
+	}
+}
+
+func TestParseReadsTheMessagesThatAreNotEncoded(t *testing.T) {
+	cases := []struct {
+		msg      string
+		expected otr3.ParsedMessage
+	}{
+		{"hello", otr3.ParsedMessage{Kind: Plaintext, Text: "hello"}},
+		{"hello \t  \t\t\t\t \t \t \t    \t\t  \t   \t\t  \t\t", otr3.ParsedMessage{Kind: TaggedPlaintext, Text: "hello", Versions: []int{2, 3}}},
+		{"?OTRv23? Bob has requested an Off-the-Record private conversation.", otr3.ParsedMessage{Kind: Query, Text: "Bob has requested an Off-the-Record private conversation.", Versions: []int{2, 3}}},
+		{"?OTR?v2?", otr3.ParsedMessage{Kind: Query, Versions: []int{1, 2}}},
+		{"?OTR Error: You sent encrypted data I can't read", otr3.ParsedMessage{Kind: Error, Text: "You sent encrypted data I can't read"}},
+		{"?OTR|5a73a599|27e31597,00001,00003,?OTR:AAMDJ+MVmSfj,", otr3.ParsedMessage{Kind: Fragment, Version: 3, SenderInstanceTag: 0x5a73a599, ReceiverInstanceTag: 0x27e31597,
+			Fragment: &otr3.ParsedFragment{Index: 1, Total: 3, Piece: "?OTR:AAMDJ+MVmSfj"}}},
+		{"?OTR,00002,00002,AAAA.,", otr3.ParsedMessage{Kind: Fragment, Version: 2, Fragment: &otr3.ParsedFragment{Index: 2, Total: 2, Piece: "AAAA."}}},
+		{"?OTR:AAXX.", otr3.ParsedMessage{Kind: Unknown}},
+	}
+
+	for _, c := range cases {
+		if m := parse(t, c.msg); !reflect.DeepEqual(m.ParsedMessage, c.expected) {
+			t.Errorf("expected %+v for %q, but got %+v", c.expected, c.msg, m.ParsedMessage)
+		}
+	}
+}
+
+func TestParseReturnsTheErrorsOfMalformedMessages(t *testing.T) {
+	for _, msg := range []string{
+		"?OTR:AAMC",
+		"?OTR:AAMC!!!.",
+		"?OTR:AAMCAAAB.",
+		"?OTR|5a73a599|27e31597,00004,00003,piece,",
+		"?OTR,00001,00002,piece",
+		"?OTR:AAEK.",
+	} {
+		if _, err := Parse([]byte(msg)); err == nil {
+			t.Errorf("expected %q to fail", msg)
+		}
+	}
+}
+
+func TestStringPrintsTheFieldsOfADataMessage(t *testing.T) {
+	messages := akeMessages(t, true)
+
+	s := parse(t, string(messages[len(messages)-1])).String()
+
+	for _, expected := range []string{"Data message:\n", "\tVersion: 3\n", "\tSender keyid: 1\n", "\tRcpt keyid: 1\n", "\tD-H y: ", "\tCounter: 0000000000000001\n", "\tEncrypted message: ", "\tMAC: ", "\tRevealed MAC keys: none\n"} {
+		if !strings.Contains(s, expected) {
+			t.Errorf("expected %q in\n%s", expected, s)
+		}
+	}
+}
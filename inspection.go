@@ -0,0 +1,309 @@
+package otr3
+
+import (
+	"bytes"
+	"math/big"
+	"strconv"
+)
+
+// MessageKind is the kind of a message that ParseMessage found
+type MessageKind int
+
+const (
+	// MessageKindPlaintext is a plaintext without a whitespace tag
+	MessageKindPlaintext MessageKind = iota
+	// MessageKindTaggedPlaintext is a plaintext with a whitespace tag
+	MessageKindTaggedPlaintext
+	// MessageKindQuery is a query message
+	MessageKindQuery
+	// MessageKindError is an error message
+	MessageKindError
+	// MessageKindFragment is a fragment of version 2 or 3
+	MessageKindFragment
+	// MessageKindDHCommit is a D-H Commit message
+	MessageKindDHCommit
+	// MessageKindDHKey is a D-H Key message
+	MessageKindDHKey
+	// MessageKindRevealSig is a Reveal Signature message
+	MessageKindRevealSig
+	// MessageKindSignature is a Signature message
+	MessageKindSignature
+	// MessageKindData is a data message
+	MessageKindData
+	// MessageKindV1KeyExchange is the key exchange message of version 1, which is not supported
+	MessageKindV1KeyExchange
+	// MessageKindUnknown is a message that starts with ?OTR, but is of no known kind
+	MessageKindUnknown
+)
+
+// String returns the string representation of the MessageKind
+func (k MessageKind) String() string {
+	switch k {
+	case MessageKindPlaintext:
+		return "MessageKindPlaintext"
+	case MessageKindTaggedPlaintext:
+		return "MessageKindTaggedPlaintext"
+	case MessageKindQuery:
+		return "MessageKindQuery"
+	case MessageKindError:
+		return "MessageKindError"
+	case MessageKindFragment:
+		return "MessageKindFragment"
+	case MessageKindDHCommit:
+		return "MessageKindDHCommit"
+	case MessageKindDHKey:
+		return "MessageKindDHKey"
+	case MessageKindRevealSig:
+		return "MessageKindRevealSig"
+	case MessageKindSignature:
+		return "MessageKindSignature"
+	case MessageKindData:
+		return "MessageKindData"
+	case MessageKindV1KeyExchange:
+		return "MessageKindV1KeyExchange"
+	case MessageKindUnknown:
+		return "MessageKindUnknown"
+	default:
+		return "MESSAGE KIND: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
+
+// ParsedMessage holds the fields of a message that ParseMessage found. Only the fields of its Kind are set.
+type ParsedMessage struct {
+	Kind MessageKind
+	// Text is the plaintext, without the whitespace tag, the text after the versions of a query message, or the
+	// text of an error message
+	Text string
+	// Versions are the protocol versions offered by a query message or a whitespace tag
+	Versions []int
+	// Version is the protocol version of a fragment, an AKE message or a data message. The instance tags are only
+	// set for version 3.
+	Version                                uint16
+	SenderInstanceTag, ReceiverInstanceTag uint32
+
+	Fragment  *ParsedFragment
+	DHCommit  *ParsedDHCommit
+	DHKey     *ParsedDHKey
+	RevealSig *ParsedRevealSig
+	Signature *ParsedSignature
+	Data      *ParsedData
+}
+
+// ParsedFragment is a fragment of a message
+type ParsedFragment struct {
+	// Index is the number of the fragment, starting at 1, of Total
+	Index, Total int
+	// Piece is the part of the message in the fragment
+	Piece string
+}
+
+// ParsedDHCommit is the body of a D-H Commit message
+type ParsedDHCommit struct {
+	// EncryptedGx is the encrypted g^x of the sender, and HashedGx its SHA-256 hash
+	EncryptedGx, HashedGx []byte
+}
+
+// ParsedDHKey is the body of a D-H Key message
+type ParsedDHKey struct {
+	Gy *big.Int
+}
+
+// ParsedRevealSig is the body of a Reveal Signature message
+type ParsedRevealSig struct {
+	// R is the key that decrypts the g^x of the D-H Commit message
+	R, EncryptedSig, MAC []byte
+}
+
+// ParsedSignature is the body of a Signature message
+type ParsedSignature struct {
+	EncryptedSig, MAC []byte
+}
+
+// ParsedData is the body of a data message
+type ParsedData struct {
+	Flags                       byte
+	SenderKeyID, RecipientKeyID uint32
+	// Y is the next D-H public key of the sender
+	Y *big.Int
+	// Counter is the top half of the counter of the encryption
+	Counter          []byte
+	EncryptedMessage []byte
+	// Authenticator is the MAC of the message
+	Authenticator []byte
+	// OldMACKeys are the MAC keys the sender doesn't use anymore, revealed so that anybody could have forged the
+	// messages they authenticated
+	OldMACKeys [][]byte
+}
+
+// ParseMessage parses any message that a conversation can receive into its fields, without decrypting anything and
+// without changing the state of a conversation. It uses the same functions that parse the messages a conversation
+// receives, so a message that it can't parse is also rejected by a conversation. When msg is malformed, it returns
+// the error a conversation would fail with, and the fields that could be parsed before the error.
+func ParseMessage(msg []byte) (*ParsedMessage, error) {
+	m := &ParsedMessage{}
+
+	switch guessMessageType(msg) {
+	case msgGuessNotOTR:
+		m.Kind, m.Text = MessageKindPlaintext, string(msg)
+	case msgGuessTaggedPlaintext:
+		plain, versions := extractWhitespaceTag(msg)
+		m.Kind, m.Text, m.Versions = MessageKindTaggedPlaintext, string(plain), versionList(versions)
+	case msgGuessQuery:
+		m.Kind, m.Text, m.Versions = MessageKindQuery, queryText(msg), parseOTRQueryMessage(msg)
+	case msgGuessError:
+		m.Kind, m.Text = MessageKindError, string(bytes.TrimSpace(msg[len(errorMarker):]))
+	case msgGuessFragment:
+		m.Kind = MessageKindFragment
+		return m, parseFragmentFields(m, msg)
+	case msgGuessV1KeyExch:
+		m.Kind = MessageKindV1KeyExchange
+		return m, errUnsupportedOTRVersion
+	case msgGuessUnknown:
+		m.Kind = MessageKindUnknown
+	default:
+		return m, parseEncodedFields(m, msg)
+	}
+
+	return m, nil
+}
+
+// versionList returns the versions set in a bit set of versions, like the one extractWhitespaceTag returns
+func versionList(versions int) []int {
+	var list []int
+	for _, v := range []int{2, 3} {
+		if versions&(1<<uint(v)) != 0 {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// queryText returns the text that follows the versions of a query message, like "?OTRv23? Bob has requested..."
+func queryText(msg []byte) string {
+	rest := msg[len(queryMarker):]
+	if len(rest) > 0 && rest[0] == '?' {
+		rest = rest[1:]
+	}
+	if len(rest) > 0 && rest[0] == 'v' {
+		if end := bytes.IndexByte(rest, '?'); end >= 0 {
+			rest = rest[end+1:]
+		}
+	}
+	return string(bytes.TrimSpace(rest))
+}
+
+// parseFragmentFields parses "?OTR|sender|receiver,k,n,piece," and "?OTR,k,n,piece,"
+func parseFragmentFields(m *ParsedMessage, msg []byte) error {
+	parts := bytes.Split(msg, fragmentSeparator)
+	if len(parts) != 5 || len(parts[4]) != 0 {
+		return errInvalidOTRMessage
+	}
+
+	m.Version = 2
+	if bytes.HasPrefix(msg, otrv3FragmentationPrefix) {
+		tags := bytes.Split(parts[0], fragmentItagsSeparator)
+		if len(tags) != 3 {
+			return errInvalidOTRMessage
+		}
+
+		var err1, err2 error
+		m.Version = 3
+		m.SenderInstanceTag, err1 = parseItag(tags[1])
+		m.ReceiverInstanceTag, err2 = parseItag(tags[2])
+		if err1 != nil || err2 != nil {
+			return errInvalidOTRMessage
+		}
+	}
+
+	index, err1 := strconv.ParseUint(string(parts[1]), 10, 16)
+	total, err2 := strconv.ParseUint(string(parts[2]), 10, 16)
+	if err1 != nil || err2 != nil || fragmentIsInvalid(uint16(index), uint16(total)) {
+		return errInvalidOTRMessage
+	}
+
+	m.Fragment = &ParsedFragment{Index: int(index), Total: int(total), Piece: string(parts[3])}
+	return nil
+}
+
+// parseEncodedFields parses the header and the body of an AKE or data message
+func parseEncodedFields(m *ParsedMessage, msg []byte) error {
+	m.Kind = MessageKindUnknown
+	if !bytes.HasSuffix(msg, []byte(".")) {
+		return errInvalidOTRMessage
+	}
+	decoded, err := b64decode(removeOTRMsgEnvelope(encodedMessage(msg)))
+	if err != nil {
+		return errInvalidOTRMessage
+	}
+
+	body, version, ok := extractShort(decoded)
+	if !ok || len(body) == 0 {
+		return errInvalidOTRMessage
+	}
+	m.Version = version
+	msgType := body[0]
+	body = body[1:]
+
+	switch version {
+	case 2:
+	case 3:
+		var ok1, ok2 bool
+		body, m.SenderInstanceTag, ok1 = extractWord(body)
+		body, m.ReceiverInstanceTag, ok2 = extractWord(body)
+		if !ok1 || !ok2 {
+			return errInvalidOTRMessage
+		}
+	default:
+		return errUnsupportedOTRVersion
+	}
+
+	switch msgType {
+	case msgTypeDHCommit:
+		var c dhCommit
+		m.Kind = MessageKindDHCommit
+		if err := c.deserialize(body); err != nil {
+			return err
+		}
+		m.DHCommit = &ParsedDHCommit{EncryptedGx: c.encryptedGx, HashedGx: c.hashedGx[:]}
+	case msgTypeDHKey:
+		var c dhKey
+		m.Kind = MessageKindDHKey
+		if err := c.deserialize(body); err != nil {
+			return err
+		}
+		m.DHKey = &ParsedDHKey{Gy: c.gy}
+	case msgTypeRevealSig:
+		var c revealSig
+		m.Kind = MessageKindRevealSig
+		if err := c.deserialize(body); err != nil {
+			return err
+		}
+		m.RevealSig = &ParsedRevealSig{R: c.r[:], EncryptedSig: c.encryptedSig, MAC: c.macSig}
+	case msgTypeSig:
+		var c sig
+		m.Kind = MessageKindSignature
+		if err := c.deserialize(body); err != nil {
+			return err
+		}
+		m.Signature = &ParsedSignature{EncryptedSig: c.encryptedSig, MAC: c.macSig}
+	case msgTypeData:
+		var c dataMsg
+		m.Kind = MessageKindData
+		if err := c.deserialize(body); err != nil {
+			return err
+		}
+		m.Data = &ParsedData{
+			Flags:            c.flag,
+			SenderKeyID:      c.senderKeyID,
+			RecipientKeyID:   c.recipientKeyID,
+			Y:                c.y,
+			Counter:          c.topHalfCtr[:],
+			EncryptedMessage: c.encryptedMsg,
+			Authenticator:    c.authenticator[:],
+		}
+		for _, k := range c.oldMACKeys {
+			m.Data.OldMACKeys = append(m.Data.OldMACKeys, makeCopy(k[:]))
+		}
+	}
+	return nil
+}
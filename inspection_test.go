@@ -0,0 +1,37 @@
+package otr3
+
+import "testing"
+
+func Test_versionList_returnsTheVersionsOfTheBitSet(t *testing.T) {
+	assertDeepEquals(t, versionList(1<<2|1<<3), []int{2, 3})
+	assertDeepEquals(t, versionList(1<<3), []int{3})
+	assertNil(t, versionList(0))
+}
+
+func Test_queryText_returnsTheTextAfterTheVersions(t *testing.T) {
+	assertEquals(t, queryText([]byte("?OTRv23? Bob has requested a conversation.")), "Bob has requested a conversation.")
+	assertEquals(t, queryText([]byte("?OTR?v2? hello")), "hello")
+	assertEquals(t, queryText([]byte("?OTR?")), "")
+}
+
+func Test_ParseMessage_returnsAnUnknownMessageWhenTheEncodingIsInvalid(t *testing.T) {
+	m, err := ParseMessage([]byte("?OTR:AAMC."))
+
+	assertEquals(t, err, errInvalidOTRMessage)
+	assertEquals(t, m.Kind, MessageKindUnknown)
+}
+
+func Test_ParseMessage_readsTheOldMACKeysOfADataMessage(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.keys.oldMACKeys = []macKey{{0x01, 0x02}}
+
+	toSend, _, err := c.createSerializedDataMessage([]byte("hello"), messageFlagNormal, []tlv{})
+	assertNil(t, err)
+
+	m, err := ParseMessage(toSend[0])
+
+	assertNil(t, err)
+	assertEquals(t, m.Kind, MessageKindData)
+	assertDeepEquals(t, m.Data.OldMACKeys, [][]byte{append([]byte{0x01, 0x02}, make([]byte, 18)...)})
+}
@@ -0,0 +1,148 @@
+// Package modeltest checks an implementation of a state machine against an executable model of it.
+//
+// A test gives it a generator of random operations and a function that runs a sequence of them on a fresh
+// implementation and a fresh model at the same time, and reports the first time they disagree. Check runs many random
+// sequences, and when one of them fails, shrinks it to a minimal sequence that still fails, so the counterexample is
+// short enough to read.
+//
+// The number of sequences and the seed of the first one can be changed with the -modeltest.sequences and
+// -modeltest.seed flags of go test. A counterexample is reported with the seed that reproduces it.
+package modeltest
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var (
+	sequences = flag.Int("modeltest.sequences", 0, "how many random sequences the model-based tests run, instead of their own number")
+	firstSeed = flag.Int64("modeltest.seed", 1, "the seed of the first random sequence of the model-based tests")
+)
+
+// Op is one operation of a sequence. String describes it in a counterexample.
+type Op fmt.Stringer
+
+// Config describes the operations and the runner of a model-based test
+type Config struct {
+	// Sequences is how many sequences are run, unless the -modeltest.sequences flag says otherwise
+	Sequences int
+	// Length is how many operations every sequence has
+	Length int
+	// Generate returns a random operation
+	Generate func(r *rand.Rand) Op
+	// Run runs ops on a fresh implementation and model, and returns how they disagreed first, if they did.
+	// It has to behave the same way every time it is given the same operations, and has to accept any subsequence
+	// of a generated sequence. It calls cover with the name of every transition of the model it takes.
+	Run func(ops []Op, cover func(transition string)) error
+	// Transitions are the names of the transitions that the sequences are expected to take at least once
+	Transitions []string
+	// Examples are sequences that run before the random ones. They take the transitions that random sequences
+	// rarely get to.
+	Examples [][]Op
+}
+
+// Check runs the random sequences of c, and fails t with a shrunk counterexample if the implementation and the model
+// disagree. If every sequence passes, it fails t if some of c.Transitions were never taken, since the sequences
+// wouldn't be testing them. That check is skipped when fewer sequences than c.Sequences are run.
+func Check(t testing.TB, c Config) {
+	t.Helper()
+
+	n := c.Sequences
+	if *sequences > 0 {
+		n = *sequences
+	}
+
+	covered := map[string]bool{}
+	cover := func(transition string) { covered[transition] = true }
+
+	for i, ops := range c.Examples {
+		if err := c.Run(ops, cover); err != nil {
+			fail(t, fmt.Sprintf("example %d", i+1), err, ops, c.Run)
+			return
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		seed := *firstSeed + int64(i)
+		ops := Generate(c, seed)
+		if err := c.Run(ops, cover); err != nil {
+			fail(t, fmt.Sprintf("the sequence with seed %d, which runs again with -modeltest.seed=%d -modeltest.sequences=1,", seed, seed), err, ops, c.Run)
+			return
+		}
+	}
+
+	if n < c.Sequences {
+		return
+	}
+
+	var missing []string
+	for _, tr := range c.Transitions {
+		if !covered[tr] {
+			missing = append(missing, tr)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		t.Errorf("modeltest: no sequence took the transitions %q", missing)
+	}
+}
+
+// Generate returns the sequence of c for seed
+func Generate(c Config, seed int64) []Op {
+	r := rand.New(rand.NewSource(seed))
+	ops := make([]Op, c.Length)
+	for i := range ops {
+		ops[i] = c.Generate(r)
+	}
+	return ops
+}
+
+// Shrink returns a subsequence of ops that still fails, and its error. No single operation can be removed from it
+// without making it pass. It first tries to remove large chunks of ops, and then smaller and smaller ones.
+func Shrink(ops []Op, run func(ops []Op, cover func(transition string)) error) ([]Op, error) {
+	noCover := func(string) {}
+	err := run(ops, noCover)
+	if err == nil {
+		return ops, nil
+	}
+
+	for size := len(ops) / 2; size > 0; {
+		removed := false
+		for start := 0; start+size <= len(ops); {
+			candidate := append(append([]Op(nil), ops[:start]...), ops[start+size:]...)
+			if candidateErr := run(candidate, noCover); candidateErr != nil {
+				ops, err, removed = candidate, candidateErr, true
+				continue
+			}
+			start += size
+		}
+
+		// Removing an operation can make one that was needed before unnecessary, so the single operations are tried
+		// again until none of them can be removed
+		if size > 1 || !removed {
+			size /= 2
+		}
+	}
+
+	return ops, err
+}
+
+func fail(t testing.TB, name string, err error, ops []Op, run func(ops []Op, cover func(transition string)) error) {
+	t.Helper()
+
+	minimal, minimalErr := Shrink(ops, run)
+	t.Errorf("modeltest: %s failed: %v\nminimal sequence of %d operations, out of %d:\n%s\nwhich fails with: %v",
+		name, err, len(minimal), len(ops), describe(minimal), minimalErr)
+}
+
+func describe(ops []Op) string {
+	lines := make([]string, len(ops))
+	for i, op := range ops {
+		lines[i] = fmt.Sprintf("  %d. %s", i+1, op)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,122 @@
+package modeltest
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+type digit int
+
+func (d digit) String() string { return fmt.Sprintf("digit %d", int(d)) }
+
+func generateDigit(r *rand.Rand) Op {
+	return digit(r.Intn(10))
+}
+
+// failsOnSevenAfterThree fails when a 3 comes before a 7, like a state machine that goes wrong after two particular
+// operations
+func failsOnSevenAfterThree(ops []Op, cover func(string)) error {
+	seenThree := false
+	for _, op := range ops {
+		switch op.(digit) {
+		case 3:
+			cover("three")
+			seenThree = true
+		case 7:
+			cover("seven")
+			if seenThree {
+				return errors.New("a seven after a three")
+			}
+		}
+	}
+	return nil
+}
+
+type fakeT struct {
+	testing.TB
+	failures []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.failures = append(t.failures, fmt.Sprintf(format, args...))
+}
+
+func TestShrinkFindsTheMinimalFailingSequence(t *testing.T) {
+	ops := []Op{digit(1), digit(3), digit(4), digit(3), digit(5), digit(7), digit(7), digit(9)}
+
+	minimal, err := Shrink(ops, failsOnSevenAfterThree)
+
+	if len(minimal) != 2 || minimal[0] != digit(3) || minimal[1] != digit(7) {
+		t.Errorf("expected [3 7], but got %v", minimal)
+	}
+	if err == nil {
+		t.Error("expected the minimal sequence to fail")
+	}
+}
+
+func TestShrinkReturnsAPassingSequenceAsItIs(t *testing.T) {
+	ops := []Op{digit(7), digit(3)}
+
+	minimal, err := Shrink(ops, failsOnSevenAfterThree)
+
+	if len(minimal) != 2 || err != nil {
+		t.Errorf("expected the sequence to be returned as it is, but got %v and %v", minimal, err)
+	}
+}
+
+func TestGenerateReturnsTheSameSequenceForTheSameSeed(t *testing.T) {
+	c := Config{Length: 20, Generate: generateDigit}
+
+	if fmt.Sprint(Generate(c, 42)) != fmt.Sprint(Generate(c, 42)) {
+		t.Error("expected the same sequence for the same seed")
+	}
+}
+
+func TestCheckReportsAShrunkCounterexampleWithItsSeed(t *testing.T) {
+	ft := &fakeT{}
+
+	Check(ft, Config{Sequences: 10, Length: 20, Generate: generateDigit, Run: failsOnSevenAfterThree})
+
+	if len(ft.failures) != 1 {
+		t.Fatalf("expected one failure, but got %q", ft.failures)
+	}
+	if !strings.Contains(ft.failures[0], "-modeltest.seed=") || !strings.Contains(ft.failures[0], "1. digit 3\n  2. digit 7\n") {
+		t.Errorf("unexpected report %q", ft.failures[0])
+	}
+}
+
+func TestCheckRunsTheExamplesFirst(t *testing.T) {
+	ft := &fakeT{}
+	onlyOnes := func(r *rand.Rand) Op { return digit(1) }
+	example := []Op{digit(3), digit(5), digit(7)}
+
+	Check(ft, Config{Sequences: 10, Length: 5, Generate: onlyOnes, Run: failsOnSevenAfterThree, Examples: [][]Op{example}})
+
+	if len(ft.failures) != 1 || !strings.Contains(ft.failures[0], "example 1 failed") || !strings.Contains(ft.failures[0], "1. digit 3\n  2. digit 7\n") {
+		t.Errorf("expected the example to fail, but got %q", ft.failures)
+	}
+}
+
+func TestCheckReportsTheTransitionsThatWereNeverTaken(t *testing.T) {
+	ft := &fakeT{}
+	onlyOnes := func(r *rand.Rand) Op { return digit(1) }
+
+	Check(ft, Config{Sequences: 10, Length: 5, Generate: onlyOnes, Run: failsOnSevenAfterThree, Transitions: []string{"three", "seven"}})
+
+	if len(ft.failures) != 1 || !strings.Contains(ft.failures[0], `["seven" "three"]`) {
+		t.Errorf("expected the missing transitions to be reported, but got %q", ft.failures)
+	}
+
+	ft = &fakeT{}
+	Check(ft, Config{Sequences: 10, Length: 5, Generate: onlyOnes, Run: failsOnSevenAfterThree, Transitions: []string{"three"},
+		Examples: [][]Op{{digit(3)}}})
+
+	if len(ft.failures) != 0 {
+		t.Errorf("expected the examples to count, but got %q", ft.failures)
+	}
+}
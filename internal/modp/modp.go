@@ -0,0 +1,268 @@
+// Package modp implements constant time arithmetic modulo the 1536-bit prime of RFC 3526 group 5,
+// which OTR uses for Diffie-Hellman and the Socialist Millionaires' Protocol, and modulo the order of its subgroup.
+//
+// Values are kept in a fixed number of 64-bit limbs in the Montgomery domain, and no branch or memory access
+// depends on them. Only the conversions from and to big.Int at the edges can reveal anything, which is the
+// position of the most significant non zero byte of the values, since big.Int doesn't keep leading zeroes.
+package modp
+
+import (
+	"math/big"
+	"math/bits"
+)
+
+const (
+	limbs = 24
+	// Bits is the width of the values handled by this package
+	Bits = limbs * 64
+	// Bytes is the width in bytes of the values handled by this package
+	Bytes = Bits / 8
+
+	windowSize = 4
+)
+
+type nat [limbs]uint64
+
+// Modulus is an odd modulus that fits in Bits bits, with everything needed to do Montgomery arithmetic with it
+type Modulus struct {
+	m     nat
+	m0inv uint64 // -m^-1 mod 2^64
+	rr    nat    // R^2 mod m, where R is 2^Bits
+	one   nat    // R mod m, which is 1 in the Montgomery domain
+	n     *big.Int
+}
+
+var (
+	// P is the prime of RFC 3526 group 5
+	P *Modulus
+	// Q is the order of the subgroup generated by 2 modulo P, (P - 1) / 2
+	Q *Modulus
+)
+
+func init() {
+	p, _ := new(big.Int).SetString(
+		"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1"+
+			"29024E088A67CC74020BBEA63B139B22514A08798E3404DD"+
+			"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245"+
+			"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+			"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D"+
+			"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F"+
+			"83655D23DCA3AD961C62F356208552BB9ED529077096966D"+
+			"670C354E4ABC9804F1746C08CA237327FFFFFFFFFFFFFFFF", 16)
+
+	P = NewModulus(p)
+	Q = NewModulus(new(big.Int).Rsh(p, 1))
+}
+
+// NewModulus prepares m for constant time arithmetic. It panics if m is even, or doesn't fit in Bits bits.
+// m is a public value, so this function is not constant time.
+func NewModulus(m *big.Int) *Modulus {
+	if m.Bit(0) != 1 || m.BitLen() > Bits {
+		panic("modp: the modulus has to be odd and fit in 1536 bits")
+	}
+
+	res := &Modulus{n: new(big.Int).Set(m)}
+	res.m = natFromBig(m)
+
+	// Newton's iteration doubles the number of correct low bits of the inverse every step
+	inv := uint64(1)
+	for i := 0; i < 6; i++ {
+		inv *= 2 - res.m[0]*inv
+	}
+	res.m0inv = -inv
+
+	r := new(big.Int).Lsh(big.NewInt(1), Bits)
+	res.one = natFromBig(new(big.Int).Mod(r, m))
+	res.rr = natFromBig(new(big.Int).Mod(new(big.Int).Mul(r, r), m))
+
+	return res
+}
+
+// Int returns the modulus as a big.Int
+func (m *Modulus) Int() *big.Int {
+	return new(big.Int).Set(m.n)
+}
+
+// Exp returns base^exp mod m. The time it takes doesn't depend on the values of base or exp, as long as
+// both are non negative and fit in Bits bits. Other values are computed by big.Int, which is not constant time.
+func (m *Modulus) Exp(base, exp *big.Int) *big.Int {
+	if !fits(base) || !fits(exp) {
+		return new(big.Int).Exp(base, exp, m.n)
+	}
+
+	var table [1 << windowSize]nat
+	table[0] = m.one
+	table[1] = m.toMontgomery(natFromBig(base))
+	for i := 2; i < len(table); i++ {
+		table[i] = m.montgomeryMul(&table[i-1], &table[1])
+	}
+
+	e := natFromBig(exp)
+	acc := m.one
+	for i := Bits - windowSize; i >= 0; i -= windowSize {
+		for j := 0; j < windowSize; j++ {
+			acc = m.montgomeryMul(&acc, &acc)
+		}
+
+		w := (e[i/64] >> uint(i%64)) & (1<<windowSize - 1)
+		t := lookup(&table, w)
+		acc = m.montgomeryMul(&acc, &t)
+	}
+
+	return m.fromMontgomery(&acc).toBig()
+}
+
+// Mul returns l * r mod m. The time it takes doesn't depend on the values of l or r, as long as both are
+// non negative and fit in Bits bits. Other values are computed by big.Int, which is not constant time.
+func (m *Modulus) Mul(l, r *big.Int) *big.Int {
+	if !fits(l) || !fits(r) {
+		res := new(big.Int).Mul(l, r)
+		return res.Mod(res, m.n)
+	}
+
+	x := m.toMontgomery(natFromBig(l))
+	y := natFromBig(r)
+	// x is l * R, so the Montgomery product with y is l * r without any R
+	res := m.montgomeryMul(&x, &y)
+	return res.toBig()
+}
+
+// Sub returns l - r mod m. The time it takes doesn't depend on the values of l or r, as long as both are
+// non negative and fit in Bits bits. Other values are computed by big.Int, which is not constant time.
+func (m *Modulus) Sub(l, r *big.Int) *big.Int {
+	if !fits(l) || !fits(r) {
+		res := new(big.Int).Sub(l, r)
+		return res.Mod(res, m.n)
+	}
+
+	x := m.reduce(natFromBig(l))
+	y := m.reduce(natFromBig(r))
+
+	var res nat
+	var borrow uint64
+	for i := range res {
+		res[i], borrow = bits.Sub64(x[i], y[i], borrow)
+	}
+
+	// If the subtraction went below zero, m has to be added back
+	mask := -borrow
+	var carry uint64
+	for i := range res {
+		res[i], carry = bits.Add64(res[i], m.m[i]&mask, carry)
+	}
+
+	return res.toBig()
+}
+
+// reduce returns x mod m for any x that fits in Bits bits
+func (m *Modulus) reduce(x nat) nat {
+	mont := m.toMontgomery(x)
+	return m.fromMontgomery(&mont)
+}
+
+func (m *Modulus) toMontgomery(x nat) nat {
+	return m.montgomeryMul(&x, &m.rr)
+}
+
+func (m *Modulus) fromMontgomery(x *nat) nat {
+	one := nat{1}
+	return m.montgomeryMul(x, &one)
+}
+
+// montgomeryMul returns x * y * R^-1 mod m, fully reduced, using the coarsely integrated operand scanning method.
+// x * y has to be less than m * R, which is true when one of them is less than m.
+func (m *Modulus) montgomeryMul(x, y *nat) nat {
+	var t [limbs + 2]uint64
+
+	for i := 0; i < limbs; i++ {
+		var c uint64
+		for j := 0; j < limbs; j++ {
+			t[j], c = mulAddWWW(x[j], y[i], t[j], c)
+		}
+		var c1 uint64
+		t[limbs], c1 = bits.Add64(t[limbs], c, 0)
+		t[limbs+1] = c1
+
+		u := t[0] * m.m0inv
+		_, c = mulAddWWW(u, m.m[0], t[0], 0)
+		for j := 1; j < limbs; j++ {
+			t[j-1], c = mulAddWWW(u, m.m[j], t[j], c)
+		}
+		t[limbs-1], c1 = bits.Add64(t[limbs], c, 0)
+		t[limbs] = t[limbs+1] + c1
+	}
+
+	// t is less than 2m, so subtracting m once, when it isn't negative, reduces it fully
+	var res nat
+	var borrow uint64
+	for i := range res {
+		res[i], borrow = bits.Sub64(t[i], m.m[i], borrow)
+	}
+	_, borrow = bits.Sub64(t[limbs], 0, borrow)
+
+	mask := -borrow
+	for i := range res {
+		res[i] = t[i]&mask | res[i]&^mask
+	}
+
+	return res
+}
+
+// mulAddWWW returns the low and high words of x * y + a + c, which never overflows two words
+func mulAddWWW(x, y, a, c uint64) (lo, hi uint64) {
+	hi, lo = bits.Mul64(x, y)
+	var carry uint64
+	lo, carry = bits.Add64(lo, a, 0)
+	hi += carry
+	lo, carry = bits.Add64(lo, c, 0)
+	hi += carry
+	return lo, hi
+}
+
+// lookup returns table[w] reading every entry, so the memory access pattern doesn't depend on w
+func lookup(table *[1 << windowSize]nat, w uint64) nat {
+	var res nat
+	for i := range table {
+		mask := ctEq(uint64(i), w)
+		for j := range res {
+			res[j] |= table[i][j] & mask
+		}
+	}
+	return res
+}
+
+// ctEq returns all ones if x == y and zero otherwise, without branching
+func ctEq(x, y uint64) uint64 {
+	d := x ^ y
+	// (d | -d) has its top bit set for every d except zero
+	return ((d | -d) >> 63) - 1
+}
+
+func fits(x *big.Int) bool {
+	return x.Sign() >= 0 && x.BitLen() <= Bits
+}
+
+func natFromBig(x *big.Int) nat {
+	var buf [Bytes]byte
+	x.FillBytes(buf[:])
+
+	var res nat
+	for i := range res {
+		off := Bytes - 8*(i+1)
+		for k := 0; k < 8; k++ {
+			res[i] = res[i]<<8 | uint64(buf[off+k])
+		}
+	}
+	return res
+}
+
+func (x nat) toBig() *big.Int {
+	var buf [Bytes]byte
+	for i := range x {
+		off := Bytes - 8*(i+1)
+		for k := 0; k < 8; k++ {
+			buf[off+k] = byte(x[i] >> uint(56-8*k))
+		}
+	}
+	return new(big.Int).SetBytes(buf[:])
+}
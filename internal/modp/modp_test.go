@@ -0,0 +1,214 @@
+package modp
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+func randomBelow(t testing.TB, n *big.Int) *big.Int {
+	r, err := rand.Int(rand.Reader, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func maxValue() *big.Int {
+	return new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), Bits), big.NewInt(1))
+}
+
+// interestingValues are the values most likely to go wrong at the edges of the limbs and the modulus
+func interestingValues(m *Modulus) []*big.Int {
+	return []*big.Int{
+		big.NewInt(0),
+		big.NewInt(1),
+		big.NewInt(2),
+		new(big.Int).Lsh(big.NewInt(1), 64),
+		new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 64), big.NewInt(1)),
+		new(big.Int).Sub(m.n, big.NewInt(1)),
+		m.Int(),
+		new(big.Int).Add(m.n, big.NewInt(1)),
+		maxValue(),
+	}
+}
+
+func assertSameInt(t *testing.T, op string, actual, expected *big.Int) {
+	if actual.Cmp(expected) != 0 {
+		t.Errorf("%s:\n%X\nexpected to equal:\n%X", op, actual, expected)
+	}
+}
+
+func forBothModuli(f func(name string, m *Modulus)) {
+	f("P", P)
+	f("Q", Q)
+}
+
+func Test_Modulus_Exp_matchesBigInt(t *testing.T) {
+	forBothModuli(func(name string, m *Modulus) {
+		for i := 0; i < 20; i++ {
+			base := randomBelow(t, m.n)
+			exp := randomBelow(t, maxValue())
+			assertSameInt(t, name+" Exp", m.Exp(base, exp), new(big.Int).Exp(base, exp, m.n))
+		}
+	})
+}
+
+func Test_Modulus_Exp_matchesBigIntForInterestingValues(t *testing.T) {
+	forBothModuli(func(name string, m *Modulus) {
+		for _, base := range interestingValues(m) {
+			for _, exp := range interestingValues(m) {
+				assertSameInt(t, name+" Exp", m.Exp(base, exp), new(big.Int).Exp(base, exp, m.n))
+			}
+		}
+	})
+}
+
+func Test_Modulus_Exp_matchesBigIntForShortExponents(t *testing.T) {
+	base := randomBelow(t, P.n)
+	exp := randomBelow(t, new(big.Int).Lsh(big.NewInt(1), 320))
+	assertSameInt(t, "Exp", P.Exp(base, exp), new(big.Int).Exp(base, exp, P.n))
+}
+
+func Test_Modulus_Exp_fallsBackToBigIntForValuesThatDontFit(t *testing.T) {
+	tooBig := new(big.Int).Lsh(big.NewInt(3), Bits)
+	assertSameInt(t, "Exp", P.Exp(tooBig, big.NewInt(3)), new(big.Int).Exp(tooBig, big.NewInt(3), P.n))
+	assertSameInt(t, "Exp", P.Exp(big.NewInt(3), tooBig), new(big.Int).Exp(big.NewInt(3), tooBig, P.n))
+}
+
+func Test_Modulus_Mul_matchesBigInt(t *testing.T) {
+	forBothModuli(func(name string, m *Modulus) {
+		for i := 0; i < 100; i++ {
+			l := randomBelow(t, maxValue())
+			r := randomBelow(t, maxValue())
+			expected := new(big.Int).Mul(l, r)
+			assertSameInt(t, name+" Mul", m.Mul(l, r), expected.Mod(expected, m.n))
+		}
+
+		for _, l := range interestingValues(m) {
+			for _, r := range interestingValues(m) {
+				expected := new(big.Int).Mul(l, r)
+				assertSameInt(t, name+" Mul", m.Mul(l, r), expected.Mod(expected, m.n))
+			}
+		}
+	})
+}
+
+func Test_Modulus_Mul_fallsBackToBigIntForValuesThatDontFit(t *testing.T) {
+	l := new(big.Int).Lsh(big.NewInt(5), Bits)
+	expected := new(big.Int).Mul(l, big.NewInt(7))
+	assertSameInt(t, "Mul", Q.Mul(l, big.NewInt(7)), expected.Mod(expected, Q.n))
+}
+
+func Test_Modulus_Sub_matchesBigInt(t *testing.T) {
+	forBothModuli(func(name string, m *Modulus) {
+		for i := 0; i < 100; i++ {
+			l := randomBelow(t, maxValue())
+			r := randomBelow(t, maxValue())
+			expected := new(big.Int).Sub(l, r)
+			assertSameInt(t, name+" Sub", m.Sub(l, r), expected.Mod(expected, m.n))
+		}
+
+		for _, l := range interestingValues(m) {
+			for _, r := range interestingValues(m) {
+				expected := new(big.Int).Sub(l, r)
+				assertSameInt(t, name+" Sub", m.Sub(l, r), expected.Mod(expected, m.n))
+			}
+		}
+	})
+}
+
+func Test_Modulus_Sub_fallsBackToBigIntForNegativeValues(t *testing.T) {
+	expected := new(big.Int).Mod(big.NewInt(-8), Q.n)
+	assertSameInt(t, "Sub", Q.Sub(big.NewInt(-5), big.NewInt(3)), expected)
+}
+
+func Test_NewModulus_panicsForAnEvenModulus(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+
+	NewModulus(big.NewInt(10))
+}
+
+func Test_NewModulus_panicsForAModulusThatDoesntFit(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+
+	NewModulus(new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), Bits), big.NewInt(1)))
+}
+
+func Test_Q_isHalfOfPMinusOne(t *testing.T) {
+	expected := new(big.Int).Sub(P.n, big.NewInt(1))
+	assertSameInt(t, "Q", Q.Int(), expected.Rsh(expected, 1))
+}
+
+func Test_ctEq_returnsAMask(t *testing.T) {
+	if ctEq(3, 3) != ^uint64(0) || ctEq(3, 4) != 0 || ctEq(0, 1<<63) != 0 {
+		t.Error("ctEq doesn't return the right masks")
+	}
+}
+
+func Test_natFromBig_roundTrips(t *testing.T) {
+	x := randomBelow(t, maxValue())
+	assertSameInt(t, "nat", natFromBig(x).toBig(), x)
+}
+
+func benchmarkValues(b *testing.B) (*big.Int, *big.Int) {
+	return randomBelow(b, P.n), randomBelow(b, Q.n)
+}
+
+func BenchmarkExp(b *testing.B) {
+	base, exp := benchmarkValues(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		P.Exp(base, exp)
+	}
+}
+
+func BenchmarkBigIntExp(b *testing.B) {
+	base, exp := benchmarkValues(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		new(big.Int).Exp(base, exp, P.n)
+	}
+}
+
+func BenchmarkMul(b *testing.B) {
+	l, r := benchmarkValues(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Q.Mul(l, r)
+	}
+}
+
+func BenchmarkBigIntMul(b *testing.B) {
+	l, r := benchmarkValues(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res := new(big.Int).Mul(l, r)
+		res.Mod(res, Q.n)
+	}
+}
+
+func BenchmarkSub(b *testing.B) {
+	l, r := benchmarkValues(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Q.Sub(l, r)
+	}
+}
+
+func BenchmarkBigIntSub(b *testing.B) {
+	l, r := benchmarkValues(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res := new(big.Int).Sub(l, r)
+		res.Mod(res, Q.n)
+	}
+}
@@ -0,0 +1,85 @@
+package securemem
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// poolBufferSize is the size of the Buffers a Pool allocates its slots from
+const poolBufferSize = 4096
+
+// Pool hands out fixed size slots of locked memory, for values that only live for a moment, like the keys of a single
+// message. Allocating a Buffer for each of them would cost several system calls every time. The memory of a Pool is
+// never given back to the operating system, but every slot is wiped when it is put back.
+// A Pool is safe for concurrent use.
+type Pool struct {
+	mu sync.Mutex
+
+	slotSize  int
+	perBuffer int
+	buffers   []*Buffer
+	free      []unsafe.Pointer
+}
+
+// NewPool returns a Pool of slots of size bytes, aligned for any Go type. The slots are allocated when they are
+// first needed.
+func NewPool(size int) *Pool {
+	slotSize := roundUp(size, 8)
+	perBuffer := poolBufferSize / slotSize
+	if perBuffer == 0 {
+		perBuffer = 1
+	}
+
+	return &Pool{slotSize: slotSize, perBuffer: perBuffer}
+}
+
+// Get returns a wiped slot. It has to be given back with Put.
+func (p *Pool) Get() unsafe.Pointer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.free) == 0 {
+		p.grow()
+	}
+
+	last := len(p.free) - 1
+	slot := p.free[last]
+	p.free = p.free[:last]
+	return slot
+}
+
+// Put wipes a slot returned by Get, and makes it available again. It does nothing with a nil slot.
+func (p *Pool) Put(slot unsafe.Pointer) {
+	if slot == nil {
+		return
+	}
+
+	wipe(unsafe.Slice((*byte)(slot), p.slotSize))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.free = append(p.free, slot)
+}
+
+// Locked returns true if all the memory of the Pool is locked
+func (p *Pool) Locked() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, b := range p.buffers {
+		if !b.Locked() {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Pool) grow() {
+	b := New(p.slotSize * p.perBuffer)
+	p.buffers = append(p.buffers, b)
+
+	// The slots are handed out from the start of the Buffer
+	for i := p.perBuffer - 1; i >= 0; i-- {
+		p.free = append(p.free, unsafe.Add(b.Pointer(), i*p.slotSize))
+	}
+}
@@ -0,0 +1,59 @@
+package securemem
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func Test_Pool_Get_returnsWipedAndAlignedSlots(t *testing.T) {
+	p := NewPool(13)
+
+	for i := 0; i < 3*poolBufferSize/16; i++ {
+		slot := p.Get()
+		if uintptr(slot)%unsafe.Alignof(uint64(0)) != 0 {
+			t.Fatal("expected the slot to be aligned")
+		}
+
+		data := unsafe.Slice((*byte)(slot), 13)
+		for _, b := range data {
+			if b != 0 {
+				t.Fatal("expected the slot to be wiped")
+			}
+		}
+		copy(data, "a secret key!")
+	}
+}
+
+func Test_Pool_Put_wipesTheSlotAndReusesIt(t *testing.T) {
+	p := NewPool(16)
+	slot := p.Get()
+	copy(unsafe.Slice((*byte)(slot), 16), "a secret value!!")
+
+	p.Put(slot)
+
+	if p.Get() != slot {
+		t.Error("expected the slot to be reused")
+	}
+	for _, b := range unsafe.Slice((*byte)(slot), 16) {
+		if b != 0 {
+			t.Fatal("expected the slot to be wiped")
+		}
+	}
+}
+
+func Test_Pool_onlyAllocatesWhenItRunsOutOfSlots(t *testing.T) {
+	p := NewPool(100)
+	before := Live()
+
+	for i := 0; i < 1000; i++ {
+		p.Put(p.Get())
+	}
+
+	if Live() != before+1 {
+		t.Errorf("expected one buffer to be allocated, got %d", Live()-before)
+	}
+}
+
+func Test_Pool_Put_ignoresNil(t *testing.T) {
+	NewPool(16).Put(nil)
+}
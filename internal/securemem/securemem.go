@@ -0,0 +1,155 @@
+// Package securemem allocates memory for key material outside of the Go heap.
+//
+// The Go heap can be swapped to disk, ends up in core dumps, and the garbage collector is free to copy values
+// around, leaving copies that can never be wiped. A Buffer is instead allocated directly from the operating system.
+// Where it is supported, the memory is locked so it is never swapped out, excluded from core dumps, and surrounded by
+// guard pages so that reading or writing past its ends crashes instead of leaking neighbouring values.
+//
+// When the memory can't be locked, for example because the process has reached RLIMIT_MEMLOCK or isn't allowed to
+// lock memory at all, the Buffer is still allocated, just without the lock. Locked reports which one happened.
+//
+// A Buffer is not freed by the garbage collector, since values pointing into it might still be in use. It has to be
+// released, which wipes it, as soon as the values it holds are not needed anymore. An owner that keeps the Buffer
+// reachable for as long as the values in it are used can ask for it to be released when it becomes unreachable, as
+// a safety net for owners that are dropped without being wiped.
+//
+// Values that only live for a moment should come from a Pool, which reuses its memory instead of asking the
+// operating system every time.
+package securemem
+
+import (
+	"math/big"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// live is the number of Buffers that hold memory and haven't been released
+var live atomic.Int64
+
+// Live returns the number of Buffers that have been allocated and not released yet, so tests can check that the key
+// material they create is released
+func Live() int {
+	return int(live.Load())
+}
+
+// Buffer is a fixed size block of memory for secret values
+type Buffer struct {
+	data   []byte
+	locked bool
+
+	// mappingOffset and mappingSize describe the whole allocation, including the guard pages, when the memory comes
+	// from the operating system. The allocation starts mappingOffset bytes before data. They are kept relative to
+	// data so nothing reads the guard pages by accident, and Buffers with the same contents are deeply equal.
+	mappingOffset int
+	mappingSize   int
+}
+
+// New returns a wiped Buffer of size bytes. The memory is aligned for any Go type.
+func New(size int) *Buffer {
+	if size <= 0 {
+		return &Buffer{}
+	}
+
+	if b := allocate(size); b != nil {
+		live.Add(1)
+		return b
+	}
+
+	return allocateFromHeap(size)
+}
+
+// CopyInt returns a copy of x whose value is kept in a new Buffer, together with that Buffer. The copy can be read
+// and used as an operand like any other big.Int, but operations that store a result in it can move its value back to
+// the Go heap. x itself is left untouched, so it should be wiped by the caller.
+func CopyInt(x *big.Int) (*big.Int, *Buffer) {
+	words := x.Bits()
+	if len(words) == 0 {
+		return new(big.Int), nil
+	}
+
+	b := New(len(words) * int(unsafe.Sizeof(big.Word(0))))
+	dst := unsafe.Slice((*big.Word)(b.Pointer()), len(words))
+	copy(dst, words)
+
+	res := new(big.Int).SetBits(dst)
+	if x.Sign() < 0 {
+		res.Neg(res)
+	}
+
+	return res, b
+}
+
+// Bytes returns the memory of the Buffer. It must not be used after the Buffer is released.
+func (b *Buffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.data
+}
+
+// Pointer returns the address of the memory of the Buffer, to place values that don't contain Go pointers in it.
+// It returns nil if the Buffer is empty or has been released.
+func (b *Buffer) Pointer() unsafe.Pointer {
+	if b == nil || len(b.data) == 0 {
+		return nil
+	}
+	return unsafe.Pointer(&b.data[0])
+}
+
+// Locked returns true if the memory of the Buffer is locked, so it can't be swapped out
+func (b *Buffer) Locked() bool {
+	return b != nil && b.locked
+}
+
+// Release wipes the memory of the Buffer and gives it back to the operating system. It is safe to call more than once,
+// and on a nil Buffer.
+func (b *Buffer) Release() {
+	if b == nil || b.data == nil {
+		return
+	}
+
+	wipe(b.data)
+	if b.mappingSize != 0 {
+		free(b)
+	}
+	live.Add(-1)
+
+	b.data = nil
+	b.locked = false
+	b.mappingOffset = 0
+	b.mappingSize = 0
+}
+
+// ReleaseWhenUnreachable makes the garbage collector release the Buffer once nothing refers to it anymore. Values
+// that point into the Buffer don't keep it reachable, so its owner has to keep a reference to it for as long as
+// they are used.
+func (b *Buffer) ReleaseWhenUnreachable() {
+	if b == nil || b.data == nil {
+		return
+	}
+	runtime.SetFinalizer(b, (*Buffer).Release)
+}
+
+// mapping returns the start of the whole allocation
+func (b *Buffer) mapping() unsafe.Pointer {
+	return unsafe.Add(b.Pointer(), -b.mappingOffset)
+}
+
+// allocateFromHeap is the last resort when the operating system doesn't give us memory.
+// The backing array is made of words, so the memory is aligned like memory from the operating system would be.
+func allocateFromHeap(size int) *Buffer {
+	words := make([]uint64, (size+7)/8)
+	live.Add(1)
+	return &Buffer{data: unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), size)}
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func roundUp(n, to int) int {
+	return (n + to - 1) / to * to
+}
@@ -0,0 +1,54 @@
+package securemem
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// madvDontDump is MADV_DONTDUMP, which the syscall package doesn't define
+const madvDontDump = 0x10
+
+// allocate maps the pages for size bytes with a guard page on each side, and tries to lock them.
+// The data is placed at the end of the pages, so an overflow runs straight into the guard page after it.
+// It returns nil if the pages can't be mapped.
+func allocate(size int) *Buffer {
+	pageSize := os.Getpagesize()
+	dataSize := roundUp(size, pageSize)
+	total := dataSize + 2*pageSize
+
+	region, err := syscall.Mmap(-1, 0, total, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return nil
+	}
+
+	if syscall.Mprotect(region[:pageSize], syscall.PROT_NONE) != nil ||
+		syscall.Mprotect(region[total-pageSize:], syscall.PROT_NONE) != nil {
+		syscall.Munmap(region)
+		return nil
+	}
+
+	pages := region[pageSize : total-pageSize]
+	// Both of these can fail without making the memory unusable: mlock fails with EPERM or ENOMEM when the process
+	// isn't allowed to lock more memory, and MADV_DONTDUMP doesn't exist in old kernels
+	locked := syscall.Mlock(pages) == nil
+	syscall.Madvise(pages, madvDontDump)
+
+	start := dataSize - roundUp(size, 8)
+	return &Buffer{
+		data:          pages[start : start+size : start+size],
+		locked:        locked,
+		mappingOffset: pageSize + start,
+		mappingSize:   total,
+	}
+}
+
+func free(b *Buffer) {
+	region := unsafe.Slice((*byte)(b.mapping()), b.mappingSize)
+	pageSize := os.Getpagesize()
+
+	if b.locked {
+		syscall.Munlock(region[pageSize : b.mappingSize-pageSize])
+	}
+	syscall.Munmap(region)
+}
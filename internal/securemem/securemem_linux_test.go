@@ -0,0 +1,49 @@
+package securemem
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+// rlimitMemlock is RLIMIT_MEMLOCK, which the syscall package doesn't define
+const rlimitMemlock = 8
+
+func Test_allocate_surroundsTheMemoryWithGuardPages(t *testing.T) {
+	b := allocate(100)
+	defer b.Release()
+
+	pageSize := uintptr(os.Getpagesize())
+	start := uintptr(b.mapping())
+	data := uintptr(b.Pointer())
+
+	if data < start+pageSize || data+100 > start+uintptr(b.mappingSize)-pageSize {
+		t.Error("expected the data to be inside the guard pages")
+	}
+	if start+uintptr(b.mappingSize)-pageSize-(data+100) >= 8 {
+		t.Error("expected the data to end right before the last guard page")
+	}
+}
+
+func Test_allocate_locksTheMemoryWhenAllowed(t *testing.T) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(rlimitMemlock, &limit); err != nil || limit.Cur < 1<<16 {
+		t.Skip("this process isn't allowed to lock memory")
+	}
+
+	b := allocate(100)
+	defer b.Release()
+
+	if !b.Locked() {
+		t.Error("expected the memory to be locked")
+	}
+}
+
+func Test_Release_forgetsTheMapping(t *testing.T) {
+	b := allocate(100)
+	b.Release()
+
+	if b.mappingOffset != 0 || b.mappingSize != 0 {
+		t.Error("expected the mapping to be forgotten")
+	}
+}
@@ -0,0 +1,163 @@
+package securemem
+
+import (
+	"bytes"
+	"math/big"
+	"runtime"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func Test_New_returnsAWipedBufferOfTheGivenSize(t *testing.T) {
+	b := New(100)
+	defer b.Release()
+
+	if len(b.Bytes()) != 100 {
+		t.Errorf("expected 100 bytes, got %d", len(b.Bytes()))
+	}
+	if !bytes.Equal(b.Bytes(), make([]byte, 100)) {
+		t.Error("expected the buffer to be wiped")
+	}
+}
+
+func Test_New_returnsMemoryThatCanBeWritten(t *testing.T) {
+	b := New(5000)
+	defer b.Release()
+
+	for i := range b.Bytes() {
+		b.Bytes()[i] = byte(i)
+	}
+
+	last := len(b.Bytes()) - 1
+	if b.Bytes()[last] != byte(last) {
+		t.Error("expected the last byte to keep its value")
+	}
+}
+
+func Test_New_returnsAlignedMemory(t *testing.T) {
+	for _, size := range []int{1, 7, 13, 64, 4097} {
+		b := New(size)
+		if uintptr(b.Pointer())%unsafe.Alignof(uint64(0)) != 0 {
+			t.Errorf("expected a buffer of %d bytes to be aligned", size)
+		}
+		b.Release()
+	}
+}
+
+func Test_New_returnsAnEmptyBufferForZeroBytes(t *testing.T) {
+	b := New(0)
+
+	if b.Bytes() != nil || b.Pointer() != nil || b.Locked() {
+		t.Error("expected an empty buffer")
+	}
+	b.Release()
+}
+
+func Test_Release_wipesTheMemory(t *testing.T) {
+	b := allocateFromHeap(16)
+	data := b.Bytes()
+	copy(data, []byte("a secret value!!"))
+
+	b.Release()
+
+	if !bytes.Equal(data, make([]byte, 16)) {
+		t.Error("expected the memory to be wiped")
+	}
+	if b.Bytes() != nil || b.Pointer() != nil {
+		t.Error("expected the buffer to be empty after being released")
+	}
+}
+
+func Test_Release_canBeCalledMoreThanOnce(t *testing.T) {
+	b := New(32)
+	b.Release()
+	b.Release()
+
+	var nilBuffer *Buffer
+	nilBuffer.Release()
+}
+
+func Test_allocateFromHeap_returnsAnUnlockedBuffer(t *testing.T) {
+	b := allocateFromHeap(10)
+
+	if b.Locked() || len(b.Bytes()) != 10 {
+		t.Error("expected an unlocked buffer of 10 bytes")
+	}
+}
+
+func Test_CopyInt_returnsTheSameValue(t *testing.T) {
+	x, _ := new(big.Int).SetString("DEADBEEFCAFEBABE0123456789ABCDEF0011223344556677", 16)
+
+	res, b := CopyInt(x)
+	defer b.Release()
+
+	if res.Cmp(x) != 0 {
+		t.Errorf("expected %X, got %X", x, res)
+	}
+	if &res.Bits()[0] == &x.Bits()[0] {
+		t.Error("expected the copy to have its own memory")
+	}
+}
+
+func Test_CopyInt_keepsTheValueInTheBuffer(t *testing.T) {
+	res, b := CopyInt(big.NewInt(0x1234))
+	defer b.Release()
+
+	if uintptr(unsafe.Pointer(&res.Bits()[0])) != uintptr(b.Pointer()) {
+		t.Error("expected the value to be stored in the buffer")
+	}
+}
+
+func Test_CopyInt_keepsTheSign(t *testing.T) {
+	res, b := CopyInt(big.NewInt(-42))
+	defer b.Release()
+
+	if res.Int64() != -42 {
+		t.Errorf("expected -42, got %d", res.Int64())
+	}
+}
+
+func Test_CopyInt_doesntAllocateForZero(t *testing.T) {
+	res, b := CopyInt(new(big.Int))
+
+	if res.Sign() != 0 || b != nil {
+		t.Error("expected zero without a buffer")
+	}
+}
+
+func Test_Live_countsTheBuffersThatArentReleased(t *testing.T) {
+	before := Live()
+
+	b1, b2 := New(16), allocateFromHeap(16)
+	if Live() != before+2 {
+		t.Errorf("expected %d live buffers, got %d", before+2, Live())
+	}
+
+	b1.Release()
+	b2.Release()
+	b2.Release()
+	New(0).Release()
+	if Live() != before {
+		t.Errorf("expected %d live buffers, got %d", before, Live())
+	}
+}
+
+func Test_ReleaseWhenUnreachable_releasesTheBufferWhenItIsCollected(t *testing.T) {
+	before := Live()
+
+	New(16).ReleaseWhenUnreachable()
+	for i := 0; i < 10 && Live() != before; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if Live() != before {
+		t.Errorf("expected the buffer to be released")
+	}
+}
+
+func Test_ReleaseWhenUnreachable_ignoresAnEmptyBuffer(t *testing.T) {
+	New(0).ReleaseWhenUnreachable()
+	(*Buffer)(nil).ReleaseWhenUnreachable()
+}
@@ -0,0 +1,259 @@
+package otr3
+
+import (
+	"crypto/dsa"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"strings"
+)
+
+const (
+	pemPrivateKeyType = "PRIVATE KEY"
+	pemPublicKeyType  = "PUBLIC KEY"
+	sshDSAKeyType     = "ssh-dss"
+)
+
+var oidDSA = asn1.ObjectIdentifier{1, 2, 840, 10040, 4, 1}
+
+var errIncompleteKey = newOtrError("the key is missing some of its values")
+
+// pkcs8PrivateKey is the PrivateKeyInfo of PKCS#8, without the optional attributes
+type pkcs8PrivateKey struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// subjectPublicKeyInfo is the encoding of public keys of X.509, as used in PEM "PUBLIC KEY" blocks
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// dsaAlgorithmParameters are the parameters of the DSA algorithm identifier
+type dsaAlgorithmParameters struct {
+	P, Q, G *big.Int
+}
+
+func dsaAlgorithmIdentifier(params *dsa.Parameters) (pkix.AlgorithmIdentifier, error) {
+	der, err := asn1.Marshal(dsaAlgorithmParameters{P: params.P, Q: params.Q, G: params.G})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	return pkix.AlgorithmIdentifier{Algorithm: oidDSA, Parameters: asn1.RawValue{FullBytes: der}}, nil
+}
+
+func (pub *PublicKey) isComplete() bool {
+	return pub.P != nil && pub.Q != nil && pub.G != nil && pub.Y != nil
+}
+
+// ExportPEM returns the private key in PKCS#8, encoded in PEM. It can be read back with ImportPrivateKeyFromPEM or
+// ImportKeysFromPEM, and by most tools that understand DSA keys, like OpenSSL.
+func (priv *PrivateKey) ExportPEM() ([]byte, error) {
+	if !priv.PublicKey.isComplete() || priv.PrivateKey.X == nil {
+		return nil, errIncompleteKey
+	}
+
+	alg, err := dsaAlgorithmIdentifier(&priv.PrivateKey.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	x, err := asn1.Marshal(priv.PrivateKey.X)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := asn1.Marshal(pkcs8PrivateKey{Algorithm: alg, PrivateKey: x})
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: pemPrivateKeyType, Bytes: der}), nil
+}
+
+// ImportPrivateKeyFromPEM returns the first DSA private key in data, in any of the formats ImportKeysFromPEM reads
+func ImportPrivateKeyFromPEM(data []byte) (*PrivateKey, error) {
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if key, err := parsePEMPrivateKey(block); err != nil || key != nil {
+			return key, err
+		}
+	}
+	return nil, errCorruptKey
+}
+
+// ExportPEM returns the public key as a DSA SubjectPublicKeyInfo, encoded in PEM as a "PUBLIC KEY". It can be read
+// back with ImportPublicKeyFromPEM.
+func (pub *PublicKey) ExportPEM() ([]byte, error) {
+	if !pub.isComplete() {
+		return nil, errIncompleteKey
+	}
+
+	alg, err := dsaAlgorithmIdentifier(&pub.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := asn1.Marshal(pub.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: alg,
+		PublicKey: asn1.BitString{Bytes: y, BitLength: 8 * len(y)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: pemPublicKeyType, Bytes: der}), nil
+}
+
+// ImportPublicKeyFromPEM returns the first DSA public key in data, in the format ExportPEM writes. The key is
+// validated before it's returned.
+func ImportPublicKeyFromPEM(data []byte) (*PublicKey, error) {
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == pemPublicKeyType {
+			return parseSubjectPublicKeyInfo(block.Bytes)
+		}
+	}
+	return nil, errCorruptKey
+}
+
+func parseSubjectPublicKeyInfo(der []byte) (*PublicKey, error) {
+	var info subjectPublicKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 {
+		return nil, errCorruptKey
+	}
+
+	if !info.Algorithm.Algorithm.Equal(oidDSA) {
+		return nil, errUnsupportedKey
+	}
+
+	var params dsaAlgorithmParameters
+	if rest, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil || len(rest) > 0 {
+		return nil, errCorruptKey
+	}
+
+	y := new(big.Int)
+	if rest, err := asn1.Unmarshal(info.PublicKey.RightAlign(), &y); err != nil || len(rest) > 0 {
+		return nil, errCorruptKey
+	}
+
+	pub := &PublicKey{}
+	pub.Parameters = dsa.Parameters{P: params.P, Q: params.Q, G: params.G}
+	pub.Y = y
+	return validatedPublicKey(pub)
+}
+
+// ExportOpenSSH returns the public key as a line of an OpenSSH authorized_keys file: ssh-dss followed by the key
+// in base64.
+func (pub *PublicKey) ExportOpenSSH() (string, error) {
+	if !pub.isComplete() {
+		return "", errIncompleteKey
+	}
+
+	blob := appendData(nil, []byte(sshDSAKeyType))
+	for _, n := range []*big.Int{pub.P, pub.Q, pub.G, pub.Y} {
+		blob = appendData(blob, sshMPInt(n))
+	}
+
+	return sshDSAKeyType + " " + base64.StdEncoding.EncodeToString(blob), nil
+}
+
+// ImportPublicKeyFromOpenSSH reads a public key from a line in the format of ExportOpenSSH. A comment after the key,
+// as OpenSSH writes it, is ignored. The key is validated before it's returned.
+func ImportPublicKeyFromOpenSSH(line string) (*PublicKey, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != sshDSAKeyType {
+		return nil, errUnsupportedKey
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, errCorruptKey
+	}
+
+	index, keyType, ok := extractData(blob)
+	if !ok || string(keyType) != sshDSAKeyType {
+		return nil, errCorruptKey
+	}
+
+	pub := &PublicKey{}
+	for _, v := range []**big.Int{&pub.P, &pub.Q, &pub.G, &pub.Y} {
+		var n []byte
+		// Negative numbers are never part of a valid key
+		if index, n, ok = extractData(index); !ok || (len(n) > 0 && n[0]&0x80 != 0) {
+			return nil, errCorruptKey
+		}
+		*v = new(big.Int).SetBytes(n)
+	}
+
+	if len(index) > 0 {
+		return nil, errCorruptKey
+	}
+
+	return validatedPublicKey(pub)
+}
+
+// sshMPInt returns n in the two's complement encoding SSH uses for its mpint values. n can't be negative.
+func sshMPInt(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		return append([]byte{0x00}, b...)
+	}
+	return b
+}
+
+// ExportBase64 returns the serialization of the private key in base64, which is how clients based on
+// golang.org/x/crypto/otr keep it in their configuration. It can be read back with ImportPrivateKeyFromBase64.
+func (priv *PrivateKey) ExportBase64() (string, error) {
+	if !priv.PublicKey.isComplete() || priv.PrivateKey.X == nil {
+		return "", errIncompleteKey
+	}
+	return base64.StdEncoding.EncodeToString(priv.Serialize()), nil
+}
+
+// ImportPrivateKeyFromBase64 reads a private key in the format of ExportBase64
+func ImportPrivateKeyFromBase64(s string) (*PrivateKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, errCorruptKey
+	}
+	return parseSerializedPrivateKey(data)
+}
+
+// ExportBase64 returns the serialization of the public key in base64, the way golang.org/x/crypto/otr would encode it
+func (pub *PublicKey) ExportBase64() (string, error) {
+	if !pub.isComplete() {
+		return "", errIncompleteKey
+	}
+	return base64.StdEncoding.EncodeToString(pub.Serialize()), nil
+}
+
+// ImportPublicKeyFromBase64 reads a public key in the format of ExportBase64. The key is validated before it's
+// returned.
+func ImportPublicKeyFromBase64(s string) (*PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, errCorruptKey
+	}
+
+	pub := &PublicKey{}
+	if rest, ok := pub.Parse(data); !ok || len(rest) > 0 {
+		return nil, errCorruptKey
+	}
+
+	return validatedPublicKey(pub)
+}
+
+func validatedPublicKey(pub *PublicKey) (*PublicKey, error) {
+	if err := pub.validate(); err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
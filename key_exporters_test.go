@@ -0,0 +1,182 @@
+package otr3
+
+import (
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func Test_PrivateKey_ExportPEM_canBeImportedWithTheSameFingerprint(t *testing.T) {
+	data, err := alicePrivateKey.ExportPEM()
+	assertNil(t, err)
+
+	key, err := ImportPrivateKeyFromPEM(data)
+
+	assertNil(t, err)
+	assertDeepEquals(t, key.Public().DefaultFingerprint(), alicePrivateKey.Public().DefaultFingerprint())
+	assertDeepEquals(t, key.PrivateKey.X, alicePrivateKey.PrivateKey.X)
+}
+
+func Test_PrivateKey_ExportPEM_writesTheSamePKCS8AsOpenSSL(t *testing.T) {
+	data, _ := alicePrivateKey.ExportPEM()
+
+	assertDeepEquals(t, string(data), string(readTestResource(t, "alice_pkcs8.pem")))
+}
+
+func Test_PrivateKey_ExportPEM_returnsAnErrorForAnIncompleteKey(t *testing.T) {
+	_, err := (&PrivateKey{}).ExportPEM()
+
+	assertEquals(t, err, errIncompleteKey)
+}
+
+func Test_ImportPrivateKeyFromPEM_readsAnOpenSSLDSAKey(t *testing.T) {
+	key, err := ImportPrivateKeyFromPEM(readTestResource(t, "alice_dsa.pem"))
+
+	assertNil(t, err)
+	assertDeepEquals(t, key.Public().DefaultFingerprint(), alicePrivateKey.Public().DefaultFingerprint())
+}
+
+func Test_ImportPrivateKeyFromPEM_returnsAnErrorWhenThereIsNoPrivateKey(t *testing.T) {
+	data, _ := alicePrivateKey.Public().ExportPEM()
+
+	_, err := ImportPrivateKeyFromPEM(data)
+
+	assertEquals(t, err, errCorruptKey)
+}
+
+func Test_PublicKey_ExportPEM_canBeImportedWithTheSameFingerprint(t *testing.T) {
+	data, err := bobPrivateKey.Public().ExportPEM()
+	assertNil(t, err)
+
+	pub, err := ImportPublicKeyFromPEM(data)
+
+	assertNil(t, err)
+	assertDeepEquals(t, pub.DefaultFingerprint(), bobPrivateKey.Public().DefaultFingerprint())
+}
+
+func Test_PublicKey_ExportPEM_returnsAnErrorForAnIncompleteKey(t *testing.T) {
+	_, err := (&PublicKey{}).ExportPEM()
+
+	assertEquals(t, err, errIncompleteKey)
+}
+
+func Test_ImportPublicKeyFromPEM_returnsAnErrorForAnotherAlgorithm(t *testing.T) {
+	block, _ := pem.Decode(mustExportPublicPEM(t))
+	block.Bytes = []byte(strings.Replace(string(block.Bytes), "\x2a\x86\x48\xce\x38\x04\x01", "\x2a\x86\x48\xce\x3d\x02\x01", 1))
+
+	_, err := ImportPublicKeyFromPEM(pem.EncodeToMemory(block))
+
+	assertEquals(t, err, errUnsupportedKey)
+}
+
+func Test_ImportPublicKeyFromPEM_returnsAnErrorForCorruptData(t *testing.T) {
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{0x30, 0x01}})
+
+	_, err := ImportPublicKeyFromPEM(data)
+
+	assertEquals(t, err, errCorruptKey)
+}
+
+func Test_ImportPublicKeyFromPEM_validatesTheKey(t *testing.T) {
+	pub := alicePrivateKey.Public()
+	weak := &PublicKey{}
+	weak.Parameters = pub.Parameters
+	weak.Y = big.NewInt(1)
+	data, _ := weak.ExportPEM()
+
+	_, err := ImportPublicKeyFromPEM(data)
+
+	assertEquals(t, err, ErrInvalidKeyPublicValue)
+}
+
+func mustExportPublicPEM(t *testing.T) []byte {
+	data, err := alicePrivateKey.Public().ExportPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func Test_PublicKey_ExportOpenSSH_canBeImportedWithTheSameFingerprint(t *testing.T) {
+	line, err := alicePrivateKey.Public().ExportOpenSSH()
+	assertNil(t, err)
+
+	pub, err := ImportPublicKeyFromOpenSSH(line + " alice@example.com")
+
+	assertNil(t, err)
+	assertEquals(t, strings.HasPrefix(line, "ssh-dss AAAAB3NzaC1kc3MAAACBA"), true)
+	assertDeepEquals(t, pub.DefaultFingerprint(), alicePrivateKey.Public().DefaultFingerprint())
+}
+
+func Test_PublicKey_ExportOpenSSH_returnsAnErrorForAnIncompleteKey(t *testing.T) {
+	_, err := (&PublicKey{}).ExportOpenSSH()
+
+	assertEquals(t, err, errIncompleteKey)
+}
+
+func Test_ImportPublicKeyFromOpenSSH_returnsAnErrorForAnotherKeyType(t *testing.T) {
+	_, err := ImportPublicKeyFromOpenSSH("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGz0")
+
+	assertEquals(t, err, errUnsupportedKey)
+}
+
+func Test_ImportPublicKeyFromOpenSSH_returnsAnErrorForCorruptData(t *testing.T) {
+	line, _ := alicePrivateKey.Public().ExportOpenSSH()
+
+	_, err := ImportPublicKeyFromOpenSSH(line[:len(line)-8])
+
+	assertEquals(t, err, errCorruptKey)
+}
+
+func Test_sshMPInt_addsAZeroWhenTheHighBitIsSet(t *testing.T) {
+	assertDeepEquals(t, sshMPInt(big.NewInt(0x7f)), []byte{0x7f})
+	assertDeepEquals(t, sshMPInt(big.NewInt(0x80)), []byte{0x00, 0x80})
+	assertDeepEquals(t, sshMPInt(big.NewInt(0)), []byte{})
+}
+
+func Test_PrivateKey_ExportBase64_canBeImportedWithTheSameFingerprint(t *testing.T) {
+	s, err := bobPrivateKey.ExportBase64()
+	assertNil(t, err)
+
+	key, err := ImportPrivateKeyFromBase64(s)
+
+	assertNil(t, err)
+	assertDeepEquals(t, key.Public().DefaultFingerprint(), bobPrivateKey.Public().DefaultFingerprint())
+}
+
+func Test_PrivateKey_ExportBase64_isWhatJSONConfigsHold(t *testing.T) {
+	s, _ := alicePrivateKey.ExportBase64()
+
+	assertEquals(t, strings.Contains(string(readTestResource(t, "xmpp-client.json")), `"`+s+`"`), true)
+}
+
+func Test_PrivateKey_ExportBase64_returnsAnErrorForAnIncompleteKey(t *testing.T) {
+	_, err := (&PrivateKey{}).ExportBase64()
+
+	assertEquals(t, err, errIncompleteKey)
+}
+
+func Test_ImportPrivateKeyFromBase64_returnsAnErrorForCorruptData(t *testing.T) {
+	_, err := ImportPrivateKeyFromBase64("AAAA!")
+
+	assertEquals(t, err, errCorruptKey)
+}
+
+func Test_PublicKey_ExportBase64_canBeImportedWithTheSameFingerprint(t *testing.T) {
+	s, err := alicePrivateKey.Public().ExportBase64()
+	assertNil(t, err)
+
+	pub, err := ImportPublicKeyFromBase64(s)
+
+	assertNil(t, err)
+	assertDeepEquals(t, pub.DefaultFingerprint(), alicePrivateKey.Public().DefaultFingerprint())
+}
+
+func Test_ImportPublicKeyFromBase64_returnsAnErrorForTrailingData(t *testing.T) {
+	s, _ := alicePrivateKey.ExportBase64()
+
+	_, err := ImportPublicKeyFromBase64(s)
+
+	assertEquals(t, err, errCorruptKey)
+}
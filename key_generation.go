@@ -0,0 +1,179 @@
+package otr3
+
+import (
+	"context"
+	"crypto/dsa"
+	"io"
+	"math/big"
+)
+
+const (
+	// OTR signatures have room for a Q of 160 bits, so the parameters always have these sizes
+	generatedPSize = 1024
+	generatedQSize = 160
+
+	// generatedPrimeRounds is the number of Miller-Rabin rounds used by dsa.GenerateParameters
+	generatedPrimeRounds = 64
+)
+
+var errInvalidParameters = newOtrError("invalid DSA parameters")
+
+// KeyGenerationStage is the stage of the generation of a PrivateKey reported to the progress callback
+type KeyGenerationStage int
+
+const (
+	// KeyGenerationSearchingQ is reported for every candidate for the prime Q
+	KeyGenerationSearchingQ KeyGenerationStage = iota
+	// KeyGenerationSearchingP is reported for every candidate for the prime P
+	KeyGenerationSearchingP
+	// KeyGenerationGeneratingKey is reported once the parameters are known, before the private value is generated
+	KeyGenerationGeneratingKey
+	// KeyGenerationDone is reported once the key is ready
+	KeyGenerationDone
+)
+
+// String returns the string representation of the KeyGenerationStage
+func (s KeyGenerationStage) String() string {
+	switch s {
+	case KeyGenerationSearchingQ:
+		return "KeyGenerationSearchingQ"
+	case KeyGenerationSearchingP:
+		return "KeyGenerationSearchingP"
+	case KeyGenerationGeneratingKey:
+		return "KeyGenerationGeneratingKey"
+	case KeyGenerationDone:
+		return "KeyGenerationDone"
+	default:
+		return "KEY GENERATION STAGE: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
+
+// GenerateOptions changes how GenerateContext generates a key
+type GenerateOptions struct {
+	// Parameters are the domain parameters of the new key. New parameters are generated when they are nil.
+	// Generating the parameters is what takes time, and keys that share parameters are just as safe, so parameters
+	// made once with GenerateParameters can be used for the keys of many accounts. They are checked before they
+	// are used, and P and Q must have 1024 and 160 bits.
+	Parameters *dsa.Parameters
+
+	// Progress is called from the generating goroutine with the current stage, and how many candidates have been
+	// tried in it. It is called very often while searching for the primes, so it should return quickly.
+	Progress func(stage KeyGenerationStage, attempt int)
+}
+
+func (o *GenerateOptions) progress(stage KeyGenerationStage, attempt int) {
+	if o != nil && o.Progress != nil {
+		o.Progress(stage, attempt)
+	}
+}
+
+// Generate will generate a new DSA Private Key with the randomness provided. The parameter size used is 1024 and 160.
+func (priv *PrivateKey) Generate(rand io.Reader) error {
+	return priv.GenerateContext(context.Background(), rand, nil)
+}
+
+// GenerateContext generates a new DSA Private Key with the randomness provided, like Generate. The generation
+// stops with the error of ctx as soon as ctx is done, so it can be run on its own goroutine and abandoned.
+// opts can be nil.
+func (priv *PrivateKey) GenerateContext(ctx context.Context, rand io.Reader, opts *GenerateOptions) error {
+	var params *dsa.Parameters
+	if opts != nil && opts.Parameters != nil {
+		params = opts.Parameters
+		if params.P == nil || params.P.BitLen() != generatedPSize || validateDSAKey(params, nil) != nil {
+			return errInvalidParameters
+		}
+	} else {
+		var err error
+		if params, err = generateParameters(ctx, rand, opts); err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	opts.progress(KeyGenerationGeneratingKey, 0)
+	priv.PrivateKey.Parameters = dsa.Parameters{
+		P: new(big.Int).Set(params.P),
+		Q: new(big.Int).Set(params.Q),
+		G: new(big.Int).Set(params.G),
+	}
+	if err := dsa.GenerateKey(&priv.PrivateKey, rand); err != nil {
+		return err
+	}
+	priv.PublicKey.PublicKey = priv.PrivateKey.PublicKey
+	priv.lockX()
+
+	opts.progress(KeyGenerationDone, 0)
+	return nil
+}
+
+// GenerateParameters generates domain parameters that can be given to GenerateContext, to generate many keys
+// quickly. progress can be nil.
+func GenerateParameters(ctx context.Context, rand io.Reader, progress func(stage KeyGenerationStage, attempt int)) (*dsa.Parameters, error) {
+	return generateParameters(ctx, rand, &GenerateOptions{Progress: progress})
+}
+
+// generateParameters does the same as dsa.GenerateParameters for L1024N160, checking ctx between candidates
+func generateParameters(ctx context.Context, rand io.Reader, opts *GenerateOptions) (*dsa.Parameters, error) {
+	qBytes := make([]byte, generatedQSize/8)
+	pBytes := make([]byte, generatedPSize/8)
+
+	q := new(big.Int)
+	p := new(big.Int)
+	rem := new(big.Int)
+
+	for qAttempt := 1; ; qAttempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		opts.progress(KeyGenerationSearchingQ, qAttempt)
+
+		if _, err := io.ReadFull(rand, qBytes); err != nil {
+			return nil, err
+		}
+		qBytes[len(qBytes)-1] |= 1
+		qBytes[0] |= 0x80
+		q.SetBytes(qBytes)
+
+		if !q.ProbablyPrime(generatedPrimeRounds) {
+			continue
+		}
+
+		for pAttempt := 1; pAttempt <= 4*generatedPSize; pAttempt++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			opts.progress(KeyGenerationSearchingP, pAttempt)
+
+			if _, err := io.ReadFull(rand, pBytes); err != nil {
+				return nil, err
+			}
+			pBytes[len(pBytes)-1] |= 1
+			pBytes[0] |= 0x80
+
+			// p = p - (p mod q - 1), so that q divides p-1
+			p.SetBytes(pBytes)
+			rem.Mod(p, q)
+			rem.Sub(rem, bigOne)
+			p.Sub(p, rem)
+			if p.BitLen() < generatedPSize || !p.ProbablyPrime(generatedPrimeRounds) {
+				continue
+			}
+
+			return &dsa.Parameters{P: p, Q: q, G: generatorFor(p, q)}, nil
+		}
+	}
+}
+
+// generatorFor returns the first h^((p-1)/q) mod p, starting at h = 2, that isn't 1
+func generatorFor(p, q *big.Int) *big.Int {
+	e := new(big.Int).Div(sub(p, bigOne), q)
+	g := new(big.Int)
+	for h := big.NewInt(2); ; h.Add(h, bigOne) {
+		if g.Exp(h, e, p); !eq(g, bigOne) {
+			return g
+		}
+	}
+}
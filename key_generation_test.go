@@ -0,0 +1,140 @@
+package otr3
+
+import (
+	"context"
+	"crypto/dsa"
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+func Test_KeyGenerationStage_hasValidStringImplementation(t *testing.T) {
+	assertEquals(t, KeyGenerationSearchingQ.String(), "KeyGenerationSearchingQ")
+	assertEquals(t, KeyGenerationSearchingP.String(), "KeyGenerationSearchingP")
+	assertEquals(t, KeyGenerationGeneratingKey.String(), "KeyGenerationGeneratingKey")
+	assertEquals(t, KeyGenerationDone.String(), "KeyGenerationDone")
+	assertEquals(t, KeyGenerationStage(20000).String(), "KEY GENERATION STAGE: (THIS SHOULD NEVER HAPPEN)")
+}
+
+func Test_GenerateParameters_generatesParametersForManyKeys(t *testing.T) {
+	var stages []KeyGenerationStage
+	params, err := GenerateParameters(context.Background(), rand.Reader, func(stage KeyGenerationStage, attempt int) {
+		if len(stages) == 0 || stages[len(stages)-1] != stage {
+			stages = append(stages, stage)
+		}
+	})
+	assertNil(t, err)
+	assertNil(t, validateDSAKey(params, nil))
+	assertEquals(t, params.P.BitLen(), 1024)
+	assertEquals(t, params.Q.BitLen(), 160)
+	assertEquals(t, stages[0], KeyGenerationSearchingQ)
+	assertEquals(t, stages[len(stages)-1], KeyGenerationSearchingP)
+
+	priv1, priv2 := PrivateKey{}, PrivateKey{}
+	assertNil(t, priv1.GenerateContext(context.Background(), rand.Reader, &GenerateOptions{Parameters: params}))
+	assertNil(t, priv2.GenerateContext(context.Background(), rand.Reader, &GenerateOptions{Parameters: params}))
+	assertDeepEquals(t, priv1.PublicKey.Parameters, priv2.PublicKey.Parameters)
+	assertEquals(t, eq(priv1.PublicKey.Y, priv2.PublicKey.Y), false)
+}
+
+func Test_GenerateContext_usesTheGivenParameters(t *testing.T) {
+	var stages []KeyGenerationStage
+	opts := &GenerateOptions{
+		Parameters: &bobPrivateKey.PublicKey.Parameters,
+		Progress: func(stage KeyGenerationStage, attempt int) {
+			stages = append(stages, stage)
+		},
+	}
+
+	priv := PrivateKey{}
+	err := priv.GenerateContext(context.Background(), rand.Reader, opts)
+
+	assertNil(t, err)
+	assertDeepEquals(t, priv.PublicKey.Parameters, bobPrivateKey.PublicKey.Parameters)
+	assertNil(t, priv.PublicKey.validate())
+	assertNotNil(t, priv.xMemory)
+	assertDeepEquals(t, stages, []KeyGenerationStage{KeyGenerationGeneratingKey, KeyGenerationDone})
+}
+
+func Test_GenerateContext_signsWithTheGeneratedKey(t *testing.T) {
+	priv := PrivateKey{}
+	priv.GenerateContext(context.Background(), rand.Reader, &GenerateOptions{Parameters: &alicePrivateKey.PublicKey.Parameters})
+
+	hashed := []byte("a message that has been hashed!!")
+	sig, err := priv.Sign(rand.Reader, hashed)
+	assertNil(t, err)
+
+	_, ok := priv.PublicKey.Verify(hashed, sig)
+	assertEquals(t, ok, true)
+}
+
+func Test_GenerateContext_copiesTheGivenParameters(t *testing.T) {
+	params := dsa.Parameters{
+		P: new(big.Int).Set(bobPrivateKey.PublicKey.P),
+		Q: new(big.Int).Set(bobPrivateKey.PublicKey.Q),
+		G: new(big.Int).Set(bobPrivateKey.PublicKey.G),
+	}
+
+	priv := PrivateKey{}
+	priv.GenerateContext(context.Background(), rand.Reader, &GenerateOptions{Parameters: &params})
+	params.G.SetInt64(1)
+
+	assertEquals(t, eq(priv.PublicKey.G, bobPrivateKey.PublicKey.G), true)
+}
+
+func Test_GenerateContext_rejectsInvalidParameters(t *testing.T) {
+	params := bobPrivateKey.PublicKey.Parameters
+	params.G = big.NewInt(1)
+
+	priv := PrivateKey{}
+	err := priv.GenerateContext(context.Background(), rand.Reader, &GenerateOptions{Parameters: &params})
+
+	assertEquals(t, err, errInvalidParameters)
+}
+
+func Test_GenerateContext_rejectsParametersOfOtherSizes(t *testing.T) {
+	params := bobPrivateKey.PublicKey.Parameters
+	params.P = new(big.Int).Lsh(params.P, 1024)
+
+	priv := PrivateKey{}
+	err := priv.GenerateContext(context.Background(), rand.Reader, &GenerateOptions{Parameters: &params})
+
+	assertEquals(t, err, errInvalidParameters)
+}
+
+func Test_GenerateContext_returnsTheErrorOfADoneContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	priv := PrivateKey{}
+	err := priv.GenerateContext(ctx, rand.Reader, nil)
+
+	assertEquals(t, err, context.Canceled)
+	assertNil(t, priv.PrivateKey.X)
+}
+
+func Test_GenerateContext_stopsWhenTheContextIsCancelledWhileSearching(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	attempts := 0
+	opts := &GenerateOptions{Progress: func(stage KeyGenerationStage, attempt int) {
+		attempts++
+		if stage == KeyGenerationSearchingP {
+			cancel()
+		}
+	}}
+
+	priv := PrivateKey{}
+	err := priv.GenerateContext(ctx, rand.Reader, opts)
+
+	assertEquals(t, err, context.Canceled)
+	assertNil(t, priv.PrivateKey.X)
+}
+
+func Test_generatorFor_returnsAGeneratorOfTheSubgroup(t *testing.T) {
+	params := bobPrivateKey.PublicKey.Parameters
+	g := generatorFor(params.P, params.Q)
+
+	assertEquals(t, inSubgroup(g, params.P, params.Q), true)
+}
@@ -0,0 +1,415 @@
+package otr3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/dsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// jabberProtocol is the name libpurple uses for XMPP accounts, which is what clients based on
+// golang.org/x/crypto/otr are
+const jabberProtocol = "prpl-jabber"
+
+const (
+	jitsiPropertyPrefix   = "net.java.sip.communicator.plugin.otr."
+	jitsiPrivateKeySuffix = "_privateKey"
+	jitsiProtocolPrefix   = "net.java.sip.communicator.impl.protocol."
+)
+
+var errUnsupportedKey = newOtrError("only unencrypted DSA keys with P of 1024 bits and Q of 160 bits can be used with OTR")
+var errCorruptKey = newOtrError("couldn't import data into private key")
+
+// NewAccount returns an Account with the given key, for example to export it with ExportKeysToFile
+func NewAccount(name, protocol string, key *PrivateKey) *Account {
+	return &Account{name: name, protocol: protocol, key: key}
+}
+
+// jsonAccount has the fields that hold the keys in the configuration of clients based on golang.org/x/crypto/otr.
+// xmpp-client has a single PrivateKey, CoyIM a list of them.
+type jsonAccount struct {
+	Account     string
+	PrivateKey  []byte
+	PrivateKeys [][]byte
+}
+
+// ImportKeysFromJSONConfig reads the JSON configuration of a client based on golang.org/x/crypto/otr, like
+// xmpp-client or CoyIM, and returns an account for every key in it. The keys are in the format of
+// PrivateKey.Serialize, encoded in base64. Both the configuration of a single account and a list of accounts in an
+// Accounts field are understood. The accounts use the protocol "prpl-jabber", as libpurple calls XMPP.
+func ImportKeysFromJSONConfig(r io.Reader) ([]*Account, error) {
+	var config struct {
+		jsonAccount
+		Accounts []jsonAccount
+	}
+
+	if err := json.NewDecoder(r).Decode(&config); err != nil {
+		return nil, err
+	}
+
+	var result []*Account
+	for _, a := range append([]jsonAccount{config.jsonAccount}, config.Accounts...) {
+		serialized := a.PrivateKeys
+		if len(a.PrivateKey) > 0 {
+			serialized = append([][]byte{a.PrivateKey}, serialized...)
+		}
+
+		for _, s := range serialized {
+			key, err := parseSerializedPrivateKey(s)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, NewAccount(a.Account, jabberProtocol, key))
+		}
+	}
+
+	return result, nil
+}
+
+// ImportKeysFromJitsiProperties reads a Jitsi configuration file, usually sip-communicator.properties, and returns an
+// account for every OTR private key in it. Jitsi keeps them as base64 encoded PKCS#8 DSA keys, under the unique ID of
+// the account followed by _privateKey, where every character that is not a letter or a digit has been replaced with
+// an underscore. That can't be undone, so the accounts are found by their ACCOUNT_UID in the same file, like
+// "Jabber:alice@example.com@example.com". The protocol of an account is the part of its unique ID before the colon,
+// and its name is its USER_ID, or the rest of its unique ID if it has none. Keys whose account is not in the file are
+// skipped.
+func ImportKeysFromJitsiProperties(r io.Reader) ([]*Account, error) {
+	props, err := readProperties(r)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := jitsiAccounts(props)
+
+	var result []*Account
+	for _, p := range props {
+		if !strings.HasPrefix(p.key, jitsiPropertyPrefix) || !strings.HasSuffix(p.key, jitsiPrivateKeySuffix) {
+			continue
+		}
+		account, ok := accounts[p.key[len(jitsiPropertyPrefix):len(p.key)-len(jitsiPrivateKeySuffix)]]
+		if !ok {
+			continue
+		}
+
+		der, err := base64.StdEncoding.DecodeString(p.value)
+		if err != nil {
+			return nil, errCorruptKey
+		}
+
+		key, err := parsePKCS8DSAKey(der)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, NewAccount(account.userID, account.protocol, key))
+	}
+
+	return result, nil
+}
+
+type jitsiAccount struct {
+	protocol, userID string
+}
+
+// jitsiAccounts returns the accounts in the properties of Jitsi, by the mangled form of their unique ID that Jitsi
+// uses in the names of the OTR properties
+func jitsiAccounts(props []property) map[string]jitsiAccount {
+	ids := map[string]string{}
+	userIDs := map[string]string{}
+	for _, p := range props {
+		if !strings.HasPrefix(p.key, jitsiProtocolPrefix) {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(p.key, ".ACCOUNT_UID"):
+			ids[strings.TrimSuffix(p.key, ".ACCOUNT_UID")] = p.value
+		case strings.HasSuffix(p.key, ".USER_ID"):
+			userIDs[strings.TrimSuffix(p.key, ".USER_ID")] = p.value
+		}
+	}
+
+	result := map[string]jitsiAccount{}
+	for prefix, id := range ids {
+		account := jitsiAccount{userID: userIDs[prefix]}
+		rest := id
+		if i := strings.Index(id, ":"); i != -1 {
+			account.protocol, rest = id[:i], id[i+1:]
+		}
+		if account.userID == "" {
+			account.userID = rest
+		}
+		result[jitsiXMLFriendly(id)] = account
+	}
+	return result
+}
+
+// jitsiXMLFriendly mangles s the way Jitsi does for the names of the OTR properties: a p is put in front of a leading
+// digit, and every character that is not a letter or a digit is replaced with an underscore
+func jitsiXMLFriendly(s string) string {
+	if s == "" {
+		return s
+	}
+	if unicode.IsDigit([]rune(s)[0]) {
+		s = "p" + s
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// ImportKeysFromPEM reads the PEM encoded DSA private keys in data, either in the format of OpenSSL ("DSA PRIVATE
+// KEY") or in PKCS#8 ("PRIVATE KEY"), and returns an account with the given name and protocol for every one of them.
+// PEM has no room for the name of the account, so it has to be given. Encrypted keys are not supported.
+func ImportKeysFromPEM(data []byte, name, protocol string) ([]*Account, error) {
+	var result []*Account
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+
+		key, err := parsePEMPrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			result = append(result, NewAccount(name, protocol, key))
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, errCorruptKey
+	}
+	return result, nil
+}
+
+// parsePEMPrivateKey parses the DSA private key in block. It returns nil and no error if the block doesn't have a
+// private key in one of the formats we understand.
+func parsePEMPrivateKey(block *pem.Block) (*PrivateKey, error) {
+	if _, encrypted := block.Headers["Proc-Type"]; encrypted {
+		return nil, errUnsupportedKey
+	}
+
+	switch block.Type {
+	case "DSA PRIVATE KEY":
+		return parseOpenSSLDSAKey(block.Bytes)
+	case pemPrivateKeyType:
+		return parsePKCS8DSAKey(block.Bytes)
+	}
+	return nil, nil
+}
+
+// parseSerializedPrivateKey parses a private key in the format of PrivateKey.Serialize
+func parseSerializedPrivateKey(s []byte) (*PrivateKey, error) {
+	key := &PrivateKey{}
+	if rest, ok := key.Parse(s); !ok || len(rest) > 0 {
+		return nil, errCorruptKey
+	}
+	if err := checkImportedKey(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// parseOpenSSLDSAKey parses the DER encoding OpenSSL uses for DSA private keys
+func parseOpenSSLDSAKey(der []byte) (*PrivateKey, error) {
+	var k struct {
+		Version       int
+		P, Q, G, Y, X *big.Int
+	}
+
+	if rest, err := asn1.Unmarshal(der, &k); err != nil || len(rest) > 0 || k.Version != 0 {
+		return nil, errCorruptKey
+	}
+
+	return newImportedKey(dsa.Parameters{P: k.P, Q: k.Q, G: k.G}, k.Y, k.X)
+}
+
+// parsePKCS8DSAKey parses a DSA private key in the DER encoding of PKCS#8
+func parsePKCS8DSAKey(der []byte) (*PrivateKey, error) {
+	var info pkcs8PrivateKey
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 {
+		return nil, errCorruptKey
+	}
+
+	if !info.Algorithm.Algorithm.Equal(oidDSA) {
+		return nil, errUnsupportedKey
+	}
+
+	var params dsaAlgorithmParameters
+	if rest, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil || len(rest) > 0 {
+		return nil, errCorruptKey
+	}
+
+	x := new(big.Int)
+	if rest, err := asn1.Unmarshal(info.PrivateKey, &x); err != nil || len(rest) > 0 {
+		return nil, errCorruptKey
+	}
+
+	return newImportedKey(dsa.Parameters{P: params.P, Q: params.Q, G: params.G}, nil, x)
+}
+
+// newImportedKey makes a PrivateKey from the parameters and private value of a DSA key. The public value is computed
+// from them, and y, if it's not nil, has to be the same. The parameters and x come from a file, so they are validated
+// before they are used to compute anything.
+func newImportedKey(params dsa.Parameters, y, x *big.Int) (*PrivateKey, error) {
+	if params.P == nil || params.Q == nil || params.G == nil || x == nil {
+		return nil, errCorruptKey
+	}
+	if params.P.BitLen() != 1024 || params.Q.BitLen() != 160 {
+		return nil, errUnsupportedKey
+	}
+	if validateDSAKey(&params, nil) != nil || x.Sign() <= 0 || gte(x, params.Q) {
+		return nil, errCorruptKey
+	}
+
+	computed := new(big.Int).Exp(params.G, x, params.P)
+	if y != nil && !eq(computed, y) {
+		return nil, errCorruptKey
+	}
+
+	key := &PrivateKey{}
+	key.PrivateKey.Parameters = params
+	key.PrivateKey.Y = computed
+	key.PrivateKey.X = x
+	key.PublicKey.PublicKey = key.PrivateKey.PublicKey
+
+	key.lockX()
+	return key, nil
+}
+
+// checkImportedKey makes sure the key can be used by OTR, whose signatures only fit a Q of 160 bits
+func checkImportedKey(key *PrivateKey) error {
+	pub := key.Public()
+	if pub.P == nil || pub.Q == nil || pub.P.BitLen() != 1024 || pub.Q.BitLen() != 160 {
+		return errUnsupportedKey
+	}
+
+	x := key.PrivateKey.X
+	if pub.validate() != nil || x == nil || x.Sign() <= 0 || gte(x, pub.Q) || !eq(new(big.Int).Exp(pub.G, x, pub.P), pub.Y) {
+		return errCorruptKey
+	}
+
+	return nil
+}
+
+type property struct {
+	key, value string
+}
+
+// readProperties reads the format of Java properties files, with the escapes and continuation lines it allows
+func readProperties(r io.Reader) ([]property, error) {
+	var result []property
+	var logical bytes.Buffer
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1024*1024)
+	continued := false
+	for s.Scan() {
+		line := s.Text()
+		if continued {
+			line = strings.TrimLeft(line, " \t\f")
+		} else {
+			line = strings.TrimLeft(line, " \t\f")
+			if line == "" || line[0] == '#' || line[0] == '!' {
+				continue
+			}
+		}
+
+		continued = endsWithEscape(line)
+		if continued {
+			line = line[:len(line)-1]
+		}
+		logical.WriteString(line)
+
+		if !continued {
+			result = append(result, parseProperty(logical.String()))
+			logical.Reset()
+		}
+	}
+
+	if logical.Len() > 0 {
+		result = append(result, parseProperty(logical.String()))
+	}
+
+	return result, s.Err()
+}
+
+// endsWithEscape returns true if the line ends with an odd number of backslashes, so it continues on the next line
+func endsWithEscape(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+func parseProperty(line string) property {
+	end := 0
+	for ; end < len(line); end++ {
+		c := line[end]
+		if c == '\\' {
+			end++
+			continue
+		}
+		if c == '=' || c == ':' || c == ' ' || c == '\t' || c == '\f' {
+			break
+		}
+	}
+	if end > len(line) {
+		end = len(line)
+	}
+
+	// The separator is either whitespace, or an = or : optionally surrounded by whitespace
+	rest := strings.TrimLeft(line[end:], " \t\f")
+	if len(rest) > 0 && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+
+	return property{unescapeProperty(line[:end]), unescapeProperty(rest)}
+}
+
+func unescapeProperty(s string) string {
+	var result strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			result.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 't':
+			result.WriteByte('\t')
+		case 'n':
+			result.WriteByte('\n')
+		case 'r':
+			result.WriteByte('\r')
+		case 'f':
+			result.WriteByte('\f')
+		case 'u':
+			if i+5 <= len(s) {
+				if r, err := strconv.ParseUint(s[i+1:i+5], 16, 16); err == nil {
+					result.WriteRune(rune(r))
+					i += 4
+					break
+				}
+			}
+			result.WriteByte('u')
+		default:
+			result.WriteByte(s[i])
+		}
+	}
+	return result.String()
+}
@@ -0,0 +1,255 @@
+package otr3
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+)
+
+func readTestResource(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile("test_resources/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func Test_NewAccount_returnsAnAccountWithTheGivenValues(t *testing.T) {
+	acc := NewAccount("alice@example.com", "prpl-jabber", alicePrivateKey)
+
+	assertEquals(t, acc.Name(), "alice@example.com")
+	assertEquals(t, acc.Protocol(), "prpl-jabber")
+	assertEquals(t, acc.Key(), alicePrivateKey)
+}
+
+func Test_ImportKeysFromJSONConfig_readsTheKeyOfAnXMPPClientConfiguration(t *testing.T) {
+	res, err := ImportKeysFromJSONConfig(bytes.NewReader(readTestResource(t, "xmpp-client.json")))
+
+	assertNil(t, err)
+	assertEquals(t, len(res), 1)
+	assertEquals(t, res[0].Name(), "alice@example.com")
+	assertEquals(t, res[0].Protocol(), "prpl-jabber")
+	assertDeepEquals(t, res[0].Key().Public().DefaultFingerprint(), alicePrivateKey.Public().DefaultFingerprint())
+}
+
+func Test_ImportKeysFromJSONConfig_readsTheKeysOfEveryAccountInACoyIMConfiguration(t *testing.T) {
+	res, err := ImportKeysFromJSONConfig(bytes.NewReader(readTestResource(t, "coyim.json")))
+
+	assertNil(t, err)
+	assertEquals(t, len(res), 2)
+	assertEquals(t, res[0].Name(), "alice@example.com")
+	assertDeepEquals(t, res[0].Key().Public().DefaultFingerprint(), alicePrivateKey.Public().DefaultFingerprint())
+	assertEquals(t, res[1].Name(), "bob@example.org")
+	assertEquals(t, res[1].Protocol(), "prpl-jabber")
+	assertDeepEquals(t, res[1].Key().Public().DefaultFingerprint(), bobPrivateKey.Public().DefaultFingerprint())
+}
+
+func Test_ImportKeysFromJSONConfig_theImportedKeyCanSign(t *testing.T) {
+	res, _ := ImportKeysFromJSONConfig(bytes.NewReader(readTestResource(t, "xmpp-client.json")))
+	hashed := []byte("an important hash of 20 bytes")[:20]
+
+	sig, err := res[0].Key().Sign(fixtureRand(), hashed)
+
+	assertNil(t, err)
+	_, ok := alicePrivateKey.Public().Verify(hashed, sig)
+	assertEquals(t, ok, true)
+}
+
+func Test_ImportKeysFromJSONConfig_returnsAnErrorForACorruptKey(t *testing.T) {
+	config := `{"Account": "alice@example.com", "PrivateKey": "` + base64.StdEncoding.EncodeToString([]byte{0x00, 0x00, 0x01}) + `"}`
+
+	_, err := ImportKeysFromJSONConfig(strings.NewReader(config))
+
+	assertEquals(t, err, errCorruptKey)
+}
+
+func Test_ImportKeysFromJSONConfig_returnsAnErrorForInvalidJSON(t *testing.T) {
+	_, err := ImportKeysFromJSONConfig(strings.NewReader(`{"Account": `))
+
+	assertNotNil(t, err)
+}
+
+func Test_ImportKeysFromJSONConfig_returnsNoAccountsWhenThereAreNoKeys(t *testing.T) {
+	res, err := ImportKeysFromJSONConfig(strings.NewReader(`{"Account": "alice@example.com"}`))
+
+	assertNil(t, err)
+	assertEquals(t, len(res), 0)
+}
+
+func Test_ImportKeysFromJitsiProperties_readsThePrivateKeysOfTheAccounts(t *testing.T) {
+	res, err := ImportKeysFromJitsiProperties(bytes.NewReader(readTestResource(t, "sip-communicator.properties")))
+
+	assertNil(t, err)
+	assertEquals(t, len(res), 1)
+	assertEquals(t, res[0].Name(), "alice@example.com")
+	assertEquals(t, res[0].Protocol(), "Jabber")
+	assertDeepEquals(t, res[0].Key().Public().DefaultFingerprint(), alicePrivateKey.Public().DefaultFingerprint())
+}
+
+const jitsiAliceAccount = "net.java.sip.communicator.impl.protocol.jabber.acc1.ACCOUNT_UID=Jabber\\:alice@example.com@example.com\n"
+
+func Test_ImportKeysFromJitsiProperties_returnsAnErrorForAKeyThatIsNotBase64(t *testing.T) {
+	props := jitsiAliceAccount + "net.java.sip.communicator.plugin.otr.Jabber_alice_example_com_example_com_privateKey=#not base64#"
+
+	_, err := ImportKeysFromJitsiProperties(strings.NewReader(props))
+
+	assertEquals(t, err, errCorruptKey)
+}
+
+func Test_ImportKeysFromJitsiProperties_usesTheUniqueIDWhenThereIsNoUserID(t *testing.T) {
+	block, _ := pem.Decode(readTestResource(t, "alice_pkcs8.pem"))
+	props := jitsiAliceAccount +
+		"net.java.sip.communicator.plugin.otr.Jabber_alice_example_com_example_com_privateKey = " + base64.StdEncoding.EncodeToString(block.Bytes)
+
+	res, err := ImportKeysFromJitsiProperties(strings.NewReader(props))
+
+	assertNil(t, err)
+	assertEquals(t, res[0].Name(), "alice@example.com@example.com")
+	assertEquals(t, res[0].Protocol(), "Jabber")
+}
+
+func Test_ImportKeysFromJitsiProperties_skipsTheKeysOfAccountsThatAreNotInTheFile(t *testing.T) {
+	block, _ := pem.Decode(readTestResource(t, "alice_pkcs8.pem"))
+	props := "net.java.sip.communicator.plugin.otr.Jabber_bob_example_com_example_com_privateKey=" + base64.StdEncoding.EncodeToString(block.Bytes)
+
+	res, err := ImportKeysFromJitsiProperties(strings.NewReader(jitsiAliceAccount + props))
+
+	assertNil(t, err)
+	assertEquals(t, len(res), 0)
+}
+
+func Test_jitsiXMLFriendly_manglesTheNameLikeJitsi(t *testing.T) {
+	assertEquals(t, jitsiXMLFriendly("Jabber:alice@example.com@example.com"), "Jabber_alice_example_com_example_com")
+	assertEquals(t, jitsiXMLFriendly("1sip:bob@example.com"), "p1sip_bob_example_com")
+	assertEquals(t, jitsiXMLFriendly("Jabber:zoë@example.com"), "Jabber_zoë_example_com")
+	assertEquals(t, jitsiXMLFriendly(""), "")
+}
+
+func Test_ImportKeysFromPEM_readsAnOpenSSLDSAKey(t *testing.T) {
+	res, err := ImportKeysFromPEM(readTestResource(t, "alice_dsa.pem"), "alice@example.com", "prpl-jabber")
+
+	assertNil(t, err)
+	assertEquals(t, len(res), 1)
+	assertEquals(t, res[0].Name(), "alice@example.com")
+	assertEquals(t, res[0].Protocol(), "prpl-jabber")
+	assertDeepEquals(t, res[0].Key().Public().DefaultFingerprint(), alicePrivateKey.Public().DefaultFingerprint())
+}
+
+func Test_ImportKeysFromPEM_readsAPKCS8DSAKey(t *testing.T) {
+	res, err := ImportKeysFromPEM(readTestResource(t, "alice_pkcs8.pem"), "alice@example.com", "prpl-jabber")
+
+	assertNil(t, err)
+	assertEquals(t, len(res), 1)
+	assertDeepEquals(t, res[0].Key().Public().DefaultFingerprint(), alicePrivateKey.Public().DefaultFingerprint())
+}
+
+func Test_ImportKeysFromPEM_readsEveryKeyInTheData(t *testing.T) {
+	data := append(readTestResource(t, "alice_dsa.pem"), readTestResource(t, "alice_pkcs8.pem")...)
+
+	res, err := ImportKeysFromPEM(data, "alice@example.com", "prpl-jabber")
+
+	assertNil(t, err)
+	assertEquals(t, len(res), 2)
+}
+
+func Test_ImportKeysFromPEM_returnsAnErrorForAnEncryptedKey(t *testing.T) {
+	block, _ := pem.Decode(readTestResource(t, "alice_dsa.pem"))
+	block.Headers = map[string]string{"Proc-Type": "4,ENCRYPTED", "DEK-Info": "AES-128-CBC,00000000000000000000000000000000"}
+
+	_, err := ImportKeysFromPEM(pem.EncodeToMemory(block), "alice@example.com", "prpl-jabber")
+
+	assertEquals(t, err, errUnsupportedKey)
+}
+
+func Test_ImportKeysFromPEM_returnsAnErrorWhenThereAreNoDSAKeys(t *testing.T) {
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte{0x01}})
+
+	_, err := ImportKeysFromPEM(data, "alice@example.com", "prpl-jabber")
+
+	assertEquals(t, err, errCorruptKey)
+}
+
+func Test_ImportKeysFromPEM_returnsAnErrorForACorruptKey(t *testing.T) {
+	data := pem.EncodeToMemory(&pem.Block{Type: "DSA PRIVATE KEY", Bytes: []byte{0x30, 0x03, 0x02, 0x01, 0x00}})
+
+	_, err := ImportKeysFromPEM(data, "alice@example.com", "prpl-jabber")
+
+	assertEquals(t, err, errCorruptKey)
+}
+
+func Test_newImportedKey_returnsAnErrorWhenThePublicValueDoesntMatch(t *testing.T) {
+	key := alicePrivateKey.PrivateKey
+	_, err := newImportedKey(key.Parameters, bobPrivateKey.PublicKey.Y, key.X)
+
+	assertEquals(t, err, errCorruptKey)
+}
+
+func Test_newImportedKey_rejectsInvalidParametersBeforeUsingThem(t *testing.T) {
+	key := alicePrivateKey.PrivateKey
+	params := key.Parameters
+	params.G = new(big.Int).Set(params.P)
+
+	_, err := newImportedKey(params, nil, key.X)
+
+	assertEquals(t, err, errCorruptKey)
+}
+
+func Test_newImportedKey_rejectsAPrivateValueThatIsNotSmallerThanQ(t *testing.T) {
+	key := alicePrivateKey.PrivateKey
+
+	_, err := newImportedKey(key.Parameters, nil, new(big.Int).Add(key.X, key.Q))
+
+	assertEquals(t, err, errCorruptKey)
+}
+
+func Test_newImportedKey_returnsAnErrorForAKeyOfTheWrongSize(t *testing.T) {
+	key := alicePrivateKey.PrivateKey
+	params := key.Parameters
+	params.Q = new(big.Int).Lsh(params.Q, 1)
+
+	_, err := newImportedKey(params, nil, key.X)
+
+	assertEquals(t, err, errUnsupportedKey)
+}
+
+func Test_ImportKeysFromPEM_importedKeysCanBeExported(t *testing.T) {
+	res, _ := ImportKeysFromPEM(readTestResource(t, "alice_pkcs8.pem"), "alice@example.com", "prpl-jabber")
+	defer os.Remove("test_resources/test_export_of_imported_keys.blah")
+
+	err := ExportKeysToFile(res, "test_resources/test_export_of_imported_keys.blah")
+	assertNil(t, err)
+
+	back, err := ImportKeysFromFile("test_resources/test_export_of_imported_keys.blah")
+	assertNil(t, err)
+	assertDeepEquals(t, back[0].Key().Public().DefaultFingerprint(), alicePrivateKey.Public().DefaultFingerprint())
+}
+
+func Test_readProperties_understandsCommentsSeparatorsEscapesAndContinuations(t *testing.T) {
+	props, err := readProperties(strings.NewReader(`# a comment
+! another comment
+
+first=one
+second : two
+third three
+fou\:rth=a\tb\u0041
+fifth = con\
+    tinued
+sixth=ends with a backslash\\
+seventh`))
+
+	assertNil(t, err)
+	assertDeepEquals(t, props, []property{
+		{"first", "one"},
+		{"second", "two"},
+		{"third", "three"},
+		{"fou:rth", "a\tbA"},
+		{"fifth", "continued"},
+		{"sixth", "ends with a backslash\\"},
+		{"seventh", ""},
+	})
+}
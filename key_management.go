@@ -8,11 +8,28 @@ import (
 	"hash"
 	"io"
 	"math/big"
+	"unsafe"
+
+	"github.com/twstrike/otr3/internal/securemem"
 )
 
 type dhKeyPair struct {
 	pub  *big.Int
 	priv *big.Int
+	// privMemory is the locked memory that holds priv
+	privMemory *securemem.Buffer
+}
+
+// newDHKeyPair returns a key pair that keeps a copy of priv in locked memory
+func newDHKeyPair(priv, pub *big.Int) dhKeyPair {
+	lockedPriv, mem := securemem.CopyInt(priv)
+	// A Conversation that is dropped without being ended never wipes its keys
+	mem.ReleaseWhenUnreachable()
+	return dhKeyPair{
+		pub:        pub,
+		priv:       lockedPriv,
+		privMemory: mem,
+	}
 }
 
 type akeKeys struct {
@@ -28,6 +45,36 @@ type sessionKeys struct {
 	extraKey                       [sha256.Size]byte
 }
 
+// sessionKeysPool holds the sessionKeys of every message in locked memory, which is reused from one message to the next
+var sessionKeysPool = securemem.NewPool(int(unsafe.Sizeof(sessionKeys{})))
+
+// lockedSessionKeys are sessionKeys kept in locked memory. They have to be wiped as soon as they are not needed anymore.
+type lockedSessionKeys struct {
+	*sessionKeys
+}
+
+func newLockedSessionKeys() lockedSessionKeys {
+	return lockedSessionKeys{(*sessionKeys)(sessionKeysPool.Get())}
+}
+
+// lockedAKEKeys holds both sets of keys of an AKE in locked memory
+type lockedAKEKeys struct {
+	revealSigKeys, signatureKeys *akeKeys
+	mem                          *securemem.Buffer
+}
+
+func newLockedAKEKeys() lockedAKEKeys {
+	size := unsafe.Sizeof(akeKeys{})
+	mem := securemem.New(int(2 * size))
+	// A Conversation that is dropped in the middle of an AKE never wipes its keys
+	mem.ReleaseWhenUnreachable()
+	return lockedAKEKeys{
+		revealSigKeys: (*akeKeys)(mem.Pointer()),
+		signatureKeys: (*akeKeys)(unsafe.Add(mem.Pointer(), size)),
+		mem:           mem,
+	}
+}
+
 type macKeyUsage struct {
 	ourKeyID, theirKeyID uint32
 	receivingKey         macKey
@@ -130,8 +177,8 @@ func (k *keyManagementContext) setTheirCurrentDHPubKey(key *big.Int) {
 }
 
 func (k *keyManagementContext) setOurCurrentDHKeys(priv *big.Int, pub *big.Int) {
-	k.ourCurrentDHKeys.priv = setBigInt(k.ourCurrentDHKeys.priv, priv)
-	k.ourCurrentDHKeys.pub = setBigInt(k.ourCurrentDHKeys.pub, pub)
+	k.ourCurrentDHKeys.wipe()
+	k.ourCurrentDHKeys = newDHKeyPair(priv, new(big.Int).Set(pub))
 }
 
 func (k *keyManagementContext) checkMessageCounter(message dataMsg) error {
@@ -161,10 +208,8 @@ func (k *keyManagementContext) generateNewDHKeyPair(randomness io.Reader) error
 	k.ourPreviousDHKeys.wipe()
 	k.ourPreviousDHKeys = k.ourCurrentDHKeys
 
-	k.ourCurrentDHKeys = dhKeyPair{
-		priv: newPrivKey,
-		pub:  modExp(g1, newPrivKey),
-	}
+	k.ourCurrentDHKeys = newDHKeyPair(newPrivKey, modExp(g1, newPrivKey))
+	wipeBigInt(newPrivKey)
 	k.ourKeyID++
 	return nil
 }
@@ -176,7 +221,7 @@ func (k *keyManagementContext) revealMACKeysForOurPreviousKeyID() {
 
 func (c *Conversation) rotateKeys(dataMessage dataMsg) error {
 	if err := c.keys.rotateOurKeys(dataMessage.recipientKeyID, c.rand()); err != nil {
-		return err
+		return c.randomnessError(err)
 	}
 	c.keys.rotateTheirKey(dataMessage.senderKeyID, dataMessage.y)
 
@@ -206,8 +251,8 @@ func (k *keyManagementContext) rotateTheirKey(senderKeyID uint32, pubDHKey *big.
 	}
 }
 
-func (k *keyManagementContext) calculateDHSessionKeys(ourKeyID, theirKeyID uint32) (sessionKeys, error) {
-	var ret sessionKeys
+func (k *keyManagementContext) calculateDHSessionKeys(ourKeyID, theirKeyID uint32) (lockedSessionKeys, error) {
+	var ret lockedSessionKeys
 
 	ourPrivKey, ourPubKey, err := k.pickOurKeys(ourKeyID)
 	if err != nil {
@@ -225,8 +270,8 @@ func (k *keyManagementContext) calculateDHSessionKeys(ourKeyID, theirKeyID uint3
 	return ret, nil
 }
 
-func calculateDHSessionKeys(ourPrivKey, ourPubKey, theirPubKey *big.Int) sessionKeys {
-	var ret sessionKeys
+func calculateDHSessionKeys(ourPrivKey, ourPubKey, theirPubKey *big.Int) lockedSessionKeys {
+	ret := newLockedSessionKeys()
 	var sendbyte, recvbyte byte
 
 	if gt(ourPubKey, theirPubKey) {
@@ -237,8 +282,10 @@ func calculateDHSessionKeys(ourPrivKey, ourPubKey, theirPubKey *big.Int) session
 		sendbyte, recvbyte = 0x02, 0x01
 	}
 
-	s := new(big.Int).Exp(theirPubKey, ourPrivKey, p)
+	s := modExp(theirPubKey, ourPrivKey)
 	secbytes := appendMPI(nil, s)
+	defer wipeBigInt(s)
+	defer wipeBytes(secbytes)
 
 	sha := sha1.New()
 	copy(ret.sendingAESKey[:], h(sendbyte, secbytes, sha))
@@ -290,8 +337,9 @@ func (k *keyManagementContext) pickTheirKey(theirKeyID uint32) (pubKey *big.Int,
 	return pubKey, err
 }
 
-func calculateAKEKeys(s *big.Int) (ssid [8]byte, revealSigKeys, signatureKeys akeKeys) {
+func calculateAKEKeys(s *big.Int, revealSigKeys, signatureKeys *akeKeys) (ssid [8]byte) {
 	secbytes := appendMPI(nil, s)
+	defer wipeBytes(secbytes)
 	sha := sha256.New()
 	keys := h(0x01, secbytes, sha)
 
@@ -3,6 +3,7 @@ package otr3
 import (
 	"math/big"
 	"testing"
+	"unsafe"
 )
 
 func Test_calculateDHSessionKeys(t *testing.T) {
@@ -110,7 +111,8 @@ func Test_pickOurKeys_shouldFailsForInvalidRecipientID(t *testing.T) {
 }
 
 func Test_calculateAKEKeys(t *testing.T) {
-	ssid, revealSigKeys, signatureKeys := calculateAKEKeys(expectedSharedSecret)
+	var revealSigKeys, signatureKeys akeKeys
+	ssid := calculateAKEKeys(expectedSharedSecret, &revealSigKeys, &signatureKeys)
 
 	assertDeepEquals(t, ssid[:], bytesFromHex("9cee5d2c7edbc86d"))
 	assertDeepEquals(t, revealSigKeys.c[:], bytesFromHex("5745340b350364a02a0ac1467a318dcc"))
@@ -336,3 +338,33 @@ func Test_generateNewDHKeypair_wipesPreviousDHKeysBeforePointingToCurrentDHKeys(
 	assertEquals(t, prevPrivKey.Int64(), int64(0))
 	assertEquals(t, prevPubKey.Int64(), int64(0))
 }
+
+func Test_generateNewDHKeypair_keepsThePrivateKeyInLockedMemory(t *testing.T) {
+	c := keyManagementContext{}
+
+	c.generateNewDHKeyPair(fixedRand([]string{"abcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcd"}))
+
+	assertEquals(t, uintptr(unsafe.Pointer(&c.ourCurrentDHKeys.priv.Bits()[0])), uintptr(c.ourCurrentDHKeys.privMemory.Pointer()))
+	assertDeepEquals(t, c.ourCurrentDHKeys.priv, bnFromHex("abcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcd"))
+}
+
+func Test_setOurCurrentDHKeys_keepsACopyOfThePrivateKeyInLockedMemory(t *testing.T) {
+	c := keyManagementContext{}
+	priv := fixedX()
+
+	c.setOurCurrentDHKeys(priv, fixedGX())
+
+	assertEquals(t, uintptr(unsafe.Pointer(&c.ourCurrentDHKeys.priv.Bits()[0])), uintptr(c.ourCurrentDHKeys.privMemory.Pointer()))
+	assertDeepEquals(t, c.ourCurrentDHKeys.priv, priv)
+}
+
+func Test_dhKeyPair_wipe_releasesTheLockedMemory(t *testing.T) {
+	c := keyManagementContext{}
+	c.generateNewDHKeyPair(fixedRand([]string{"abcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcd"}))
+	mem := c.ourCurrentDHKeys.privMemory
+
+	c.ourCurrentDHKeys.wipe()
+
+	assertNil(t, c.ourCurrentDHKeys.privMemory)
+	assertNil(t, mem.Bytes())
+}
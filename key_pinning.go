@@ -0,0 +1,49 @@
+package otr3
+
+import "bytes"
+
+var errPinnedKeyMismatch = newOtrError("the peer presented a key that is not pinned")
+
+// PinKeys makes the Conversation only accept the given keys from the peer. An AKE where the peer presents any other
+// key is aborted before the conversation becomes encrypted, and PinnedKeyMismatch is signalled with the fingerprint
+// of the presented key. Calling it without keys removes the pinning. It replaces the fingerprints given to
+// PinFingerprints.
+func (c *Conversation) PinKeys(keys ...*PublicKey) {
+	fingerprints := make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		fingerprints = append(fingerprints, k.DefaultFingerprint())
+	}
+	c.PinFingerprints(fingerprints...)
+}
+
+// PinFingerprints is like PinKeys, for keys known only by their default fingerprint
+func (c *Conversation) PinFingerprints(fingerprints ...[]byte) {
+	c.pinnedFingerprints = nil
+	for _, f := range fingerprints {
+		c.pinnedFingerprints = append(c.pinnedFingerprints, makeCopy(f))
+	}
+}
+
+func (c *Conversation) isPinned(fingerprint []byte) bool {
+	for _, f := range c.pinnedFingerprints {
+		if bytes.Equal(f, fingerprint) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPinnedKey is called once the peer has proven that it has the key it presented during the AKE
+func (c *Conversation) checkPinnedKey() error {
+	if len(c.pinnedFingerprints) == 0 {
+		return nil
+	}
+
+	fingerprint := c.theirKey.DefaultFingerprint()
+	if !c.isPinned(fingerprint) {
+		c.securityEventWithFingerprint(PinnedKeyMismatch, fingerprint)
+		return errPinnedKeyMismatch
+	}
+
+	return nil
+}
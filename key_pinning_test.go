@@ -0,0 +1,115 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func conversationsWithPinnedKeys(aliceKey, bobKey *PrivateKey) (alice, bob *Conversation) {
+	alice = &Conversation{Rand: rand.Reader}
+	alice.ourKey = aliceKey
+	alice.Policies = policies(allowV3)
+
+	bob = &Conversation{Rand: rand.Reader}
+	bob.ourKey = bobKey
+	bob.Policies = policies(allowV3)
+
+	return alice, bob
+}
+
+func Test_PinKeys_storesTheFingerprintsOfTheKeys(t *testing.T) {
+	c := &Conversation{}
+	c.PinKeys(&alicePrivateKey.PublicKey, &bobPrivateKey.PublicKey)
+
+	assertDeepEquals(t, c.pinnedFingerprints, [][]byte{alicePrivateKey.PublicKey.DefaultFingerprint(), bobPrivateKey.PublicKey.DefaultFingerprint()})
+}
+
+func Test_PinKeys_withoutKeysRemovesThePinning(t *testing.T) {
+	c := &Conversation{}
+	c.PinKeys(&alicePrivateKey.PublicKey)
+	c.PinKeys()
+
+	assertEquals(t, len(c.pinnedFingerprints), 0)
+}
+
+func Test_PinFingerprints_copiesTheFingerprints(t *testing.T) {
+	c := &Conversation{}
+	fingerprint := bobPrivateKey.PublicKey.DefaultFingerprint()
+	c.PinFingerprints(fingerprint)
+	fingerprint[0]++
+
+	assertEquals(t, c.isPinned(bobPrivateKey.PublicKey.DefaultFingerprint()), true)
+}
+
+func Test_AKE_succeedsWithThePinnedKey(t *testing.T) {
+	alice, bob := conversationsWithPinnedKeys(alicePrivateKey, bobPrivateKey)
+	alice.PinFingerprints([]byte{0x01, 0x02}, bobPrivateKey.PublicKey.DefaultFingerprint())
+	bob.PinKeys(&alicePrivateKey.PublicKey)
+
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	_, dhKey, _ := alice.Receive(dhCommit[0])
+	_, revealSig, _ := bob.Receive(dhKey[0])
+	_, sig, err := alice.Receive(revealSig[0])
+	assertNil(t, err)
+	_, _, err = bob.Receive(sig[0])
+	assertNil(t, err)
+
+	assertEquals(t, alice.IsEncrypted(), true)
+	assertEquals(t, bob.IsEncrypted(), true)
+}
+
+func Test_AKE_isAbortedWhenTheRevealSignatureMessageHasAnotherKey(t *testing.T) {
+	alice, bob := conversationsWithPinnedKeys(alicePrivateKey, bobPrivateKey)
+	alice.SetKeys(alicePrivateKey, &alicePrivateKey.PublicKey)
+	alice.PinKeys(&alicePrivateKey.PublicKey)
+
+	var events []SecurityEvent
+	var fingerprint []byte
+	alice.securityEventHandler = dynamicFingerprintSecurityEventHandler{
+		func(event SecurityEvent) { events = append(events, event) },
+		func(event SecurityEvent, f []byte) { events = append(events, event); fingerprint = f },
+	}
+
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	_, dhKey, _ := alice.Receive(dhCommit[0])
+	_, revealSig, _ := bob.Receive(dhKey[0])
+
+	var toSend []ValidMessage
+	var err error
+	expectedError := wrapOtrError("in reveal signature message", errPinnedKeyMismatch)
+	alice.expectMessageEvent(t, func() {
+		_, toSend, err = alice.Receive(revealSig[0])
+	}, MessageEventSetupError, nil, expectedError)
+
+	assertEquals(t, err, expectedError)
+	assertNil(t, toSend)
+	assertDeepEquals(t, events, []SecurityEvent{PinnedKeyMismatch})
+	assertDeepEquals(t, fingerprint, bobPrivateKey.PublicKey.DefaultFingerprint())
+	assertEquals(t, alice.IsEncrypted(), false)
+	assertEquals(t, alice.GetTheirKey(), &alicePrivateKey.PublicKey)
+}
+
+func Test_AKE_isAbortedWhenTheSignatureMessageHasAnotherKey(t *testing.T) {
+	alice, bob := conversationsWithPinnedKeys(alicePrivateKey, bobPrivateKey)
+	bob.PinKeys(&bobPrivateKey.PublicKey)
+
+	var events []SecurityEvent
+	bob.securityEventHandler = dynamicSecurityEventHandler{func(event SecurityEvent) {
+		events = append(events, event)
+	}}
+
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	_, dhKey, _ := alice.Receive(dhCommit[0])
+	_, revealSig, _ := bob.Receive(dhKey[0])
+	_, sig, _ := alice.Receive(revealSig[0])
+
+	var err error
+	expectedError := wrapOtrError("in signature message", errPinnedKeyMismatch)
+	bob.expectMessageEvent(t, func() {
+		_, _, err = bob.Receive(sig[0])
+	}, MessageEventSetupError, nil, expectedError)
+
+	assertEquals(t, err, expectedError)
+	assertDeepEquals(t, events, []SecurityEvent{PinnedKeyMismatch})
+	assertEquals(t, bob.IsEncrypted(), false)
+}
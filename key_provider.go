@@ -0,0 +1,50 @@
+package otr3
+
+var errNoPrivateKey = newOtrError("no private key to authenticate with")
+
+// KeyProvider is an interface for creating the private key of a Conversation lazily, like the create_privkey
+// operation of libotr. The Conversation asks for the key the first time the AKE needs it, which is when it has to
+// sign, so keys are only made for the accounts that are actually used.
+type KeyProvider interface {
+	// ProvidePrivateKey returns the private key to use. It will usually generate the key and persist it, for example
+	// with ExportKeysToFile, so the same key is used the next time. If it returns an error, the AKE fails with a
+	// MessageEventSetupError carrying the error, and the provider is asked again in the next AKE.
+	ProvidePrivateKey() (*PrivateKey, error)
+}
+
+type dynamicKeyProvider struct {
+	provide func() (*PrivateKey, error)
+}
+
+func (d dynamicKeyProvider) ProvidePrivateKey() (*PrivateKey, error) {
+	return d.provide()
+}
+
+// SetKeyProvider assigns the provider that is asked for our private key when the Conversation doesn't have one.
+// A key given to SetKeys is always used instead.
+func (c *Conversation) SetKeyProvider(provider KeyProvider) {
+	c.keyProvider = provider
+}
+
+// ensureOurKey asks the KeyProvider for our key if we don't have one yet
+func (c *Conversation) ensureOurKey() error {
+	if c.ourKey != nil {
+		return nil
+	}
+
+	if c.keyProvider == nil {
+		return errNoPrivateKey
+	}
+
+	key, err := c.keyProvider.ProvidePrivateKey()
+	if err != nil {
+		return err
+	}
+
+	if key == nil {
+		return errNoPrivateKey
+	}
+
+	c.ourKey = key
+	return nil
+}
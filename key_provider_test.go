@@ -0,0 +1,118 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func conversationsWithKeyProvider(provider KeyProvider) (alice, bob *Conversation) {
+	alice = &Conversation{Rand: rand.Reader}
+	alice.ourKey = alicePrivateKey
+	alice.Policies = policies(allowV3)
+
+	bob = &Conversation{Rand: rand.Reader}
+	bob.SetKeyProvider(provider)
+	bob.Policies = policies(allowV3)
+
+	return alice, bob
+}
+
+func Test_AKE_asksTheKeyProviderForOurKeyOnce(t *testing.T) {
+	calls := 0
+	alice, bob := conversationsWithKeyProvider(dynamicKeyProvider{func() (*PrivateKey, error) {
+		calls++
+		return bobPrivateKey, nil
+	}})
+
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	assertEquals(t, calls, 0)
+
+	_, dhKey, _ := alice.Receive(dhCommit[0])
+	_, revealSig, err := bob.Receive(dhKey[0])
+	assertNil(t, err)
+	assertEquals(t, calls, 1)
+
+	_, sig, _ := alice.Receive(revealSig[0])
+	_, _, err = bob.Receive(sig[0])
+	assertNil(t, err)
+
+	assertEquals(t, bob.IsEncrypted(), true)
+	assertEquals(t, bob.ourKey, bobPrivateKey)
+	assertDeepEquals(t, alice.GetTheirKey().serialize(), bobPrivateKey.PublicKey.serialize())
+
+	bob.ake = nil
+	bob.Receive(alice.QueryMessage())
+	assertEquals(t, calls, 1)
+}
+
+func Test_AKE_doesntAskTheKeyProviderWhenWeHaveAKey(t *testing.T) {
+	alice, bob := conversationsWithKeyProvider(dynamicKeyProvider{func() (*PrivateKey, error) {
+		t.Errorf("Didn't expect to be asked for a key")
+		return nil, nil
+	}})
+	bob.SetKeys(bobPrivateKey, nil)
+
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	_, dhKey, _ := alice.Receive(dhCommit[0])
+	_, _, err := bob.Receive(dhKey[0])
+	assertNil(t, err)
+}
+
+func Test_AKE_signalsASetupErrorWhenTheKeyProviderFails(t *testing.T) {
+	providerError := errors.New("can't write the key file")
+	alice, bob := conversationsWithKeyProvider(dynamicKeyProvider{func() (*PrivateKey, error) {
+		return nil, providerError
+	}})
+
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	_, dhKey, _ := alice.Receive(dhCommit[0])
+
+	var err error
+	bob.expectMessageEvent(t, func() {
+		_, _, err = bob.Receive(dhKey[0])
+	}, MessageEventSetupError, nil, providerError)
+
+	assertEquals(t, err, providerError)
+	assertNil(t, bob.ourKey)
+}
+
+func Test_AKE_signalsASetupErrorWithoutAKey(t *testing.T) {
+	alice, bob := conversationsWithKeyProvider(nil)
+
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	_, dhKey, _ := alice.Receive(dhCommit[0])
+
+	var err error
+	bob.expectMessageEvent(t, func() {
+		_, _, err = bob.Receive(dhKey[0])
+	}, MessageEventSetupError, nil, errNoPrivateKey)
+
+	assertEquals(t, err, errNoPrivateKey)
+}
+
+func Test_ensureOurKey_returnsAnErrorWhenTheProviderReturnsNoKey(t *testing.T) {
+	c := &Conversation{}
+	c.SetKeyProvider(dynamicKeyProvider{func() (*PrivateKey, error) {
+		return nil, nil
+	}})
+
+	assertEquals(t, c.ensureOurKey(), errNoPrivateKey)
+}
+
+func Test_ensureOurKey_asksAgainAfterAFailure(t *testing.T) {
+	calls := 0
+	c := &Conversation{}
+	c.SetKeyProvider(dynamicKeyProvider{func() (*PrivateKey, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("not yet")
+		}
+		return bobPrivateKey, nil
+	}})
+
+	assertNotNil(t, c.ensureOurKey())
+	assertNil(t, c.ensureOurKey())
+	assertEquals(t, c.ourKey, bobPrivateKey)
+	assertEquals(t, calls, 2)
+}
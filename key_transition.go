@@ -0,0 +1,120 @@
+package otr3
+
+import "crypto/sha256"
+
+var keyTransitionContext = []byte("OTR key transition\x00")
+
+var errCorruptKeyTransition = newOtrError("corrupt key transition")
+var errBadKeyTransitionSignature = newOtrError("bad signature in key transition")
+var errKeyTransitionNotAllowed = newOtrError("key transitions need the AllowPrivateTLVs policy")
+
+// AnnounceKeyTransition tells the peer that newKey replaces our current long-term key. It returns the messages to send
+// over the encrypted conversation. The announcement is signed by both keys, so the peer knows that whoever has the
+// current key also has the new one, and can carry its trust in the current key forward to the new key.
+// Our key is not changed by this function - SetKeys should be used with newKey before the next AKE.
+// The announcement is a private TLV, so both peers need the AllowPrivateTLVs policy.
+func (c *Conversation) AnnounceKeyTransition(newKey Signer) ([]ValidMessage, error) {
+	if !c.Policies.has(allowPrivateTLVs) {
+		return nil, errKeyTransitionNotAllowed
+	}
+
+	if c.msgState != encrypted {
+		return nil, newOtrError("cannot send message in current state")
+	}
+
+	t, err := c.keyTransitionTLV(c.ourKey, newKey)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagNormal, []tlv{t})
+	return msgs, err
+}
+
+// KeyTransitionHandler is an interface that will be invoked when the peer announces a new long-term key
+type KeyTransitionHandler interface {
+	// HandleKeyTransition is called once both signatures of the announcement are verified. oldFingerprint is the
+	// fingerprint of the key the peer used in the AKE of this conversation.
+	HandleKeyTransition(oldFingerprint, newFingerprint []byte, newKey *PublicKey)
+}
+
+type dynamicKeyTransitionHandler struct {
+	eh func(oldFingerprint, newFingerprint []byte, newKey *PublicKey)
+}
+
+func (d dynamicKeyTransitionHandler) HandleKeyTransition(oldFingerprint, newFingerprint []byte, newKey *PublicKey) {
+	d.eh(oldFingerprint, newFingerprint, newKey)
+}
+
+// SetKeyTransitionHandler assigns handler for key transitions announced by the peer
+func (c *Conversation) SetKeyTransitionHandler(handler KeyTransitionHandler) {
+	c.keyTransitionHandler = handler
+}
+
+func (c *Conversation) keyTransition(oldKey, newKey *PublicKey) {
+	if c.keyTransitionHandler != nil {
+		c.keyTransitionHandler.HandleKeyTransition(oldKey.DefaultFingerprint(), newKey.DefaultFingerprint(), newKey)
+	}
+}
+
+// keyTransitionHash is the data signed by both keys. It is bound to the session and to the instance tags of the
+// sender and the receiver, so an announcement can't be replayed in another conversation.
+func keyTransitionHash(ssid [8]byte, senderTag, receiverTag uint32, oldKey, newKey *PublicKey) []byte {
+	h := sha256.New()
+	h.Write(keyTransitionContext)
+	h.Write(ssid[:])
+	h.Write(appendWord(appendWord(nil, senderTag), receiverTag))
+	h.Write(oldKey.serialize())
+	h.Write(newKey.serialize())
+	return h.Sum(nil)
+}
+
+// keyTransitionTLV contains the new public key, followed by the signatures of the old key and of the new key
+func (c *Conversation) keyTransitionTLV(oldKey, newKey Signer) (tlv, error) {
+	hashed := keyTransitionHash(c.ssid, c.ourInstanceTag, c.theirInstanceTag, oldKey.Public(), newKey.Public())
+
+	oldSig, err := oldKey.Sign(c.rand(), hashed)
+	if err != nil {
+		return tlv{}, wrapOtrError("the current key couldn't sign the key transition", err)
+	}
+
+	newSig, err := newKey.Sign(c.rand(), hashed)
+	if err != nil {
+		return tlv{}, wrapOtrError("the new key couldn't sign the key transition", err)
+	}
+
+	value := append(append(newKey.Public().serialize(), oldSig...), newSig...)
+	return tlv{
+		tlvType:   tlvTypeKeyTransition,
+		tlvLength: uint16(len(value)),
+		tlvValue:  value,
+	}, nil
+}
+
+func (c *Conversation) processKeyTransitionTLV(t tlv, x dataMessageExtra) (toSend *tlv, err error) {
+	if !c.Policies.has(allowPrivateTLVs) {
+		return nil, nil
+	}
+
+	newKey := &PublicKey{}
+	rest, ok := newKey.Parse(t.tlvValue[:t.tlvLength])
+	if !ok || len(rest) != 2*dsaSignatureLength {
+		return nil, errCorruptKeyTransition
+	}
+
+	if err := newKey.validate(); err != nil {
+		return nil, err
+	}
+
+	oldKey := c.theirKey
+	hashed := keyTransitionHash(c.ssid, c.theirInstanceTag, c.ourInstanceTag, oldKey, newKey)
+	if _, ok := oldKey.Verify(hashed, rest[:dsaSignatureLength]); !ok {
+		return nil, errBadKeyTransitionSignature
+	}
+	if _, ok := newKey.Verify(hashed, rest[dsaSignatureLength:]); !ok {
+		return nil, errBadKeyTransitionSignature
+	}
+
+	c.keyTransition(oldKey, newKey)
+	return nil, nil
+}
@@ -0,0 +1,197 @@
+package otr3
+
+import (
+	"crypto/dsa"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// newPrivateKeyLike returns a new private key with the same parameters as priv, which is much faster than generating them
+func newPrivateKeyLike(priv *PrivateKey) *PrivateKey {
+	k := priv.PublicKey
+	x, _ := rand.Int(rand.Reader, sub(k.Q, bigOne))
+	x.Add(x, bigOne)
+
+	res := &PrivateKey{}
+	res.PublicKey = *publicKeyWith(k.P, k.Q, k.G, new(big.Int).Exp(k.G, x, k.P))
+	res.PrivateKey.PublicKey = res.PublicKey.PublicKey
+	res.X = x
+	return res
+}
+
+// privateTLVConversations returns two conversations in encrypted state that allow private TLVs
+func privateTLVConversations(t *testing.T) (alice, bob *Conversation) {
+	alice, bob = encryptedConversations(t)
+	alice.Policies.AllowPrivateTLVs()
+	bob.Policies.AllowPrivateTLVs()
+	return alice, bob
+}
+
+func Test_AnnounceKeyTransition_signalsTheNewKeyToThePeer(t *testing.T) {
+	alice, bob := privateTLVConversations(t)
+	newKey := newPrivateKeyLike(bobPrivateKey)
+
+	called := false
+	alice.SetKeyTransitionHandler(dynamicKeyTransitionHandler{func(oldFingerprint, newFingerprint []byte, k *PublicKey) {
+		assertDeepEquals(t, oldFingerprint, bobPrivateKey.PublicKey.DefaultFingerprint())
+		assertDeepEquals(t, newFingerprint, newKey.PublicKey.DefaultFingerprint())
+		assertDeepEquals(t, k.serialize(), newKey.PublicKey.serialize())
+		called = true
+	}})
+
+	msgs, err := bob.AnnounceKeyTransition(newKey)
+	assertNil(t, err)
+
+	_, _, err = alice.Receive(msgs[0])
+	assertNil(t, err)
+	assertEquals(t, called, true)
+}
+
+func Test_AnnounceKeyTransition_doesntChangeTheKeysOfTheConversations(t *testing.T) {
+	alice, bob := privateTLVConversations(t)
+
+	msgs, _ := bob.AnnounceKeyTransition(newPrivateKeyLike(bobPrivateKey))
+	alice.Receive(msgs[0])
+
+	assertEquals(t, bob.ourKey, bobPrivateKey)
+	assertDeepEquals(t, alice.GetTheirKey().serialize(), bobPrivateKey.PublicKey.serialize())
+}
+
+func Test_AnnounceKeyTransition_returnsAnErrorWhenNotEncrypted(t *testing.T) {
+	c := &Conversation{}
+	c.Policies.AllowPrivateTLVs()
+	c.ourKey = bobPrivateKey
+
+	_, err := c.AnnounceKeyTransition(newPrivateKeyLike(bobPrivateKey))
+
+	assertEquals(t, err, newOtrError("cannot send message in current state"))
+}
+
+func Test_processKeyTransitionTLV_returnsAnErrorForACorruptTLV(t *testing.T) {
+	c := &Conversation{}
+	c.Policies.AllowPrivateTLVs()
+	c.theirKey = &bobPrivateKey.PublicKey
+
+	_, err := c.processKeyTransitionTLV(tlv{tlvTypeKeyTransition, 0x02, []byte{0x00, 0x00}}, dataMessageExtra{})
+	assertEquals(t, err, errCorruptKeyTransition)
+
+	t1, _ := c.keyTransitionTLV(bobPrivateKey, newPrivateKeyLike(bobPrivateKey))
+	_, err = c.processKeyTransitionTLV(tlv{tlvTypeKeyTransition, t1.tlvLength - 1, t1.tlvValue}, dataMessageExtra{})
+	assertEquals(t, err, errCorruptKeyTransition)
+}
+
+func Test_processKeyTransitionTLV_returnsAnErrorWhenTheOldKeyDidntSign(t *testing.T) {
+	c := &Conversation{}
+	c.Policies.AllowPrivateTLVs()
+	c.theirKey = &bobPrivateKey.PublicKey
+	c.keyTransitionHandler = dynamicKeyTransitionHandler{func(oldFingerprint, newFingerprint []byte, k *PublicKey) {
+		t.Errorf("Didn't expect a key transition")
+	}}
+
+	// Someone who only has the new key can't announce a transition from bob's key
+	newKey := newPrivateKeyLike(bobPrivateKey)
+	t1, _ := c.keyTransitionTLV(newPrivateKeyLike(bobPrivateKey), newKey)
+	t2, _ := c.keyTransitionTLV(bobPrivateKey, newKey)
+	copy(t1.tlvValue[len(t1.tlvValue)-dsaSignatureLength:], t2.tlvValue[len(t2.tlvValue)-dsaSignatureLength:])
+
+	_, err := c.processKeyTransitionTLV(t1, dataMessageExtra{})
+	assertEquals(t, err, errBadKeyTransitionSignature)
+}
+
+func Test_processKeyTransitionTLV_returnsAnErrorWhenTheNewKeyDidntSign(t *testing.T) {
+	c := &Conversation{}
+	c.Policies.AllowPrivateTLVs()
+	c.theirKey = &bobPrivateKey.PublicKey
+	c.keyTransitionHandler = dynamicKeyTransitionHandler{func(oldFingerprint, newFingerprint []byte, k *PublicKey) {
+		t.Errorf("Didn't expect a key transition")
+	}}
+
+	t1, _ := c.keyTransitionTLV(bobPrivateKey, newPrivateKeyLike(bobPrivateKey))
+	t1.tlvValue[len(t1.tlvValue)-1] ^= 0x01
+
+	_, err := c.processKeyTransitionTLV(t1, dataMessageExtra{})
+	assertEquals(t, err, errBadKeyTransitionSignature)
+}
+
+func Test_processKeyTransitionTLV_returnsAnErrorForAWeakNewKey(t *testing.T) {
+	c := &Conversation{}
+	c.Policies.AllowPrivateTLVs()
+	c.theirKey = &bobPrivateKey.PublicKey
+
+	t1, _ := c.keyTransitionTLV(bobPrivateKey, weakPrivateKey())
+
+	_, err := c.processKeyTransitionTLV(t1, dataMessageExtra{})
+	assertEquals(t, err, ErrInvalidKeyPublicValue)
+}
+
+func Test_Receive_signalsAMalformedMessageForABadKeyTransition(t *testing.T) {
+	alice, bob := privateTLVConversations(t)
+
+	t1, _ := bob.keyTransitionTLV(newPrivateKeyLike(bobPrivateKey), newPrivateKeyLike(bobPrivateKey))
+	msgs, _, _ := bob.createSerializedDataMessage([]byte("hi"), messageFlagNormal, []tlv{t1})
+
+	var err error
+	alice.expectMessageEvent(t, func() {
+		_, _, err = alice.Receive(msgs[0])
+	}, MessageEventReceivedMessageMalformed, nil, nil)
+
+	assertEquals(t, err, errBadKeyTransitionSignature)
+}
+
+func Test_processKeyTransitionTLV_rejectsAnAnnouncementReplayedInAnotherSession(t *testing.T) {
+	alice, bob := privateTLVConversations(t)
+	announcement, _ := bob.keyTransitionTLV(bobPrivateKey, newPrivateKeyLike(bobPrivateKey))
+
+	_, err := alice.processKeyTransitionTLV(announcement, dataMessageExtra{})
+	assertNil(t, err)
+
+	alice, _ = privateTLVConversations(t)
+	alice.keyTransitionHandler = dynamicKeyTransitionHandler{func(oldFingerprint, newFingerprint []byte, k *PublicKey) {
+		t.Errorf("Didn't expect a key transition")
+	}}
+
+	_, err = alice.processKeyTransitionTLV(announcement, dataMessageExtra{})
+	assertEquals(t, err, errBadKeyTransitionSignature)
+}
+
+func Test_processKeyTransitionTLV_rejectsAnAnnouncementForAnotherInstance(t *testing.T) {
+	alice, bob := privateTLVConversations(t)
+	announcement, _ := bob.keyTransitionTLV(bobPrivateKey, newPrivateKeyLike(bobPrivateKey))
+	alice.ourInstanceTag++
+
+	_, err := alice.processKeyTransitionTLV(announcement, dataMessageExtra{})
+	assertEquals(t, err, errBadKeyTransitionSignature)
+}
+
+func Test_AnnounceKeyTransition_returnsAnErrorWithoutPrivateTLVs(t *testing.T) {
+	_, bob := encryptedConversations(t)
+
+	_, err := bob.AnnounceKeyTransition(newPrivateKeyLike(bobPrivateKey))
+
+	assertEquals(t, err, errKeyTransitionNotAllowed)
+}
+
+func Test_Receive_ignoresAKeyTransitionWithoutPrivateTLVs(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	bob.Policies.AllowPrivateTLVs()
+	alice.SetKeyTransitionHandler(dynamicKeyTransitionHandler{func(oldFingerprint, newFingerprint []byte, k *PublicKey) {
+		t.Errorf("Didn't expect a key transition")
+	}})
+
+	msgs, _ := bob.AnnounceKeyTransition(newPrivateKeyLike(bobPrivateKey))
+	_, _, err := alice.Receive(msgs[0])
+
+	assertNil(t, err)
+}
+
+func Test_AnnounceKeyTransition_returnsTheErrorOfTheSigner(t *testing.T) {
+	_, bob := privateTLVConversations(t)
+	newKey := newPrivateKeyLike(bobPrivateKey)
+	newKey.PrivateKey.X = new(big.Int)
+
+	_, err := bob.AnnounceKeyTransition(newKey)
+
+	assertEquals(t, errors.Is(err, dsa.ErrInvalidPublicKey), true)
+}
@@ -0,0 +1,84 @@
+package otr3
+
+import (
+	"crypto/dsa"
+	"math/big"
+)
+
+// dsaParameterSizes are the sizes in bits of P and Q that OTR can use. FIPS 186-3 allows bigger ones too, but OTR
+// signatures are always 20 bytes for r and 20 for s, so they only fit a Q of 160 bits
+var dsaParameterSizes = []struct{ l, n int }{
+	{1024, 160},
+}
+
+// primalityTestRounds is the number of Miller-Rabin rounds used to check P and Q. ProbablyPrime also runs a
+// Baillie-PSW test, which no known composite passes, so this is more than FIPS 186-3 asks for
+const primalityTestRounds = 20
+
+var bigOne = big.NewInt(1)
+
+// The errors that a DSA key of the peer fails validation with. The AKE fails with an error that wraps one of them,
+// so they can be told apart with errors.Is
+var ErrInvalidKeySize = newOtrError("the DSA key of the peer doesn't have allowed sizes for P and Q")
+var ErrInvalidKeyPrime = newOtrError("P or Q in the DSA key of the peer is not a prime")
+var ErrInvalidKeySubgroup = newOtrError("Q doesn't divide P-1 in the DSA key of the peer")
+var ErrInvalidKeyGenerator = newOtrError("G doesn't generate a subgroup of order Q in the DSA key of the peer")
+var ErrInvalidKeyPublicValue = newOtrError("Y is not in the subgroup of order Q in the DSA key of the peer")
+
+// validate checks that the key has the sizes OTR can use, and that its parameters and public value are
+// well formed, as described in SP 800-89. A peer could otherwise pick parameters that make it easy to forge
+// signatures with its key, or to find more than one private value that matches it.
+func (pub *PublicKey) validate() error {
+	if pub.Y == nil {
+		return ErrInvalidKeySize
+	}
+	return validateDSAKey(&pub.Parameters, pub.Y)
+}
+
+// validateDSAKey checks the parameters, and y too if it's not nil.
+// The checks that only need arithmetic are done first, since the primality tests are expensive.
+func validateDSAKey(params *dsa.Parameters, y *big.Int) error {
+	p, q, g := params.P, params.Q, params.G
+	if p == nil || q == nil || g == nil || !allowedDSAParameterSizes(p.BitLen(), q.BitLen()) {
+		return ErrInvalidKeySize
+	}
+
+	if p.Bit(0) == 0 || q.Bit(0) == 0 {
+		return ErrInvalidKeyPrime
+	}
+
+	if mod(sub(p, bigOne), q).Sign() != 0 {
+		return ErrInvalidKeySubgroup
+	}
+
+	if !inSubgroup(g, p, q) {
+		return ErrInvalidKeyGenerator
+	}
+
+	if y != nil && !inSubgroup(y, p, q) {
+		return ErrInvalidKeyPublicValue
+	}
+
+	if !q.ProbablyPrime(primalityTestRounds) || !p.ProbablyPrime(primalityTestRounds) {
+		return ErrInvalidKeyPrime
+	}
+
+	return nil
+}
+
+func allowedDSAParameterSizes(l, n int) bool {
+	for _, s := range dsaParameterSizes {
+		if s.l == l && s.n == n {
+			return true
+		}
+	}
+	return false
+}
+
+// inSubgroup returns true if x is in [2, p-1] and x^q = 1 mod p. When q is a prime, that means x has order q
+func inSubgroup(x, p, q *big.Int) bool {
+	if lte(x, bigOne) || gte(x, p) {
+		return false
+	}
+	return eq(new(big.Int).Exp(x, q, p), bigOne)
+}
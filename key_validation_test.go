@@ -0,0 +1,182 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func publicKeyWith(p, q, g, y *big.Int) *PublicKey {
+	pub := &PublicKey{}
+	pub.P, pub.Q, pub.G, pub.Y = p, q, g, y
+	return pub
+}
+
+func bobPublicKeyWith(f func(pub *PublicKey)) *PublicKey {
+	b := bobPrivateKey.PublicKey
+	pub := publicKeyWith(b.P, b.Q, b.G, b.Y)
+	f(pub)
+	return pub
+}
+
+// weakPrivateKey returns a private key with the parameters of bob's key, whose private value is Q.
+// It makes signatures that verify with a public value of 1.
+func weakPrivateKey() *PrivateKey {
+	b := bobPrivateKey.PublicKey
+	priv := &PrivateKey{}
+	priv.PublicKey = *publicKeyWith(b.P, b.Q, b.G, big.NewInt(1))
+	priv.PrivateKey.PublicKey = priv.PublicKey.PublicKey
+	priv.X = b.Q
+	return priv
+}
+
+func Test_validate_acceptsAWellFormedKey(t *testing.T) {
+	assertNil(t, alicePrivateKey.PublicKey.validate())
+	assertNil(t, bobPrivateKey.PublicKey.validate())
+}
+
+func Test_validate_rejectsAKeyWithMissingValues(t *testing.T) {
+	assertEquals(t, (&PublicKey{}).validate(), ErrInvalidKeySize)
+	assertEquals(t, bobPublicKeyWith(func(pub *PublicKey) { pub.Y = nil }).validate(), ErrInvalidKeySize)
+}
+
+func Test_validate_rejectsSizesThatAreNotAllowed(t *testing.T) {
+	short := bobPublicKeyWith(func(pub *PublicKey) { pub.P = new(big.Int).Rsh(pub.P, 512) })
+	assertEquals(t, short.validate(), ErrInvalidKeySize)
+
+	longQ := bobPublicKeyWith(func(pub *PublicKey) { pub.Q = new(big.Int).Lsh(pub.Q, 64) })
+	assertEquals(t, longQ.validate(), ErrInvalidKeySize)
+}
+
+func Test_allowedDSAParameterSizes_onlyAcceptsTheSizesOTRSignaturesFit(t *testing.T) {
+	assertEquals(t, allowedDSAParameterSizes(1024, 160), true)
+	assertEquals(t, allowedDSAParameterSizes(2048, 224), false)
+	assertEquals(t, allowedDSAParameterSizes(2048, 256), false)
+	assertEquals(t, allowedDSAParameterSizes(3072, 256), false)
+	assertEquals(t, allowedDSAParameterSizes(1024, 256), false)
+	assertEquals(t, allowedDSAParameterSizes(512, 160), false)
+}
+
+func Test_validate_rejectsAnEvenP(t *testing.T) {
+	pub := bobPublicKeyWith(func(pub *PublicKey) { pub.P = sub(pub.P, bigOne) })
+	assertEquals(t, pub.validate(), ErrInvalidKeyPrime)
+}
+
+func Test_validate_rejectsAQThatDoesntDividePMinusOne(t *testing.T) {
+	pub := bobPublicKeyWith(func(pub *PublicKey) { pub.Q = new(big.Int).Add(pub.Q, big.NewInt(2)) })
+	assertEquals(t, pub.validate(), ErrInvalidKeySubgroup)
+}
+
+func Test_validate_rejectsAGeneratorOutOfRange(t *testing.T) {
+	assertEquals(t, bobPublicKeyWith(func(pub *PublicKey) { pub.G = big.NewInt(1) }).validate(), ErrInvalidKeyGenerator)
+	assertEquals(t, bobPublicKeyWith(func(pub *PublicKey) { pub.G = pub.P }).validate(), ErrInvalidKeyGenerator)
+}
+
+func Test_validate_rejectsAGeneratorOfTheWrongOrder(t *testing.T) {
+	// P-1 has order 2
+	pub := bobPublicKeyWith(func(pub *PublicKey) { pub.G = sub(pub.P, bigOne) })
+	assertEquals(t, pub.validate(), ErrInvalidKeyGenerator)
+}
+
+func Test_validate_rejectsAPublicValueOutOfRange(t *testing.T) {
+	assertEquals(t, bobPublicKeyWith(func(pub *PublicKey) { pub.Y = big.NewInt(1) }).validate(), ErrInvalidKeyPublicValue)
+	assertEquals(t, bobPublicKeyWith(func(pub *PublicKey) { pub.Y = pub.P }).validate(), ErrInvalidKeyPublicValue)
+}
+
+func Test_validate_rejectsAPublicValueOutsideOfTheSubgroup(t *testing.T) {
+	pub := bobPublicKeyWith(func(pub *PublicKey) { pub.Y = big.NewInt(2) })
+	assertEquals(t, pub.validate(), ErrInvalidKeyPublicValue)
+}
+
+func Test_validate_rejectsACompositeQ(t *testing.T) {
+	// 2^159+1 is divisible by 3. Everything else about the key is well formed: P is a prime of the form kQ+1,
+	// and G has order Q
+	q := new(big.Int).Lsh(bigOne, 159)
+	q.Add(q, bigOne)
+
+	k := new(big.Int).Lsh(bigOne, 864)
+	p := new(big.Int)
+	for {
+		p.Mul(q, k)
+		p.Add(p, bigOne)
+		if p.ProbablyPrime(primalityTestRounds) {
+			break
+		}
+		k.Add(k, big.NewInt(2))
+	}
+
+	g := new(big.Int).Exp(big.NewInt(2), k, p)
+	y := new(big.Int).Exp(g, big.NewInt(12345), p)
+
+	assertEquals(t, publicKeyWith(p, q, g, y).validate(), ErrInvalidKeyPrime)
+}
+
+func Test_AKE_failsWhenTheRevealSignatureMessageHasAWeakKey(t *testing.T) {
+	alice := &Conversation{Rand: rand.Reader}
+	alice.ourKey = alicePrivateKey
+	alice.Policies = policies(allowV3)
+
+	bob := &Conversation{Rand: rand.Reader}
+	bob.ourKey = weakPrivateKey()
+	bob.Policies = policies(allowV3)
+
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	_, dhKey, _ := alice.Receive(dhCommit[0])
+	_, revealSig, _ := bob.Receive(dhKey[0])
+
+	var err error
+	expectedError := wrapOtrError("in reveal signature message", ErrInvalidKeyPublicValue)
+	alice.expectMessageEvent(t, func() {
+		_, _, err = alice.Receive(revealSig[0])
+	}, MessageEventSetupError, nil, expectedError)
+
+	assertEquals(t, err, expectedError)
+	assertEquals(t, errors.Is(err, ErrInvalidKeyPublicValue), true)
+	assertEquals(t, alice.msgState, plainText)
+	assertNil(t, alice.GetTheirKey())
+}
+
+func Test_AKE_keepsThePreviousKeyOfThePeerWhenItsNewKeyIsRejected(t *testing.T) {
+	alice := &Conversation{Rand: rand.Reader}
+	alice.SetKeys(alicePrivateKey, &bobPrivateKey.PublicKey)
+	alice.Policies = policies(allowV3)
+
+	bob := &Conversation{Rand: rand.Reader}
+	bob.ourKey = weakPrivateKey()
+	bob.Policies = policies(allowV3)
+
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	_, dhKey, _ := alice.Receive(dhCommit[0])
+	_, revealSig, _ := bob.Receive(dhKey[0])
+	alice.Receive(revealSig[0])
+
+	assertEquals(t, alice.GetTheirKey(), &bobPrivateKey.PublicKey)
+}
+
+func Test_AKE_failsWhenTheSignatureMessageHasAWeakKey(t *testing.T) {
+	alice := &Conversation{Rand: rand.Reader}
+	alice.ourKey = weakPrivateKey()
+	alice.Policies = policies(allowV3)
+
+	bob := &Conversation{Rand: rand.Reader}
+	bob.ourKey = bobPrivateKey
+	bob.Policies = policies(allowV3)
+
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	_, dhKey, _ := alice.Receive(dhCommit[0])
+	_, revealSig, _ := bob.Receive(dhKey[0])
+	_, sig, _ := alice.Receive(revealSig[0])
+
+	var err error
+	expectedError := wrapOtrError("in signature message", ErrInvalidKeyPublicValue)
+	bob.expectMessageEvent(t, func() {
+		_, _, err = bob.Receive(sig[0])
+	}, MessageEventSetupError, nil, expectedError)
+
+	assertEquals(t, err, expectedError)
+	assertEquals(t, errors.Is(err, ErrInvalidKeyPublicValue), true)
+	var otrErr OtrError
+	assertEquals(t, errors.As(err, &otrErr), true)
+	assertEquals(t, bob.msgState, plainText)
+}
@@ -14,18 +14,34 @@ import (
 	"math/big"
 	"os"
 
+	"github.com/twstrike/otr3/internal/securemem"
 	"github.com/twstrike/otr3/sexp"
 )
 
+// dsaSignatureLength is the length of an OTR signature: 20 bytes for r followed by 20 bytes for s
+const dsaSignatureLength = 2 * 20
+
 // PublicKey is a public key used to verify signed messages
 type PublicKey struct {
 	dsa.PublicKey
 }
 
-// PrivateKey is a private key used to sign messages
+// PrivateKey is a private key used to sign messages.
+// When the key is parsed, imported or generated, the PrivateKey keeps a copy of its private value X in locked memory,
+// and signs with that copy. X itself stays on the heap, so the embedded dsa.PrivateKey can be copied and used on its
+// own. Wipe wipes X and releases the locked copy as soon as the key is not needed anymore. A key that is dropped
+// without being wiped has its locked memory released by the garbage collector, once it is unreachable.
 type PrivateKey struct {
 	PublicKey
 	dsa.PrivateKey
+
+	// Nonces is how the nonces of the signatures made with this key are generated. It is RandomNonces by default.
+	Nonces NonceGeneration
+
+	// lockedX is the copy of X in xMemory, and lockedFrom is the X it was copied from
+	lockedX    *big.Int
+	lockedFrom *big.Int
+	xMemory    *securemem.Buffer
 }
 
 // Account is a holder for the private key associated with an account
@@ -36,6 +52,21 @@ type Account struct {
 	key      *PrivateKey
 }
 
+// Name returns the name of the account
+func (a *Account) Name() string {
+	return a.name
+}
+
+// Protocol returns the protocol of the account
+func (a *Account) Protocol() string {
+	return a.protocol
+}
+
+// Key returns the private key of the account
+func (a *Account) Key() *PrivateKey {
+	return a.key
+}
+
 func readSymbolAndExpect(r *bufio.Reader, s string) bool {
 	res, ok := readPotentialSymbol(r)
 	return ok && res == s
@@ -96,7 +127,7 @@ func ExportKeysToFile(acs []*Account, fname string) error {
 func ImportKeys(r io.Reader) ([]*Account, error) {
 	res, ok := readAccounts(bufio.NewReader(r))
 	if !ok {
-		return nil, newOtrError("couldn't import data into private key")
+		return nil, errCorruptKey
 	}
 	return res, nil
 }
@@ -174,6 +205,7 @@ func readPrivateKey(r *bufio.Reader) (*PrivateKey, bool) {
 	if ok2 {
 		k.PrivateKey = *res
 		k.PublicKey.PublicKey = k.PrivateKey.PublicKey
+		k.lockX()
 	}
 	ok3 := sexp.ReadListEnd(r)
 	return k, ok1 && ok2 && ok3
@@ -241,7 +273,9 @@ func (priv *PrivateKey) Parse(in []byte) (index []byte, ok bool) {
 	}
 
 	priv.PrivateKey.PublicKey = priv.PublicKey.PublicKey
-	index, priv.X, ok = extractMPI(in)
+	if index, priv.X, ok = extractMPI(in); ok {
+		priv.lockX()
+	}
 
 	return index, ok
 }
@@ -259,6 +293,11 @@ func (priv *PrivateKey) Serialize() []byte {
 	return priv.serialize()
 }
 
+// Serialize will return the serialization of the public key to a byte array, in the format used by OTR messages
+func (pub *PublicKey) Serialize() []byte {
+	return pub.serialize()
+}
+
 func (pub *PublicKey) serialize() []byte {
 	if pub.P == nil || pub.Q == nil || pub.G == nil || pub.Y == nil {
 		return nil
@@ -288,15 +327,31 @@ func (pub *PublicKey) DefaultFingerprint() []byte {
 	return pub.Fingerprint(sha1.New())
 }
 
-// Sign will generate a signature of a hashed data using dsa Sign.
+// Sign will generate a signature of a hashed data using dsa Sign, or with nonces generated as specified by RFC 6979,
+// depending on the Nonces of the key.
 func (priv *PrivateKey) Sign(rand io.Reader, hashed []byte) ([]byte, error) {
-	r, s, err := dsa.Sign(rand, &priv.PrivateKey, hashed)
+	var r, s *big.Int
+	var err error
+
+	switch priv.Nonces {
+	case DeterministicNonces:
+		r, s, err = signWithGeneratedNonces(rand, priv.signingKey(), hashed, false)
+	case HedgedNonces:
+		r, s, err = signWithGeneratedNonces(rand, priv.signingKey(), hashed, true)
+	default:
+		r, s, err = dsa.Sign(rand, priv.signingKey(), hashed)
+	}
+
 	if err == nil {
 		rBytes := r.Bytes()
 		sBytes := s.Bytes()
+		if len(rBytes) > dsaSignatureLength/2 || len(sBytes) > dsaSignatureLength/2 {
+			// Only a Q of 160 bits makes signatures that fit
+			return nil, errUnsupportedKey
+		}
 
-		out := make([]byte, 40)
-		copy(out[20-len(rBytes):], rBytes)
+		out := make([]byte, dsaSignatureLength)
+		copy(out[dsaSignatureLength/2-len(rBytes):], rBytes)
 		copy(out[len(out)-len(sBytes):], sBytes)
 		return out, nil
 	}
@@ -305,13 +360,13 @@ func (priv *PrivateKey) Sign(rand io.Reader, hashed []byte) ([]byte, error) {
 
 // Verify will verify a signature of a hashed data using dsa Verify.
 func (pub *PublicKey) Verify(hashed, sig []byte) (nextPoint []byte, sigOk bool) {
-	if len(sig) < 2*20 {
+	if len(sig) < dsaSignatureLength {
 		return nil, false
 	}
-	r := new(big.Int).SetBytes(sig[:20])
-	s := new(big.Int).SetBytes(sig[20:40])
+	r := new(big.Int).SetBytes(sig[:dsaSignatureLength/2])
+	s := new(big.Int).SetBytes(sig[dsaSignatureLength/2 : dsaSignatureLength])
 	ok := dsa.Verify(&pub.PublicKey, hashed, r, s)
-	return sig[20*2:], ok
+	return sig[dsaSignatureLength:], ok
 }
 
 func counterEncipher(key, iv, src, dst []byte) error {
@@ -374,21 +429,47 @@ func (priv *PrivateKey) Import(in []byte) bool {
 	priv.PrivateKey.Y = mpis[3]
 	priv.PrivateKey.X = mpis[4]
 	priv.PublicKey.PublicKey = priv.PrivateKey.PublicKey
+	priv.lockX()
 
 	a := new(big.Int).Exp(priv.PrivateKey.G, priv.PrivateKey.X, priv.PrivateKey.P)
 	return a.Cmp(priv.PrivateKey.Y) == 0
 }
 
-// Generate will generate a new DSA Private Key with the randomness provided. The parameter size used is 1024 and 160.
-func (priv *PrivateKey) Generate(rand io.Reader) error {
-	if err := dsa.GenerateParameters(&priv.PrivateKey.PublicKey.Parameters, rand, dsa.L1024N160); err != nil {
-		return err
+// lockX copies the private value to locked memory, releasing the previous copy.
+// The locked copy is only ever reachable from this PrivateKey, so the garbage collector can't release it while it is
+// still in use.
+func (priv *PrivateKey) lockX() {
+	priv.xMemory.Release()
+	priv.lockedX, priv.lockedFrom, priv.xMemory = nil, nil, nil
+
+	if priv.X == nil {
+		return
 	}
-	if err := dsa.GenerateKey(&priv.PrivateKey, rand); err != nil {
-		return err
+
+	x, mem := securemem.CopyInt(priv.X)
+	mem.ReleaseWhenUnreachable()
+	priv.lockedX, priv.lockedFrom, priv.xMemory = x, priv.X, mem
+}
+
+// signingKey returns the key to sign with. It is the locked copy of X, unless X has been replaced since it was copied
+// or the copy has been released.
+func (priv *PrivateKey) signingKey() *dsa.PrivateKey {
+	if priv.lockedX == nil || priv.X != priv.lockedFrom || priv.xMemory.Bytes() == nil {
+		return &priv.PrivateKey
 	}
-	priv.PublicKey.PublicKey = priv.PrivateKey.PublicKey
-	return nil
+
+	key := priv.PrivateKey
+	key.X = priv.lockedX
+	return &key
+}
+
+// Wipe wipes the private value of the key and releases the locked memory that holds its copy.
+// The key can't be used to sign anymore.
+func (priv *PrivateKey) Wipe() {
+	wipeBigInt(priv.X)
+	priv.X = nil
+	priv.xMemory.Release()
+	priv.lockedX, priv.lockedFrom, priv.xMemory = nil, nil, nil
 }
 
 func notHex(r rune) bool {
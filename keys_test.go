@@ -3,11 +3,15 @@ package otr3
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/dsa"
 	"crypto/rand"
 	"crypto/sha1"
+	"math/big"
 	"os"
 	"syscall"
 	"testing"
+	"unsafe"
 )
 
 var (
@@ -741,6 +745,89 @@ func Test_PrivateKey_parse_ParseXofAPrivateKeyCorrectly(t *testing.T) {
 	assertDeepEquals(t, ok, true)
 }
 
+func Test_PrivateKey_parse_keepsXInLockedMemory(t *testing.T) {
+	var priv PrivateKey
+	priv.Parse(serializedPrivateKey)
+
+	assertEquals(t, uintptr(unsafe.Pointer(&priv.lockedX.Bits()[0])), uintptr(priv.xMemory.Pointer()))
+	assertEquals(t, uintptr(unsafe.Pointer(&priv.X.Bits()[0])) != uintptr(priv.xMemory.Pointer()), true)
+	assertDeepEquals(t, priv.lockedX, priv.X)
+}
+
+func Test_PrivateKey_Sign_usesTheLockedCopyOfX(t *testing.T) {
+	var priv PrivateKey
+	priv.Parse(serializedPrivateKey)
+	priv.lockedX.SetInt64(1)
+
+	hashed := []byte("a message that has been hashed!!")
+	sig, _ := priv.Sign(rand.Reader, hashed)
+	_, ok := priv.PublicKey.Verify(hashed, sig)
+
+	assertEquals(t, ok, false)
+}
+
+func Test_PrivateKey_Sign_usesXWhenItHasBeenReplaced(t *testing.T) {
+	var priv PrivateKey
+	priv.Parse(serializedPrivateKey)
+	priv.PrivateKey.X = new(big.Int)
+
+	_, err := priv.Sign(rand.Reader, []byte("a message that has been hashed!!"))
+
+	assertNotNil(t, err)
+}
+
+func Test_PrivateKey_embeddedKeyCanStillSignAfterTheKeyIsCollected(t *testing.T) {
+	var key *dsa.PrivateKey
+	func() {
+		priv := &PrivateKey{}
+		priv.GenerateContext(context.Background(), rand.Reader, &GenerateOptions{Parameters: &alicePrivateKey.PublicKey.Parameters})
+		k := priv.PrivateKey
+		key = &k
+	}()
+	collectGarbage()
+
+	hashed := []byte("a message that has been hashed!!")
+	r, s, err := dsa.Sign(rand.Reader, key, hashed)
+
+	assertNil(t, err)
+	assertEquals(t, dsa.Verify(&key.PublicKey, hashed, r, s), true)
+}
+
+func Test_PrivateKey_parse_releasesThePreviousX(t *testing.T) {
+	var priv PrivateKey
+	priv.Parse(serializedPrivateKey)
+	previous := priv.xMemory
+
+	priv.Parse(serializedPrivateKey)
+
+	assertNil(t, previous.Bytes())
+	assertDeepEquals(t, priv.X, bnFromHex("14D0345A3562C480A039E3C72764F72D79043216"))
+}
+
+func Test_PrivateKey_Wipe_releasesX(t *testing.T) {
+	var priv PrivateKey
+	priv.Parse(serializedPrivateKey)
+	mem := priv.xMemory
+
+	priv.Wipe()
+
+	assertNil(t, priv.X)
+	assertNil(t, priv.lockedX)
+	assertNil(t, priv.xMemory)
+	assertNil(t, mem.Bytes())
+}
+
+func Test_PrivateKey_releasesXWhenTheKeyIsCollectedWithoutBeingWiped(t *testing.T) {
+	before := collectGarbage()
+
+	func() {
+		var priv PrivateKey
+		priv.Parse(serializedPrivateKey)
+	}()
+
+	assertEquals(t, collectGarbage(), before)
+}
+
 func Test_PrivateKey_parse_ReturnsNotOKIfPublicKeyIsNotOK(t *testing.T) {
 	var priv PrivateKey
 	_, ok := priv.Parse([]byte{
@@ -1003,12 +1090,14 @@ func Test_PrivateKey_ImportWithoutError(t *testing.T) {
 	priv := PrivateKey{}
 	ok := priv.Import([]byte(libOTRPrivateKey))
 	assertEquals(t, ok, true)
+	assertNotNil(t, priv.xMemory)
 }
 
 func Test_PrivateKey_GenerateWithoutError(t *testing.T) {
 	priv := PrivateKey{}
 	err := priv.Generate(rand.Reader)
 	assertEquals(t, err, nil)
+	assertNotNil(t, priv.xMemory)
 }
 
 func Test_PrivateKey_GenerateErrorWhenGenerateParams(t *testing.T) {
@@ -1075,3 +1164,16 @@ func Test_ExportKeysToFile_returnsAnErrorIfSomethingGoesWrong(t *testing.T) {
 	err := ExportKeysToFile([]*Account{acc}, "non_existing_directory/test_export_of_keys.blah")
 	assertDeepEquals(t, err.Error(), "open non_existing_directory/test_export_of_keys.blah: no such file or directory")
 }
+
+func Test_PrivateKey_PublicReturnsItsPublicKey(t *testing.T) {
+	assertEquals(t, alicePrivateKey.Public(), &alicePrivateKey.PublicKey)
+}
+
+func Test_Account_returnsItsValues(t *testing.T) {
+	acs, err := ImportKeysFromFile("test_resources/valid_key.asc")
+	assertNil(t, err)
+
+	assertEquals(t, acs[0].Name(), "foo2")
+	assertEquals(t, acs[0].Protocol(), "libpurple-Jabberx")
+	assertEquals(t, acs[0].Key(), acs[0].key)
+}
@@ -53,6 +53,10 @@ const (
 
 	// MessageEventReceivedMessageForOtherInstance is triggered when we receive and discard a message for another instance
 	MessageEventReceivedMessageForOtherInstance
+
+	// MessageEventRandomnessHealthTestFailed is signaled when the source of randomness, wrapped in a HealthCheckedReader, fails a health test.
+	// The operation that needed the randomness is not done, and the error is passed.
+	MessageEventRandomnessHealthTestFailed
 )
 
 // MessageEventHandler handles MessageEvents
@@ -120,6 +124,8 @@ func (s MessageEvent) String() string {
 		return "MessageEventReceivedMessageUnrecognized"
 	case MessageEventReceivedMessageForOtherInstance:
 		return "MessageEventReceivedMessageForOtherInstance"
+	case MessageEventRandomnessHealthTestFailed:
+		return "MessageEventRandomnessHealthTestFailed"
 	default:
 		return "MESSAGE EVENT: (THIS SHOULD NEVER HAPPEN)"
 	}
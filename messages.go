@@ -43,7 +43,7 @@ func (c *dhCommit) deserialize(msg []byte) error {
 	var ok1 bool
 	msg, c.encryptedGx, ok1 = extractData(msg)
 	_, h, ok2 := extractData(msg)
-	if !ok1 || !ok2 {
+	if !ok1 || !ok2 || len(h) != len(c.hashedGx) {
 		return newOtrError("corrupt DH commit message")
 	}
 	copy(c.hashedGx[:], h)
@@ -232,6 +232,9 @@ func (c *dataMsg) deserialize(msg []byte) error {
 	}
 
 	msg = msg[len(c.serializeUnsignedCache):]
+	if len(msg) < len(c.authenticator) {
+		return newOtrError("dataMsg.deserialize corrupted authenticator")
+	}
 	copy(c.authenticator[:], msg)
 	msg = msg[len(c.authenticator):]
 
@@ -257,6 +257,22 @@ func Test_dataMsgDeserialzeErrorWhenCorruptedTopHalfCtr(t *testing.T) {
 	assertEquals(t, err.Error(), "otr: dataMsg.deserialize corrupted topHalfCtr")
 }
 
+func Test_dataMsgDeserialzeErrorWhenCorruptedAuthenticator(t *testing.T) {
+	var msg []byte
+
+	msg = append(msg, 0x00)
+	msg = appendWord(msg, 0x00000000)
+	msg = appendWord(msg, 0x00000001)
+	msg = appendMPI(msg, big.NewInt(1))
+	msg = append(msg, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07)
+	msg = appendData(msg, []byte{0x00, 0x01, 0x02, 0x03})
+	msg = append(msg, 0x00, 0x01, 0x02, 0x03)
+
+	dataMessage := dataMsg{}
+	err := dataMessage.deserialize(msg)
+	assertEquals(t, err.Error(), "otr: dataMsg.deserialize corrupted authenticator")
+}
+
 func Test_dataMsgDeserialzeErrorWhenCorruptedRevealMACKeys(t *testing.T) {
 	var msg []byte
 
@@ -458,7 +474,7 @@ func Test_pad_PlainMessageUsingTLV0(t *testing.T) {
 	plain := plainDataMsg{
 		message: []byte("123456"),
 		tlvs: []tlv{
-			smpMessageAbort{}.tlv(),
+			tlv{tlvType: tlvTypeSMPAbort, tlvLength: 4, tlvValue: []byte{0x00, 0x00, 0x00, 0x00}},
 		},
 	}
 
@@ -0,0 +1,194 @@
+package otr3
+
+import (
+	"crypto/dsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"math/big"
+)
+
+// NonceGeneration describes how the secret nonce of every DSA signature made by a PrivateKey is generated.
+// A nonce that repeats, or that is only slightly predictable, reveals the private key to anyone who sees the
+// signatures, so a broken source of randomness during the AKE is enough to lose the long-term key.
+type NonceGeneration int
+
+const (
+	// RandomNonces reads the nonces from the source of randomness given to Sign. This is the default
+	RandomNonces NonceGeneration = iota
+	// DeterministicNonces derives the nonces from the private key and the signed data, as specified by RFC 6979.
+	// The source of randomness given to Sign is not used at all
+	DeterministicNonces
+	// HedgedNonces derives the nonces like DeterministicNonces, but also mixes in data read from the source of
+	// randomness given to Sign, as allowed by section 3.6 of RFC 6979. The nonces are safe as long as either the
+	// private key or the randomness is secret, and signing the same data twice gives different signatures.
+	HedgedNonces
+)
+
+const hedgedNonceEntropySize = 32
+
+// String returns the string representation of the NonceGeneration
+func (n NonceGeneration) String() string {
+	switch n {
+	case RandomNonces:
+		return "RandomNonces"
+	case DeterministicNonces:
+		return "DeterministicNonces"
+	case HedgedNonces:
+		return "HedgedNonces"
+	default:
+		return "NONCE GENERATION: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
+
+// signWithGeneratedNonces makes a DSA signature with nonces from an RFC 6979 generator.
+// OTR signs the output of SHA-256 based MACs, so SHA-256 is the hash used by the generator.
+func signWithGeneratedNonces(rand io.Reader, priv *dsa.PrivateKey, hashed []byte, hedged bool) (r, s *big.Int, err error) {
+	var extra []byte
+	if hedged {
+		extra = make([]byte, hedgedNonceEntropySize)
+		if _, err = io.ReadFull(rand, extra); err != nil {
+			return nil, nil, err
+		}
+		defer wipeBytes(extra)
+	}
+
+	g := newNonceGenerator(sha256.New, priv.Q, priv.X, hashed, extra)
+	defer g.wipe()
+
+	return signWithNonces(priv, hashed, g)
+}
+
+// signWithNonces makes a DSA signature, in the same way as dsa.Sign, with the first nonce from g that gives
+// a valid signature
+func signWithNonces(priv *dsa.PrivateKey, hashed []byte, g *nonceGenerator) (r, s *big.Int, err error) {
+	q := priv.Q
+	if q.Sign() <= 0 || priv.P.Sign() <= 0 || priv.G.Sign() <= 0 || priv.X == nil || priv.X.Sign() <= 0 || priv.X.Cmp(q) >= 0 {
+		return nil, nil, dsa.ErrInvalidPublicKey
+	}
+
+	// dsa.Sign and dsa.Verify use the whole hash, unlike RFC 6979 which truncates it to the size of q,
+	// so we do the same to make signatures that verify with PublicKey.Verify
+	z := new(big.Int).SetBytes(hashed)
+	for {
+		k := g.next()
+
+		r = new(big.Int).Exp(priv.G, k, priv.P)
+		r.Mod(r, q)
+
+		if r.Sign() != 0 {
+			// k is secret, so its inverse is computed with Fermat's little theorem, as dsa.Sign does
+			kInv := new(big.Int).Exp(k, new(big.Int).Sub(q, big.NewInt(2)), q)
+
+			s = new(big.Int).Mul(priv.X, r)
+			s.Add(s, z)
+			s.Mod(s, q)
+			s.Mul(s, kInv)
+			s.Mod(s, q)
+
+			wipeBigInt(kInv)
+		}
+
+		wipeBigInt(k)
+
+		if r.Sign() != 0 && s.Sign() != 0 {
+			return r, s, nil
+		}
+	}
+}
+
+// nonceGenerator is the HMAC_DRBG based generator of section 3.2 of RFC 6979
+type nonceGenerator struct {
+	q    *big.Int
+	qlen int
+	k, v []byte
+	hash func() hash.Hash
+}
+
+func newNonceGenerator(h func() hash.Hash, q, x *big.Int, hashed, extra []byte) *nonceGenerator {
+	g := &nonceGenerator{q: q, qlen: q.BitLen(), hash: h}
+
+	size := h().Size()
+	g.v = make([]byte, size)
+	for i := range g.v {
+		g.v[i] = 0x01
+	}
+	g.k = make([]byte, size)
+
+	privateOctets := g.intToOctets(x)
+	defer wipeBytes(privateOctets)
+	hashOctets := g.bitsToOctets(hashed)
+
+	g.update(0x00, privateOctets, hashOctets, extra)
+	g.update(0x01, privateOctets, hashOctets, extra)
+
+	return g
+}
+
+// next returns the next candidate nonce, which is always in [1, q-1]
+func (g *nonceGenerator) next() *big.Int {
+	for {
+		var t []byte
+		for len(t)*8 < g.qlen {
+			g.v = g.mac(g.v)
+			t = append(t, g.v...)
+		}
+
+		k := bitsToInt(t, g.qlen)
+		wipeBytes(t)
+
+		// The state is always updated, so the next call returns a different candidate if this one is rejected
+		g.update(0x00)
+
+		if k.Sign() > 0 && k.Cmp(g.q) < 0 {
+			return k
+		}
+		wipeBigInt(k)
+	}
+}
+
+// update sets K = HMAC_K(V || sep || data) and V = HMAC_K(V)
+func (g *nonceGenerator) update(sep byte, data ...[]byte) {
+	k := g.mac(append([][]byte{g.v, {sep}}, data...)...)
+	wipeBytes(g.k)
+	g.k = k
+	g.v = g.mac(g.v)
+}
+
+func (g *nonceGenerator) mac(data ...[]byte) []byte {
+	m := hmac.New(g.hash, g.k)
+	for _, d := range data {
+		m.Write(d)
+	}
+	return m.Sum(nil)
+}
+
+func (g *nonceGenerator) wipe() {
+	wipeBytes(g.k)
+	wipeBytes(g.v)
+}
+
+// intToOctets is int2octets from section 2.3.3 of RFC 6979
+func (g *nonceGenerator) intToOctets(x *big.Int) []byte {
+	res := make([]byte, (g.qlen+7)/8)
+	return x.FillBytes(res)
+}
+
+// bitsToOctets is bits2octets from section 2.3.4 of RFC 6979
+func (g *nonceGenerator) bitsToOctets(b []byte) []byte {
+	z := bitsToInt(b, g.qlen)
+	if z.Cmp(g.q) >= 0 {
+		z.Sub(z, g.q)
+	}
+	return g.intToOctets(z)
+}
+
+// bitsToInt is bits2int from section 2.3.2 of RFC 6979, which keeps the leftmost qlen bits of b
+func bitsToInt(b []byte, qlen int) *big.Int {
+	res := new(big.Int).SetBytes(b)
+	if blen := len(b) * 8; blen > qlen {
+		res.Rsh(res, uint(blen-qlen))
+	}
+	return res
+}
@@ -0,0 +1,175 @@
+package otr3
+
+import (
+	"crypto/dsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"hash"
+	"testing"
+)
+
+// rfc6979Key is the 1024-bit DSA key of appendix A.2.1 of RFC 6979
+func rfc6979Key() *dsa.PrivateKey {
+	k := &dsa.PrivateKey{}
+	k.P = bnFromHex("86F5CA03DCFEB225063FF830A0C769B9DD9D6153AD91D7CE27F787C43278B447E6533B86B18BED6E8A48B784A14C252C5BE0DBF60B86D6385BD2F12FB763ED8873ABFD3F5BA2E0A8C0A59082EAC056935E529DAF7C610467899C77ADEDFC846C881870B7B19B2B58F9BE0521A17002E3BDD6B86685EE90B3D9A1B02B782B1779")
+	k.Q = bnFromHex("996F967F6C8E388D9E28D01E205FBA957A5698B1")
+	k.G = bnFromHex("07B0F92546150B62514BB771E2A0C0CE387F03BDA6C56B505209FF25FD3C133D89BBCD97E904E09114D9A7DEFDEADFC9078EA544D2E401AEECC40BB9FBBF78FD87995A10A1C27CB7789B594BA7EFB5C4326A9FE59A070E136DB77175464ADCA417BE5DCE2F40D10A46A3A3943F26AB7FD9C0398FF8C76EE0A56826A8A88F1DBD")
+	k.X = bnFromHex("411602CB19A6CCC34494D79D98EF1E7ED5AF25F7")
+	k.Y = bnFromHex("5DF5E01DED31D0297E274E1691C192FE5868FEF9E19A84776454B100CF16F65392195A38B90523E2542EE61871C0440CB87C322FC4B4D2EC5E1E7EC766E1BE8D4CE935437DC11C3C8FD426338933EBFE739CB3465F4D3668C5E473508253B1E682F65CBDC4FAE93C2EA212390E54905A86E2223170B44EAA7DA5DD9FFCFB7F3B")
+	return k
+}
+
+var rfc6979Vectors = []struct {
+	name    string
+	hash    func() hash.Hash
+	message string
+	k, r, s string
+}{
+	{"SHA-1, sample", sha1.New, "sample",
+		"7BDB6B0FF756E1BB5D53583EF979082F9AD5BD5B", "2E1A0C2562B2912CAAF89186FB0F42001585DA55", "29EFB6B0AFF2D7A68EB70CA313022253B9A88DF5"},
+	{"SHA-256, sample", sha256.New, "sample",
+		"519BA0546D0C39202A7D34D7DFA5E760B318BCFB", "81F2F5850BE5BC123C43F71A3033E9384611C545", "4CDD914B65EB6C66A8AAAD27299BEE6B035F5E89"},
+	{"SHA-1, test", sha1.New, "test",
+		"5C842DF4F9E344EE09F056838B42C7A17F4A6433", "42AB2052FD43E123F0607F115052A67DCD9C5C77", "183916B0230D45B9931491D4C6B0BD2FB4AAF088"},
+	{"SHA-256, test", sha256.New, "test",
+		"5A67592E8128E03A417B0484410FB72C0B630E1A", "22518C127299B0F6FDC9872B282B9E70D0790812", "6837EC18F150D55DE95B5E29BE7AF5D01E4FE160"},
+}
+
+func hashOf(h func() hash.Hash, message string) []byte {
+	d := h()
+	d.Write([]byte(message))
+	return d.Sum(nil)
+}
+
+func Test_nonceGenerator_generatesTheNoncesOfTheRFC6979Vectors(t *testing.T) {
+	key := rfc6979Key()
+	for _, v := range rfc6979Vectors {
+		g := newNonceGenerator(v.hash, key.Q, key.X, hashOf(v.hash, v.message), nil)
+		if k := g.next(); k.Cmp(bnFromHex(v.k)) != 0 {
+			t.Errorf("%s: expected k to be %s, got %X", v.name, v.k, k)
+		}
+	}
+}
+
+func Test_signWithNonces_generatesTheSignaturesOfTheRFC6979Vectors(t *testing.T) {
+	key := rfc6979Key()
+	for _, v := range rfc6979Vectors {
+		hashed := hashOf(v.hash, v.message)
+		// The RFC truncates the hash to the size of q before signing, while dsa.Sign doesn't
+		truncated := hashed[:key.Q.BitLen()/8]
+		r, s, err := signWithNonces(key, truncated, newNonceGenerator(v.hash, key.Q, key.X, hashed, nil))
+
+		assertNil(t, err)
+		if r.Cmp(bnFromHex(v.r)) != 0 || s.Cmp(bnFromHex(v.s)) != 0 {
+			t.Errorf("%s: expected (%s, %s), got (%X, %X)", v.name, v.r, v.s, r, s)
+		}
+	}
+}
+
+func Test_nonceGenerator_returnsADifferentNonceEveryTime(t *testing.T) {
+	key := rfc6979Key()
+	g := newNonceGenerator(sha256.New, key.Q, key.X, hashOf(sha256.New, "sample"), nil)
+
+	first := g.next()
+	second := g.next()
+
+	if first.Cmp(second) == 0 {
+		t.Error("expected the nonces to be different")
+	}
+}
+
+func Test_nonceGenerator_mixesInTheExtraData(t *testing.T) {
+	key := rfc6979Key()
+	hashed := hashOf(sha256.New, "sample")
+
+	k := newNonceGenerator(sha256.New, key.Q, key.X, hashed, []byte{0x01}).next()
+
+	if k.Cmp(bnFromHex("519BA0546D0C39202A7D34D7DFA5E760B318BCFB")) == 0 {
+		t.Error("expected the extra data to change the nonce")
+	}
+}
+
+func Test_PrivateKey_Sign_withDeterministicNoncesDoesntReadFromRand(t *testing.T) {
+	priv := *alicePrivateKey
+	priv.Nonces = DeterministicNonces
+	hashed := hashOf(sha256.New, "hello")
+
+	sig1, err1 := priv.Sign(fixedRand([]string{}), hashed)
+	sig2, err2 := priv.Sign(fixedRand([]string{}), hashed)
+
+	assertNil(t, err1)
+	assertNil(t, err2)
+	assertDeepEquals(t, sig1, sig2)
+
+	_, ok := alicePrivateKey.PublicKey.Verify(hashed, sig1)
+	assertEquals(t, ok, true)
+}
+
+func Test_PrivateKey_Sign_withHedgedNoncesMixesInRandomness(t *testing.T) {
+	priv := *alicePrivateKey
+	priv.Nonces = HedgedNonces
+	hashed := hashOf(sha256.New, "hello")
+
+	sig1, err1 := priv.Sign(fixedRand([]string{"0000000000000000000000000000000000000000000000000000000000000001"}), hashed)
+	sig2, err2 := priv.Sign(fixedRand([]string{"0000000000000000000000000000000000000000000000000000000000000002"}), hashed)
+
+	assertNil(t, err1)
+	assertNil(t, err2)
+	if string(sig1) == string(sig2) {
+		t.Error("expected different signatures")
+	}
+
+	_, ok1 := alicePrivateKey.PublicKey.Verify(hashed, sig1)
+	_, ok2 := alicePrivateKey.PublicKey.Verify(hashed, sig2)
+	assertEquals(t, ok1, true)
+	assertEquals(t, ok2, true)
+}
+
+func Test_PrivateKey_Sign_withHedgedNoncesFailsWhenRandFails(t *testing.T) {
+	priv := *alicePrivateKey
+	priv.Nonces = HedgedNonces
+
+	_, err := priv.Sign(fixedRand([]string{"ABCD"}), hashOf(sha256.New, "hello"))
+
+	assertEquals(t, err.Error(), "unexpected EOF")
+}
+
+func Test_AKE_completesWithDeterministicAndHedgedNonces(t *testing.T) {
+	aliceKey := *alicePrivateKey
+	aliceKey.Nonces = DeterministicNonces
+	bobKey := *bobPrivateKey
+	bobKey.Nonces = HedgedNonces
+
+	alice, bob := encryptedConversationsWithKeys(t, &aliceKey, &bobKey)
+
+	assertEquals(t, alice.msgState, encrypted)
+	assertEquals(t, bob.msgState, encrypted)
+}
+
+func Test_signWithNonces_rejectsAnInvalidKey(t *testing.T) {
+	key := rfc6979Key()
+	key.X = key.Q
+	hashed := hashOf(sha256.New, "sample")
+
+	_, _, err := signWithNonces(key, hashed, nil)
+
+	assertEquals(t, err, dsa.ErrInvalidPublicKey)
+}
+
+func Test_NonceGeneration_String(t *testing.T) {
+	assertEquals(t, RandomNonces.String(), "RandomNonces")
+	assertEquals(t, DeterministicNonces.String(), "DeterministicNonces")
+	assertEquals(t, HedgedNonces.String(), "HedgedNonces")
+	assertEquals(t, NonceGeneration(42).String(), "NONCE GENERATION: (THIS SHOULD NEVER HAPPEN)")
+}
+
+func Test_PrivateKey_Sign_returnsAnErrorWhenTheSignatureDoesntFitOTR(t *testing.T) {
+	priv := *alicePrivateKey
+	priv.Nonces = DeterministicNonces
+	priv.PrivateKey.Q = bnFromHex("F2C3119374CE76C9356990B465374A17F23F9ED35089BD969F61C6DDE9998C1F")
+
+	sig, err := priv.Sign(fixedRand([]string{}), hashOf(sha256.New, "hello"))
+
+	assertNil(t, sig)
+	assertEquals(t, err, errUnsupportedKey)
+}
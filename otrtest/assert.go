@@ -0,0 +1,52 @@
+package otrtest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/twstrike/otr3"
+)
+
+// AssertEventually delivers messages until cond is true. The test fails if the network runs out of messages, or
+// delivers Network.MaxDeliveries of them, before that.
+func AssertEventually(t testing.TB, n *Network, cond func() bool, description string) {
+	t.Helper()
+
+	for i := 0; !cond(); i++ {
+		if i == n.maxDeliveries() || !n.Step() {
+			t.Fatalf("otrtest: expected %s, but it never happened", description)
+			return
+		}
+	}
+}
+
+// AssertEventuallyEncrypted delivers messages until both peers are in an encrypted conversation
+func AssertEventuallyEncrypted(t testing.TB, n *Network) {
+	t.Helper()
+
+	AssertEventually(t, n, func() bool {
+		return len(n.peers) == 2 && n.peers[0].Conversation.IsEncrypted() && n.peers[1].Conversation.IsEncrypted()
+	}, "an encrypted conversation")
+}
+
+// AssertEventuallySMPSucceeded delivers messages until both peers have been told that the authentication succeeded
+func AssertEventuallySMPSucceeded(t testing.TB, n *Network) {
+	t.Helper()
+
+	AssertEventually(t, n, func() bool {
+		return len(n.peers) == 2 &&
+			n.peers[0].Events.HasSMPEvent(otr3.SMPEventSuccess) && n.peers[1].Events.HasSMPEvent(otr3.SMPEventSuccess)
+	}, "a successful authentication")
+}
+
+// AssertReceived checks that p has received exactly messages, in that order
+func AssertReceived(t testing.TB, p *Peer, messages ...string) {
+	t.Helper()
+
+	if len(p.Received) == 0 && len(messages) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(p.Received, messages) {
+		t.Errorf("otrtest: expected %s to receive %q, but it received %q", p.Name, messages, p.Received)
+	}
+}
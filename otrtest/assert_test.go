@@ -0,0 +1,80 @@
+package otrtest
+
+import (
+	"testing"
+)
+
+func TestAssertEventuallyFailsWhenTheNetworkRunsOutOfMessages(t *testing.T) {
+	n := NewNetwork(1)
+	alice, _ := newOTRPeers(t, n)
+	n.Loss = 1
+	ft := &fakeT{}
+
+	alice.Query()
+	AssertEventuallyEncrypted(ft, n)
+
+	if len(ft.failures) != 1 {
+		t.Errorf("expected one failure, but got %q", ft.failures)
+	}
+}
+
+func TestAssertEventuallyStopsAfterTheMostDeliveries(t *testing.T) {
+	n := NewNetwork(1)
+	alice, _ := newPlainPeers(n)
+	n.MaxDeliveries = 2
+	ft := &fakeT{}
+	sendAll(t, alice, "one", "two", "three")
+
+	AssertEventually(ft, n, func() bool { return false }, "nothing")
+
+	if len(ft.failures) != 1 || n.Stats().Delivered != 2 {
+		t.Errorf("expected to fail after 2 messages, but got %q after %d", ft.failures, n.Stats().Delivered)
+	}
+}
+
+func TestAssertEventuallyEncryptedFailsWhenTheMessagesAreTooLongForTheNetwork(t *testing.T) {
+	n := NewNetwork(1)
+	alice, _ := newOTRPeers(t, n)
+	n.MaxMessageSize = 150
+	ft := &fakeT{}
+
+	alice.Query()
+	AssertEventuallyEncrypted(ft, n)
+
+	if len(ft.failures) != 1 {
+		t.Errorf("expected one failure, but got %q", ft.failures)
+	}
+}
+
+func TestAssertEventuallySMPSucceededFailsWhenTheSecretsAreDifferent(t *testing.T) {
+	n := NewNetwork(1)
+	alice, bob := newOTRPeers(t, n)
+	alice.Query()
+	AssertEventuallyEncrypted(t, n)
+	ft := &fakeT{}
+
+	alice.StartAuthenticate("", "our secret")
+	n.Run()
+	bob.ProvideAuthenticationSecret("another secret")
+	AssertEventuallySMPSucceeded(ft, n)
+
+	if len(ft.failures) != 1 {
+		t.Errorf("expected one failure, but got %q", ft.failures)
+	}
+}
+
+func TestAssertReceivedFailsWhenTheMessagesAreDifferent(t *testing.T) {
+	n := NewNetwork(1)
+	alice, bob := newPlainPeers(n)
+	ft := &fakeT{}
+	sendAll(t, alice, "one", "two")
+	n.Run()
+
+	AssertReceived(ft, bob, "two", "one")
+	AssertReceived(ft, bob, "one")
+	AssertReceived(ft, bob, "one", "two")
+
+	if len(ft.failures) != 2 {
+		t.Errorf("expected two failures, but got %q", ft.failures)
+	}
+}
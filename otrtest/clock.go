@@ -0,0 +1,41 @@
+package otrtest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a virtual clock. It only moves when it is told to, so timeouts and heartbeats can be tested without
+// waiting. Give its Now method to Conversation.SetClock. It is safe for concurrent use.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a Clock that starts at now
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the time of the clock
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// advanceTo moves the clock forward to t. The clock never goes back, so nothing happens if t has passed.
+func (c *Clock) advanceTo(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.After(c.now) {
+		c.now = t
+	}
+}
@@ -0,0 +1,24 @@
+package otrtest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockOnlyMovesWhenItIsAdvanced(t *testing.T) {
+	c := NewClock(StartTime)
+	c.Advance(time.Minute)
+
+	if !c.Now().Equal(StartTime.Add(time.Minute)) {
+		t.Errorf("expected the clock to be a minute later, but it is %v", c.Now())
+	}
+}
+
+func TestClockNeverGoesBack(t *testing.T) {
+	c := NewClock(StartTime)
+	c.advanceTo(StartTime.Add(-time.Minute))
+
+	if !c.Now().Equal(StartTime) {
+		t.Errorf("expected the clock to stay at %v, but it is %v", StartTime, c.Now())
+	}
+}
@@ -0,0 +1,119 @@
+package otrtest
+
+import (
+	"sync"
+
+	"github.com/twstrike/otr3"
+)
+
+// SMPEvent is an SMP event with the progress and question it was signaled with
+type SMPEvent struct {
+	Event    otr3.SMPEvent
+	Progress int
+	Question string
+}
+
+// MessageEvent is a message event with the message and error it was signaled with
+type MessageEvent struct {
+	Event   otr3.MessageEvent
+	Message []byte
+	Err     error
+}
+
+// EventRecorder keeps every security, SMP and message event of a conversation, in the order they happened.
+// It is safe for concurrent use.
+type EventRecorder struct {
+	mu       sync.Mutex
+	security []otr3.SecurityEvent
+	smp      []SMPEvent
+	message  []MessageEvent
+}
+
+// NewEventRecorder returns an EventRecorder that handles the security, SMP and message events of c. It replaces the
+// handlers c had for them.
+func NewEventRecorder(c *otr3.Conversation) *EventRecorder {
+	r := &EventRecorder{}
+	c.SetSecurityEventHandler(r)
+	c.SetSMPEventHandler(r)
+	c.SetMessageEventHandler(r)
+	return r
+}
+
+// HandleSecurityEvent implements otr3.SecurityEventHandler
+func (r *EventRecorder) HandleSecurityEvent(event otr3.SecurityEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.security = append(r.security, event)
+}
+
+// HandleSMPEvent implements otr3.SMPEventHandler
+func (r *EventRecorder) HandleSMPEvent(event otr3.SMPEvent, progressPercent int, question string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.smp = append(r.smp, SMPEvent{event, progressPercent, question})
+}
+
+// HandleMessageEvent implements otr3.MessageEventHandler
+func (r *EventRecorder) HandleMessageEvent(event otr3.MessageEvent, message []byte, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.message = append(r.message, MessageEvent{event, append([]byte(nil), message...), err})
+}
+
+// SecurityEvents returns the security events recorded so far
+func (r *EventRecorder) SecurityEvents() []otr3.SecurityEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]otr3.SecurityEvent(nil), r.security...)
+}
+
+// SMPEvents returns the SMP events recorded so far
+func (r *EventRecorder) SMPEvents() []SMPEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]SMPEvent(nil), r.smp...)
+}
+
+// MessageEvents returns the message events recorded so far
+func (r *EventRecorder) MessageEvents() []MessageEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]MessageEvent(nil), r.message...)
+}
+
+// HasSecurityEvent returns true if event has been recorded
+func (r *EventRecorder) HasSecurityEvent(event otr3.SecurityEvent) bool {
+	for _, e := range r.SecurityEvents() {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// HasSMPEvent returns true if event has been recorded
+func (r *EventRecorder) HasSMPEvent(event otr3.SMPEvent) bool {
+	for _, e := range r.SMPEvents() {
+		if e.Event == event {
+			return true
+		}
+	}
+	return false
+}
+
+// HasMessageEvent returns true if event has been recorded
+func (r *EventRecorder) HasMessageEvent(event otr3.MessageEvent) bool {
+	for _, e := range r.MessageEvents() {
+		if e.Event == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Reset forgets every event recorded so far
+func (r *EventRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.security, r.smp, r.message = nil, nil, nil
+}
@@ -0,0 +1,66 @@
+package otrtest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/twstrike/otr3"
+)
+
+func TestEventRecorderRecordsTheEventsOfTheConversation(t *testing.T) {
+	n := NewNetwork(1)
+	alice, bob := newOTRPeers(t, n)
+
+	alice.Query()
+	n.Run()
+
+	expected := []otr3.SecurityEvent{otr3.GoneSecure}
+	if !reflect.DeepEqual(alice.Events.SecurityEvents(), expected) || !reflect.DeepEqual(bob.Events.SecurityEvents(), expected) {
+		t.Errorf("expected both peers to go secure, but got %v and %v", alice.Events.SecurityEvents(), bob.Events.SecurityEvents())
+	}
+}
+
+func TestEventRecorderKeepsEverythingAnEventWasSignaledWith(t *testing.T) {
+	r := &EventRecorder{}
+	err := errors.New("something failed")
+	r.HandleSMPEvent(otr3.SMPEventAskForAnswer, 25, "Where did we meet?")
+	r.HandleMessageEvent(otr3.MessageEventReceivedMessageGeneralError, []byte("oops"), err)
+
+	if !reflect.DeepEqual(r.SMPEvents(), []SMPEvent{{otr3.SMPEventAskForAnswer, 25, "Where did we meet?"}}) {
+		t.Errorf("unexpected SMP events %v", r.SMPEvents())
+	}
+	if !reflect.DeepEqual(r.MessageEvents(), []MessageEvent{{otr3.MessageEventReceivedMessageGeneralError, []byte("oops"), err}}) {
+		t.Errorf("unexpected message events %v", r.MessageEvents())
+	}
+}
+
+func TestEventRecorderTellsWhetherAnEventHappened(t *testing.T) {
+	r := &EventRecorder{}
+	r.HandleSecurityEvent(otr3.GoneSecure)
+	r.HandleSMPEvent(otr3.SMPEventSuccess, 100, "")
+	r.HandleMessageEvent(otr3.MessageEventLogHeartbeatSent, nil, nil)
+
+	if !r.HasSecurityEvent(otr3.GoneSecure) || r.HasSecurityEvent(otr3.GoneInsecure) {
+		t.Error("expected only GoneSecure to have happened")
+	}
+	if !r.HasSMPEvent(otr3.SMPEventSuccess) || r.HasSMPEvent(otr3.SMPEventFailure) {
+		t.Error("expected only SMPEventSuccess to have happened")
+	}
+	if !r.HasMessageEvent(otr3.MessageEventLogHeartbeatSent) || r.HasMessageEvent(otr3.MessageEventLogHeartbeatReceived) {
+		t.Error("expected only MessageEventLogHeartbeatSent to have happened")
+	}
+}
+
+func TestEventRecorderForgetsEverythingWhenReset(t *testing.T) {
+	r := &EventRecorder{}
+	r.HandleSecurityEvent(otr3.GoneSecure)
+	r.HandleSMPEvent(otr3.SMPEventSuccess, 100, "")
+	r.HandleMessageEvent(otr3.MessageEventLogHeartbeatSent, nil, nil)
+
+	r.Reset()
+
+	if len(r.SecurityEvents())+len(r.SMPEvents())+len(r.MessageEvents()) != 0 {
+		t.Error("expected no events after a reset")
+	}
+}
@@ -0,0 +1,341 @@
+// Package otrtest simulates the network between two OTR conversations, so that applications, and the library itself,
+// can test how conversations behave when messages are lost, duplicated, reordered, delayed or too long.
+//
+// A Network carries the messages of its two peers. It has a virtual clock that the conversations use as well, so
+// delays, heartbeats and timeouts don't take any real time:
+//
+//	n := otrtest.NewNetwork(1)
+//	n.Loss = 0.1
+//	alice := n.NewPeer("alice", aliceConversation)
+//	bob := n.NewPeer("bob", bobConversation)
+//
+//	alice.Query()
+//	otrtest.AssertEventuallyEncrypted(t, n)
+//
+//	alice.Send("hello")
+//	n.Run()
+//	otrtest.AssertReceived(t, bob, "hello")
+//
+// Everything random about the network comes from its seed, so a failing test runs exactly the same way again.
+// Networks, peers and conversations are not safe for concurrent use.
+package otrtest
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/twstrike/otr3"
+)
+
+// ErrTooManyDeliveries is returned by Network.Run when the peers are still sending messages to each other after
+// Network.MaxDeliveries messages
+var ErrTooManyDeliveries = errors.New("otrtest: the peers didn't stop sending messages")
+
+// DefaultMaxDeliveries is how many messages a Network delivers before giving up, when its MaxDeliveries is zero
+const DefaultMaxDeliveries = 10000
+
+// StartTime is when the clock of every network starts. The day doesn't matter, as long as it's always the same.
+var StartTime = time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Network carries the messages between two peers. The zero values of its fields make it deliver every message once,
+// in order and right away. They can be changed at any time, and apply to the messages sent after that.
+type Network struct {
+	// Loss is the probability that a message is lost
+	Loss float64
+	// Duplication is the probability that a message is delivered twice
+	Duplication float64
+	// Reordering is the probability that a message is held back until the next message of the same peer has
+	// overtaken it
+	Reordering float64
+	// Delay is how long every message takes to arrive, and Jitter the most that is randomly added to it
+	Delay, Jitter time.Duration
+	// MaxMessageSize is the length of the longest message the network carries. Longer messages are lost, like some
+	// servers do, so the conversations have to fragment them with SetFragmentSize. Zero means there's no limit.
+	MaxMessageSize int
+	// MaxDeliveries is how many messages Run and the assertions deliver before giving up. Zero means DefaultMaxDeliveries.
+	MaxDeliveries int
+
+	// Clock is the time of the network, and of the conversations of its peers
+	Clock *Clock
+
+	rand     *rand.Rand
+	peers    []*Peer
+	inFlight []*packet
+	seq      int
+	stats    Stats
+}
+
+// Stats counts what happened to the messages on a network
+type Stats struct {
+	Sent, Delivered, Lost, Duplicated, Reordered int
+}
+
+type packet struct {
+	to        *Peer
+	message   otr3.ValidMessage
+	deliverAt time.Time
+	seq       int
+}
+
+// NewNetwork returns a network whose randomness comes from seed, and whose clock starts at the same time every time
+func NewNetwork(seed int64) *Network {
+	return &Network{
+		Clock: NewClock(StartTime),
+		rand:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// NewPeer connects c to the network. The conversation uses the clock of the network from now on, and its events are
+// recorded by the Events of the peer. A network connects only two peers, and NewPeer panics if it's called a third
+// time.
+func (n *Network) NewPeer(name string, c *otr3.Conversation) *Peer {
+	if len(n.peers) == 2 {
+		panic("otrtest: a network connects only two peers")
+	}
+
+	c.SetClock(n.Clock.Now)
+	p := &Peer{
+		Name:         name,
+		Conversation: c,
+		Events:       NewEventRecorder(c),
+		network:      n,
+	}
+	n.peers = append(n.peers, p)
+	return p
+}
+
+// Stats returns what has happened to the messages so far
+func (n *Network) Stats() Stats {
+	return n.stats
+}
+
+// Run delivers messages, moving the clock forward as needed, until there are no more. It returns
+// ErrTooManyDeliveries if there are still messages after MaxDeliveries of them.
+func (n *Network) Run() error {
+	for i := 0; i < n.maxDeliveries(); i++ {
+		if !n.Step() {
+			return nil
+		}
+	}
+
+	if n.pending() {
+		return ErrTooManyDeliveries
+	}
+	return nil
+}
+
+// Step delivers the next message, moving the clock forward to when it arrives. It returns false if there was no
+// message to deliver.
+func (n *Network) Step() bool {
+	if len(n.inFlight) == 0 {
+		n.releaseHeld()
+	}
+
+	p := n.next(time.Time{})
+	if p == nil {
+		return false
+	}
+
+	n.Clock.advanceTo(p.deliverAt)
+	n.deliver(p)
+	return true
+}
+
+// Advance moves the clock forward by d, delivering the messages that arrive in that time
+func (n *Network) Advance(d time.Duration) {
+	until := n.Clock.Now().Add(d)
+	for p := n.next(until); p != nil; p = n.next(until) {
+		n.Clock.advanceTo(p.deliverAt)
+		n.deliver(p)
+	}
+	n.Clock.advanceTo(until)
+}
+
+func (n *Network) maxDeliveries() int {
+	if n.MaxDeliveries > 0 {
+		return n.MaxDeliveries
+	}
+	return DefaultMaxDeliveries
+}
+
+func (n *Network) pending() bool {
+	if len(n.inFlight) > 0 {
+		return true
+	}
+	for _, p := range n.peers {
+		if p.held != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Network) other(p *Peer) *Peer {
+	for _, o := range n.peers {
+		if o != p {
+			return o
+		}
+	}
+	return nil
+}
+
+func (n *Network) happens(probability float64) bool {
+	return probability > 0 && n.rand.Float64() < probability
+}
+
+// transmit puts the messages from sent on the network, and decides what happens to each of them
+func (n *Network) transmit(from *Peer, messages []otr3.ValidMessage) {
+	to := n.other(from)
+	for _, m := range messages {
+		n.stats.Sent++
+		if to == nil || n.MaxMessageSize > 0 && len(m) > n.MaxMessageSize || n.happens(n.Loss) {
+			n.stats.Lost++
+			continue
+		}
+
+		if n.happens(n.Duplication) {
+			n.stats.Duplicated++
+			n.enqueue(n.newPacket(to, m))
+		}
+
+		p := n.newPacket(to, m)
+		held := from.held
+		if held == nil && n.happens(n.Reordering) {
+			n.stats.Reordered++
+			from.held = p
+			continue
+		}
+
+		n.enqueue(p)
+		if held != nil {
+			from.held = nil
+			n.enqueueAfter(held, p)
+		}
+	}
+}
+
+func (n *Network) newPacket(to *Peer, m otr3.ValidMessage) *packet {
+	delay := n.Delay
+	if n.Jitter > 0 {
+		delay += time.Duration(n.rand.Int63n(int64(n.Jitter) + 1))
+	}
+	return &packet{to: to, message: append(otr3.ValidMessage(nil), m...), deliverAt: n.Clock.Now().Add(delay)}
+}
+
+func (n *Network) enqueue(p *packet) {
+	n.seq++
+	p.seq = n.seq
+	n.inFlight = append(n.inFlight, p)
+}
+
+// enqueueAfter makes sure p arrives after the packet that overtook it
+func (n *Network) enqueueAfter(p, overtaking *packet) {
+	if p.deliverAt.Before(overtaking.deliverAt) {
+		p.deliverAt = overtaking.deliverAt
+	}
+	n.enqueue(p)
+}
+
+// releaseHeld sends the messages that were waiting to be overtaken, since nothing else is going to overtake them
+func (n *Network) releaseHeld() {
+	for _, p := range n.peers {
+		if p.held != nil {
+			n.enqueue(p.held)
+			p.held = nil
+		}
+	}
+}
+
+// next takes the packet that arrives first out of the network. If until is not zero, only a packet that arrives
+// before or at until is taken.
+func (n *Network) next(until time.Time) *packet {
+	first := -1
+	for i, p := range n.inFlight {
+		if first == -1 || p.deliverAt.Before(n.inFlight[first].deliverAt) ||
+			p.deliverAt.Equal(n.inFlight[first].deliverAt) && p.seq < n.inFlight[first].seq {
+			first = i
+		}
+	}
+
+	if first == -1 || !until.IsZero() && n.inFlight[first].deliverAt.After(until) {
+		return nil
+	}
+
+	p := n.inFlight[first]
+	n.inFlight = append(n.inFlight[:first], n.inFlight[first+1:]...)
+	return p
+}
+
+func (n *Network) deliver(p *packet) {
+	n.stats.Delivered++
+
+	plain, toSend, err := p.to.Conversation.Receive(p.message)
+	if err != nil {
+		p.to.Errors = append(p.to.Errors, err)
+	}
+	if len(plain) > 0 {
+		p.to.Received = append(p.to.Received, string(plain))
+	}
+	n.transmit(p.to, toSend)
+}
+
+// Peer is a conversation connected to a network. Everything it sends is carried to the other peer of the network.
+type Peer struct {
+	Name         string
+	Conversation *otr3.Conversation
+	// Events has the events of the conversation
+	Events *EventRecorder
+	// Received has the messages the conversation returned from Receive, in the order they arrived
+	Received []string
+	// Errors has the errors the conversation returned from Receive
+	Errors []error
+
+	network *Network
+	held    *packet
+}
+
+// Query sends a query message, to start the AKE
+func (p *Peer) Query() {
+	p.Transmit([]otr3.ValidMessage{p.Conversation.QueryMessage()})
+}
+
+// Send sends message like the user had typed it
+func (p *Peer) Send(message string) error {
+	toSend, err := p.Conversation.Send(otr3.ValidMessage(message))
+	p.Transmit(toSend)
+	return err
+}
+
+// End ends the private conversation
+func (p *Peer) End() error {
+	toSend, err := p.Conversation.End()
+	p.Transmit(toSend)
+	return err
+}
+
+// StartAuthenticate starts an SMP authentication with question, which can be empty, and secret
+func (p *Peer) StartAuthenticate(question, secret string) error {
+	toSend, err := p.Conversation.StartAuthenticate(question, []byte(secret))
+	p.Transmit(toSend)
+	return err
+}
+
+// ProvideAuthenticationSecret answers the authentication the other peer started
+func (p *Peer) ProvideAuthenticationSecret(secret string) error {
+	toSend, err := p.Conversation.ProvideAuthenticationSecret([]byte(secret))
+	p.Transmit(toSend)
+	return err
+}
+
+// AbortAuthentication aborts the authentication in progress
+func (p *Peer) AbortAuthentication() error {
+	toSend, err := p.Conversation.AbortAuthentication()
+	p.Transmit(toSend)
+	return err
+}
+
+// Transmit sends messages the conversation returned from anything else, like UseExtraSymmetricKey
+func (p *Peer) Transmit(messages []otr3.ValidMessage) {
+	p.network.transmit(p, messages)
+}
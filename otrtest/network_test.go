@@ -0,0 +1,273 @@
+package otrtest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/twstrike/otr3"
+)
+
+func sendAll(t *testing.T, p *Peer, messages ...string) {
+	for _, m := range messages {
+		if err := p.Send(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNetworkDeliversEveryMessageOnceAndInOrderByDefault(t *testing.T) {
+	n := NewNetwork(1)
+	alice, bob := newPlainPeers(n)
+
+	sendAll(t, alice, "one", "two", "three")
+	n.Run()
+
+	AssertReceived(t, bob, "one", "two", "three")
+	if n.Stats() != (Stats{Sent: 3, Delivered: 3}) {
+		t.Errorf("unexpected stats %+v", n.Stats())
+	}
+	if !n.Clock.Now().Equal(StartTime) {
+		t.Errorf("expected no time to pass, but the clock is at %v", n.Clock.Now())
+	}
+}
+
+func TestNetworkLosesMessages(t *testing.T) {
+	n := NewNetwork(1)
+	alice, bob := newPlainPeers(n)
+	n.Loss = 1
+
+	sendAll(t, alice, "one", "two", "three")
+	n.Run()
+
+	AssertReceived(t, bob)
+	if n.Stats().Lost != 3 {
+		t.Errorf("expected 3 lost messages, but got %+v", n.Stats())
+	}
+}
+
+func TestNetworkLosesSomeOfTheMessagesWithTheGivenProbability(t *testing.T) {
+	n := NewNetwork(1)
+	alice, bob := newPlainPeers(n)
+	n.Loss = 0.5
+
+	for i := 0; i < 100; i++ {
+		sendAll(t, alice, "hello")
+	}
+	n.Run()
+
+	if len(bob.Received) < 25 || len(bob.Received) > 75 || len(bob.Received)+n.Stats().Lost != 100 {
+		t.Errorf("expected about half of the messages to arrive, but %d of them did", len(bob.Received))
+	}
+}
+
+func TestNetworkBehavesTheSameWithTheSameSeed(t *testing.T) {
+	received := func(seed int64) []string {
+		n := NewNetwork(seed)
+		alice, bob := newPlainPeers(n)
+		n.Loss = 0.5
+		sendAll(t, alice, "one", "two", "three", "four", "five", "six", "seven", "eight")
+		n.Run()
+		return bob.Received
+	}
+
+	if !reflect.DeepEqual(received(42), received(42)) {
+		t.Error("expected the same messages to arrive with the same seed")
+	}
+}
+
+func TestNetworkDuplicatesMessages(t *testing.T) {
+	n := NewNetwork(1)
+	alice, bob := newPlainPeers(n)
+	n.Duplication = 1
+
+	sendAll(t, alice, "one", "two")
+	n.Run()
+
+	AssertReceived(t, bob, "one", "one", "two", "two")
+}
+
+func TestNetworkReordersMessages(t *testing.T) {
+	n := NewNetwork(1)
+	alice, bob := newPlainPeers(n)
+	n.Reordering = 1
+
+	sendAll(t, alice, "one", "two", "three", "four", "five")
+	n.Run()
+
+	AssertReceived(t, bob, "two", "one", "four", "three", "five")
+	if n.Stats().Reordered != 3 {
+		t.Errorf("expected 3 messages to be held back, but got %+v", n.Stats())
+	}
+}
+
+func TestNetworkDelaysMessages(t *testing.T) {
+	n := NewNetwork(1)
+	alice, bob := newPlainPeers(n)
+	n.Delay = 2 * time.Second
+
+	sendAll(t, alice, "hello")
+	n.Advance(time.Second)
+	AssertReceived(t, bob)
+
+	n.Advance(time.Second)
+	AssertReceived(t, bob, "hello")
+	if !n.Clock.Now().Equal(StartTime.Add(2 * time.Second)) {
+		t.Errorf("expected two seconds to pass, but the clock is at %v", n.Clock.Now())
+	}
+}
+
+func TestNetworkMovesTheClockToWhenTheMessageArrives(t *testing.T) {
+	n := NewNetwork(1)
+	alice, bob := newPlainPeers(n)
+	n.Delay = time.Minute
+	n.Jitter = 10 * time.Second
+
+	sendAll(t, alice, "one", "two", "three")
+	n.Run()
+
+	if len(bob.Received) != 3 {
+		t.Errorf("expected every message to arrive, but got %q", bob.Received)
+	}
+	now := n.Clock.Now()
+	if now.Before(StartTime.Add(time.Minute)) || now.After(StartTime.Add(time.Minute+10*time.Second)) {
+		t.Errorf("expected the last message to arrive within the jitter, but the clock is at %v", now)
+	}
+}
+
+func TestNetworkLosesMessagesThatAreTooLong(t *testing.T) {
+	n := NewNetwork(1)
+	alice, bob := newPlainPeers(n)
+	n.MaxMessageSize = 5
+
+	sendAll(t, alice, "short", "too long")
+	n.Run()
+
+	AssertReceived(t, bob, "short")
+}
+
+func TestNetworkGivesUpWhenThereAreTooManyMessages(t *testing.T) {
+	n := NewNetwork(1)
+	alice, _ := newPlainPeers(n)
+	n.MaxDeliveries = 2
+
+	sendAll(t, alice, "one", "two", "three")
+
+	if err := n.Run(); err != ErrTooManyDeliveries {
+		t.Errorf("expected ErrTooManyDeliveries, but got %v", err)
+	}
+}
+
+func TestNetworkConnectsOnlyTwoPeers(t *testing.T) {
+	n := NewNetwork(1)
+	newPlainPeers(n)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	n.NewPeer("eve", &otr3.Conversation{})
+}
+
+func TestPeersGetEncryptedAndTalkPrivately(t *testing.T) {
+	n := NewNetwork(1)
+	alice, bob := newOTRPeers(t, n)
+
+	alice.Query()
+	AssertEventuallyEncrypted(t, n)
+	sendAll(t, alice, "hello")
+	sendAll(t, bob, "hi")
+	n.Run()
+
+	AssertReceived(t, bob, "hello")
+	AssertReceived(t, alice, "hi")
+}
+
+func TestPeersNeedToFragmentWhenTheMessagesAreTooLong(t *testing.T) {
+	n := NewNetwork(1)
+	alice, bob := newOTRPeers(t, n)
+	n.MaxMessageSize = 150
+	alice.Conversation.SetFragmentSize(150)
+	bob.Conversation.SetFragmentSize(150)
+
+	alice.Query()
+	AssertEventuallyEncrypted(t, n)
+	sendAll(t, alice, "hello")
+	n.Run()
+
+	AssertReceived(t, bob, "hello")
+}
+
+func TestPeersOnlyAcceptADuplicatedMessageOnce(t *testing.T) {
+	n := NewNetwork(1)
+	alice, bob := newOTRPeers(t, n)
+	alice.Query()
+	AssertEventuallyEncrypted(t, n)
+
+	n.Duplication = 1
+	sendAll(t, alice, "hello")
+	n.Run()
+
+	AssertReceived(t, bob, "hello")
+	if len(bob.Errors) != 1 {
+		t.Errorf("expected the duplicate to be rejected, but got %v", bob.Errors)
+	}
+}
+
+func TestPeersSendHeartbeatsByTheClockOfTheNetwork(t *testing.T) {
+	n := NewNetwork(1)
+	alice, bob := newOTRPeers(t, n)
+	alice.Query()
+	AssertEventuallyEncrypted(t, n)
+	sendAll(t, alice, "hello")
+	n.Run()
+	bob.Events.Reset()
+
+	sendAll(t, alice, "are you there?")
+	n.Run()
+	if bob.Events.HasMessageEvent(otr3.MessageEventLogHeartbeatSent) {
+		t.Error("expected no heartbeat right after the last one")
+	}
+
+	n.Advance(2 * time.Minute)
+	sendAll(t, alice, "are you still there?")
+	n.Run()
+	if !bob.Events.HasMessageEvent(otr3.MessageEventLogHeartbeatSent) {
+		t.Error("expected a heartbeat after two minutes")
+	}
+}
+
+func TestPeersAuthenticateEachOther(t *testing.T) {
+	n := NewNetwork(1)
+	alice, bob := newOTRPeers(t, n)
+	alice.Query()
+	AssertEventuallyEncrypted(t, n)
+
+	if err := alice.StartAuthenticate("Where did we meet?", "the library"); err != nil {
+		t.Fatal(err)
+	}
+	AssertEventually(t, n, func() bool { return bob.Events.HasSMPEvent(otr3.SMPEventAskForAnswer) }, "a question")
+	if err := bob.ProvideAuthenticationSecret("the library"); err != nil {
+		t.Fatal(err)
+	}
+
+	AssertEventuallySMPSucceeded(t, n)
+}
+
+func TestPeersAbortAnAuthenticationThatTimesOutByTheClockOfTheNetwork(t *testing.T) {
+	n := NewNetwork(1)
+	alice, _ := newOTRPeers(t, n)
+	alice.Conversation.SetSMPTimeout(time.Minute)
+	alice.Query()
+	AssertEventuallyEncrypted(t, n)
+
+	n.Loss = 1
+	alice.StartAuthenticate("", "secret")
+	n.Advance(2 * time.Minute)
+	sendAll(t, alice, "hello?")
+
+	if !alice.Events.HasSMPEvent(otr3.SMPEventAbort) {
+		t.Error("expected the authentication to time out")
+	}
+}
@@ -3,7 +3,6 @@ package otr3
 import (
 	"bytes"
 	"fmt"
-	"math/big"
 )
 
 var otrv2FragmentationPrefix = []byte("?OTR,")
@@ -16,8 +15,8 @@ func (v otrV2) parameterLength() int {
 	return 16
 }
 
-func (v otrV2) isGroupElement(n *big.Int) bool {
-	return true
+func (v otrV2) checksGroupElements() bool {
+	return false
 }
 
 func (v otrV2) isFragmented(data []byte) bool {
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"math/big"
 	"strconv"
 )
 
@@ -21,8 +20,8 @@ func (v otrV3) parameterLength() int {
 	return 192
 }
 
-func (v otrV3) isGroupElement(n *big.Int) bool {
-	return isGroupElement(n)
+func (v otrV3) checksGroupElements() bool {
+	return true
 }
 
 func (v otrV3) isFragmented(data []byte) bool {
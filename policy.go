@@ -11,6 +11,7 @@ const (
 	sendWhitespaceTag
 	whitespaceStartAKE
 	errorStartAKE
+	allowPrivateTLVs
 )
 
 func (p *policies) isOTREnabled() bool {
@@ -48,3 +49,10 @@ func (p *policies) WhitespaceStartAKE() {
 func (p *policies) ErrorStartAKE() {
 	p.add(errorStartAKE)
 }
+
+// AllowPrivateTLVs allows the TLVs this package adds to the OTR specification, like the ones that announce the SMP
+// secret normalization rules and key transitions. Without it, they are neither sent nor read. Both peers have to allow
+// them.
+func (p *policies) AllowPrivateTLVs() {
+	p.add(allowPrivateTLVs)
+}
@@ -13,9 +13,13 @@ func (c *Conversation) rand() io.Reader {
 	return rand.Reader
 }
 
+// randomInto fills b from r. Errors of r itself, like a failed health test, are returned as they are
 func randomInto(r io.Reader, b []byte) error {
 	if _, err := io.ReadFull(r, b); err != nil {
-		return errShortRandomRead
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errShortRandomRead
+		}
+		return err
 	}
 	return nil
 }
@@ -33,13 +37,14 @@ func randSizedMPI(r io.Reader, size int) (*big.Int, error) {
 }
 
 func (c *Conversation) randSizedMPI(size int) (*big.Int, error) {
-	return randMPI(c.rand(), make([]byte, size))
+	return c.randMPI(make([]byte, size))
 }
 
 func (c *Conversation) randMPI(buf []byte) (*big.Int, error) {
-	return randMPI(c.rand(), buf)
+	res, err := randMPI(c.rand(), buf)
+	return res, c.randomnessError(err)
 }
 
 func (c *Conversation) randomInto(b []byte) error {
-	return randomInto(c.rand(), b)
+	return c.randomnessError(randomInto(c.rand(), b))
 }
@@ -0,0 +1,163 @@
+package otr3
+
+import (
+	"io"
+	"sync"
+)
+
+// ErrRandomnessHealthTestFailed is returned by a HealthCheckedReader, and by the Conversation that uses it, once the
+// randomness it reads fails one of the health tests
+var ErrRandomnessHealthTestFailed = newOtrError("the source of randomness failed a health test")
+
+const (
+	// The cutoffs assume that every byte has full entropy, as the output of a cryptographic generator should,
+	// and give a probability of 2^-40 of failing a healthy source on any given byte, as described in SP 800-90B
+
+	// repetitionCountCutoff is the number of identical bytes in a row that fail the repetition count test
+	repetitionCountCutoff = 6
+	// adaptiveProportionWindow is the number of bytes in every window of the adaptive proportion test
+	adaptiveProportionWindow = 512
+	// adaptiveProportionCutoff is the number of times the first byte of a window can appear in it before the
+	// adaptive proportion test fails
+	adaptiveProportionCutoff = 20
+
+	// healthBlockSize is the size of the blocks compared by the block repetition test
+	healthBlockSize = 16
+	// healthBlockHistory is the number of previous blocks every block is compared with
+	healthBlockHistory = 64
+)
+
+// HealthCheckedReader wraps a source of randomness with continuous health tests, in the style of the repetition
+// count and adaptive proportion tests of NIST SP 800-90B, and a test that rejects blocks of 16 bytes that repeat
+// one of the previous 64 blocks. They catch readers that are stuck, return zeroes, or replay the same data.
+//
+// Once a test fails, the data that failed is wiped, and every read returns ErrRandomnessHealthTestFailed, since
+// randomness from the source can't be trusted anymore. A Conversation that uses the reader signals
+// MessageEventRandomnessHealthTestFailed and returns the error instead of using the randomness.
+//
+// A HealthCheckedReader is safe for concurrent use if the reader it wraps is, so it can be used with EnableAsyncSMP.
+type HealthCheckedReader struct {
+	mu     sync.Mutex
+	r      io.Reader
+	failed bool
+
+	repeated     byte
+	repeatCount  int
+	aptReference byte
+	aptCount     int
+	aptSeen      int
+
+	block     [healthBlockSize]byte
+	blockLen  int
+	history   [healthBlockHistory][healthBlockSize]byte
+	historyAt int
+	blocks    int
+}
+
+// NewHealthCheckedReader returns a HealthCheckedReader that reads from r
+func NewHealthCheckedReader(r io.Reader) *HealthCheckedReader {
+	return &HealthCheckedReader{r: r}
+}
+
+// Read reads from the wrapped reader and runs the health tests on everything it returns
+func (h *HealthCheckedReader) Read(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.failed {
+		return 0, ErrRandomnessHealthTestFailed
+	}
+
+	n, err := h.r.Read(p)
+	for _, b := range p[:n] {
+		if !h.sample(b) {
+			h.failed = true
+			wipeBytes(p[:n])
+			wipeBytes(h.block[:])
+			h.history = [healthBlockHistory][healthBlockSize]byte{}
+			return 0, ErrRandomnessHealthTestFailed
+		}
+	}
+
+	return n, err
+}
+
+// Failed returns true if a health test has failed
+func (h *HealthCheckedReader) Failed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.failed
+}
+
+// sample runs all tests on the next byte, and returns false if any of them fails
+func (h *HealthCheckedReader) sample(b byte) bool {
+	return h.repetitionCount(b) && h.adaptiveProportion(b) && h.blockRepetition(b)
+}
+
+func (h *HealthCheckedReader) repetitionCount(b byte) bool {
+	if h.repeatCount > 0 && b == h.repeated {
+		h.repeatCount++
+	} else {
+		h.repeated = b
+		h.repeatCount = 1
+	}
+
+	return h.repeatCount < repetitionCountCutoff
+}
+
+func (h *HealthCheckedReader) adaptiveProportion(b byte) bool {
+	if h.aptSeen == adaptiveProportionWindow {
+		h.aptSeen = 0
+	}
+
+	if h.aptSeen == 0 {
+		h.aptReference = b
+		h.aptCount = 0
+	}
+	h.aptSeen++
+
+	if b == h.aptReference {
+		h.aptCount++
+	}
+
+	return h.aptCount < adaptiveProportionCutoff
+}
+
+func (h *HealthCheckedReader) blockRepetition(b byte) bool {
+	h.block[h.blockLen] = b
+	h.blockLen++
+	if h.blockLen < healthBlockSize {
+		return true
+	}
+	h.blockLen = 0
+
+	known := h.blocks
+	if known > healthBlockHistory {
+		known = healthBlockHistory
+	}
+	for i := 0; i < known; i++ {
+		if h.history[i] == h.block {
+			return false
+		}
+	}
+
+	h.history[h.historyAt] = h.block
+	h.historyAt = (h.historyAt + 1) % healthBlockHistory
+	h.blocks++
+
+	return true
+}
+
+func isRandomnessHealthTestFailure(err error) bool {
+	return err == ErrRandomnessHealthTestFailed
+}
+
+// randomnessError signals MessageEventRandomnessHealthTestFailed if err comes from a failed health test,
+// and returns err
+func (c *Conversation) randomnessError(err error) error {
+	if isRandomnessHealthTestFailure(err) {
+		c.messageEventWithError(MessageEventRandomnessHealthTestFailed, err)
+	}
+	return err
+}
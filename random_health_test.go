@@ -0,0 +1,186 @@
+package otr3
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// replayReader returns the same data on every read
+type replayReader struct {
+	data []byte
+}
+
+func (r replayReader) Read(p []byte) (int, error) {
+	return copy(p, r.data), nil
+}
+
+func Test_HealthCheckedReader_passesAHealthySource(t *testing.T) {
+	h := NewHealthCheckedReader(rand.Reader)
+	buf := make([]byte, 4096)
+
+	for i := 0; i < 256; i++ {
+		_, err := io.ReadFull(h, buf)
+		assertNil(t, err)
+	}
+	assertEquals(t, h.Failed(), false)
+}
+
+func Test_HealthCheckedReader_failsWhenTheSourceReturnsZeroes(t *testing.T) {
+	h := NewHealthCheckedReader(zeroReader{})
+	buf := make([]byte, 192)
+
+	n, err := h.Read(buf)
+
+	assertEquals(t, n, 0)
+	assertEquals(t, err, ErrRandomnessHealthTestFailed)
+	assertEquals(t, h.Failed(), true)
+}
+
+func Test_HealthCheckedReader_failsTheRepetitionCountTest(t *testing.T) {
+	h := NewHealthCheckedReader(nil)
+
+	for i := 0; i < repetitionCountCutoff-1; i++ {
+		assertEquals(t, h.repetitionCount(0x42), true)
+	}
+	assertEquals(t, h.repetitionCount(0x42), false)
+}
+
+func Test_HealthCheckedReader_failsTheAdaptiveProportionTest(t *testing.T) {
+	h := NewHealthCheckedReader(nil)
+
+	ok := true
+	for i := 0; i < adaptiveProportionWindow && ok; i++ {
+		b := byte(i)
+		if i%8 == 0 {
+			b = 0x42
+		}
+		ok = h.adaptiveProportion(b)
+	}
+
+	assertEquals(t, ok, false)
+}
+
+func Test_HealthCheckedReader_startsANewWindowForTheAdaptiveProportionTest(t *testing.T) {
+	h := NewHealthCheckedReader(nil)
+
+	for i := 0; i < 3*adaptiveProportionWindow; i++ {
+		b := byte(i)
+		if i%64 == 0 {
+			b = 0x42
+		}
+		assertEquals(t, h.adaptiveProportion(b), true)
+	}
+}
+
+func Test_HealthCheckedReader_failsWhenTheSourceReplaysTheSameData(t *testing.T) {
+	data := make([]byte, 40)
+	rand.Read(data)
+	h := NewHealthCheckedReader(replayReader{data})
+	buf := make([]byte, 40)
+
+	var err error
+	for i := 0; i < 40 && err == nil; i++ {
+		_, err = h.Read(buf)
+	}
+
+	assertEquals(t, err, ErrRandomnessHealthTestFailed)
+}
+
+func Test_HealthCheckedReader_wipesTheDataThatFailed(t *testing.T) {
+	data := bytes.Repeat([]byte{1, 2, 3}, 200)
+	h := NewHealthCheckedReader(replayReader{data})
+	buf := make([]byte, len(data))
+
+	h.Read(buf)
+
+	assertDeepEquals(t, buf, make([]byte, len(data)))
+}
+
+func Test_HealthCheckedReader_keepsFailingAfterAFailure(t *testing.T) {
+	h := NewHealthCheckedReader(zeroReader{})
+	h.Read(make([]byte, 10))
+	h.r = rand.Reader
+
+	_, err := h.Read(make([]byte, 10))
+
+	assertEquals(t, err, ErrRandomnessHealthTestFailed)
+}
+
+func Test_HealthCheckedReader_returnsTheErrorsOfTheSource(t *testing.T) {
+	h := NewHealthCheckedReader(fixedRand([]string{"ABCD"}))
+
+	_, err := io.ReadFull(h, make([]byte, 3))
+
+	assertEquals(t, err, io.ErrUnexpectedEOF)
+	assertEquals(t, h.Failed(), false)
+}
+
+func Test_randomInto_returnsOtherErrorsOfTheSourceAsTheyAre(t *testing.T) {
+	expected := errors.New("the source is broken")
+	err := randomInto(failingReader{expected}, make([]byte, 3))
+
+	assertEquals(t, err, expected)
+}
+
+type failingReader struct {
+	err error
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func Test_StartAuthenticate_signalsAFailedHealthTestOfTheRandomness(t *testing.T) {
+	alice, _ := encryptedConversations(t)
+	alice.Rand = NewHealthCheckedReader(zeroReader{})
+
+	var err error
+	alice.expectMessageEvent(t, func() {
+		_, err = alice.StartAuthenticate("", []byte("secret"))
+	}, MessageEventRandomnessHealthTestFailed, nil, ErrRandomnessHealthTestFailed)
+
+	assertEquals(t, err, ErrRandomnessHealthTestFailed)
+}
+
+func Test_Receive_signalsAFailedHealthTestOfTheRandomnessWhenRotatingKeys(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	msg, _ := alice.Send(ValidMessage("hello"))
+	bob.Receive(msg[0])
+	msg, _ = bob.Send(ValidMessage("hi"))
+	alice.Receive(msg[0])
+
+	// Bob has to generate a new key once Alice uses his latest one
+	msg, _ = alice.Send(ValidMessage("how are you?"))
+	bob.Rand = NewHealthCheckedReader(zeroReader{})
+
+	var err error
+	bob.expectMessageEvent(t, func() {
+		_, _, err = bob.Receive(msg[0])
+	}, MessageEventRandomnessHealthTestFailed, nil, ErrRandomnessHealthTestFailed)
+
+	assertEquals(t, err, ErrRandomnessHealthTestFailed)
+}
+
+func Test_HealthCheckedReader_canBeUsedByAConversation(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	alice.Rand = NewHealthCheckedReader(rand.Reader)
+	bob.Rand = NewHealthCheckedReader(rand.Reader)
+
+	msg, err := alice.Send(ValidMessage("hello"))
+	assertNil(t, err)
+	plain, _, err := bob.Receive(msg[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+}
@@ -2,6 +2,8 @@ package otr3
 
 // Receive handles a message from a peer. It returns a human readable message and zero or more messages to send back to the peer.
 func (c *Conversation) Receive(m ValidMessage) (plain MessagePlaintext, toSend []ValidMessage, err error) {
+	c.potentialSMPTimeout()
+	c.potentialSMPInjections()
 	return c.receiveUnit(m, true)
 }
 
@@ -47,8 +49,9 @@ func (c *Conversation) receiveUnit(m ValidMessage, forgetFragments bool) (plain
 	return c.withInjectionsPlain(c.toSendEncoded(plain, messagesToSend, err))
 }
 
+// receiveWithoutOTR returns a copy of message, since receiveUnit wipes message when it returns
 func (c *Conversation) receiveWithoutOTR(message ValidMessage) (MessagePlaintext, []ValidMessage, error) {
-	return MessagePlaintext(message), nil, nil
+	return MessagePlaintext(makeCopy(message)), nil, nil
 }
 
 func withoutPotentialSpaceStart(msg []byte) []byte {
@@ -174,6 +177,11 @@ func (c *Conversation) receiveDataMessage(messageHeader, messageBody []byte) (pl
 }
 
 func (c *Conversation) notifyDataMessageError(err error) {
+	if isRandomnessHealthTestFailure(err) {
+		// The message was fine, we just can't trust our randomness to answer it. This has already been signaled
+		return
+	}
+
 	var e ErrorCode
 	if isConflict(err) {
 		c.messageEvent(MessageEventReceivedMessageUnreadable)
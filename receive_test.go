@@ -229,3 +229,15 @@ func Test_Receive_willResetFragmentationContextIfWeReceiveAnUnfragmentedMessage(
 	assertEquals(t, c.fragmentationContext.currentIndex, uint16(0))
 	assertEquals(t, c.fragmentationContext.currentLen, uint16(0))
 }
+
+func Test_Receive_returnsTheMessageAsItIsWhenOTRIsNotEnabled(t *testing.T) {
+	c := &Conversation{}
+	message := ValidMessage("hello")
+
+	plain, toSend, err := c.Receive(message)
+	message[0] = 'j'
+
+	assertNil(t, err)
+	assertNil(t, toSend)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+}
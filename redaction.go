@@ -0,0 +1,123 @@
+package otr3
+
+import (
+	"bytes"
+	"crypto/aes"
+)
+
+var (
+	errRedactOnlyDataMessages = newOtrError("only whole data messages can be redacted")
+	errRedactionChangesLength = newOtrError("a redacted plaintext must have the same length, and no NUL byte")
+)
+
+// RedactDataMessage returns a copy of message, a whole data message that c sent or received, where redact has replaced
+// the plaintext and the values of the SMP TLVs are zeroed. The copy is encrypted again with the same keys and counter,
+// and authenticated again if the original was authentic, so c goes through the same states with it as with the
+// original message. The keys are the ones c has when RedactDataMessage is called, so a received message has to be
+// redacted before it is received, and a sent one right after it was sent. redact must return as many bytes as it is
+// given, none of them NUL. hadSMP tells whether the message had SMP TLVs, which c can't process in the same way
+// without their values.
+func (c *Conversation) RedactDataMessage(message ValidMessage, sent bool, redact func([]byte) []byte) (redacted ValidMessage, hadSMP bool, err error) {
+	if guessMessageType(message) != msgGuessData || !bytes.HasSuffix(message, []byte(".")) {
+		return nil, false, errRedactOnlyDataMessages
+	}
+
+	decoded, err := c.decode(encodedMessage(message))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(decoded) < otrv2HeaderLen {
+		return nil, false, errInvalidOTRMessage
+	}
+	headerLen := otrv2HeaderLen
+	if decoded[1] == 3 {
+		headerLen = otrv3HeaderLen
+	}
+	if len(decoded) < headerLen {
+		return nil, false, errInvalidOTRMessage
+	}
+	header, body := decoded[:headerLen], decoded[headerLen:]
+
+	dataMessage := dataMsg{}
+	if err = dataMessage.deserialize(body); err != nil {
+		return nil, false, err
+	}
+
+	ourKeyID, theirKeyID := dataMessage.recipientKeyID, dataMessage.senderKeyID
+	if sent {
+		ourKeyID, theirKeyID = dataMessage.senderKeyID, dataMessage.recipientKeyID
+	}
+
+	// calculateDHSessionKeys of the keyManagementContext would remember the MAC keys, and reveal them later
+	ourPrivKey, ourPubKey, err := c.keys.pickOurKeys(ourKeyID)
+	if err != nil {
+		return nil, false, err
+	}
+	theirPubKey, err := c.keys.pickTheirKey(theirKeyID)
+	if err != nil {
+		return nil, false, err
+	}
+	keys := calculateDHSessionKeys(ourPrivKey, ourPubKey, theirPubKey)
+	defer keys.wipe()
+
+	aesKey, macKey := keys.receivingAESKey, keys.receivingMACKey
+	if sent {
+		aesKey, macKey = keys.sendingAESKey, keys.sendingMACKey
+	}
+	authentic := dataMessage.checkSign(macKey, header) == nil
+
+	var iv [aes.BlockSize]byte
+	copy(iv[:], dataMessage.topHalfCtr[:])
+
+	plain := make([]byte, len(dataMessage.encryptedMsg))
+	defer wipeBytes(plain)
+	counterEncipher(aesKey[:], iv[:], dataMessage.encryptedMsg, plain)
+
+	if hadSMP, err = redactPlaintext(plain, redact); err != nil {
+		return nil, false, err
+	}
+
+	dataMessage.encryptedMsg = make([]byte, len(plain))
+	counterEncipher(aesKey[:], iv[:], plain, dataMessage.encryptedMsg)
+	dataMessage.serializeUnsignedCache = nil
+	if authentic {
+		dataMessage.sign(macKey, header)
+	}
+
+	return ValidMessage(c.encode(append(makeCopy(header), dataMessage.serialize()...))), hadSMP, nil
+}
+
+// redactPlaintext replaces the message in plain, the decrypted content of a data message, with what redact returns
+// for it, and zeroes the values of the SMP TLVs that follow it. TLVs that can't be parsed are left as they are, since
+// they are ignored when the message is received.
+func redactPlaintext(plain []byte, redact func([]byte) []byte) (hadSMP bool, err error) {
+	end := bytes.IndexByte(plain, 0x00)
+	if end < 0 {
+		end = len(plain)
+	}
+
+	placeholder := redact(makeCopy(plain[:end]))
+	if len(placeholder) != end || bytes.IndexByte(placeholder, 0x00) >= 0 {
+		return false, errRedactionChangesLength
+	}
+	copy(plain, placeholder)
+
+	if end == len(plain) {
+		return false, nil
+	}
+
+	tlvsBytes := plain[end+1:]
+	for len(tlvsBytes) > 0 {
+		atlv := tlv{}
+		if atlv.deserialize(tlvsBytes) != nil {
+			break
+		}
+		if atlv.tlvType >= tlvTypeSMP1 && atlv.tlvType <= tlvTypeSMP1WithQuestion {
+			wipeBytes(atlv.tlvValue)
+			hadSMP = true
+		}
+		tlvsBytes = tlvsBytes[tlvHeaderLen+int(atlv.tlvLength):]
+	}
+	return hadSMP, nil
+}
@@ -0,0 +1,114 @@
+package otr3
+
+import (
+	"bytes"
+	"testing"
+)
+
+func redactWithX(b []byte) []byte {
+	return bytes.Repeat([]byte("x"), len(b))
+}
+
+func Test_RedactDataMessage_redactsASentMessageSoThePeerReceivesThePlaceholder(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	toSend, _ := alice.Send(ValidMessage("hello bob"))
+
+	redacted, hadSMP, err := alice.RedactDataMessage(toSend[0], true, redactWithX)
+	assertNil(t, err)
+	assertEquals(t, hadSMP, false)
+	assertEquals(t, len(redacted), len(toSend[0]))
+
+	plain, _, err := bob.Receive(redacted)
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("xxxxxxxxx"))
+}
+
+func Test_RedactDataMessage_redactsAReceivedMessageBeforeItIsReceived(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	toSend, _ := alice.Send(ValidMessage("hello bob"))
+
+	redacted, _, err := bob.RedactDataMessage(toSend[0], false, redactWithX)
+	assertNil(t, err)
+
+	plain, _, err := bob.Receive(redacted)
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("xxxxxxxxx"))
+}
+
+func Test_RedactDataMessage_doesntRememberTheMACKeys(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	toSend, _ := alice.Send(ValidMessage("hello bob"))
+	before := len(bob.keys.macKeyHistory.items)
+
+	bob.RedactDataMessage(toSend[0], false, redactWithX)
+
+	assertEquals(t, len(bob.keys.macKeyHistory.items), before)
+}
+
+func Test_RedactDataMessage_keepsAMessageThatIsNotAuthenticUnauthentic(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	toSend, _ := alice.Send(ValidMessage("hello bob"))
+
+	redacted, _, err := bob.RedactDataMessage(forgeAuthenticator(t, bob, toSend[0]), false, redactWithX)
+	assertNil(t, err)
+
+	_, _, err = bob.Receive(redacted)
+	assertNotNil(t, err)
+}
+
+func Test_RedactDataMessage_zeroesTheValuesOfSMPTLVs(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	toSend, _ := alice.StartAuthenticate("the name of our cat?", []byte("tom"))
+
+	redacted, hadSMP, err := alice.RedactDataMessage(toSend[0], true, redactWithX)
+	assertNil(t, err)
+	assertEquals(t, hadSMP, true)
+
+	decoded, _ := bob.decode(encodedMessage(redacted))
+	dataMessage := dataMsg{}
+	assertNil(t, dataMessage.deserialize(decoded[otrv3HeaderLen:]))
+	keys, _ := bob.keys.calculateDHSessionKeys(dataMessage.recipientKeyID, dataMessage.senderKeyID)
+	defer keys.wipe()
+	p := plainDataMsg{}
+	p.decrypt(keys.receivingAESKey, dataMessage.topHalfCtr, dataMessage.encryptedMsg)
+
+	assertEquals(t, p.tlvs[0].tlvType, tlvTypeSMP1WithQuestion)
+	assertDeepEquals(t, p.tlvs[0].tlvValue, make([]byte, p.tlvs[0].tlvLength))
+}
+
+func Test_RedactDataMessage_rejectsMessagesThatAreNotDataMessages(t *testing.T) {
+	alice, _ := encryptedConversations(t)
+
+	_, _, err := alice.RedactDataMessage(alice.QueryMessage(), true, redactWithX)
+
+	assertEquals(t, err, errRedactOnlyDataMessages)
+}
+
+func Test_RedactDataMessage_rejectsARedactionOfAnotherLength(t *testing.T) {
+	alice, _ := encryptedConversations(t)
+	toSend, _ := alice.Send(ValidMessage("hello bob"))
+
+	_, _, err := alice.RedactDataMessage(toSend[0], true, func(b []byte) []byte { return nil })
+
+	assertEquals(t, err, errRedactionChangesLength)
+}
+
+func Test_RedactDataMessage_returnsAnErrorForKeysTheConversationDoesntHave(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	toSend, _ := alice.Send(ValidMessage("hello bob"))
+	bob.keys.theirKeyID += 2
+
+	_, _, err := bob.RedactDataMessage(toSend[0], false, redactWithX)
+
+	assertNotNil(t, err)
+}
+
+// forgeAuthenticator returns message with another authenticator
+func forgeAuthenticator(t *testing.T, c *Conversation, message ValidMessage) ValidMessage {
+	decoded, err := c.decode(encodedMessage(message))
+	assertNil(t, err)
+	dataMessage := dataMsg{}
+	assertNil(t, dataMessage.deserialize(decoded[otrv3HeaderLen:]))
+	dataMessage.authenticator[0] ^= 0x01
+	return ValidMessage(c.encode(append(decoded[:otrv3HeaderLen:otrv3HeaderLen], dataMessage.serialize()...)))
+}
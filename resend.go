@@ -42,7 +42,7 @@ func (c *Conversation) updateMayRetransmitTo(f retransmitFlag) {
 func (c *Conversation) shouldRetransmit() bool {
 	return c.resend.lastMessage != nil &&
 		c.resend.mayRetransmit != noRetransmit &&
-		c.heartbeat.lastSent.After(time.Now().Add(-resendInterval))
+		c.heartbeat.lastSent.After(c.now().Add(-resendInterval))
 }
 
 func (c *Conversation) maybeRetransmit() (messageWithHeader, error) {
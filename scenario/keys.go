@@ -0,0 +1,62 @@
+package scenario
+
+import (
+	"context"
+	"crypto/dsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/twstrike/otr3"
+)
+
+// parameters are the DSA parameters of the keys of every peer. Generating parameters takes seconds, but a key with
+// parameters that are already known only takes one exponentiation.
+var parameters = dsa.Parameters{
+	P: fromHex("c81c2cb2eb729b7e6fd48e975a932c638b3a9055478583afa46755683e30102447f6da2d8bec9f386bbb5da6403b0040fee8650b6ab2d7f32c55ab017ae9b6aec8c324ab5844784e9a80e194830d548fb7f09a0410df2c4d5c8bc2b3e9ad484e65412be689cf0834694e0839fb2954021521ffdffb8f5c32c14dbf2020b3ce75"),
+	Q: fromHex("da4591d58def96de61aea7b04a8405fe1609308d"),
+	G: fromHex("8ddd5cb0b9d66956e3dea5a915d9aba9d8a6e7053b74dadb2fc52f9fe4e5bcc487d2305485ed95fed026ad93f06ebb8c9e8baf693b7887132c7ffdd3b0f72f4002ff4ed56583ca7c54458f8c068ca3e8a4dfa309d1dd5d34e2a4b68e6f4338835e5e0fb4317c9e4c7e4806dafda3ef459cd563775a586dd91b1319f72621bf3f"),
+}
+
+func fromHex(s string) *big.Int {
+	n, _ := new(big.Int).SetString(s, 16)
+	return n
+}
+
+// keyFor returns the key of the peer called name. It is always the same key for the same name.
+func keyFor(name string) (*otr3.PrivateKey, error) {
+	key := &otr3.PrivateKey{Nonces: otr3.DeterministicNonces}
+	if err := key.GenerateContext(context.Background(), newStream("key "+name), &otr3.GenerateOptions{Parameters: &parameters}); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// stream is an endless stream of bytes derived from a seed, so that everything random in a scenario is the same
+// every time it runs. It is SHA-256 of the seed and a counter, which looks random enough for the conversations,
+// but is not a secure source of randomness.
+type stream struct {
+	seed    []byte
+	counter uint64
+	buf     []byte
+}
+
+func newStream(seed string) *stream {
+	return &stream{seed: []byte(seed)}
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	for n := 0; n < len(p); {
+		if len(s.buf) == 0 {
+			var counter [8]byte
+			binary.BigEndian.PutUint64(counter[:], s.counter)
+			s.counter++
+			block := sha256.Sum256(append(append([]byte(nil), s.seed...), counter[:]...))
+			s.buf = block[:]
+		}
+		copied := copy(p[n:], s.buf)
+		s.buf = s.buf[copied:]
+		n += copied
+	}
+	return len(p), nil
+}
@@ -0,0 +1,360 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/twstrike/otr3"
+	"github.com/twstrike/otr3/otrtest"
+)
+
+// errTooManyDeliveries is returned by deliver all when the peers are still sending messages to each other after
+// otrtest.DefaultMaxDeliveries messages
+var errTooManyDeliveries = errors.New("the peers didn't stop sending messages")
+
+// Runner runs scenarios. The zero value runs them without tracing anything.
+type Runner struct {
+	// Trace, if not nil, gets every step as it runs, and every message delivered, received or lost in it
+	Trace io.Writer
+}
+
+// Run runs s with new conversations, and returns an *Error for the first step that didn't pass
+func (r *Runner) Run(s *Scenario) error {
+	st := &state{trace: r.Trace, clock: otrtest.NewClock(otrtest.StartTime), links: map[link]*peerConversation{}}
+	peers := map[string]bool{}
+
+	for i, step := range s.Steps {
+		st.tracef("%d: %s\n", step.Line, step)
+
+		var next *Step
+		if i+1 < len(s.Steps) {
+			next = &s.Steps[i+1]
+		}
+
+		err := check(step, peers)
+		if err == nil {
+			err = st.run(step, next)
+		}
+		if err != nil {
+			return &Error{Scenario: s.Name, Line: step.Line, Step: step.String(), Err: err}
+		}
+	}
+	return nil
+}
+
+// link is the direction of the messages from one peer to another
+type link struct {
+	from, to string
+}
+
+// peerConversation is the conversation of a peer with another, and what happened in it
+type peerConversation struct {
+	*otr3.Conversation
+	events *otrtest.EventRecorder
+	// expected is how many events of every name expect steps have used
+	expected map[string]int
+	// received are the messages that were received and haven't been checked by expect-received yet
+	received []string
+	// errors are the errors that haven't been checked by expect-error yet
+	errors []error
+}
+
+type message struct {
+	link
+	data otr3.ValidMessage
+}
+
+type state struct {
+	trace    io.Writer
+	clock    *otrtest.Clock
+	links    map[link]*peerConversation
+	inFlight []message
+}
+
+func (s *state) tracef(format string, args ...interface{}) {
+	if s.trace != nil {
+		fmt.Fprintf(s.trace, format, args...)
+	}
+}
+
+// run runs step. next is the step after it, if there is one.
+func (s *state) run(step Step, next *Step) error {
+	args := step.Args
+	if step.Verb == "peers" {
+		return s.newPeers(args)
+	}
+
+	var l link
+	var c *peerConversation
+	if len(args) >= 2 {
+		l = link{args[0], args[1]}
+		c = s.links[l]
+	}
+
+	var toSend []otr3.ValidMessage
+	var err error
+	switch step.Verb {
+	case "fragment-size":
+		size, _ := parseFragmentSize(args[2])
+		c.SetFragmentSize(size)
+	case "query":
+		toSend = []otr3.ValidMessage{c.QueryMessage()}
+	case "send":
+		toSend, err = c.Send(otr3.ValidMessage(args[2]))
+	case "end":
+		toSend, err = c.End()
+	case "smp":
+		question, secret := "", args[2]
+		if len(args) == 4 {
+			question, secret = args[2], args[3]
+		}
+		toSend, err = c.StartAuthenticate(question, []byte(secret))
+	case "answer":
+		toSend, err = c.ProvideAuthenticationSecret([]byte(args[2]))
+	case "abort-smp":
+		toSend, err = c.AbortAuthentication()
+	case "deliver":
+		if len(args) == 1 {
+			return s.deliverAll()
+		}
+		n, _ := parseCount(countArg(args))
+		return s.deliver(l, n)
+	case "drop":
+		n, _ := parseCount(countArg(args))
+		return s.drop(l, n)
+	case "reorder":
+		return s.reorder(l)
+	case "advance":
+		d, _ := parseDuration(args[0])
+		s.clock.Advance(d)
+	case "expect":
+		return c.expect(args[2])
+	case "expect-no":
+		return c.expectNo(args[2])
+	case "expect-received":
+		return c.expectReceived(args[2])
+	case "expect-error":
+		return c.expectError(args[2:])
+	case "expect-encrypted":
+		if !c.IsEncrypted() {
+			return errors.New("the conversation is not encrypted")
+		}
+	case "expect-plaintext":
+		if c.IsEncrypted() {
+			return errors.New("the conversation is encrypted")
+		}
+	}
+
+	s.send(l, toSend)
+	if err != nil && expectsError(next, l) {
+		c.errors = append(c.errors, err)
+		return nil
+	}
+	return err
+}
+
+// expectsError returns whether step is an expect-error step for the conversation of l. An error of the step before
+// it doesn't make the scenario fail, but is left for it to check.
+func expectsError(step *Step, l link) bool {
+	return step != nil && step.Verb == "expect-error" && len(step.Args) >= 2 && step.Args[0] == l.from && step.Args[1] == l.to
+}
+
+func countArg(args []string) string {
+	if len(args) == 3 {
+		return args[2]
+	}
+	return "1"
+}
+
+// newPeers makes the conversations of every peer with every other peer
+func (s *state) newPeers(names []string) error {
+	keys := map[string]*otr3.PrivateKey{}
+	for _, name := range names {
+		key, err := keyFor(name)
+		if err != nil {
+			return err
+		}
+		keys[name] = key
+	}
+
+	for _, from := range names {
+		for _, to := range names {
+			if from == to {
+				continue
+			}
+			c := &otr3.Conversation{Rand: newStream("conversation " + from + " " + to)}
+			c.Policies.AllowV2()
+			c.Policies.AllowV3()
+			c.SetKeys(keys[from], nil)
+			c.SetClock(s.clock.Now)
+			s.links[link{from, to}] = &peerConversation{
+				Conversation: c,
+				events:       otrtest.NewEventRecorder(c),
+				expected:     map[string]int{},
+			}
+		}
+	}
+	return nil
+}
+
+// send puts the messages that the conversation of l returned in flight
+func (s *state) send(l link, toSend []otr3.ValidMessage) {
+	for _, m := range toSend {
+		s.inFlight = append(s.inFlight, message{l, m})
+	}
+}
+
+// next returns the index of the next message in flight on l, or -1 if there's none
+func (s *state) next(l link) int {
+	for i, m := range s.inFlight {
+		if m.link == l {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *state) take(i int) message {
+	m := s.inFlight[i]
+	s.inFlight = append(s.inFlight[:i:i], s.inFlight[i+1:]...)
+	return m
+}
+
+func (s *state) deliver(l link, n int) error {
+	for delivered := 0; delivered < n; delivered++ {
+		i := s.next(l)
+		if i < 0 {
+			if n == allMessages {
+				return nil
+			}
+			return fmt.Errorf("only %d of %d messages were in flight from %s to %s", delivered, n, l.from, l.to)
+		}
+		s.receive(s.take(i))
+	}
+	return nil
+}
+
+func (s *state) deliverAll() error {
+	for delivered := 0; len(s.inFlight) > 0; delivered++ {
+		if delivered == otrtest.DefaultMaxDeliveries {
+			return errTooManyDeliveries
+		}
+		s.receive(s.take(0))
+	}
+	return nil
+}
+
+// receive gives m to the conversation of its receiver, and puts what it sends back in flight
+func (s *state) receive(m message) {
+	s.tracef("  %s -> %s: %s\n", m.from, m.to, abbreviate(m.data))
+
+	back := link{m.to, m.from}
+	c := s.links[back]
+	plain, toSend, err := c.Receive(m.data)
+	if len(plain) > 0 {
+		s.tracef("  %s received %q\n", m.to, plain)
+		c.received = append(c.received, string(plain))
+	}
+	if err != nil {
+		s.tracef("  %s failed to receive it: %v\n", m.to, err)
+		c.errors = append(c.errors, err)
+	}
+	s.send(back, toSend)
+}
+
+func (s *state) drop(l link, n int) error {
+	for dropped := 0; dropped < n; dropped++ {
+		i := s.next(l)
+		if i < 0 {
+			if n == allMessages {
+				return nil
+			}
+			return fmt.Errorf("only %d of %d messages were in flight from %s to %s", dropped, n, l.from, l.to)
+		}
+		m := s.take(i)
+		s.tracef("  %s -> %s lost: %s\n", m.from, m.to, abbreviate(m.data))
+	}
+	return nil
+}
+
+func (s *state) reorder(l link) error {
+	i := s.next(l)
+	if i < 0 {
+		return fmt.Errorf("no message is in flight from %s to %s", l.from, l.to)
+	}
+	s.inFlight = append(s.inFlight, s.take(i))
+	return nil
+}
+
+// abbreviate shortens long messages in the trace
+func abbreviate(m otr3.ValidMessage) string {
+	const max = 60
+	if len(m) > max {
+		return fmt.Sprintf("%s... (%d bytes)", m[:max], len(m))
+	}
+	return string(m)
+}
+
+// signaled returns how many times c signaled the event called name
+func (c *peerConversation) signaled(name string) int {
+	n := 0
+	for _, e := range c.events.SecurityEvents() {
+		if e.String() == name {
+			n++
+		}
+	}
+	for _, e := range c.events.SMPEvents() {
+		if e.Event.String() == name {
+			n++
+		}
+	}
+	for _, e := range c.events.MessageEvents() {
+		if e.Event.String() == name {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *peerConversation) expect(name string) error {
+	if c.signaled(name) <= c.expected[name] {
+		return fmt.Errorf("%s was not signaled", name)
+	}
+	c.expected[name]++
+	return nil
+}
+
+func (c *peerConversation) expectNo(name string) error {
+	if n := c.signaled(name) - c.expected[name]; n > 0 {
+		return fmt.Errorf("%s was signaled %d times", name, n)
+	}
+	return nil
+}
+
+func (c *peerConversation) expectReceived(text string) error {
+	if len(c.received) == 0 {
+		return fmt.Errorf("no message was received, instead of %q", text)
+	}
+	got := c.received[0]
+	c.received = c.received[1:]
+	if got != text {
+		return fmt.Errorf("received %q instead of %q", got, text)
+	}
+	return nil
+}
+
+// expectError uses up the first error that contains the text in args, or the first error if args are empty
+func (c *peerConversation) expectError(args []string) error {
+	for i, err := range c.errors {
+		if len(args) == 0 || strings.Contains(err.Error(), args[0]) {
+			c.errors = append(c.errors[:i:i], c.errors[i+1:]...)
+			return nil
+		}
+	}
+	if len(args) == 0 {
+		return errors.New("there was no error")
+	}
+	return fmt.Errorf("there was no error with %q", args[0])
+}
@@ -0,0 +1,185 @@
+// Package scenario runs scripted conversations between two or more peers, so that a sequence of events that makes
+// real Conversations misbehave can be written down once and replayed exactly.
+//
+// A scenario is a text file with one step on every line. Empty lines, and comments from a # that starts a word to the
+// end of the line, are ignored. Arguments with spaces are written as Go quoted strings:
+//
+//	# SMP after a refresh, while a fragment of a long message is in flight
+//	peers alice bob
+//	fragment-size alice bob 200
+//	query alice bob
+//	deliver all
+//	expect alice bob GoneSecure
+//
+//	send alice bob "a message long enough to be sent in more than one fragment ..."
+//	deliver alice bob
+//	query alice bob
+//	deliver all
+//	smp alice bob "the name of our cat?" "tom"
+//	deliver all
+//	answer bob alice "tom"
+//	deliver all
+//	expect alice bob SMPEventSuccess
+//	expect bob alice SMPEventSuccess
+//
+// Every peer has a conversation with every other peer. Messages are only delivered by the deliver steps, so they
+// can be dropped or reordered in between. The steps are:
+//
+//	peers NAME...                  declares the peers. It has to be the first step.
+//	fragment-size FROM TO SIZE     makes FROM fragment what it sends to TO into pieces of at most SIZE bytes
+//	query FROM TO                  makes FROM send a query message to TO
+//	send FROM TO TEXT              makes FROM send TEXT to TO, like the user had typed it
+//	end FROM TO                    makes FROM end the private conversation with TO
+//	smp FROM TO [QUESTION] SECRET  makes FROM start an SMP authentication with TO
+//	answer FROM TO SECRET          makes FROM answer the SMP authentication TO started
+//	abort-smp FROM TO              makes FROM abort the SMP authentication with TO
+//	deliver FROM TO [N|all]        delivers the next N messages in flight from FROM to TO, 1 by default
+//	deliver all                    delivers every message in flight, and everything sent in reply, in order
+//	drop FROM TO [N|all]           loses the next N messages in flight from FROM to TO, 1 by default
+//	reorder FROM TO                moves the next message in flight from FROM to TO behind all the others
+//	advance DURATION               moves the clock of every conversation forward, like 90s or 2h
+//	expect PEER OTHER EVENT        checks that the conversation of PEER with OTHER signaled EVENT
+//	expect-no PEER OTHER EVENT     checks that it didn't signal EVENT
+//	expect-received PEER OTHER TEXT  checks that the next message PEER received from OTHER is TEXT
+//	expect-error PEER OTHER [TEXT]   checks that the conversation of PEER with OTHER returned an error with TEXT
+//	expect-encrypted PEER OTHER    checks that the conversation of PEER with OTHER is encrypted
+//	expect-plaintext PEER OTHER    checks that it is not encrypted
+//
+// EVENT is the name of a security, SMP or message event, like GoneSecure, SMPEventSuccess or
+// MessageEventConnectionEnded. Every expect step uses up the event it finds, so expecting an event twice checks that
+// it was signaled twice, and expect-no only looks at the events that no expect step has used yet.
+//
+// The errors returned when a message is received are kept for expect-error steps. An error returned by a step that
+// makes a peer do something, like send or smp, makes the scenario fail, unless the next step is an expect-error step
+// for the same conversation.
+//
+// The keys of the peers, and everything random in the conversations, are derived from the names of the peers, so
+// a scenario runs exactly the same way every time. The keys are not secret, and must not be used for anything else.
+package scenario
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Scenario is a parsed scenario
+type Scenario struct {
+	// Name identifies the scenario in errors, usually with the name of its file
+	Name  string
+	Steps []Step
+}
+
+// Step is one step of a scenario
+type Step struct {
+	// Line is the line of the step in the scenario, starting at 1
+	Line int
+	Verb string
+	Args []string
+}
+
+// String returns the step like it was written in the scenario
+func (s Step) String() string {
+	words := []string{s.Verb}
+	for _, a := range s.Args {
+		if a == "" || strings.ContainsAny(a, " \t#") || strconv.Quote(a) != `"`+a+`"` {
+			a = strconv.Quote(a)
+		}
+		words = append(words, a)
+	}
+	return strings.Join(words, " ")
+}
+
+// Error is the error of a step that couldn't be parsed or didn't pass
+type Error struct {
+	Scenario string
+	Line     int
+	Step     string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	if e.Step == "" {
+		return fmt.Sprintf("%s:%d: %v", e.Scenario, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %s: %v", e.Scenario, e.Line, e.Step, e.Err)
+}
+
+// ParseFile parses the scenario in the file at path. The scenario is named after the file.
+func ParseFile(path string) (*Scenario, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(filepath.Base(path), f)
+}
+
+// Parse parses the scenario in r. It checks that every step is known and has the right arguments, so a scenario
+// that parses only fails when it runs because the conversations didn't behave like it expected.
+func Parse(name string, r io.Reader) (*Scenario, error) {
+	s := &Scenario{Name: name}
+	peers := map[string]bool{}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		words, err := splitLine(scanner.Text())
+		if err != nil {
+			return nil, &Error{Scenario: name, Line: line, Err: err}
+		}
+		if len(words) == 0 {
+			continue
+		}
+
+		step := Step{Line: line, Verb: words[0], Args: words[1:]}
+		if err := check(step, peers); err != nil {
+			return nil, &Error{Scenario: name, Line: line, Step: step.String(), Err: err}
+		}
+		s.Steps = append(s.Steps, step)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(s.Steps) == 0 {
+		return nil, &Error{Scenario: name, Line: 1, Err: errNoPeers}
+	}
+	return s, nil
+}
+
+// splitLine returns the words of line, with the quoted ones unquoted, and without the comment
+func splitLine(line string) ([]string, error) {
+	var words []string
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" || line[0] == '#' {
+			return words, nil
+		}
+
+		if line[0] == '"' {
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil, fmt.Errorf("bad quoted string: %s", line)
+			}
+			word, _ := strconv.Unquote(quoted)
+			words = append(words, word)
+			line = line[len(quoted):]
+			if line != "" && line[0] != ' ' && line[0] != '\t' {
+				return nil, fmt.Errorf("missing space after %s", quoted)
+			}
+			continue
+		}
+
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			end = len(line)
+		}
+		words = append(words, line[:end])
+		line = line[end:]
+	}
+}
@@ -0,0 +1,128 @@
+package scenario
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, text string) *Scenario {
+	s, err := Parse("test", strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestScenarios(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.scenario")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no scenarios found: %v", err)
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			s, err := ParseFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			trace := &bytes.Buffer{}
+			if err := (&Runner{Trace: trace}).Run(s); err != nil {
+				t.Errorf("%v\n%s", err, trace)
+			}
+		})
+	}
+}
+
+func TestParseUnquotesArgumentsAndIgnoresComments(t *testing.T) {
+	s := parse(t, "# a comment\n\npeers alice bob\n  send alice bob \"hello # there\"   # and another one\n")
+
+	expected := []Step{
+		{Line: 3, Verb: "peers", Args: []string{"alice", "bob"}},
+		{Line: 4, Verb: "send", Args: []string{"alice", "bob", "hello # there"}},
+	}
+	if !reflect.DeepEqual(s.Steps, expected) {
+		t.Errorf("expected %v, but got %v", expected, s.Steps)
+	}
+	if s.Steps[1].String() != `send alice bob "hello # there"` {
+		t.Errorf("unexpected step %s", s.Steps[1])
+	}
+}
+
+func TestParseReportsTheLineOfABadStep(t *testing.T) {
+	cases := map[string]string{
+		"send alice bob hello":                  "test:1: send alice bob hello: the scenario has to start by declaring its peers",
+		"peers alice bob\ndance alice bob":      `test:2: dance alice bob: unknown step "dance"`,
+		"peers alice bob\nsend alice carol hi":  "test:2: send alice carol hi: unknown peer carol",
+		"peers alice bob\nsend alice bob":       "test:2: send alice bob: expected 3 arguments, but got 2",
+		"peers alice bob\nquery alice alice":    "test:2: query alice alice: alice can't have a conversation with itself",
+		"peers alice bob\nadvance soon":         `test:2: advance soon: bad duration "soon"`,
+		"peers alice bob\nexpect bob alice Yay": `test:2: expect bob alice Yay: unknown event "Yay"`,
+		"peers alice bob\nsend alice bob \"hi":  `test:2: bad quoted string: "hi`,
+		"peers alice":                           "test:1: peers alice: a scenario needs at least two peers",
+		"# nothing":                             "test:1: the scenario has to start by declaring its peers",
+	}
+
+	for text, expected := range cases {
+		_, err := Parse("test", strings.NewReader(text))
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected %q for %q, but got %v", expected, text, err)
+		}
+	}
+}
+
+func TestRunReportsTheFirstStepThatDidNotPass(t *testing.T) {
+	s := parse(t, "peers alice bob\nquery alice bob\ndeliver all\nexpect alice bob GoneSecure\nexpect alice bob GoneSecure\n")
+
+	err := (&Runner{}).Run(s)
+
+	if err == nil || err.Error() != "test:5: expect alice bob GoneSecure: GoneSecure was not signaled" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestRunReportsMessagesThatAreNotInFlight(t *testing.T) {
+	s := parse(t, "peers alice bob\nsend alice bob hello\ndeliver alice bob 2\n")
+
+	err := (&Runner{}).Run(s)
+
+	if err == nil || !strings.Contains(err.Error(), "only 1 of 2 messages were in flight from alice to bob") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestRunOnlyFailsOnTheErrorOfAStepIfTheNextStepDoesNotExpectIt(t *testing.T) {
+	s := parse(t, "peers alice bob\nquery alice bob\ndeliver all\nend bob alice\ndeliver all\nsend alice bob hello\n")
+
+	err := (&Runner{}).Run(s)
+
+	if err == nil || !strings.HasPrefix(err.Error(), "test:6: send alice bob hello: otr:") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	s = parse(t, "peers alice bob\nquery alice bob\ndeliver all\nend bob alice\ndeliver all\nsend alice bob hello\nexpect-error alice bob finished\nexpect-error alice bob\n")
+
+	err = (&Runner{}).Run(s)
+
+	if err == nil || err.Error() != "test:8: expect-error alice bob: there was no error" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestRunDoesTheSameEveryTime(t *testing.T) {
+	s, err := ParseFile("testdata/three_peers.scenario")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := &bytes.Buffer{}, &bytes.Buffer{}
+	(&Runner{Trace: first}).Run(s)
+	(&Runner{Trace: second}).Run(s)
+
+	if first.String() != second.String() {
+		t.Errorf("expected the same trace twice, but got\n%s\nand\n%s", first, second)
+	}
+}
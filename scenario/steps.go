@@ -0,0 +1,195 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/twstrike/otr3"
+)
+
+var (
+	errNoPeers       = errors.New("the scenario has to start by declaring its peers")
+	errPeersDeclared = errors.New("the peers are already declared")
+)
+
+var securityEvents = []otr3.SecurityEvent{
+	otr3.GoneInsecure,
+	otr3.GoneSecure,
+	otr3.StillSecure,
+	otr3.PinnedKeyMismatch,
+}
+
+var smpEvents = []otr3.SMPEvent{
+	otr3.SMPEventError,
+	otr3.SMPEventAbort,
+	otr3.SMPEventCheated,
+	otr3.SMPEventAskForAnswer,
+	otr3.SMPEventAskForSecret,
+	otr3.SMPEventInProgress,
+	otr3.SMPEventSuccess,
+	otr3.SMPEventFailure,
+	otr3.SMPEventNormalizationMismatch,
+}
+
+var messageEvents = []otr3.MessageEvent{
+	otr3.MessageEventEncryptionRequired,
+	otr3.MessageEventEncryptionError,
+	otr3.MessageEventConnectionEnded,
+	otr3.MessageEventSetupError,
+	otr3.MessageEventMessageReflected,
+	otr3.MessageEventMessageResent,
+	otr3.MessageEventReceivedMessageNotInPrivate,
+	otr3.MessageEventReceivedMessageUnreadable,
+	otr3.MessageEventReceivedMessageMalformed,
+	otr3.MessageEventLogHeartbeatReceived,
+	otr3.MessageEventLogHeartbeatSent,
+	otr3.MessageEventReceivedMessageGeneralError,
+	otr3.MessageEventReceivedMessageUnencrypted,
+	otr3.MessageEventReceivedMessageUnrecognized,
+	otr3.MessageEventReceivedMessageForOtherInstance,
+	otr3.MessageEventRandomnessHealthTestFailed,
+}
+
+func isEvent(name string) bool {
+	for _, e := range securityEvents {
+		if e.String() == name {
+			return true
+		}
+	}
+	for _, e := range smpEvents {
+		if e.String() == name {
+			return true
+		}
+	}
+	for _, e := range messageEvents {
+		if e.String() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns why step can't run, if it can't. peers are the peers declared so far, and a peers step adds to
+// them.
+func check(step Step, peers map[string]bool) error {
+	if step.Verb == "peers" {
+		return checkPeers(step.Args, peers)
+	}
+	if len(peers) == 0 {
+		return errNoPeers
+	}
+
+	args := step.Args
+	switch step.Verb {
+	case "query", "end", "abort-smp", "reorder", "expect-encrypted", "expect-plaintext":
+		return checkArgs(args, peers, 0, 0)
+	case "send", "answer", "expect-received":
+		return checkArgs(args, peers, 1, 1)
+	case "smp":
+		return checkArgs(args, peers, 1, 2)
+	case "expect-error":
+		return checkArgs(args, peers, 0, 1)
+	case "expect", "expect-no":
+		if err := checkArgs(args, peers, 1, 1); err != nil {
+			return err
+		}
+		if !isEvent(args[2]) {
+			return fmt.Errorf("unknown event %q", args[2])
+		}
+	case "fragment-size":
+		if err := checkArgs(args, peers, 1, 1); err != nil {
+			return err
+		}
+		_, err := parseFragmentSize(args[2])
+		return err
+	case "deliver", "drop":
+		if step.Verb == "deliver" && len(args) == 1 && args[0] == "all" {
+			return nil
+		}
+		if err := checkArgs(args, peers, 0, 1); err != nil {
+			return err
+		}
+		if len(args) == 3 {
+			_, err := parseCount(args[2])
+			return err
+		}
+	case "advance":
+		if len(args) != 1 {
+			return errors.New("expected a duration")
+		}
+		_, err := parseDuration(args[0])
+		return err
+	default:
+		return fmt.Errorf("unknown step %q", step.Verb)
+	}
+	return nil
+}
+
+func checkPeers(names []string, peers map[string]bool) error {
+	if len(peers) > 0 {
+		return errPeersDeclared
+	}
+	if len(names) < 2 {
+		return errors.New("a scenario needs at least two peers")
+	}
+	for _, name := range names {
+		if peers[name] {
+			return fmt.Errorf("peer %s is declared twice", name)
+		}
+		peers[name] = true
+	}
+	return nil
+}
+
+// checkArgs checks that args are two different peers, followed by between minMore and maxMore other arguments
+func checkArgs(args []string, peers map[string]bool, minMore, maxMore int) error {
+	if len(args) < 2+minMore || len(args) > 2+maxMore {
+		if minMore == maxMore {
+			return fmt.Errorf("expected %d arguments, but got %d", 2+minMore, len(args))
+		}
+		return fmt.Errorf("expected %d to %d arguments, but got %d", 2+minMore, 2+maxMore, len(args))
+	}
+	for _, name := range args[:2] {
+		if !peers[name] {
+			return fmt.Errorf("unknown peer %s", name)
+		}
+	}
+	if args[0] == args[1] {
+		return fmt.Errorf("%s can't have a conversation with itself", args[0])
+	}
+	return nil
+}
+
+func parseFragmentSize(s string) (uint16, error) {
+	n, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("bad fragment size %q", s)
+	}
+	return uint16(n), nil
+}
+
+// allMessages is the count of a deliver or drop step for all the messages in flight
+const allMessages = math.MaxInt32
+
+// parseCount parses the number of messages of a deliver or drop step, where all is as many as there are
+func parseCount(s string) (int, error) {
+	if s == "all" {
+		return allMessages, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("bad number of messages %q", s)
+	}
+	return n, nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("bad duration %q", s)
+	}
+	return d, nil
+}
@@ -1,6 +1,9 @@
 package otr3
 
-import "fmt"
+import (
+	"encoding/hex"
+	"fmt"
+)
 
 // SecurityEvent define the events used to indicate changes in security status. In comparison with libotr, this library does not take trust levels into concern for security events
 type SecurityEvent int
@@ -12,6 +15,9 @@ const (
 	GoneSecure
 	// StillSecure is signalled when we have refreshed the security state but is still in a secure state
 	StillSecure
+	// PinnedKeyMismatch is signalled when the peer presents a key that is not pinned during the AKE. The AKE is aborted,
+	// so the security state doesn't change. A FingerprintSecurityEventHandler also gets the fingerprint of the key
+	PinnedKeyMismatch
 )
 
 // SecurityEventHandler is an interface for events that are related to changes of security status
@@ -20,6 +26,13 @@ type SecurityEventHandler interface {
 	HandleSecurityEvent(event SecurityEvent)
 }
 
+// FingerprintSecurityEventHandler is an optional interface for a SecurityEventHandler. Security events that are about
+// a key, like PinnedKeyMismatch, are delivered to it together with the fingerprint of that key
+type FingerprintSecurityEventHandler interface {
+	// HandleSecurityEventWithFingerprint is called instead of HandleSecurityEvent for events about a key
+	HandleSecurityEventWithFingerprint(event SecurityEvent, fingerprint []byte)
+}
+
 type dynamicSecurityEventHandler struct {
 	eh func(event SecurityEvent)
 }
@@ -34,6 +47,20 @@ func (c *Conversation) securityEvent(e SecurityEvent) {
 	}
 }
 
+func (c *Conversation) securityEventWithFingerprint(e SecurityEvent, fingerprint []byte) {
+	if c.securityEventHandler != nil {
+		handleSecurityEventWithFingerprint(c.securityEventHandler, e, fingerprint)
+	}
+}
+
+func handleSecurityEventWithFingerprint(h SecurityEventHandler, e SecurityEvent, fingerprint []byte) {
+	if fh, ok := h.(FingerprintSecurityEventHandler); ok {
+		fh.HandleSecurityEventWithFingerprint(e, fingerprint)
+	} else {
+		h.HandleSecurityEvent(e)
+	}
+}
+
 // String returns the string representation of the SecurityEvent
 func (s SecurityEvent) String() string {
 	switch s {
@@ -43,6 +70,8 @@ func (s SecurityEvent) String() string {
 		return "GoneSecure"
 	case StillSecure:
 		return "StillSecure"
+	case PinnedKeyMismatch:
+		return "PinnedKeyMismatch"
 	default:
 		return "SECURITY EVENT: (THIS SHOULD NEVER HAPPEN)"
 	}
@@ -60,6 +89,14 @@ func (c combinedSecurityEventHandler) HandleSecurityEvent(event SecurityEvent) {
 	}
 }
 
+func (c combinedSecurityEventHandler) HandleSecurityEventWithFingerprint(event SecurityEvent, fingerprint []byte) {
+	for _, h := range c.handlers {
+		if h != nil {
+			handleSecurityEventWithFingerprint(h, event, fingerprint)
+		}
+	}
+}
+
 // CombineSecurityEventHandlers creates a SecurityEventHandler that will call all handlers
 // given to this function. It ignores nil entries.
 func CombineSecurityEventHandlers(handlers ...SecurityEventHandler) SecurityEventHandler {
@@ -79,3 +116,8 @@ type DebugSecurityEventHandler struct{}
 func (DebugSecurityEventHandler) HandleSecurityEvent(event SecurityEvent) {
 	fmt.Fprintf(standardErrorOutput, "%sHandleSecurityEvent(%s)\n", debugPrefix, event)
 }
+
+// HandleSecurityEventWithFingerprint dumps all security events about a key, with its fingerprint
+func (DebugSecurityEventHandler) HandleSecurityEventWithFingerprint(event SecurityEvent, fingerprint []byte) {
+	fmt.Fprintf(standardErrorOutput, "%sHandleSecurityEventWithFingerprint(%s, %s)\n", debugPrefix, event, hex.EncodeToString(fingerprint))
+}
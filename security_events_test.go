@@ -6,6 +6,7 @@ func Test_SecurityEvent_hasValidStringImplementation(t *testing.T) {
 	assertEquals(t, GoneInsecure.String(), "GoneInsecure")
 	assertEquals(t, GoneSecure.String(), "GoneSecure")
 	assertEquals(t, StillSecure.String(), "StillSecure")
+	assertEquals(t, PinnedKeyMismatch.String(), "PinnedKeyMismatch")
 	assertEquals(t, SecurityEvent(20000).String(), "SECURITY EVENT: (THIS SHOULD NEVER HAPPEN)")
 }
 
@@ -28,6 +29,42 @@ func Test_combinedSecurityEventHandler_callsAllSecurityEventHandlersGiven(t *tes
 	assertEquals(t, called3, true)
 }
 
+type dynamicFingerprintSecurityEventHandler struct {
+	eh  func(event SecurityEvent)
+	feh func(event SecurityEvent, fingerprint []byte)
+}
+
+func (d dynamicFingerprintSecurityEventHandler) HandleSecurityEvent(event SecurityEvent) {
+	d.eh(event)
+}
+
+func (d dynamicFingerprintSecurityEventHandler) HandleSecurityEventWithFingerprint(event SecurityEvent, fingerprint []byte) {
+	d.feh(event, fingerprint)
+}
+
+func Test_combinedSecurityEventHandler_passesTheFingerprintToHandlersThatTakeIt(t *testing.T) {
+	var plainEvent SecurityEvent = -1
+	var fingerprint []byte
+	f1 := dynamicSecurityEventHandler{func(event SecurityEvent) {
+		plainEvent = event
+	}}
+	f2 := dynamicFingerprintSecurityEventHandler{nil, func(event SecurityEvent, f []byte) {
+		fingerprint = f
+	}}
+	d := CombineSecurityEventHandlers(f1, nil, f2)
+	d.(FingerprintSecurityEventHandler).HandleSecurityEventWithFingerprint(PinnedKeyMismatch, []byte{0x01, 0x02})
+
+	assertEquals(t, plainEvent, PinnedKeyMismatch)
+	assertDeepEquals(t, fingerprint, []byte{0x01, 0x02})
+}
+
+func Test_debugSecurityEventHandler_writesTheEventWithTheFingerprintToStderr(t *testing.T) {
+	ss := captureStderr(func() {
+		DebugSecurityEventHandler{}.HandleSecurityEventWithFingerprint(PinnedKeyMismatch, []byte{0xAB, 0x01})
+	})
+	assertEquals(t, ss, "[DEBUG] HandleSecurityEventWithFingerprint(PinnedKeyMismatch, ab01)\n")
+}
+
 func Test_debugSecurityEventHandler_writesTheEventToStderr(t *testing.T) {
 	ss := captureStderr(func() {
 		DebugSecurityEventHandler{}.HandleSecurityEvent(StillSecure)
@@ -20,6 +20,9 @@ func (c *Conversation) Send(m ValidMessage) ([]ValidMessage, error) {
 		return nil, nil
 	}
 
+	c.potentialSMPTimeout()
+	c.potentialSMPInjections()
+
 	switch c.msgState {
 	case plainText:
 		return c.withInjections(c.sendMessageOnPlaintext(message))
@@ -0,0 +1,23 @@
+package sexp
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func FuzzReadValue(f *testing.F) {
+	f.Add([]byte(`(privkeys (account (name "alice@example.com") (protocol prpl-jabber) (private-key (dsa (p #00FC07ABCF0DC916AFF6E9AE47BEF60C7AB9B4D6B2469E436630E36F8A489BE812486A09F30B71224508654940A835301ACC525A4FF133FC152CC53DCC59D65C30A54F1993FE13FE63E5823D4C746DB21B90F9B9C00B49EC7404AB1D929BA7FBA12F2E45C6E0A651689750E8528AB8C031D3561FECEE72EBB4A090D450A9B7A857#)))))`))
+	f.Add([]byte(`(an-atom (another-atom) "a string" #123FFCADDD#)`))
+	f.Add([]byte(`)`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bufio.NewReader(bytes.NewReader(data))
+		for i := 0; i <= len(data); i++ {
+			if _, end := ReadValue(r); end {
+				return
+			}
+		}
+		t.Errorf("reading %q doesn't come to an end", data)
+	})
+}
@@ -54,3 +54,13 @@ func Test_parse_willParseAListWithSeveralLists(t *testing.T) {
 	result := Read(inp("(an-atom (another-atom) (a-third))"))
 	assertDeepEquals(t, result, List(Symbol("an-atom"), List(Symbol("another-atom")), List(Symbol("a-third"))))
 }
+
+func Test_parse_willNotParseAnUnfinishedBigNumInAList(t *testing.T) {
+	result := Read(inp("(#"))
+	assertDeepEquals(t, result, nil)
+}
+
+func Test_parse_willNotParseAnUnfinishedStringInAList(t *testing.T) {
+	result := Read(inp("(\""))
+	assertDeepEquals(t, result, nil)
+}
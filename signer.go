@@ -0,0 +1,18 @@
+package otr3
+
+import "io"
+
+// Signer is a long-term key that can sign, without necessarily giving access to its private value.
+// A Signer can keep the private key in another process or in hardware, and only hand out signatures.
+type Signer interface {
+	// Public returns the public key that verifies the signatures
+	Public() *PublicKey
+	// Sign returns the signature of hashed, in the format used by OTR - the values r and s of a DSA signature,
+	// 20 bytes each
+	Sign(rand io.Reader, hashed []byte) ([]byte, error)
+}
+
+// Public returns the public key of the private key
+func (priv *PrivateKey) Public() *PublicKey {
+	return &priv.PublicKey
+}
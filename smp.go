@@ -1,112 +1,203 @@
 package otr3
 
 import (
-	"crypto/sha256"
-	"math/big"
+	"time"
+
+	"github.com/twstrike/otr3/smp"
 )
 
-type smp struct {
-	state    smpState
-	question *string
-	secret   *big.Int
-	s1       *smp1State
-	s2       *smp2State
-	s3       *smp3State
+type smpContext struct {
+	smp.Engine
+
+	timeout      time.Duration
+	lastActivity time.Time
+
+	normalization           SMPNormalization
+	followPeerNormalization bool
+	// announcedNormalization holds the rules the peer announced in the message being received, until the
+	// authentication they come with starts. peerNormalization holds the rules of the authentication the peer started
+	// last. They are nil when the peer didn't announce any
+	announcedNormalization, peerNormalization *SMPNormalization
+
+	async *smpWorker
 }
 
-const smpVersion = 1
+// Wipe restarts the authentication, cancels the computations for it and forgets everything the peer told us about it
+func (s *smpContext) Wipe() {
+	s.cancelComputations()
+	s.Engine.Wipe()
+}
 
-func (s *smp) wipe() {
-	s.state = nil
-	s.question = nil
-	wipeBigInt(s.secret)
-	s.secret = nil
-	s.s1 = nil
-	s.s2 = nil
-	s.s3 = nil
+func (s *smpContext) cancelComputations() bool {
+	return s.async != nil && s.async.cancel()
 }
 
-func (s *smp) ensureSMP() {
-	if s.state != nil {
-		return
+// SMPStatus describes which step of the Socialist Millionaires' Protocol a Conversation is waiting for
+type SMPStatus int
+
+const (
+	// SMPStatusExpect1 means that no authentication is in progress
+	SMPStatusExpect1 SMPStatus = iota
+	// SMPStatusWaitingForSecret means that the peer started an authentication and we are waiting for the user to provide the secret
+	SMPStatusWaitingForSecret
+	// SMPStatusExpect2 means that we started an authentication and are waiting for the peer to reply
+	SMPStatusExpect2
+	// SMPStatusExpect3 means that we provided our secret and are waiting for the peer to continue the authentication
+	SMPStatusExpect3
+	// SMPStatusExpect4 means that we are waiting for the last message of the authentication
+	SMPStatusExpect4
+)
+
+// String returns the string representation of the SMPStatus
+func (s SMPStatus) String() string {
+	switch s {
+	case SMPStatusExpect1:
+		return "SMPStatusExpect1"
+	case SMPStatusWaitingForSecret:
+		return "SMPStatusWaitingForSecret"
+	case SMPStatusExpect2:
+		return "SMPStatusExpect2"
+	case SMPStatusExpect3:
+		return "SMPStatusExpect3"
+	case SMPStatusExpect4:
+		return "SMPStatusExpect4"
+	default:
+		return "SMP STATUS: (THIS SHOULD NEVER HAPPEN)"
 	}
+}
 
-	s.state = smpStateExpect1{}
+// SMPStatus returns the step the current authentication is at
+func (c *Conversation) SMPStatus() SMPStatus {
+	switch c.smp.Status() {
+	case smp.StatusWaitingForSecret:
+		return SMPStatusWaitingForSecret
+	case smp.StatusExpect2:
+		return SMPStatusExpect2
+	case smp.StatusExpect3:
+		return SMPStatusExpect3
+	case smp.StatusExpect4:
+		return SMPStatusExpect4
+	default:
+		return SMPStatusExpect1
+	}
 }
 
 // SMPQuestion returns the current SMP question and ok if there is one, and not ok if there isn't one.
 func (c *Conversation) SMPQuestion() (string, bool) {
-	if c.smp.question == nil {
-		return "", false
-	}
-	return *c.smp.question, true
+	return c.smp.Question()
 }
 
-func generateSMPSecret(initiatorFingerprint, recipientFingerprint, ssid, secret []byte) *big.Int {
-	h := sha256.New()
-	h.Write([]byte{smpVersion})
-	h.Write(initiatorFingerprint)
-	h.Write(recipientFingerprint)
-	h.Write(ssid)
-	h.Write(secret)
-	return new(big.Int).SetBytes(h.Sum(nil))
+func (c *Conversation) smpEngine() *smp.Engine {
+	e := &c.smp.Engine
+	e.Rand = c.rand()
+	e.ExponentSize = c.version.parameterLength()
+	e.SkipGroupElementChecks = !c.version.checksGroupElements()
+	return e
 }
 
-func generateDZKP(r, a, c *big.Int) *big.Int {
-	return subMod(r, mul(a, c), q)
+// Using ssid here should always be safe - we can't be in an encrypted state without having gone through the AKE
+func (c *Conversation) smpInputs() smp.Inputs {
+	return smp.Inputs{
+		OurFingerprint:   c.ourKey.Public().DefaultFingerprint(),
+		TheirFingerprint: c.theirKey.DefaultFingerprint(),
+		SessionID:        c.ssid[:],
+	}
 }
 
-func generateZKP(r, a *big.Int, ix byte) (c, d *big.Int) {
-	c = hashMPIsBN(nil, ix, modExp(g1, r))
-	d = generateDZKP(r, a, c)
-	return
-}
+func (c *Conversation) receiveSMP(t tlv) (*tlv, error) {
+	toSend, ev, err := c.smpEngine().Receive(t.serialize())
+	c.signalSMPEvent(ev)
+	if err != nil {
+		return nil, c.smpError(err)
+	}
 
-func verifyZKP(d, gen, c *big.Int, ix byte) bool {
-	r := modExp(g1, d)
-	s := modExp(gen, c)
-	t := hashMPIsBN(nil, ix, mulMod(r, s, p))
-	return eq(c, t)
+	return smpTLV(toSend)
 }
 
-func verifyZKP2(g2, g3, d5, d6, pb, qb, cp *big.Int, ix byte) bool {
-	l := mulMod(
-		modExp(g3, d5),
-		modExp(pb, cp),
-		p)
-	r := mulMod(mul(modExp(g1, d5),
-		modExp(g2, d6)),
-		modExp(qb, cp),
-		p)
-	t := hashMPIsBN(nil, ix, l, r)
-	return eq(cp, t)
-}
+func (c *Conversation) continueSMP(mutualSecret []byte) (*tlv, error) {
+	if c.smp.Status() != smp.StatusWaitingForSecret {
+		// The engine would restart too, but we can't ask it before the conversation has started
+		if c.smp.async == nil {
+			c.smp.Engine.Wipe()
+		}
+		return nil, errNotWaitingForSMPSecret
+	}
+
+	if !c.IsEncrypted() {
+		c.smp.Wipe()
+		return nil, errCantAuthenticateWithoutEncryption
+	}
+
+	if c.smp.async != nil {
+		c.continueSMPAsync(mutualSecret)
+		return nil, nil
+	}
+
+	toSend, ev, err := c.smpEngine().ProvideSecret(c.smpInputs(), c.smp.responderNormalization().apply(mutualSecret))
+	c.signalSMPEvent(ev)
+	if err != nil {
+		return nil, c.smpError(err)
+	}
 
-func verifyZKP3(cp, g2, g3, d5, d6, pa, qa *big.Int, ix byte) bool {
-	l := mulMod(modExp(g3, d5), modExp(pa, cp), p)
-	r := mulMod(mul(modExp(g1, d5), modExp(g2, d6)), modExp(qa, cp), p)
-	t := hashMPIsBN(nil, ix, l, r)
-	return eq(cp, t)
+	return smpTLV(toSend)
 }
 
-func verifyZKP4(cr, g3a, d7, qaqb, ra *big.Int, ix byte) bool {
-	l := mulMod(modExp(g1, d7), modExp(g3a, cr), p)
-	r := mulMod(modExp(qaqb, d7), modExp(ra, cr), p)
-	t := hashMPIsBN(nil, ix, l, r)
-	return eq(cr, t)
+func (c *Conversation) signalSMPEvent(ev smp.Event) {
+	switch ev {
+	case smp.EventError:
+		c.smpEvent(SMPEventError, 0)
+	case smp.EventAbort:
+		c.smpEvent(SMPEventAbort, 0)
+	case smp.EventCheated:
+		c.smpEvent(SMPEventCheated, 0)
+	case smp.EventAskForAnswer:
+		question, _ := c.smp.Question()
+		c.smpEventWithQuestion(SMPEventAskForAnswer, 25, question)
+	case smp.EventAskForSecret:
+		c.smpEvent(SMPEventAskForSecret, 25)
+	case smp.EventInProgress:
+		c.smpEvent(SMPEventInProgress, 60)
+	case smp.EventSuccess:
+		c.smpEvent(SMPEventSuccess, 100)
+	case smp.EventFailure:
+		c.smpEvent(SMPEventFailure, 100)
+	}
 }
 
-func genSMPTLV(tp uint16, mpis ...*big.Int) tlv {
-	data := make([]byte, 0, 1000)
+func smpTLV(msg []byte) (*tlv, error) {
+	if msg == nil {
+		return nil, nil
+	}
 
-	data = appendWord(data, uint32(len(mpis)))
-	data = appendMPIs(data, mpis...)
-	length := uint16(len(data))
-	out := tlv{
-		tlvType:   tp,
-		tlvLength: length,
-		tlvValue:  data,
+	var t tlv
+	if err := t.deserialize(msg); err != nil {
+		return nil, err
 	}
+	return &t, nil
+}
 
-	return out
+func smpTLVs(msgs [][]byte) ([]tlv, error) {
+	tlvs := make([]tlv, 0, len(msgs))
+	for _, m := range msgs {
+		t, err := smpTLV(m)
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			tlvs = append(tlvs, *t)
+		}
+	}
+	return tlvs, nil
+}
+
+func (c *Conversation) smpError(err error) error {
+	switch err {
+	case smp.ErrShortRandomRead:
+		return errShortRandomRead
+	case smp.ErrNotWaitingForSecret:
+		return errNotWaitingForSMPSecret
+	case smp.ErrCorruptMessage:
+		return errCorruptDataMessage
+	}
+	return c.randomnessError(err)
 }
@@ -0,0 +1,103 @@
+package smp
+
+import (
+	"crypto/sha256"
+	"io"
+	"math/big"
+)
+
+func appendWord(l []byte, r uint32) []byte {
+	return append(l, byte(r>>24), byte(r>>16), byte(r>>8), byte(r))
+}
+
+func appendShort(l []byte, r uint16) []byte {
+	return append(l, byte(r>>8), byte(r))
+}
+
+func appendMPI(l []byte, r *big.Int) []byte {
+	b := r.Bytes()
+	return append(appendWord(l, uint32(len(b))), b...)
+}
+
+func appendMPIs(l []byte, r ...*big.Int) []byte {
+	for _, mpi := range r {
+		l = appendMPI(l, mpi)
+	}
+	return l
+}
+
+func extractWord(d []byte) ([]byte, uint32, bool) {
+	if len(d) < 4 {
+		return nil, 0, false
+	}
+
+	return d[4:], uint32(d[0])<<24 |
+		uint32(d[1])<<16 |
+		uint32(d[2])<<8 |
+		uint32(d[3]), true
+}
+
+func extractShort(d []byte) ([]byte, uint16, bool) {
+	if len(d) < 2 {
+		return nil, 0, false
+	}
+
+	return d[2:], uint16(d[0])<<8 |
+		uint16(d[1]), true
+}
+
+func extractMPI(d []byte) (newPoint []byte, mpi *big.Int, ok bool) {
+	d, mpiLen, ok := extractWord(d)
+	if !ok || len(d) < int(mpiLen) {
+		return nil, nil, false
+	}
+
+	mpi = new(big.Int).SetBytes(d[:int(mpiLen)])
+	newPoint = d[int(mpiLen):]
+	ok = true
+	return
+}
+
+func extractMPIs(d []byte) ([]byte, []*big.Int, bool) {
+	current, mpiCount, ok := extractWord(d)
+	if !ok {
+		return nil, nil, false
+	}
+	result := make([]*big.Int, int(mpiCount))
+	for i := 0; i < int(mpiCount); i++ {
+		current, result[i], ok = extractMPI(current)
+		if !ok {
+			return nil, nil, false
+		}
+	}
+	return current, result, true
+}
+
+func hashMPIsBN(magic byte, mpis ...*big.Int) *big.Int {
+	h := sha256.New()
+	h.Write([]byte{magic})
+	for _, mpi := range mpis {
+		h.Write(appendMPI(nil, mpi))
+	}
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
+
+func randMPI(r io.Reader, b []byte) (*big.Int, error) {
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrShortRandomRead
+		}
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+func firstError(es ...error) error {
+	for _, e := range es {
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
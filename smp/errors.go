@@ -0,0 +1,13 @@
+package smp
+
+import "errors"
+
+var (
+	// ErrShortRandomRead is returned when the source of randomness could not provide enough data for a new exponent.
+	// Other errors of the source of randomness are returned as they are
+	ErrShortRandomRead = errors.New("smp: short read from random source")
+	// ErrNotWaitingForSecret is returned when a secret is provided but the peer hasn't started an authentication
+	ErrNotWaitingForSecret = errors.New("smp: not expected SMP secret to be provided now")
+	// ErrCorruptMessage is returned when a received message can't be parsed
+	ErrCorruptMessage = errors.New("smp: corrupt message")
+)
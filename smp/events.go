@@ -0,0 +1,51 @@
+package smp
+
+// Event describes what happened to the authentication as a result of a call to the Engine
+type Event int
+
+const (
+	// EventNone means that nothing noteworthy happened
+	EventNone Event = iota
+	// EventError means that a message was received that isn't valid in the current state. The authentication was aborted
+	EventError
+	// EventAbort means that the peer aborted the authentication
+	EventAbort
+	// EventCheated means that the peer sent a message that couldn't be verified. The authentication was aborted
+	EventCheated
+	// EventAskForAnswer means that the peer started an authentication with a question, available from Question
+	EventAskForAnswer
+	// EventAskForSecret means that the peer started an authentication without a question
+	EventAskForSecret
+	// EventInProgress means that the authentication has progressed and is waiting for the last message
+	EventInProgress
+	// EventSuccess means that both peers used the same secret
+	EventSuccess
+	// EventFailure means that the peers used different secrets
+	EventFailure
+)
+
+// String returns the string representation of the Event
+func (e Event) String() string {
+	switch e {
+	case EventNone:
+		return "EventNone"
+	case EventError:
+		return "EventError"
+	case EventAbort:
+		return "EventAbort"
+	case EventCheated:
+		return "EventCheated"
+	case EventAskForAnswer:
+		return "EventAskForAnswer"
+	case EventAskForSecret:
+		return "EventAskForSecret"
+	case EventInProgress:
+		return "EventInProgress"
+	case EventSuccess:
+		return "EventSuccess"
+	case EventFailure:
+		return "EventFailure"
+	default:
+		return "SMP EVENT: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
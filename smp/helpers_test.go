@@ -0,0 +1,96 @@
+package smp
+
+import (
+	"encoding/hex"
+	"io"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func assertEquals(t *testing.T, actual, expected interface{}) {
+	if actual != expected {
+		t.Errorf("Expected:\n%#v \nto equal:\n%#v\n", actual, expected)
+	}
+}
+
+func isNil(actual interface{}) bool {
+	val := reflect.ValueOf(actual)
+	switch val.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice:
+		return val.IsNil()
+	default:
+		return actual == nil
+	}
+}
+
+func assertNil(t *testing.T, actual interface{}) {
+	if !isNil(actual) {
+		t.Errorf("Expected:\n%#v \nto be nil\n", actual)
+	}
+}
+
+func assertNotNil(t *testing.T, actual interface{}) {
+	if isNil(actual) {
+		t.Errorf("Expected:\n%#v \nto not be nil\n", actual)
+	}
+}
+
+func assertDeepEquals(t *testing.T, actual, expected interface{}) {
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected:\n%#v \nto equal:\n%#v\n", actual, expected)
+	}
+}
+
+func bytesFromHex(s string) []byte {
+	val, _ := hex.DecodeString(s)
+	return val
+}
+
+// bnFromHex is a test utility that doesn't take into account possible errors. Thus, make sure to only call it with valid hexadecimal strings (of even length)
+func bnFromHex(s string) *big.Int {
+	res, _ := new(big.Int).SetString(s, 16)
+	return res
+}
+
+type fixedRandReader struct {
+	data []string
+	at   int
+}
+
+func fixedRand(data []string) io.Reader {
+	return &fixedRandReader{data, 0}
+}
+
+func (frr *fixedRandReader) Read(p []byte) (n int, err error) {
+	if frr.at < len(frr.data) {
+		plainBytes := bytesFromHex(frr.data[frr.at])
+		frr.at++
+		n = copy(p, plainBytes)
+		return
+	}
+	return 0, io.EOF
+}
+
+func newEngine(rand io.Reader) *Engine {
+	return &Engine{Rand: rand}
+}
+
+// newV2Engine returns an Engine configured the way OTR version 2 runs the protocol
+func newV2Engine(rand io.Reader) *Engine {
+	return &Engine{
+		Rand:                   rand,
+		ExponentSize:           16,
+		SkipGroupElementChecks: true,
+	}
+}
+
+func (e *Engine) expectEvent(t *testing.T, f func(), expectedEvent Event) {
+	e.event = EventNone
+
+	f()
+
+	assertEquals(t, e.event, expectedEvent)
+}
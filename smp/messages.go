@@ -0,0 +1,198 @@
+package smp
+
+import (
+	"bytes"
+	"math/big"
+)
+
+// The message types match the OTR TLV types that carry SMP messages,
+// so a serialized message can be put in a data message unchanged
+const (
+	typeSMP1             = uint16(0x02)
+	typeSMP2             = uint16(0x03)
+	typeSMP3             = uint16(0x04)
+	typeSMP4             = uint16(0x05)
+	typeSMPAbort         = uint16(0x06)
+	typeSMP1WithQuestion = uint16(0x07)
+)
+
+type message interface {
+	receivedMessage(*Engine) (message, error)
+	serialize() []byte
+}
+
+type smp1Message struct {
+	g2a, g3a    *big.Int
+	c2, c3      *big.Int
+	d2, d3      *big.Int
+	hasQuestion bool
+	question    string
+}
+
+type smp2Message struct {
+	g2b, g3b *big.Int
+	c2, c3   *big.Int
+	d2, d3   *big.Int
+	pb, qb   *big.Int
+	cp       *big.Int
+	d5, d6   *big.Int
+}
+
+type smp3Message struct {
+	pa, qa     *big.Int
+	cp         *big.Int
+	d5, d6, d7 *big.Int
+	ra         *big.Int
+	cr         *big.Int
+}
+
+type smp4Message struct {
+	cr *big.Int
+	d7 *big.Int
+	rb *big.Int
+}
+
+type smpMessageAbort struct{}
+
+func serializeMessage(tp uint16, prefix []byte, mpis ...*big.Int) []byte {
+	data := make([]byte, 0, 1000)
+
+	data = append(data, prefix...)
+	data = appendWord(data, uint32(len(mpis)))
+	data = appendMPIs(data, mpis...)
+
+	out := appendShort(nil, tp)
+	out = appendShort(out, uint16(len(data)))
+	return append(out, data...)
+}
+
+func (m smp1Message) serialize() []byte {
+	if m.hasQuestion {
+		return serializeMessage(typeSMP1WithQuestion, append([]byte(m.question), 0), m.g2a, m.c2, m.d2, m.g3a, m.c3, m.d3)
+	}
+	return serializeMessage(typeSMP1, nil, m.g2a, m.c2, m.d2, m.g3a, m.c3, m.d3)
+}
+
+func (m smp2Message) serialize() []byte {
+	return serializeMessage(typeSMP2, nil, m.g2b, m.c2, m.d2, m.g3b, m.c3, m.d3, m.pb, m.qb, m.cp, m.d5, m.d6)
+}
+
+func (m smp3Message) serialize() []byte {
+	return serializeMessage(typeSMP3, nil, m.pa, m.qa, m.cp, m.d5, m.d6, m.ra, m.cr, m.d7)
+}
+
+func (m smp4Message) serialize() []byte {
+	return serializeMessage(typeSMP4, nil, m.rb, m.cr, m.d7)
+}
+
+func (m smpMessageAbort) serialize() []byte {
+	return serializeMessage(typeSMPAbort, nil)
+}
+
+// AbortMessage returns the message that lets the peer know that the authentication was aborted
+func AbortMessage() []byte {
+	return smpMessageAbort{}.serialize()
+}
+
+// IsMessage returns true if the given type is the type of a message used by the Socialist Millionaires' Protocol
+func IsMessage(tp uint16) bool {
+	return tp >= typeSMP1 && tp <= typeSMP1WithQuestion
+}
+
+func parseMessage(msg []byte) (message, bool) {
+	msg, tp, ok1 := extractShort(msg)
+	msg, length, ok2 := extractShort(msg)
+	if !ok1 || !ok2 || len(msg) < int(length) {
+		return nil, false
+	}
+	value := msg[:int(length)]
+
+	switch tp {
+	case typeSMP1:
+		return toSmpMessage1(value)
+	case typeSMP1WithQuestion:
+		return toSmpMessage1Q(value)
+	case typeSMP2:
+		return toSmpMessage2(value)
+	case typeSMP3:
+		return toSmpMessage3(value)
+	case typeSMP4:
+		return toSmpMessage4(value)
+	case typeSMPAbort:
+		return smpMessageAbort{}, true
+	}
+
+	return nil, false
+}
+
+func toSmpMessage1(value []byte) (msg smp1Message, ok bool) {
+	_, mpis, ok := extractMPIs(value)
+	if !ok || len(mpis) < 6 {
+		return msg, false
+	}
+	msg.g2a = mpis[0]
+	msg.c2 = mpis[1]
+	msg.d2 = mpis[2]
+	msg.g3a = mpis[3]
+	msg.c3 = mpis[4]
+	msg.d3 = mpis[5]
+	return msg, true
+}
+
+func toSmpMessage1Q(value []byte) (msg smp1Message, ok bool) {
+	nulPos := bytes.IndexByte(value, 0)
+	if nulPos == -1 {
+		return msg, false
+	}
+	question := string(value[:nulPos])
+	msg, ok = toSmpMessage1(value[(nulPos + 1):])
+	msg.hasQuestion = true
+	msg.question = question
+	return msg, ok
+}
+
+func toSmpMessage2(value []byte) (msg smp2Message, ok bool) {
+	_, mpis, ok := extractMPIs(value)
+	if !ok || len(mpis) < 11 {
+		return msg, false
+	}
+	msg.g2b = mpis[0]
+	msg.c2 = mpis[1]
+	msg.d2 = mpis[2]
+	msg.g3b = mpis[3]
+	msg.c3 = mpis[4]
+	msg.d3 = mpis[5]
+	msg.pb = mpis[6]
+	msg.qb = mpis[7]
+	msg.cp = mpis[8]
+	msg.d5 = mpis[9]
+	msg.d6 = mpis[10]
+	return msg, true
+}
+
+func toSmpMessage3(value []byte) (msg smp3Message, ok bool) {
+	_, mpis, ok := extractMPIs(value)
+	if !ok || len(mpis) < 8 {
+		return msg, false
+	}
+	msg.pa = mpis[0]
+	msg.qa = mpis[1]
+	msg.cp = mpis[2]
+	msg.d5 = mpis[3]
+	msg.d6 = mpis[4]
+	msg.ra = mpis[5]
+	msg.cr = mpis[6]
+	msg.d7 = mpis[7]
+	return msg, true
+}
+
+func toSmpMessage4(value []byte) (msg smp4Message, ok bool) {
+	_, mpis, ok := extractMPIs(value)
+	if !ok || len(mpis) < 3 {
+		return msg, false
+	}
+	msg.rb = mpis[0]
+	msg.cr = mpis[1]
+	msg.d7 = mpis[2]
+	return msg, true
+}
@@ -1,10 +1,10 @@
-package otr3
+package smp
 
 import "testing"
 
 const (
-	tlvTypeLen  = 2
-	tlvSizeLen  = 2
+	typeLen     = 2
+	sizeLen     = 2
 	mpiCountLen = 4
 	c2Len       = 32
 	c3Len       = 32
@@ -28,7 +28,7 @@ const (
 )
 
 func Test_smpMessage1TLV(t *testing.T) {
-	expectedLength := tlvTypeLen + tlvSizeLen + mpiCountLen + (4 + g2aLen) + (4 + c2Len) + (4 + d2Len) +
+	expectedLength := typeLen + sizeLen + mpiCountLen + (4 + g2aLen) + (4 + c2Len) + (4 + d2Len) +
 		(4 + g3aLen) + (4 + c3Len) + (4 + d3Len)
 
 	exp := []byte{
@@ -40,13 +40,13 @@ func Test_smpMessage1TLV(t *testing.T) {
 	}
 
 	msg := fixtureMessage1()
-	tlv := msg.tlv().serialize()
-	assertEquals(t, len(tlv), expectedLength)
-	assertDeepEquals(t, tlv[:len(exp)], exp)
+	serialized := msg.serialize()
+	assertEquals(t, len(serialized), expectedLength)
+	assertDeepEquals(t, serialized[:len(exp)], exp)
 }
 
 func Test_smpMessage2TLV(t *testing.T) {
-	expectedLength := tlvTypeLen + tlvSizeLen + mpiCountLen +
+	expectedLength := typeLen + sizeLen + mpiCountLen +
 		(4 + g2bLen) + (4 + c2Len) + (4 + d2Len) + (4 + g3bLen) +
 		(4 + c3Len) + (4 + d3Len) + (4 + pbLen) + (4 + qbLen) +
 		(4 + cpLen) + (4 + d5Len) + (4 + d6Len)
@@ -60,13 +60,13 @@ func Test_smpMessage2TLV(t *testing.T) {
 	}
 
 	msg := fixtureMessage2()
-	tlv := msg.tlv().serialize()
-	assertEquals(t, len(tlv), expectedLength)
-	assertDeepEquals(t, tlv[:len(exp)], exp)
+	serialized := msg.serialize()
+	assertEquals(t, len(serialized), expectedLength)
+	assertDeepEquals(t, serialized[:len(exp)], exp)
 }
 
 func Test_smpMessage3TLV(t *testing.T) {
-	expectedLength := tlvTypeLen + tlvSizeLen + mpiCountLen +
+	expectedLength := typeLen + sizeLen + mpiCountLen +
 		(4 + paLen) + (4 + qaLen) + (4 + cpLen) +
 		(4 + d5Len) + (4 + d6Len) + (4 + raLen) +
 		(4 + crLen) + (4 + d7Len)
@@ -80,13 +80,13 @@ func Test_smpMessage3TLV(t *testing.T) {
 	}
 
 	msg := fixtureMessage3()
-	tlv := msg.tlv().serialize()
-	assertEquals(t, len(tlv), expectedLength)
-	assertDeepEquals(t, tlv[:len(exp)], exp)
+	serialized := msg.serialize()
+	assertEquals(t, len(serialized), expectedLength)
+	assertDeepEquals(t, serialized[:len(exp)], exp)
 }
 
 func Test_smpMessage4TLV(t *testing.T) {
-	expectedLength := tlvTypeLen + tlvSizeLen + mpiCountLen + (4 + rbLen) + (4 + crLen) + (4 + d7Len)
+	expectedLength := typeLen + sizeLen + mpiCountLen + (4 + rbLen) + (4 + crLen) + (4 + d7Len)
 	exp := []byte{
 		0x00, 0x05,
 		0x01, 0xB0,
@@ -96,16 +96,21 @@ func Test_smpMessage4TLV(t *testing.T) {
 	}
 
 	msg := fixtureMessage4()
-	tlv := msg.tlv().serialize()
-	assertEquals(t, len(tlv), expectedLength)
-	assertDeepEquals(t, tlv[:len(exp)], exp)
+	serialized := msg.serialize()
+	assertEquals(t, len(serialized), expectedLength)
+	assertDeepEquals(t, serialized[:len(exp)], exp)
+}
+
+func rawMessage(tp uint16, value []byte) []byte {
+	out := appendShort(nil, tp)
+	out = appendShort(out, uint16(len(value)))
+	return append(out, value...)
 }
 
 func Test_readSmpMessage1TLV(t *testing.T) {
 	msg := fixtureMessage1()
-	tlv := msg.tlv()
 
-	parsedValue, parsedOk := tlv.smpMessage()
+	parsedValue, parsedOk := parseMessage(msg.serialize())
 	assertEquals(t, parsedOk, true)
 	val, ok := parsedValue.(smp1Message)
 	assertEquals(t, ok, true)
@@ -114,9 +119,8 @@ func Test_readSmpMessage1TLV(t *testing.T) {
 
 func Test_readSmpMessage1TLVWithAQuestion(t *testing.T) {
 	msg := fixtureMessage1Q()
-	tlv := msg.tlv()
 
-	parsedValue, parsedOk := tlv.smpMessage()
+	parsedValue, parsedOk := parseMessage(msg.serialize())
 	assertEquals(t, parsedOk, true)
 	val, ok := parsedValue.(smp1Message)
 	assertEquals(t, ok, true)
@@ -124,126 +128,99 @@ func Test_readSmpMessage1TLVWithAQuestion(t *testing.T) {
 }
 
 func Test_readSmpMessage1TLVWithAQuestion_willFailIfThereIsNoNulByte(t *testing.T) {
-	msg := fixtureMessage1Q()
-	tlv := msg.tlv()
-	tlv.tlvLength = 0
-	tlv.tlvValue = []byte{}
-
-	_, parsedOk := tlv.smpMessage()
+	_, parsedOk := parseMessage(rawMessage(typeSMP1WithQuestion, []byte{}))
 	assertEquals(t, parsedOk, false)
 }
 
 func Test_readSmpMessage1TLVWithAQuestion_willHandleItCorrectlyIfTheQuestionEndsOnAByte(t *testing.T) {
-	msg := fixtureMessage1Q()
-	tlv := msg.tlv()
-	tlv.tlvLength = 2
-	tlv.tlvValue = []byte{0x01, 0x00}
-
-	_, parsedOk := tlv.smpMessage()
+	_, parsedOk := parseMessage(rawMessage(typeSMP1WithQuestion, []byte{0x01, 0x00}))
 	assertEquals(t, parsedOk, false)
 }
 
 func Test_readSmpMessage1TLVWithAQuestion_willHandleItCorrectlyIfANulByteIsTheOnlyContent(t *testing.T) {
-	msg := fixtureMessage1Q()
-	tlv := msg.tlv()
-	tlv.tlvLength = 1
-	tlv.tlvValue = []byte{0x00}
-
-	_, parsedOk := tlv.smpMessage()
+	_, parsedOk := parseMessage(rawMessage(typeSMP1WithQuestion, []byte{0x00}))
 	assertEquals(t, parsedOk, false)
 }
 
 func Test_readSmpMessage1TLV_ReturnsNotOKForInValidMessage1(t *testing.T) {
-	msg := fixtureMessage1()
-	tlv := msg.tlv()
-	tlv.tlvValue = tlv.tlvValue[:24]
+	msg := fixtureMessage1().serialize()
 
-	_, parsedOk := tlv.smpMessage()
+	_, parsedOk := parseMessage(rawMessage(typeSMP1, msg[4:28]))
 	assertEquals(t, parsedOk, false)
 }
 
 func Test_readSmpMessage1TLV_ReturnsNotOKIfTheNumberOfMPIsIsTooShort(t *testing.T) {
-	msg := fixtureMessage1()
-	tlv := msg.tlv()
-	tlv.tlvValue[3] = 0x01
+	msg := fixtureMessage1().serialize()
+	msg[7] = 0x01
 
-	_, parsedOk := tlv.smpMessage()
+	_, parsedOk := parseMessage(msg)
 	assertEquals(t, parsedOk, false)
 }
 
 func Test_readSmpMessage2TLV_ReturnsNotOKForInValidMessage2(t *testing.T) {
-	msg := fixtureMessage2()
-	tlv := msg.tlv()
-	tlv.tlvValue = tlv.tlvValue[:24]
+	msg := fixtureMessage2().serialize()
 
-	_, parsedOk := tlv.smpMessage()
+	_, parsedOk := parseMessage(rawMessage(typeSMP2, msg[4:28]))
 	assertEquals(t, parsedOk, false)
 }
 
 func Test_readSmpMessage2TLV_ReturnsNotOKIfTheNumberOfMPIsIsTooShort(t *testing.T) {
-	msg := fixtureMessage2()
-	tlv := msg.tlv()
-	tlv.tlvValue[3] = 0x01
+	msg := fixtureMessage2().serialize()
+	msg[7] = 0x01
 
-	_, parsedOk := tlv.smpMessage()
+	_, parsedOk := parseMessage(msg)
 	assertEquals(t, parsedOk, false)
 }
 
 func Test_readSmpMessage3TLV_ReturnsNotOKForInValidMessage2(t *testing.T) {
-	msg := fixtureMessage3()
-	tlv := msg.tlv()
-	tlv.tlvValue = tlv.tlvValue[:24]
+	msg := fixtureMessage3().serialize()
 
-	_, parsedOk := tlv.smpMessage()
+	_, parsedOk := parseMessage(rawMessage(typeSMP3, msg[4:28]))
 	assertEquals(t, parsedOk, false)
 }
 
 func Test_readSmpMessage3TLV_ReturnsNotOKIfTheNumberOfMPIsIsTooShort(t *testing.T) {
-	msg := fixtureMessage3()
-	tlv := msg.tlv()
-	tlv.tlvValue[3] = 0x01
+	msg := fixtureMessage3().serialize()
+	msg[7] = 0x01
 
-	_, parsedOk := tlv.smpMessage()
+	_, parsedOk := parseMessage(msg)
 	assertEquals(t, parsedOk, false)
 }
 
 func Test_readSmpMessage4TLV_ReturnsNotOKForInValidMessage2(t *testing.T) {
-	msg := fixtureMessage4()
-	tlv := msg.tlv()
-	tlv.tlvValue = tlv.tlvValue[:24]
+	msg := fixtureMessage4().serialize()
 
-	_, parsedOk := tlv.smpMessage()
+	_, parsedOk := parseMessage(rawMessage(typeSMP4, msg[4:28]))
 	assertEquals(t, parsedOk, false)
 }
 
 func Test_readSmpMessage4TLV_ReturnsNotOKIfTheNumberOfMPIsIsTooShort(t *testing.T) {
-	msg := fixtureMessage4()
-	tlv := msg.tlv()
-	tlv.tlvValue[3] = 0x01
+	msg := fixtureMessage4().serialize()
+	msg[7] = 0x01
 
-	_, parsedOk := tlv.smpMessage()
+	_, parsedOk := parseMessage(msg)
 	assertEquals(t, parsedOk, false)
 }
 
 func Test_toSMPMessage_ReturnsNotOKForIncorrectTLVType(t *testing.T) {
-	tlv := tlv{tlvType: 0x0A}
-
-	_, parsedOk := tlv.smpMessage()
+	_, parsedOk := parseMessage(rawMessage(0x0A, nil))
 	assertEquals(t, parsedOk, false)
 }
 
 func Test_toSMPMessage_ReturnsNotOKForTooShortTLV(t *testing.T) {
-	tlv := tlv{}
+	_, parsedOk := parseMessage([]byte{0x00, 0x02, 0x00})
+	assertEquals(t, parsedOk, false)
+}
 
-	_, parsedOk := tlv.smpMessage()
+func Test_toSMPMessage_ReturnsNotOKIfTheLengthIsLongerThanTheValue(t *testing.T) {
+	_, parsedOk := parseMessage([]byte{0x00, 0x06, 0x00, 0x04, 0x00, 0x00})
 	assertEquals(t, parsedOk, false)
 }
 
 func Test_readSmpMessage2TLV(t *testing.T) {
 	msg := fixtureMessage2()
-	tlv := msg.tlv()
 
-	parsedValue, parsedOk := tlv.smpMessage()
+	parsedValue, parsedOk := parseMessage(msg.serialize())
 	assertEquals(t, parsedOk, true)
 	val, ok := parsedValue.(smp2Message)
 	assertEquals(t, ok, true)
@@ -252,9 +229,8 @@ func Test_readSmpMessage2TLV(t *testing.T) {
 
 func Test_readSmpMessage3TLV(t *testing.T) {
 	msg := fixtureMessage3()
-	tlv := msg.tlv()
 
-	parsedValue, parsedOk := tlv.smpMessage()
+	parsedValue, parsedOk := parseMessage(msg.serialize())
 	assertEquals(t, parsedOk, true)
 	val, ok := parsedValue.(smp3Message)
 	assertEquals(t, ok, true)
@@ -263,9 +239,8 @@ func Test_readSmpMessage3TLV(t *testing.T) {
 
 func Test_readSmpMessage4TLV(t *testing.T) {
 	msg := fixtureMessage4()
-	tlv := msg.tlv()
 
-	parsedValue, parsedOk := tlv.smpMessage()
+	parsedValue, parsedOk := parseMessage(msg.serialize())
 	assertEquals(t, parsedOk, true)
 	val, ok := parsedValue.(smp4Message)
 	assertEquals(t, ok, true)
@@ -274,11 +249,25 @@ func Test_readSmpMessage4TLV(t *testing.T) {
 
 func Test_readSmpMessageAbortTLV(t *testing.T) {
 	msg := fixtureMessageAbort()
-	tlv := msg.tlv()
 
-	parsedValue, parsedOk := tlv.smpMessage()
+	parsedValue, parsedOk := parseMessage(msg.serialize())
 	assertEquals(t, parsedOk, true)
 	val, ok := parsedValue.(smpMessageAbort)
 	assertEquals(t, ok, true)
 	assertDeepEquals(t, val, msg)
 }
+
+func Test_IsMessage_returnsTrueForTheTypesOfSMPMessages(t *testing.T) {
+	assertEquals(t, IsMessage(0x01), false)
+	assertEquals(t, IsMessage(typeSMP1), true)
+	assertEquals(t, IsMessage(typeSMP2), true)
+	assertEquals(t, IsMessage(typeSMP3), true)
+	assertEquals(t, IsMessage(typeSMP4), true)
+	assertEquals(t, IsMessage(typeSMPAbort), true)
+	assertEquals(t, IsMessage(typeSMP1WithQuestion), true)
+	assertEquals(t, IsMessage(0x08), false)
+}
+
+func Test_AbortMessage_returnsAnAbortWithoutValues(t *testing.T) {
+	assertDeepEquals(t, AbortMessage(), []byte{0x00, 0x06, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00})
+}
@@ -0,0 +1,436 @@
+package smp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/twstrike/otr3/internal/modeltest"
+)
+
+// The model of this file is the SMP state machine of the OTRv3 spec, written as plainly as possible. It doesn't do
+// any cryptography: it tracks which run of the protocol each message belongs to instead, since that is what decides
+// whether the proofs in it can be verified. The only state the spec doesn't have is StatusWaitingForSecret, in which
+// the Engine waits for the secret after a message 1, and handles everything else like an unexpected message.
+
+// smpModelMessage is what the model knows about a message: a message 1 starts a run, a message 2 is a response to a
+// run, and messages 3 and 4 belong to both of them
+type smpModelMessage struct {
+	typ      uint16
+	run      int
+	response int
+	secret   string
+	question string
+}
+
+type smpModelParty struct {
+	status Status
+	secret string
+	// run is the run we are in, and response the response to it, whether we started it or the peer did
+	run, response int
+}
+
+type smpModel struct {
+	runs, responses int
+	cover           func(string)
+}
+
+type smpModelResult struct {
+	sent     []smpModelMessage
+	event    Event
+	question string
+	err      error
+}
+
+func (m *smpModel) start(p *smpModelParty, question, secret string) (r smpModelResult) {
+	if p.status != StatusExpect1 {
+		m.cover("start while in progress")
+		r.sent = append(r.sent, smpModelMessage{typ: typeSMPAbort})
+	} else {
+		m.cover("start")
+	}
+
+	m.runs++
+	msg := smpModelMessage{typ: typeSMP1, run: m.runs, question: question}
+	if question != "" {
+		msg.typ = typeSMP1WithQuestion
+	}
+	*p = smpModelParty{status: StatusExpect2, secret: secret, run: m.runs}
+	r.sent = append(r.sent, msg)
+	return
+}
+
+func (m *smpModel) provide(p *smpModelParty, secret string) (r smpModelResult) {
+	if p.status != StatusWaitingForSecret {
+		m.cover("provide while not waiting for the secret")
+		*p = smpModelParty{status: StatusExpect1}
+		r.err = ErrNotWaitingForSecret
+		return
+	}
+
+	m.cover("provide")
+	m.responses++
+	p.status, p.secret, p.response = StatusExpect3, secret, m.responses
+	r.sent = append(r.sent, smpModelMessage{typ: typeSMP2, run: p.run, response: p.response, secret: secret})
+	return
+}
+
+func (m *smpModel) abort(p *smpModelParty) (r smpModelResult) {
+	if p.status == StatusExpect1 {
+		m.cover("abort while not in progress")
+		return
+	}
+
+	m.cover("abort")
+	*p = smpModelParty{status: StatusExpect1}
+	r.sent = append(r.sent, smpModelMessage{typ: typeSMPAbort})
+	return
+}
+
+// restart goes back to SMPSTATE_EXPECT1 and sends an abort, with the event that says why
+func (m *smpModel) restart(p *smpModelParty, transition string, ev Event) smpModelResult {
+	m.cover(transition)
+	*p = smpModelParty{status: StatusExpect1}
+	return smpModelResult{sent: []smpModelMessage{{typ: typeSMPAbort}}, event: ev}
+}
+
+func outcome(ourSecret, theirSecret string) (Event, string) {
+	if ourSecret == theirSecret {
+		return EventSuccess, "success"
+	}
+	return EventFailure, "failure"
+}
+
+func (m *smpModel) receive(p *smpModelParty, msg smpModelMessage) (r smpModelResult) {
+	switch msg.typ {
+	case typeSMPAbort:
+		m.cover("receive abort")
+		*p = smpModelParty{status: StatusExpect1}
+		r.event = EventAbort
+
+	case typeSMP1, typeSMP1WithQuestion:
+		if p.status != StatusExpect1 {
+			return m.restart(p, "unexpected message 1", EventError)
+		}
+		m.cover("receive message 1")
+		*p = smpModelParty{status: StatusWaitingForSecret, run: msg.run}
+		r.event = EventAskForSecret
+		if msg.question != "" {
+			r.event, r.question = EventAskForAnswer, msg.question
+		}
+
+	case typeSMP2:
+		if p.status != StatusExpect2 {
+			return m.restart(p, "unexpected message 2", EventError)
+		}
+		if msg.run != p.run {
+			return m.restart(p, "message 2 of another run", EventCheated)
+		}
+		m.cover("receive message 2")
+		p.status, p.response = StatusExpect4, msg.response
+		r.sent = append(r.sent, smpModelMessage{typ: typeSMP3, run: p.run, response: p.response, secret: p.secret})
+		r.event = EventInProgress
+
+	case typeSMP3:
+		if p.status != StatusExpect3 {
+			return m.restart(p, "unexpected message 3", EventError)
+		}
+		if msg.run != p.run || msg.response != p.response {
+			return m.restart(p, "message 3 of another run", EventCheated)
+		}
+		var result string
+		r.event, result = outcome(p.secret, msg.secret)
+		m.cover("receive message 3 with " + result)
+		r.sent = append(r.sent, smpModelMessage{typ: typeSMP4, run: p.run, response: p.response, secret: p.secret})
+		*p = smpModelParty{status: StatusExpect1}
+
+	case typeSMP4:
+		if p.status != StatusExpect4 {
+			return m.restart(p, "unexpected message 4", EventError)
+		}
+		if msg.run != p.run || msg.response != p.response {
+			return m.restart(p, "message 4 of another run", EventCheated)
+		}
+		var result string
+		r.event, result = outcome(p.secret, msg.secret)
+		m.cover("receive message 4 with " + result)
+		*p = smpModelParty{status: StatusExpect1}
+	}
+	return
+}
+
+var smpModelTransitions = []string{
+	"start", "start while in progress",
+	"provide", "provide while not waiting for the secret",
+	"abort", "abort while not in progress",
+	"receive abort",
+	"receive message 1", "unexpected message 1",
+	"receive message 2", "unexpected message 2", "message 2 of another run",
+	"receive message 3 with success", "receive message 3 with failure", "unexpected message 3", "message 3 of another run",
+	"receive message 4 with success", "receive message 4 with failure", "unexpected message 4", "message 4 of another run",
+}
+
+type smpOpKind int
+
+const (
+	opStart smpOpKind = iota
+	opProvide
+	opAbort
+	opDeliver
+	opReplay
+	opDrop
+)
+
+// smpOp is something that happens to one of the peers, or to the messages between them. Deliveries and losses pick
+// the message in flight at index, and replays the message the peer received index messages ago, modulo how many
+// there are, so they still make sense when the sequence is shrunk. Replays stand for messages that the network
+// duplicated and delayed.
+type smpOp struct {
+	kind     smpOpKind
+	bob      bool
+	index    int
+	question string
+	secret   string
+}
+
+func (op smpOp) String() string {
+	name := "alice"
+	if op.bob {
+		name = "bob"
+	}
+
+	switch op.kind {
+	case opStart:
+		return fmt.Sprintf("%s starts with question %q and secret %q", name, op.question, op.secret)
+	case opProvide:
+		return fmt.Sprintf("%s provides secret %q", name, op.secret)
+	case opAbort:
+		return fmt.Sprintf("%s aborts", name)
+	case opDeliver:
+		return fmt.Sprintf("message %d in flight arrives", op.index)
+	case opReplay:
+		return fmt.Sprintf("%s receives again the message received %d messages ago", name, op.index)
+	default:
+		return fmt.Sprintf("message %d in flight is lost", op.index)
+	}
+}
+
+func generateSMPOp(r *rand.Rand) modeltest.Op {
+	// Most operations deliver messages in order, and most secrets are the same, so that runs often get to the end
+	op := smpOp{bob: r.Intn(2) == 1, secret: "one"}
+	if r.Intn(2) == 0 {
+		op.index = 1 + r.Intn(2)
+	}
+	if r.Intn(4) == 0 {
+		op.secret = "two"
+	}
+	if r.Intn(2) == 0 {
+		op.question = "which one?"
+	}
+
+	switch n := r.Intn(40); {
+	case n < 2:
+		op.kind = opStart
+	case n < 8:
+		op.kind = opProvide
+	case n < 9:
+		op.kind = opAbort
+	case n < 34:
+		op.kind = opDeliver
+	case n < 37:
+		op.kind = opReplay
+	default:
+		op.kind = opDrop
+	}
+	return op
+}
+
+type smpInFlight struct {
+	to    *smpModelPeer
+	wire  []byte
+	model smpModelMessage
+}
+
+type smpModelPeer struct {
+	name     string
+	engine   *Engine
+	inputs   Inputs
+	model    smpModelParty
+	received []smpInFlight
+}
+
+func newSMPModelPeer(name string, seed int64, inputs Inputs) *smpModelPeer {
+	// The exponents are much shorter than in OTR, to run many sequences quickly. It doesn't change the state machine.
+	return &smpModelPeer{name: name, engine: &Engine{Rand: rand.New(rand.NewSource(seed)), ExponentSize: 16}, inputs: inputs}
+}
+
+type smpModelRunner struct {
+	model      smpModel
+	alice, bob *smpModelPeer
+	inFlight   []smpInFlight
+}
+
+// take returns the message op picks, and removes it from the messages in flight unless it's a replay
+func (r *smpModelRunner) take(op smpOp) (smpInFlight, bool) {
+	if op.kind == opReplay {
+		p := r.alice
+		if op.bob {
+			p = r.bob
+		}
+		if len(p.received) == 0 {
+			return smpInFlight{}, false
+		}
+		return p.received[len(p.received)-1-op.index%len(p.received)], true
+	}
+
+	if len(r.inFlight) == 0 {
+		return smpInFlight{}, false
+	}
+	j := op.index % len(r.inFlight)
+	msg := r.inFlight[j]
+	r.inFlight = append(r.inFlight[:j], r.inFlight[j+1:]...)
+	return msg, true
+}
+
+func (r *smpModelRunner) do(op smpOp) error {
+	p, other := r.alice, r.bob
+	if op.bob {
+		p, other = r.bob, r.alice
+	}
+
+	var expected smpModelResult
+	var sent [][]byte
+	var ev Event
+	var err error
+
+	switch op.kind {
+	case opStart:
+		expected = r.model.start(&p.model, op.question, op.secret)
+		sent, err = p.engine.Start(p.inputs, op.question, []byte(op.secret))
+	case opProvide:
+		expected = r.model.provide(&p.model, op.secret)
+		var msg []byte
+		msg, ev, err = p.engine.ProvideSecret(p.inputs, []byte(op.secret))
+		sent = appendNonEmpty(sent, msg)
+	case opAbort:
+		expected = r.model.abort(&p.model)
+		sent = appendNonEmpty(sent, p.engine.Abort())
+	default:
+		msg, ok := r.take(op)
+		if !ok || op.kind == opDrop {
+			return nil
+		}
+
+		p, other = msg.to, r.alice
+		if p == r.alice {
+			other = r.bob
+		}
+		p.received = append(p.received, msg)
+		expected = r.model.receive(&p.model, msg.model)
+		var reply []byte
+		reply, ev, err = p.engine.Receive(msg.wire)
+		sent = appendNonEmpty(sent, reply)
+	}
+
+	if err := compareSMPStep(p, expected, sent, ev, err); err != nil {
+		return err
+	}
+
+	for j, msg := range sent {
+		r.inFlight = append(r.inFlight, smpInFlight{to: other, wire: msg, model: expected.sent[j]})
+	}
+	return nil
+}
+
+func runSMPModel(ops []modeltest.Op, cover func(string)) error {
+	in := fixtureInputs()
+	r := &smpModelRunner{
+		model: smpModel{cover: cover},
+		alice: newSMPModelPeer("alice", 1, in),
+		bob:   newSMPModelPeer("bob", 2, Inputs{OurFingerprint: in.TheirFingerprint, TheirFingerprint: in.OurFingerprint, SessionID: in.SessionID}),
+	}
+
+	for i, op := range ops {
+		if err := r.do(op.(smpOp)); err != nil {
+			return fmt.Errorf("after operation %d, %s: %v", i+1, op, err)
+		}
+	}
+	return nil
+}
+
+func appendNonEmpty(messages [][]byte, msg []byte) [][]byte {
+	if len(msg) == 0 {
+		return messages
+	}
+	return append(messages, msg)
+}
+
+func compareSMPStep(p *smpModelPeer, expected smpModelResult, sent [][]byte, ev Event, err error) error {
+	if err != expected.err {
+		return fmt.Errorf("%s returned the error %v, but the model expects %v", p.name, err, expected.err)
+	}
+	if ev != expected.event {
+		return fmt.Errorf("%s signaled %s, but the model expects %s", p.name, ev, expected.event)
+	}
+	if question, _ := p.engine.Question(); ev == EventAskForAnswer && question != expected.question {
+		return fmt.Errorf("%s was asked %q, but the model expects %q", p.name, question, expected.question)
+	}
+
+	var types, expectedTypes []uint16
+	for _, msg := range sent {
+		types = append(types, binary.BigEndian.Uint16(msg))
+	}
+	for _, msg := range expected.sent {
+		expectedTypes = append(expectedTypes, msg.typ)
+	}
+	if fmt.Sprint(types) != fmt.Sprint(expectedTypes) {
+		return fmt.Errorf("%s sent messages of types %v, but the model expects %v", p.name, types, expectedTypes)
+	}
+
+	if p.engine.Status() != p.model.status {
+		return fmt.Errorf("%s is in %s, but the model expects %s", p.name, p.engine.Status(), p.model.status)
+	}
+	return nil
+}
+
+// smpCompleteRun is alice authenticating bob with the same secret, with every message arriving in order
+var smpCompleteRun = []modeltest.Op{
+	smpOp{kind: opStart, secret: "one"},
+	smpOp{kind: opDeliver},
+	smpOp{kind: opProvide, bob: true, secret: "one"},
+	smpOp{kind: opDeliver},
+	smpOp{kind: opDeliver},
+	smpOp{kind: opDeliver},
+}
+
+// smpModelExamples get messages 3 and 4 from an earlier run to peers that are in the same step of a new run, and
+// message 4 again to alice once the run is over
+var smpModelExamples = [][]modeltest.Op{
+	append(smpCompleteRun[:len(smpCompleteRun):len(smpCompleteRun)],
+		smpOp{kind: opReplay},
+	),
+	append(smpCompleteRun[:len(smpCompleteRun):len(smpCompleteRun)],
+		smpOp{kind: opReplay, bob: true, index: 1},
+		smpOp{kind: opProvide, bob: true, secret: "one"},
+		smpOp{kind: opReplay, bob: true, index: 1},
+	),
+	append(smpCompleteRun[:len(smpCompleteRun):len(smpCompleteRun)],
+		smpOp{kind: opStart, secret: "one"},
+		smpOp{kind: opDeliver},
+		smpOp{kind: opProvide, bob: true, secret: "one"},
+		smpOp{kind: opDeliver},
+		smpOp{kind: opReplay, index: 1},
+	),
+}
+
+func Test_Engine_followsTheStateMachineOfTheSpec(t *testing.T) {
+	modeltest.Check(t, modeltest.Config{
+		Sequences:   40,
+		Length:      25,
+		Generate:    generateSMPOp,
+		Run:         runSMPModel,
+		Transitions: smpModelTransitions,
+		Examples:    smpModelExamples,
+	})
+}
@@ -0,0 +1,58 @@
+package smp
+
+import (
+	"errors"
+	"math/big"
+)
+
+type smp1State struct {
+	a2, a3 *big.Int
+	r2, r3 *big.Int
+	msg    smp1Message
+}
+
+func (e *Engine) generateSMP1Parameters() (s smp1State, err error) {
+	b := make([]byte, e.parameterLength())
+	var err1, err2, err3, err4 error
+	s.a2, err1 = e.randMPI(b)
+	s.a3, err2 = e.randMPI(b)
+	s.r2, err3 = e.randMPI(b)
+	s.r3, err4 = e.randMPI(b)
+	return s, firstError(err1, err2, err3, err4)
+}
+
+func generateSMP1Message(s smp1State) (m smp1Message) {
+	m.g2a = modExp(g1, s.a2)
+	m.g3a = modExp(g1, s.a3)
+	m.c2, m.d2 = generateZKP(s.r2, s.a2, 1)
+	m.c3, m.d3 = generateZKP(s.r3, s.a3, 2)
+	return
+}
+
+func (e *Engine) generateSMP1() (s smp1State, err error) {
+	if s, err = e.generateSMP1Parameters(); err != nil {
+		return s, err
+	}
+	s.msg = generateSMP1Message(s)
+	return
+}
+
+func (e *Engine) verifySMP1(msg smp1Message) error {
+	if !e.isGroupElement(msg.g2a) {
+		return errors.New("g2a is an invalid group element")
+	}
+
+	if !e.isGroupElement(msg.g3a) {
+		return errors.New("g3a is an invalid group element")
+	}
+
+	if !verifyZKP(msg.d2, msg.g2a, msg.c2, 1) {
+		return errors.New("c2 is not a valid zero knowledge proof")
+	}
+
+	if !verifyZKP(msg.d3, msg.g3a, msg.c3, 2) {
+		return errors.New("c3 is not a valid zero knowledge proof")
+	}
+
+	return nil
+}
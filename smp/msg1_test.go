@@ -1,12 +1,13 @@
-package otr3
+package smp
 
 import (
+	"errors"
 	"math/big"
 	"testing"
 )
 
 func Test_generatesLongerAandRValuesForOtrV3(t *testing.T) {
-	otr := newConversation(otrV3{}, fixtureRand())
+	otr := newEngine(fixtureRand())
 	smp, err := otr.generateSMP1()
 	assertDeepEquals(t, smp.a2, fixtureLong1)
 	assertDeepEquals(t, smp.a3, fixtureLong2)
@@ -16,44 +17,44 @@ func Test_generatesLongerAandRValuesForOtrV3(t *testing.T) {
 }
 
 func Test_generateSMP1Parameters_ReturnsErrorIfThereIsntEnoughRandomnessForA2(t *testing.T) {
-	_, err := newConversation(otrV2{}, fixedRand([]string{"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b"})).generateSMP1Parameters()
-	assertDeepEquals(t, err, errShortRandomRead)
+	_, err := newV2Engine(fixedRand([]string{"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b"})).generateSMP1Parameters()
+	assertDeepEquals(t, err, ErrShortRandomRead)
 }
 
 func Test_generateSMP1_ReturnsErrorIfGenerateInitialParametersDoesntWork(t *testing.T) {
-	_, err := newConversation(otrV2{}, fixedRand([]string{"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b"})).generateSMP1()
-	assertDeepEquals(t, err, errShortRandomRead)
+	_, err := newV2Engine(fixedRand([]string{"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b"})).generateSMP1()
+	assertDeepEquals(t, err, ErrShortRandomRead)
 }
 
 func Test_generateSMP1Parameters_ReturnsErrorIfThereIsntEnoughRandomnessForA3(t *testing.T) {
-	_, err := newConversation(otrV2{}, fixedRand([]string{
+	_, err := newV2Engine(fixedRand([]string{
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b8b",
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b",
 	})).generateSMP1Parameters()
-	assertDeepEquals(t, err, errShortRandomRead)
+	assertDeepEquals(t, err, ErrShortRandomRead)
 }
 
 func Test_generateSMP1Parameters_ReturnsErrorIfThereIsntEnoughRandomnessForR2(t *testing.T) {
-	_, err := newConversation(otrV2{}, fixedRand([]string{
+	_, err := newV2Engine(fixedRand([]string{
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b8b",
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b8b",
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b",
 	})).generateSMP1Parameters()
-	assertDeepEquals(t, err, errShortRandomRead)
+	assertDeepEquals(t, err, ErrShortRandomRead)
 }
 
 func Test_generateSMP1Parameters_ReturnsErrorIfThereIsntEnoughRandomnessForR3(t *testing.T) {
-	_, err := newConversation(otrV2{}, fixedRand([]string{
+	_, err := newV2Engine(fixedRand([]string{
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b8b",
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b8b",
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b8b",
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b",
 	})).generateSMP1Parameters()
-	assertDeepEquals(t, err, errShortRandomRead)
+	assertDeepEquals(t, err, ErrShortRandomRead)
 }
 
 func Test_generatesShorterAandRValuesForOtrV2(t *testing.T) {
-	otr := newConversation(otrV2{}, fixtureRand())
+	otr := newV2Engine(fixtureRand())
 	smp, _ := otr.generateSMP1()
 	assertDeepEquals(t, smp.a2, fixtureShort1)
 	assertDeepEquals(t, smp.a3, fixtureShort2)
@@ -62,47 +63,47 @@ func Test_generatesShorterAandRValuesForOtrV2(t *testing.T) {
 }
 
 func Test_computesG2aAndG3aCorrectlyForOtrV3(t *testing.T) {
-	otr := newConversation(otrV3{}, fixtureRand())
+	otr := newEngine(fixtureRand())
 	smp, _ := otr.generateSMP1()
 	assertDeepEquals(t, smp.msg.g2a, fixtureMessage1v3().g2a)
 	assertDeepEquals(t, smp.msg.g3a, fixtureMessage1v3().g3a)
 }
 
 func Test_computesG2aAndG3aCorrectlyForOtrV2(t *testing.T) {
-	otr := newConversation(otrV2{}, fixtureRand())
+	otr := newV2Engine(fixtureRand())
 	smp, _ := otr.generateSMP1()
 	assertDeepEquals(t, smp.msg.g2a, fixtureMessage1().g2a)
 	assertDeepEquals(t, smp.msg.g3a, fixtureMessage1().g3a)
 }
 
 func Test_computesC2AndD2CorrectlyForOtrV2(t *testing.T) {
-	otr := newConversation(otrV2{}, fixtureRand())
+	otr := newV2Engine(fixtureRand())
 	smp, _ := otr.generateSMP1()
 	assertDeepEquals(t, smp.msg.c2, fixtureMessage1().c2)
 	assertDeepEquals(t, smp.msg.d2, fixtureMessage1().d2)
 }
 
 func Test_computesC3AndD3CorrectlyForOtrV2(t *testing.T) {
-	otr := newConversation(otrV2{}, fixtureRand())
+	otr := newV2Engine(fixtureRand())
 	smp, _ := otr.generateSMP1()
 	assertDeepEquals(t, smp.msg.c3, fixtureMessage1().c3)
 	assertDeepEquals(t, smp.msg.d3, fixtureMessage1().d3)
 }
 
 func Test_thatVerifySMPStartParametersCheckG2AForOtrV3(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 	err := c.verifySMP1(smp1Message{g2a: new(big.Int).SetInt64(1)})
-	assertDeepEquals(t, err, newOtrError("g2a is an invalid group element"))
+	assertDeepEquals(t, err, errors.New("g2a is an invalid group element"))
 }
 
 func Test_thatVerifySMPStartParametersCheckG3AForOtrV3(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 	err := c.verifySMP1(smp1Message{g2a: new(big.Int).SetInt64(3), g3a: p})
-	assertDeepEquals(t, err, newOtrError("g3a is an invalid group element"))
+	assertDeepEquals(t, err, errors.New("g3a is an invalid group element"))
 }
 
 func Test_thatVerifySMPStartParametersDoesntCheckG2AForOtrV2(t *testing.T) {
-	c := newConversation(otrV2{}, fixtureRand())
+	c := newV2Engine(fixtureRand())
 	err := c.verifySMP1(smp1Message{
 		g2a: new(big.Int).SetInt64(1),
 		g3a: new(big.Int).SetInt64(1),
@@ -111,11 +112,11 @@ func Test_thatVerifySMPStartParametersDoesntCheckG2AForOtrV2(t *testing.T) {
 		d2:  new(big.Int).SetInt64(1),
 		d3:  new(big.Int).SetInt64(1),
 	})
-	assertDeepEquals(t, err, newOtrError("c2 is not a valid zero knowledge proof"))
+	assertDeepEquals(t, err, errors.New("c2 is not a valid zero knowledge proof"))
 }
 
 func Test_thatVerifySMPStartParametersDoesntCheckG3AForOtrV2(t *testing.T) {
-	c := newConversation(otrV2{}, fixtureRand())
+	c := newV2Engine(fixtureRand())
 	err := c.verifySMP1(smp1Message{
 		g2a: new(big.Int).SetInt64(3),
 		g3a: new(big.Int).SetInt64(1),
@@ -124,11 +125,11 @@ func Test_thatVerifySMPStartParametersDoesntCheckG3AForOtrV2(t *testing.T) {
 		d2:  new(big.Int).SetInt64(1),
 		d3:  new(big.Int).SetInt64(1),
 	})
-	assertDeepEquals(t, err, newOtrError("c2 is not a valid zero knowledge proof"))
+	assertDeepEquals(t, err, errors.New("c2 is not a valid zero knowledge proof"))
 }
 
 func Test_thatVerifySMPStartParametersChecksThatc2IsAValidZeroKnowledgeProof(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 	err := c.verifySMP1(smp1Message{
 		g2a: new(big.Int).SetInt64(3),
 		g3a: new(big.Int).SetInt64(3),
@@ -137,11 +138,11 @@ func Test_thatVerifySMPStartParametersChecksThatc2IsAValidZeroKnowledgeProof(t *
 		d2:  new(big.Int).SetInt64(3),
 		d3:  new(big.Int).SetInt64(3),
 	})
-	assertDeepEquals(t, err, newOtrError("c2 is not a valid zero knowledge proof"))
+	assertDeepEquals(t, err, errors.New("c2 is not a valid zero knowledge proof"))
 }
 
 func Test_thatVerifySMPStartParametersChecksThatc3IsAValidZeroKnowledgeProof(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 	err := c.verifySMP1(smp1Message{
 		g2a: fixtureMessage1().g2a,
 		g3a: new(big.Int).SetInt64(3),
@@ -150,11 +151,11 @@ func Test_thatVerifySMPStartParametersChecksThatc3IsAValidZeroKnowledgeProof(t *
 		d2:  fixtureMessage1().d2,
 		d3:  new(big.Int).SetInt64(3),
 	})
-	assertDeepEquals(t, err, newOtrError("c3 is not a valid zero knowledge proof"))
+	assertDeepEquals(t, err, errors.New("c3 is not a valid zero knowledge proof"))
 }
 
 func Test_thatVerifySMPStartParametersIsOKWithAValidParameterMessage(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 
 	g2a, _ := new(big.Int).SetString("8a88c345c63aa25dab9815f8c51f6b7b621a12d31c8220a0579381c1e2e85a2275e2407c79c8e6e1f72ae765804e6b4562ac1b2d634313c70d59752ac119c6da5cb95dde3eedd9c48595b37256f5b64c56fb938eb1131447c9af9054b42841c57d1f41fe5aa510e2bd2965434f46dd0473c60d6114da088c7047760b00bc10287a03afc4c4f30e1c7dd7c9dbd51bdbd049eb2b8921cbdc72b4f69309f61e559c2d6dec9c9ce6f38ccb4dfd07f4cf2cf6e76279b88b297848c473e13f091a0f77", 16)
 	g3a, _ := new(big.Int).SetString("d275468351fd48246e406ee74a8dc3db6ee335067bfa63300ce6a23867a1b2beddbdae9a8a36555fd4837f3ef8bad4f7fd5d7b4f346d7c7b7cb64bd7707eeb515902c66aa0c9323931364471ab93dd315f65c6624c956d74680863a9388cd5d89f1b5033b1cf232b8b6dcffaaea195de4e17cc1ba4c99497be18c011b2ad7742b43fa9ee3f95f7b6da02c8e894d054eb178a7822273655dc286ad15874687fe6671908d83662e7a529744ce4ea8dad49290d19dbe6caba202a825a20a27ee98a", 16)
@@ -175,7 +176,7 @@ func Test_thatVerifySMPStartParametersIsOKWithAValidParameterMessage(t *testing.
 }
 
 func Test_thatVerifySMPStartParametersIsOKWithAValidParameterMessageWithProtocolV2(t *testing.T) {
-	c := newConversation(otrV2{}, fixtureRand())
+	c := newV2Engine(fixtureRand())
 
 	g2a, _ := new(big.Int).SetString("8a88c345c63aa25dab9815f8c51f6b7b621a12d31c8220a0579381c1e2e85a2275e2407c79c8e6e1f72ae765804e6b4562ac1b2d634313c70d59752ac119c6da5cb95dde3eedd9c48595b37256f5b64c56fb938eb1131447c9af9054b42841c57d1f41fe5aa510e2bd2965434f46dd0473c60d6114da088c7047760b00bc10287a03afc4c4f30e1c7dd7c9dbd51bdbd049eb2b8921cbdc72b4f69309f61e559c2d6dec9c9ce6f38ccb4dfd07f4cf2cf6e76279b88b297848c473e13f091a0f77", 16)
 	g3a, _ := new(big.Int).SetString("d275468351fd48246e406ee74a8dc3db6ee335067bfa63300ce6a23867a1b2beddbdae9a8a36555fd4837f3ef8bad4f7fd5d7b4f346d7c7b7cb64bd7707eeb515902c66aa0c9323931364471ab93dd315f65c6624c956d74680863a9388cd5d89f1b5033b1cf232b8b6dcffaaea195de4e17cc1ba4c99497be18c011b2ad7742b43fa9ee3f95f7b6da02c8e894d054eb178a7822273655dc286ad15874687fe6671908d83662e7a529744ce4ea8dad49290d19dbe6caba202a825a20a27ee98a", 16)
@@ -0,0 +1,97 @@
+package smp
+
+import (
+	"errors"
+	"math/big"
+)
+
+type smp3State struct {
+	x              *big.Int
+	g3b            *big.Int
+	r4, r5, r6, r7 *big.Int
+	qaqb, papb     *big.Int
+	msg            smp3Message
+}
+
+func (e *Engine) generateSMP3Parameters() (s smp3State, err error) {
+	b := make([]byte, e.parameterLength())
+	var err1, err2, err3, err4 error
+
+	s.r4, err1 = e.randMPI(b)
+	s.r5, err2 = e.randMPI(b)
+	s.r6, err3 = e.randMPI(b)
+	s.r7, err4 = e.randMPI(b)
+
+	return s, firstError(err1, err2, err3, err4)
+}
+
+func generateSMP3Message(s *smp3State, s1 smp1State, m2 smp2Message) smp3Message {
+	var m smp3Message
+
+	g2 := modExp(m2.g2b, s1.a2)
+	g3 := modExp(m2.g3b, s1.a3)
+
+	m.pa = modExp(g3, s.r4)
+	m.qa = mulMod(modExp(g1, s.r4), modExp(g2, s.x), p)
+
+	s.g3b = m2.g3b
+	s.qaqb = divMod(m.qa, m2.qb, p)
+	s.papb = divMod(m.pa, m2.pb, p)
+
+	m.cp = hashMPIsBN(6, modExp(g3, s.r5), mulMod(modExp(g1, s.r5), modExp(g2, s.r6), p))
+	m.d5 = generateDZKP(s.r5, s.r4, m.cp)
+	m.d6 = generateDZKP(s.r6, s.x, m.cp)
+
+	m.ra = modExp(s.qaqb, s1.a3)
+
+	m.cr = hashMPIsBN(7, modExp(g1, s.r7), modExp(s.qaqb, s.r7))
+	m.d7 = subMod(s.r7, mulMod(s1.a3, m.cr, q), q)
+
+	return m
+}
+
+func (e *Engine) generateSMP3(secret *big.Int, s1 smp1State, m2 smp2Message) (s smp3State, err error) {
+	if s, err = e.generateSMP3Parameters(); err != nil {
+		return s, err
+	}
+	s.x = secret
+	s.msg = generateSMP3Message(&s, s1, m2)
+	return
+}
+
+func (e *Engine) verifySMP3(s2 *smp2State, msg smp3Message) error {
+	if !e.isGroupElement(msg.pa) {
+		return errors.New("Pa is an invalid group element")
+	}
+
+	if !e.isGroupElement(msg.qa) {
+		return errors.New("Qa is an invalid group element")
+	}
+
+	if !e.isGroupElement(msg.ra) {
+		return errors.New("Ra is an invalid group element")
+	}
+
+	if !verifyZKP3(msg.cp, s2.g2, s2.g3, msg.d5, msg.d6, msg.pa, msg.qa, 6) {
+		return errors.New("cP is not a valid zero knowledge proof")
+	}
+
+	qaqb := divMod(msg.qa, s2.qb, p)
+
+	if !verifyZKP4(msg.cr, s2.g3a, msg.d7, qaqb, msg.ra, 7) {
+		return errors.New("cR is not a valid zero knowledge proof")
+	}
+
+	return nil
+}
+
+func verifySMP3ProtocolSuccess(s2 *smp2State, msg smp3Message) error {
+	papb := divMod(msg.pa, s2.pb, p)
+
+	rab := modExp(msg.ra, s2.b3)
+	if !eq(rab, papb) {
+		return errors.New("protocol failed: x != y")
+	}
+
+	return nil
+}
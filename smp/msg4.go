@@ -0,0 +1,60 @@
+package smp
+
+import (
+	"errors"
+	"math/big"
+)
+
+type smp4State struct {
+	y   *big.Int
+	r7  *big.Int
+	msg smp4Message
+}
+
+func (e *Engine) generateSMP4(secret *big.Int, s2 smp2State, msg3 smp3Message) (s smp4State, err error) {
+	if s, err = e.generateSMP4Parameters(); err != nil {
+		return s, err
+	}
+	s.y = secret
+	s.msg = generateSMP4Message(s, s2, msg3)
+	return
+}
+
+func (e *Engine) verifySMP4(s3 *smp3State, msg smp4Message) error {
+	if !e.isGroupElement(msg.rb) {
+		return errors.New("Rb is an invalid group element")
+	}
+
+	if !verifyZKP4(msg.cr, s3.g3b, msg.d7, s3.qaqb, msg.rb, 8) {
+		return errors.New("cR is not a valid zero knowledge proof")
+	}
+
+	return nil
+}
+
+func (e *Engine) generateSMP4Parameters() (s smp4State, err error) {
+	b := make([]byte, e.parameterLength())
+	s.r7, err = e.randMPI(b)
+	return
+}
+
+func generateSMP4Message(s smp4State, s2 smp2State, msg3 smp3Message) smp4Message {
+	var m smp4Message
+
+	qaqb := divMod(msg3.qa, s2.qb, p)
+
+	m.rb = modExp(qaqb, s2.b3)
+	m.cr = hashMPIsBN(8, modExp(g1, s.r7), modExp(qaqb, s.r7))
+	m.d7 = subMod(s.r7, mulMod(s2.b3, m.cr, q), q)
+
+	return m
+}
+
+func verifySMP4ProtocolSuccess(s1 *smp1State, s3 *smp3State, msg smp4Message) error {
+	rab := modExp(msg.rb, s1.a3)
+	if !eq(rab, s3.papb) {
+		return errors.New("protocol failed: x != y")
+	}
+
+	return nil
+}
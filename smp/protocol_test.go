@@ -0,0 +1,54 @@
+package smp
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func TestFullSMPHandshake(t *testing.T) {
+	secret := bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	alice := newEngine(rand.Reader)
+	bob := newEngine(rand.Reader)
+
+	// Alice -> Bob
+	// Stores: x, a2, and a3
+	// Sends: g2a, c2, D2, g3a, c3 and D3
+	s1, _ := alice.generateSMP1()
+
+	//Bob
+	err := bob.verifySMP1(s1.msg)
+	assertDeepEquals(t, err, nil)
+
+	// Bob -> Alice
+	// Stores: g3a, g2, g3, b3, Pb and Qb
+	// Sends: g2b, c2, D2, g3b, c3, D3, Pb, Qb, cP, D5 and D6
+	s2, _ := bob.generateSMP2(secret, s1.msg)
+
+	// Alice
+	err = alice.verifySMP2(&s1, s2.msg)
+	assertDeepEquals(t, err, nil)
+
+	// Alice -> Bob
+	// Stores: g3b, (Pa / Pb), (Qa / Qb) and Ra
+	// Sends: Pa, Qa, cP, D5, D6, Ra, cR and D7
+	s3, _ := alice.generateSMP3(secret, s1, s2.msg)
+
+	// Bob
+	err = bob.verifySMP3(&s2, s3.msg)
+	assertDeepEquals(t, err, nil)
+
+	err = verifySMP3ProtocolSuccess(&s2, s3.msg)
+	assertDeepEquals(t, err, nil)
+
+	// Bob -> Alice
+	// Stores: ???
+	// Sends: Rb, cR and D7
+	s4, _ := bob.generateSMP4(secret, s2, s3.msg)
+
+	// Alice
+	err = alice.verifySMP4(&s3, s4.msg)
+	assertDeepEquals(t, err, nil)
+
+	err = verifySMP4ProtocolSuccess(&s1, &s3, s4.msg)
+	assertDeepEquals(t, err, nil)
+}
@@ -0,0 +1,252 @@
+// Package smp implements the Socialist Millionaires' Protocol as specified by OTR version 2 and 3.
+// It lets two peers find out whether they share a secret without revealing anything else about it.
+//
+// The Engine doesn't know anything about OTR conversations. It consumes and produces opaque
+// messages, so it can be used over any channel that both peers trust to be confidential, for example
+// to pair two devices over a QR code. An OTR conversation uses it by carrying the messages as TLVs.
+package smp
+
+import (
+	"crypto/rand"
+	"io"
+	"math/big"
+
+	"github.com/twstrike/otr3/internal/securemem"
+)
+
+const defaultExponentSize = 192
+
+// Engine runs one side of the Socialist Millionaires' Protocol. The zero value is ready to use.
+// An Engine is not safe for concurrent use.
+type Engine struct {
+	// Rand is the source of randomness used for the exponents. If it is nil, crypto/rand.Reader is used
+	Rand io.Reader
+	// ExponentSize is the size in bytes of the random exponents. If it is zero, 192 bytes is used, as OTR version 3 does
+	ExponentSize int
+	// SkipGroupElementChecks disables the checks that received values are valid group elements, since OTR version 2 doesn't do them
+	SkipGroupElementChecks bool
+
+	state    smpState
+	question *string
+	secret   *big.Int
+	// secretMemory is the locked memory that holds secret
+	secretMemory *securemem.Buffer
+	s1           *smp1State
+	s2           *smp2State
+	s3           *smp3State
+	event        Event
+}
+
+// Inputs are the values, apart from the secret, that both peers bind into the authentication.
+// Each peer gives its own view of them, so OurFingerprint for one peer is TheirFingerprint for the other.
+type Inputs struct {
+	OurFingerprint   []byte
+	TheirFingerprint []byte
+	SessionID        []byte
+}
+
+// Status describes which step of the protocol an Engine is waiting for
+type Status int
+
+const (
+	// StatusExpect1 means that no authentication is in progress
+	StatusExpect1 Status = iota
+	// StatusWaitingForSecret means that the peer started an authentication and the secret hasn't been provided yet
+	StatusWaitingForSecret
+	// StatusExpect2 means that we started an authentication and are waiting for the peer to reply
+	StatusExpect2
+	// StatusExpect3 means that we provided our secret and are waiting for the peer to continue the authentication
+	StatusExpect3
+	// StatusExpect4 means that we are waiting for the last message of the authentication
+	StatusExpect4
+)
+
+// String returns the string representation of the Status
+func (s Status) String() string {
+	switch s {
+	case StatusExpect1:
+		return "StatusExpect1"
+	case StatusWaitingForSecret:
+		return "StatusWaitingForSecret"
+	case StatusExpect2:
+		return "StatusExpect2"
+	case StatusExpect3:
+		return "StatusExpect3"
+	case StatusExpect4:
+		return "StatusExpect4"
+	default:
+		return "SMP STATUS: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
+
+// Start begins a new authentication with an optional question and returns the messages to send to the peer.
+// If an authentication is already in progress, an abort message for it comes first.
+func (e *Engine) Start(in Inputs, question string, secret []byte) ([][]byte, error) {
+	var toSend [][]byte
+	if e.InProgress() {
+		toSend = append(toSend, smpMessageAbort{}.serialize())
+	}
+
+	s1, err := e.generateSMP1()
+	if err != nil {
+		return nil, err
+	}
+
+	if question != "" {
+		s1.msg.hasQuestion = true
+		s1.msg.question = question
+	}
+
+	e.wipeSecrets()
+	e.setSecret(generateSecret(in.OurFingerprint, in.TheirFingerprint, in.SessionID, secret))
+	e.s1 = &s1
+	e.state = smpStateExpect2{}
+
+	return append(toSend, s1.msg.serialize()), nil
+}
+
+// ProvideSecret continues an authentication started by the peer, and returns the message to send to the peer.
+// It is only valid to call it when Status is StatusWaitingForSecret.
+func (e *Engine) ProvideSecret(in Inputs, secret []byte) ([]byte, Event, error) {
+	e.event = EventNone
+
+	var ret message
+	var err error
+	e.state, ret, err = e.currentState().continueMessage1(e, in, secret)
+	if err != nil {
+		return nil, EventNone, err
+	}
+
+	return ret.serialize(), e.event, nil
+}
+
+// Receive processes a message from the peer. It returns the message to send back, if any, and
+// the event that the message caused.
+func (e *Engine) Receive(msg []byte) ([]byte, Event, error) {
+	m, ok := parseMessage(msg)
+	if !ok {
+		return nil, EventNone, ErrCorruptMessage
+	}
+
+	e.event = EventNone
+	ret, err := m.receivedMessage(e)
+	if !e.InProgress() {
+		// The authentication is over, whatever its result, so the secret isn't needed anymore
+		e.wipeSecrets()
+	}
+	if err != nil {
+		return nil, EventNone, err
+	}
+
+	if ret == nil {
+		return nil, e.event, nil
+	}
+
+	return ret.serialize(), e.event, nil
+}
+
+// Abort cancels the authentication in progress, and returns the message that lets the peer know about it.
+// If no authentication is in progress, nothing is returned.
+func (e *Engine) Abort() []byte {
+	if !e.InProgress() {
+		return nil
+	}
+
+	e.Wipe()
+	return smpMessageAbort{}.serialize()
+}
+
+// Status returns the step the Engine is waiting for
+func (e *Engine) Status() Status {
+	return e.currentState().status()
+}
+
+// InProgress returns true if an authentication has been started and hasn't finished yet
+func (e *Engine) InProgress() bool {
+	return e.Status() != StatusExpect1
+}
+
+// Question returns the question the peer asked, and ok if there is one
+func (e *Engine) Question() (string, bool) {
+	if e.question == nil {
+		return "", false
+	}
+	return *e.question, true
+}
+
+// Clone returns a copy of the Engine that can be used and wiped independently of e.
+// The copy shares the values that never change once computed, so it is cheap to make.
+func (e *Engine) Clone() Engine {
+	c := *e
+	if e.secret != nil {
+		c.secret, c.secretMemory = securemem.CopyInt(e.secret)
+		c.secretMemory.ReleaseWhenUnreachable()
+	}
+	return c
+}
+
+// Wipe forgets all secret values and restarts the Engine
+func (e *Engine) Wipe() {
+	e.state = nil
+	e.question = nil
+	e.wipeSecrets()
+}
+
+// Release wipes an Engine that is not going to be used anymore, like one replaced by a Clone, and gives the locked
+// memory of its secret back to the operating system right away. An Engine that is dropped without being released or
+// wiped has that memory freed by the garbage collector once it is unreachable, but only at some later collection, so
+// every Engine that holds a secret, including the ones returned by Clone, should be released or wiped.
+func (e *Engine) Release() {
+	e.Wipe()
+	*e = Engine{}
+}
+
+// setSecret keeps the secret in locked memory, and wipes the copy that was on the heap
+func (e *Engine) setSecret(secret *big.Int) {
+	e.secret, e.secretMemory = securemem.CopyInt(secret)
+	e.secretMemory.ReleaseWhenUnreachable()
+	wipeBigInt(secret)
+}
+
+func (e *Engine) wipeSecrets() {
+	wipeBigInt(e.secret)
+	e.secret = nil
+	e.secretMemory.Release()
+	e.secretMemory = nil
+	e.s1 = nil
+	e.s2 = nil
+	e.s3 = nil
+}
+
+func (e *Engine) currentState() smpState {
+	if e.state == nil {
+		return smpStateExpect1{}
+	}
+	return e.state
+}
+
+func (e *Engine) notify(ev Event) {
+	e.event = ev
+}
+
+func (e *Engine) rand() io.Reader {
+	if e.Rand != nil {
+		return e.Rand
+	}
+	return rand.Reader
+}
+
+func (e *Engine) randMPI(b []byte) (*big.Int, error) {
+	return randMPI(e.rand(), b)
+}
+
+func (e *Engine) parameterLength() int {
+	if e.ExponentSize != 0 {
+		return e.ExponentSize
+	}
+	return defaultExponentSize
+}
+
+func (e *Engine) isGroupElement(n *big.Int) bool {
+	return e.SkipGroupElementChecks || isGroupElement(n)
+}
@@ -0,0 +1,298 @@
+package smp
+
+import (
+	"crypto/rand"
+	"testing"
+	"unsafe"
+)
+
+func Test_Engine_Start_returnsTheFirstMessage(t *testing.T) {
+	e := newV2Engine(fixtureRand())
+
+	toSend, err := e.Start(fixtureInputs(), "", []byte("hello"))
+
+	assertNil(t, err)
+	assertDeepEquals(t, toSend, [][]byte{fixtureMessage1().serialize()})
+	assertEquals(t, e.Status(), StatusExpect2)
+}
+
+func Test_Engine_Start_includesTheQuestion(t *testing.T) {
+	e := newV2Engine(fixtureRand())
+
+	toSend, _ := e.Start(fixtureInputs(), "What's the clue?", []byte("hello"))
+
+	assertDeepEquals(t, toSend, [][]byte{fixtureMessage1Q().serialize()})
+}
+
+func Test_Engine_Start_abortsTheAuthenticationInProgress(t *testing.T) {
+	e := newEngine(fixtureRand())
+	e.state = smpStateExpect3{}
+
+	toSend, err := e.Start(fixtureInputs(), "", []byte("hello"))
+
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 2)
+	assertDeepEquals(t, toSend[0], smpMessageAbort{}.serialize())
+	assertEquals(t, e.Status(), StatusExpect2)
+}
+
+func Test_Engine_Start_returnsAnErrorAndKeepsTheStateIfThereIsNotEnoughRandomness(t *testing.T) {
+	e := newEngine(fixedRand([]string{"ABCD"}))
+	e.state = smpStateExpect3{}
+
+	toSend, err := e.Start(fixtureInputs(), "", []byte("hello"))
+
+	assertNil(t, toSend)
+	assertEquals(t, err, ErrShortRandomRead)
+	assertEquals(t, e.Status(), StatusExpect3)
+}
+
+func Test_Engine_Start_usesOurFingerprintAsTheInitiator(t *testing.T) {
+	in := fixtureInputs()
+	e := newEngine(rand.Reader)
+
+	e.Start(in, "", []byte("hello"))
+
+	assertDeepEquals(t, e.secret, generateSecret(in.OurFingerprint, in.TheirFingerprint, in.SessionID, []byte("hello")))
+}
+
+func Test_Engine_ProvideSecret_usesTheirFingerprintAsTheInitiator(t *testing.T) {
+	in := fixtureInputs()
+	e := newV2Engine(fixtureRand())
+	e.Receive(fixtureMessage1().serialize())
+
+	_, ev, err := e.ProvideSecret(in, []byte("hello"))
+
+	assertNil(t, err)
+	assertEquals(t, ev, EventNone)
+	assertEquals(t, e.Status(), StatusExpect3)
+	assertDeepEquals(t, e.secret, generateSecret(in.TheirFingerprint, in.OurFingerprint, in.SessionID, []byte("hello")))
+}
+
+func Test_Engine_ProvideSecret_returnsAnErrorIfNotWaitingForASecret(t *testing.T) {
+	e := newEngine(fixtureRand())
+	e.state = smpStateExpect2{}
+
+	msg, _, err := e.ProvideSecret(fixtureInputs(), []byte("hello"))
+
+	assertNil(t, msg)
+	assertEquals(t, err, ErrNotWaitingForSecret)
+	assertEquals(t, e.Status(), StatusExpect1)
+}
+
+func Test_Engine_ProvideSecret_signalsCheatingIfTheMessageCantBeGenerated(t *testing.T) {
+	e := newEngine(fixedRand([]string{"ABCD"}))
+	e.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
+
+	msg, ev, err := e.ProvideSecret(fixtureInputs(), []byte("hello"))
+
+	assertNil(t, err)
+	assertEquals(t, ev, EventCheated)
+	assertDeepEquals(t, msg, smpMessageAbort{}.serialize())
+}
+
+func Test_Engine_Receive_returnsAnErrorForACorruptMessage(t *testing.T) {
+	e := newEngine(fixtureRand())
+
+	msg, ev, err := e.Receive([]byte{0x00, 0x02, 0x00})
+
+	assertNil(t, msg)
+	assertEquals(t, ev, EventNone)
+	assertEquals(t, err, ErrCorruptMessage)
+}
+
+func Test_Engine_Receive_returnsTheEventCausedByTheMessage(t *testing.T) {
+	e := newEngine(fixtureRand())
+
+	msg, ev, err := e.Receive(fixtureMessage1Q().serialize())
+
+	assertNil(t, msg)
+	assertNil(t, err)
+	assertEquals(t, ev, EventAskForAnswer)
+	assertEquals(t, e.Status(), StatusWaitingForSecret)
+}
+
+func Test_Engine_Receive_sendsTheLastMessageAndSignalsAFailureToBothPeersWhenTheSecretsDontMatch(t *testing.T) {
+	alice, bob := &Engine{Rand: rand.Reader}, &Engine{Rand: rand.Reader}
+
+	toSend, _ := alice.Start(fixtureInputs(), "", []byte("tom"))
+	bob.Receive(toSend[0])
+	msg, _, _ := bob.ProvideSecret(fixtureInputs(), []byte("jerry"))
+	msg, _, _ = alice.Receive(msg)
+	msg, bobEvent, err := bob.Receive(msg)
+
+	assertNil(t, err)
+	assertEquals(t, bobEvent, EventFailure)
+	last, ok := parseMessage(msg)
+	_, isSMP4 := last.(smp4Message)
+	assertEquals(t, ok && isSMP4, true)
+
+	msg, aliceEvent, err := alice.Receive(msg)
+
+	assertNil(t, err)
+	assertNil(t, msg)
+	assertEquals(t, aliceEvent, EventFailure)
+	assertEquals(t, alice.Status(), StatusExpect1)
+	assertEquals(t, bob.Status(), StatusExpect1)
+}
+
+func Test_Engine_Abort_returnsNothingIfNoAuthenticationIsInProgress(t *testing.T) {
+	e := newEngine(fixtureRand())
+
+	assertNil(t, e.Abort())
+}
+
+func Test_Engine_Abort_restartsAndReturnsAnAbortMessage(t *testing.T) {
+	e := newEngine(fixtureRand())
+	e.state = smpStateExpect4{}
+	e.secret = bnFromHex("ABCDEF")
+	e.s1 = fixtureSmp1()
+
+	assertDeepEquals(t, e.Abort(), smpMessageAbort{}.serialize())
+	assertEquals(t, e.Status(), StatusExpect1)
+	assertNil(t, e.secret)
+	assertNil(t, e.s1)
+}
+
+func Test_Engine_Wipe_forgetsEverything(t *testing.T) {
+	e := newEngine(fixtureRand())
+	q := "Are all greeks liars?"
+	e.state = smpStateExpect2{}
+	e.question = &q
+	e.secret = bnFromHex("ABCDEF")
+	e.s1 = fixtureSmp1()
+	e.s2 = fixtureSmp2()
+	e.s3 = fixtureSmp3()
+
+	e.Wipe()
+
+	assertNil(t, e.state)
+	assertNil(t, e.question)
+	assertNil(t, e.secret)
+	assertNil(t, e.s1)
+	assertNil(t, e.s2)
+	assertNil(t, e.s3)
+	assertNotNil(t, e.Rand)
+}
+
+func Test_Engine_Clone_canBeWipedWithoutAffectingTheOriginal(t *testing.T) {
+	e := newEngine(fixtureRand())
+	e.state = smpStateExpect2{}
+	e.secret = bnFromHex("ABCDEF")
+	e.s1 = fixtureSmp1()
+
+	c := e.Clone()
+	assertEquals(t, c.Status(), StatusExpect2)
+	assertDeepEquals(t, c.secret, e.secret)
+
+	c.Wipe()
+
+	assertEquals(t, e.Status(), StatusExpect2)
+	assertDeepEquals(t, e.secret, bnFromHex("ABCDEF"))
+	assertNotNil(t, e.s1)
+}
+
+func Test_Engine_Clone_keepsItsOwnSecretInLockedMemory(t *testing.T) {
+	e := newEngine(fixtureRand())
+	e.setSecret(bnFromHex("ABCDEF"))
+
+	c := e.Clone()
+
+	assertNotNil(t, c.secretMemory)
+	if c.secretMemory == e.secretMemory {
+		t.Error("expected the clone to have its own memory")
+	}
+}
+
+func Test_Engine_setSecret_keepsTheSecretInLockedMemory(t *testing.T) {
+	e := newEngine(fixtureRand())
+	secret := bnFromHex("ABCDEF")
+
+	e.setSecret(secret)
+
+	assertDeepEquals(t, e.secret, bnFromHex("ABCDEF"))
+	assertEquals(t, uintptr(unsafe.Pointer(&e.secret.Bits()[0])), uintptr(e.secretMemory.Pointer()))
+	assertEquals(t, secret.Sign(), 0)
+}
+
+func Test_Engine_Wipe_releasesTheSecret(t *testing.T) {
+	e := newEngine(fixtureRand())
+	e.setSecret(bnFromHex("ABCDEF"))
+	mem := e.secretMemory
+
+	e.Wipe()
+
+	assertNil(t, e.secretMemory)
+	assertNil(t, mem.Bytes())
+}
+
+func Test_Engine_Release_releasesTheSecretOfAClone(t *testing.T) {
+	e := newEngine(fixtureRand())
+	e.setSecret(bnFromHex("ABCDEF"))
+	c := e.Clone()
+	mem := c.secretMemory
+
+	c.Release()
+
+	assertNil(t, mem.Bytes())
+	assertNil(t, c.secret)
+	assertDeepEquals(t, e.secret, bnFromHex("ABCDEF"))
+}
+
+func Test_Engine_Receive_releasesTheSecretWhenTheAuthenticationIsOver(t *testing.T) {
+	e := newEngine(fixtureRand())
+	e.state = smpStateExpect3{}
+	e.setSecret(bnFromHex("ABCDEF"))
+	mem := e.secretMemory
+
+	e.Receive(smpMessageAbort{}.serialize())
+
+	assertNil(t, e.secret)
+	assertNil(t, mem.Bytes())
+}
+
+func Test_Engine_Question_returnsNotOKIfThereIsNoQuestion(t *testing.T) {
+	_, ok := newEngine(fixtureRand()).Question()
+	assertEquals(t, ok, false)
+}
+
+func Test_Engine_Status_returnsTheStepOfTheCurrentState(t *testing.T) {
+	e := &Engine{}
+	assertEquals(t, e.Status(), StatusExpect1)
+	assertEquals(t, e.InProgress(), false)
+
+	e.state = smpStateWaitingForSecret{}
+	assertEquals(t, e.Status(), StatusWaitingForSecret)
+	assertEquals(t, e.InProgress(), true)
+
+	e.state = smpStateExpect2{}
+	assertEquals(t, e.Status(), StatusExpect2)
+
+	e.state = smpStateExpect3{}
+	assertEquals(t, e.Status(), StatusExpect3)
+
+	e.state = smpStateExpect4{}
+	assertEquals(t, e.Status(), StatusExpect4)
+}
+
+func Test_Status_hasStringRepresentation(t *testing.T) {
+	assertEquals(t, StatusExpect1.String(), "StatusExpect1")
+	assertEquals(t, StatusWaitingForSecret.String(), "StatusWaitingForSecret")
+	assertEquals(t, StatusExpect2.String(), "StatusExpect2")
+	assertEquals(t, StatusExpect3.String(), "StatusExpect3")
+	assertEquals(t, StatusExpect4.String(), "StatusExpect4")
+	assertEquals(t, Status(99).String(), "SMP STATUS: (THIS SHOULD NEVER HAPPEN)")
+}
+
+func Test_Engine_usesDefaultsForOTRVersion3(t *testing.T) {
+	e := &Engine{}
+	assertEquals(t, e.parameterLength(), 192)
+	assertEquals(t, e.rand(), rand.Reader)
+	assertEquals(t, e.isGroupElement(g1), true)
+	assertEquals(t, e.isGroupElement(p), false)
+}
+
+func Test_Engine_canSkipTheGroupElementChecks(t *testing.T) {
+	e := &Engine{SkipGroupElementChecks: true}
+	assertEquals(t, e.isGroupElement(p), true)
+}
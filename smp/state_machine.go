@@ -0,0 +1,180 @@
+package smp
+
+type smpStateBase struct{}
+type smpStateExpect1 struct{ smpStateBase }
+type smpStateExpect2 struct{ smpStateBase }
+type smpStateExpect3 struct{ smpStateBase }
+type smpStateExpect4 struct{ smpStateBase }
+type smpStateWaitingForSecret struct {
+	smpStateBase
+	msg smp1Message
+}
+
+type smpState interface {
+	receiveMessage1(*Engine, smp1Message) (smpState, message, error)
+	continueMessage1(*Engine, Inputs, []byte) (smpState, message, error)
+	receiveMessage2(*Engine, smp2Message) (smpState, message, error)
+	receiveMessage3(*Engine, smp3Message) (smpState, message, error)
+	receiveMessage4(*Engine, smp4Message) (smpState, message, error)
+	status() Status
+}
+
+func abortState(e error) (smpState, message, error) {
+	return smpStateExpect1{}, smpMessageAbort{}, e
+}
+
+func sendSMPAbortAndRestartStateMachine() (smpState, message, error) {
+	//must return nil error otherwise the abort message will be ignored
+	return abortState(nil)
+}
+
+func (e *Engine) abortStateMachineAndNotifyCheated() (smpState, message, error) {
+	e.notify(EventCheated)
+	return sendSMPAbortAndRestartStateMachine()
+}
+
+func (e *Engine) abortStateMachineAndNotifyError() (smpState, message, error) {
+	e.notify(EventError)
+	return sendSMPAbortAndRestartStateMachine()
+}
+
+func (smpStateBase) receiveMessage1(e *Engine, m smp1Message) (smpState, message, error) {
+	return e.abortStateMachineAndNotifyError()
+}
+
+func (smpStateBase) continueMessage1(e *Engine, in Inputs, mutualSecret []byte) (smpState, message, error) {
+	return abortState(ErrNotWaitingForSecret)
+}
+
+func (smpStateBase) receiveMessage2(e *Engine, m smp2Message) (smpState, message, error) {
+	return e.abortStateMachineAndNotifyError()
+}
+
+func (smpStateBase) receiveMessage3(e *Engine, m smp3Message) (smpState, message, error) {
+	return e.abortStateMachineAndNotifyError()
+}
+
+func (smpStateBase) receiveMessage4(e *Engine, m smp4Message) (smpState, message, error) {
+	return e.abortStateMachineAndNotifyError()
+}
+
+func (smpStateExpect1) receiveMessage1(e *Engine, m smp1Message) (smpState, message, error) {
+	err := e.verifySMP1(m)
+	if err != nil {
+		return e.abortStateMachineAndNotifyCheated()
+	}
+
+	if m.hasQuestion {
+		e.question = &m.question
+		e.notify(EventAskForAnswer)
+	} else {
+		e.notify(EventAskForSecret)
+	}
+
+	return smpStateWaitingForSecret{msg: m}, nil, nil
+}
+
+func (s smpStateWaitingForSecret) continueMessage1(e *Engine, in Inputs, mutualSecret []byte) (smpState, message, error) {
+	e.setSecret(generateSecret(in.TheirFingerprint, in.OurFingerprint, in.SessionID, mutualSecret))
+	s2, err := e.generateSMP2(e.secret, s.msg)
+	if err != nil {
+		return e.abortStateMachineAndNotifyCheated()
+	}
+
+	e.s2 = &s2
+
+	return smpStateExpect3{}, s2.msg, nil
+}
+
+func (smpStateExpect2) receiveMessage2(e *Engine, m smp2Message) (smpState, message, error) {
+	err := e.verifySMP2(e.s1, m)
+	if err != nil {
+		return e.abortStateMachineAndNotifyCheated()
+	}
+
+	s3, err := e.generateSMP3(e.secret, *e.s1, m)
+	if err != nil {
+		return e.abortStateMachineAndNotifyCheated()
+	}
+
+	e.notify(EventInProgress)
+
+	e.s3 = &s3
+
+	return smpStateExpect4{}, s3.msg, nil
+}
+
+func (smpStateExpect3) receiveMessage3(e *Engine, m smp3Message) (smpState, message, error) {
+	err := e.verifySMP3(e.s2, m)
+	if err != nil {
+		return e.abortStateMachineAndNotifyCheated()
+	}
+
+	ret, err := e.generateSMP4(e.secret, *e.s2, m)
+	if err != nil {
+		return e.abortStateMachineAndNotifyCheated()
+	}
+
+	//As per spec, the last message is sent whether the secrets match or not,
+	//so the peer can find out too
+	if verifySMP3ProtocolSuccess(e.s2, m) != nil {
+		e.notify(EventFailure)
+	} else {
+		e.notify(EventSuccess)
+	}
+
+	return smpStateExpect1{}, ret.msg, nil
+}
+
+func (smpStateExpect4) receiveMessage4(e *Engine, m smp4Message) (smpState, message, error) {
+	err := e.verifySMP4(e.s3, m)
+	if err != nil {
+		return e.abortStateMachineAndNotifyCheated()
+	}
+
+	if verifySMP4ProtocolSuccess(e.s1, e.s3, m) != nil {
+		e.notify(EventFailure)
+	} else {
+		e.notify(EventSuccess)
+	}
+
+	return smpStateExpect1{}, nil, nil
+}
+
+func (m smp1Message) receivedMessage(e *Engine) (ret message, err error) {
+	e.state, ret, err = e.currentState().receiveMessage1(e, m)
+	return
+}
+
+func (m smp2Message) receivedMessage(e *Engine) (ret message, err error) {
+	e.state, ret, err = e.currentState().receiveMessage2(e, m)
+	return
+}
+
+func (m smp3Message) receivedMessage(e *Engine) (ret message, err error) {
+	e.state, ret, err = e.currentState().receiveMessage3(e, m)
+	return
+}
+
+func (m smp4Message) receivedMessage(e *Engine) (ret message, err error) {
+	e.state, ret, err = e.currentState().receiveMessage4(e, m)
+	return
+}
+
+func (m smpMessageAbort) receivedMessage(e *Engine) (ret message, err error) {
+	e.state = smpStateExpect1{}
+	e.notify(EventAbort)
+	return
+}
+
+func (smpStateExpect1) String() string          { return "SMPSTATE_EXPECT1" }
+func (smpStateExpect2) String() string          { return "SMPSTATE_EXPECT2" }
+func (smpStateExpect3) String() string          { return "SMPSTATE_EXPECT3" }
+func (smpStateExpect4) String() string          { return "SMPSTATE_EXPECT4" }
+func (smpStateWaitingForSecret) String() string { return "SMPSTATE_WAITINGFORSECRET (internal)" }
+
+func (smpStateExpect1) status() Status          { return StatusExpect1 }
+func (smpStateExpect2) status() Status          { return StatusExpect2 }
+func (smpStateExpect3) status() Status          { return StatusExpect3 }
+func (smpStateExpect4) status() Status          { return StatusExpect4 }
+func (smpStateWaitingForSecret) status() Status { return StatusWaitingForSecret }
@@ -1,4 +1,4 @@
-package otr3
+package smp
 
 import (
 	"math/big"
@@ -6,7 +6,7 @@ import (
 )
 
 func Test_smpStateExpect1_goToWaitingForSecretWhenReceivesSmpMessage1(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 	msg := fixtureMessage1()
 	nextState, _, _ := smpStateExpect1{}.receiveMessage1(c, msg)
 
@@ -14,46 +14,45 @@ func Test_smpStateExpect1_goToWaitingForSecretWhenReceivesSmpMessage1(t *testing
 }
 
 func Test_smpStateExpect1_willSendANotificationThatASecretIsNeeded(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.expectSMPEvent(t, func() {
+	c := newEngine(fixtureRand())
+	c.expectEvent(t, func() {
 		smpStateExpect1{}.receiveMessage1(c, fixtureMessage1())
-	}, SMPEventAskForSecret, 25, "")
+	}, EventAskForSecret)
 }
 
 func Test_smpStateExpect1_willSendANotificationThatAnAnswerIsNeededIfQuestionProvided(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 	msg := fixtureMessage1()
 	msg.hasQuestion = true
 	msg.question = "What do you think?"
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		smpStateExpect1{}.receiveMessage1(c, msg)
-	}, SMPEventAskForAnswer, 25, "What do you think?")
+	}, EventAskForAnswer)
+
+	question, _ := c.Question()
+	assertEquals(t, question, "What do you think?")
 }
 
 func Test_smpStateWaitingForSecret_goToExpectState3WhenReceivesContinueSmpMessage1(t *testing.T) {
-	c := bobContextAfterAKE()
-	c.msgState = encrypted
-	c.ssid = [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
-	c.ourKey = bobPrivateKey
-	c.theirKey = &alicePrivateKey.PublicKey
-	c.smp.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
+	c := newEngine(fixtureRand())
+	c.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
 
 	msg := fixtureMessage1()
-	nextState, _, err := smpStateWaitingForSecret{msg: msg}.continueMessage1(c, []byte{})
+	nextState, _, err := smpStateWaitingForSecret{msg: msg}.continueMessage1(c, fixtureInputs(), []byte{})
 
 	assertNil(t, err)
-	assertNotNil(t, c.smp.s2)
+	assertNotNil(t, c.s2)
 	assertEquals(t, nextState, smpStateExpect3{})
 }
 
 func Test_smpStateExpect1_receiveMessage1_setsTheSMPQuestionIfThereWasOneInTheMessage(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c := newEngine(fixtureRand())
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 	msg := fixtureMessage1Q()
 
 	smpStateExpect1{}.receiveMessage1(c, msg)
-	v, ok := c.SMPQuestion()
+	v, ok := c.Question()
 
 	assertDeepEquals(t, ok, true)
 	assertDeepEquals(t, v, "What's the clue?")
@@ -61,7 +60,7 @@ func Test_smpStateExpect1_receiveMessage1_setsTheSMPQuestionIfThereWasOneInTheMe
 
 func Test_smpStateExpect1_returnsSmpMessageAbortIfReceivesUnexpectedMessage(t *testing.T) {
 	state := smpStateExpect1{}
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 	_, msg, err := state.receiveMessage2(c, smp2Message{})
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, msg, smpMessageAbort{})
@@ -77,98 +76,98 @@ func Test_smpStateExpect1_returnsSmpMessageAbortIfReceivesUnexpectedMessage(t *t
 
 func Test_smpStateExpect1_givesAnErrorNotificationIfTheWrongMessageIsSent(t *testing.T) {
 	state := smpStateExpect1{}
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		state.receiveMessage2(c, smp2Message{})
-	}, SMPEventError, 0, "")
+	}, EventError)
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		state.receiveMessage3(c, smp3Message{})
-	}, SMPEventError, 0, "")
+	}, EventError)
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		state.receiveMessage4(c, smp4Message{})
-	}, SMPEventError, 0, "")
+	}, EventError)
 }
 
 func Test_smpStateExpect2_givesAnErrorNotificationIfTheWrongMessageIsSent(t *testing.T) {
 	state := smpStateExpect2{}
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		state.receiveMessage1(c, smp1Message{})
-	}, SMPEventError, 0, "")
+	}, EventError)
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		state.receiveMessage3(c, smp3Message{})
-	}, SMPEventError, 0, "")
+	}, EventError)
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		state.receiveMessage4(c, smp4Message{})
-	}, SMPEventError, 0, "")
+	}, EventError)
 }
 
 func Test_smpStateExpect3_givesAnErrorNotificationIfTheWrongMessageIsSent(t *testing.T) {
 	state := smpStateExpect3{}
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		state.receiveMessage1(c, smp1Message{})
-	}, SMPEventError, 0, "")
+	}, EventError)
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		state.receiveMessage2(c, smp2Message{})
-	}, SMPEventError, 0, "")
+	}, EventError)
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		state.receiveMessage4(c, smp4Message{})
-	}, SMPEventError, 0, "")
+	}, EventError)
 }
 
 func Test_smpStateExpect4_givesAnErrorNotificationIfTheWrongMessageIsSent(t *testing.T) {
 	state := smpStateExpect4{}
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		state.receiveMessage1(c, smp1Message{})
-	}, SMPEventError, 0, "")
+	}, EventError)
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		state.receiveMessage2(c, smp2Message{})
-	}, SMPEventError, 0, "")
+	}, EventError)
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		state.receiveMessage3(c, smp3Message{})
-	}, SMPEventError, 0, "")
+	}, EventError)
 }
 
 func Test_smpStateExpect2_goToExpectState4WhenReceivesSmpMessage2(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
-	c.smp.s1 = fixtureSmp1()
+	c := newEngine(fixtureRand())
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c.s1 = fixtureSmp1()
 
 	msg := fixtureMessage2()
 	nextState, _, err := smpStateExpect2{}.receiveMessage2(c, msg)
 
 	assertNil(t, err)
-	assertNotNil(t, c.smp.s3)
+	assertNotNil(t, c.s3)
 	assertEquals(t, nextState, smpStateExpect4{})
 }
 
 func Test_smpStateExpect2_sendsAnSMPEventAboutSMPProgressHere(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
-	c.smp.s1 = fixtureSmp1()
+	c := newEngine(fixtureRand())
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c.s1 = fixtureSmp1()
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		smpStateExpect2{}.receiveMessage2(c, fixtureMessage2())
-	}, SMPEventInProgress, 60, "")
+	}, EventInProgress)
 }
 
 func Test_smpStateExpect2_returnsSmpMessageAbortIfReceivesUnexpectedMessage(t *testing.T) {
 	state := smpStateExpect2{}
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 	_, msg, err := state.receiveMessage1(c, smp1Message{})
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, msg, smpMessageAbort{})
@@ -183,9 +182,9 @@ func Test_smpStateExpect2_returnsSmpMessageAbortIfReceivesUnexpectedMessage(t *t
 }
 
 func Test_smpStateExpect3_goToExpectState1WhenReceivesSmpMessage3(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
-	c.smp.s2 = fixtureSmp2()
+	c := newEngine(fixtureRand())
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c.s2 = fixtureSmp2()
 	msg := fixtureMessage3()
 
 	nextState, _, _ := smpStateExpect3{}.receiveMessage3(c, msg)
@@ -194,18 +193,18 @@ func Test_smpStateExpect3_goToExpectState1WhenReceivesSmpMessage3(t *testing.T)
 }
 
 func Test_smpStateExpect3_willSendAnSMPNotificationOnProtocolSuccess(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
-	c.smp.s2 = fixtureSmp2()
+	c := newEngine(fixtureRand())
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c.s2 = fixtureSmp2()
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		smpStateExpect3{}.receiveMessage3(c, fixtureMessage3())
-	}, SMPEventSuccess, 100, "")
+	}, EventSuccess)
 }
 
 func Test_smpStateExpect3_returnsSmpMessageAbortIfReceivesUnexpectedMessage(t *testing.T) {
 	state := smpStateExpect3{}
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 	_, msg, err := state.receiveMessage1(c, smp1Message{})
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, msg, smpMessageAbort{})
@@ -220,9 +219,9 @@ func Test_smpStateExpect3_returnsSmpMessageAbortIfReceivesUnexpectedMessage(t *t
 }
 
 func Test_smpStateExpect4_goToExpectState1WhenReceivesSmpMessage4(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.s1 = fixtureSmp1()
-	c.smp.s3 = fixtureSmp3()
+	c := newEngine(fixtureRand())
+	c.s1 = fixtureSmp1()
+	c.s3 = fixtureSmp3()
 	msg := fixtureMessage4()
 
 	nextState, _, _ := smpStateExpect4{}.receiveMessage4(c, msg)
@@ -231,18 +230,18 @@ func Test_smpStateExpect4_goToExpectState1WhenReceivesSmpMessage4(t *testing.T)
 }
 
 func Test_smpStateExpect4_willSendAnSMPNotificationOnProtocolSuccess(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.s1 = fixtureSmp1()
-	c.smp.s3 = fixtureSmp3()
+	c := newEngine(fixtureRand())
+	c.s1 = fixtureSmp1()
+	c.s3 = fixtureSmp3()
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		smpStateExpect4{}.receiveMessage4(c, fixtureMessage4())
-	}, SMPEventSuccess, 100, "")
+	}, EventSuccess)
 }
 
 func Test_smpStateExpect4_returnsSmpMessageAbortIfReceivesUnexpectedMessage(t *testing.T) {
 	state := smpStateExpect4{}
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 	_, msg, err := state.receiveMessage1(c, smp1Message{})
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, msg, smpMessageAbort{})
@@ -256,62 +255,62 @@ func Test_smpStateExpect4_returnsSmpMessageAbortIfReceivesUnexpectedMessage(t *t
 	assertDeepEquals(t, msg, smpMessageAbort{})
 }
 
-func Test_contextTransitionsFromSmpExpect1ToSmpWaitingForSecret(t *testing.T) {
+func Test_engineTransitionsFromSmpExpect1ToSmpWaitingForSecret(t *testing.T) {
 	m := fixtureMessage1()
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c := newEngine(fixtureRand())
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
-	c.receiveSMP(m)
-	assertDeepEquals(t, c.smp.state, smpStateWaitingForSecret{msg: m})
+	c.Receive(m.serialize())
+	assertDeepEquals(t, c.state, smpStateWaitingForSecret{msg: m})
 }
 
-func Test_contextTransitionsFromSmpExpect2ToSmpExpect4(t *testing.T) {
+func Test_engineTransitionsFromSmpExpect2ToSmpExpect4(t *testing.T) {
 	m := fixtureMessage2()
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.state = smpStateExpect2{}
-	c.smp.s1 = fixtureSmp1()
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c := newEngine(fixtureRand())
+	c.state = smpStateExpect2{}
+	c.s1 = fixtureSmp1()
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
-	c.receiveSMP(m)
-	assertEquals(t, c.smp.state, smpStateExpect4{})
+	c.Receive(m.serialize())
+	assertEquals(t, c.state, smpStateExpect4{})
 }
 
-func Test_contextTransitionsFromSmpExpect3ToSmpExpect1(t *testing.T) {
+func Test_engineTransitionsFromSmpExpect3ToSmpExpect1(t *testing.T) {
 	m := fixtureMessage3()
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.state = smpStateExpect3{}
-	c.smp.s2 = fixtureSmp2()
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c := newEngine(fixtureRand())
+	c.state = smpStateExpect3{}
+	c.s2 = fixtureSmp2()
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
-	c.receiveSMP(m)
-	assertEquals(t, c.smp.state, smpStateExpect1{})
+	c.Receive(m.serialize())
+	assertEquals(t, c.state, smpStateExpect1{})
 }
 
-func Test_contextTransitionsFromSmpExpect4ToSmpExpect1(t *testing.T) {
+func Test_engineTransitionsFromSmpExpect4ToSmpExpect1(t *testing.T) {
 	m := fixtureMessage4()
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.state = smpStateExpect4{}
-	c.smp.s1 = fixtureSmp1()
-	c.smp.s3 = fixtureSmp3()
+	c := newEngine(fixtureRand())
+	c.state = smpStateExpect4{}
+	c.s1 = fixtureSmp1()
+	c.s3 = fixtureSmp3()
 
-	c.receiveSMP(m)
-	assertEquals(t, c.smp.state, smpStateExpect1{})
+	c.Receive(m.serialize())
+	assertEquals(t, c.state, smpStateExpect1{})
 }
 
-func Test_contextUnexpectedMessageTransitionsToSmpExpected1(t *testing.T) {
+func Test_engineUnexpectedMessageTransitionsToSmpExpected1(t *testing.T) {
 	m := fixtureMessage1()
 
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.state = smpStateExpect3{}
-	toSend, err := c.receiveSMP(m)
+	c := newEngine(fixtureRand())
+	c.state = smpStateExpect3{}
+	toSend, _, err := c.Receive(m.serialize())
 
 	assertNil(t, err)
-	assertEquals(t, c.smp.state, smpStateExpect1{})
-	assertDeepEquals(t, *toSend, smpMessageAbort{}.tlv())
+	assertEquals(t, c.state, smpStateExpect1{})
+	assertDeepEquals(t, toSend, smpMessageAbort{}.serialize())
 }
 
 func Test_smpStateExpect1_receiveMessage1_abortsSMPIfVerifySMP1ReturnsError(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 
 	s, m, err := smpStateExpect1{}.receiveMessage1(c, smp1Message{g2a: big.NewInt(1)})
 
@@ -321,16 +320,16 @@ func Test_smpStateExpect1_receiveMessage1_abortsSMPIfVerifySMP1ReturnsError(t *t
 }
 
 func Test_smpStateExpect1_receiveMessage1_signalsCheatingIfVerifySMP1Fails(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
+	c := newEngine(fixtureRand())
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		smpStateExpect1{}.receiveMessage1(c, smp1Message{g2a: big.NewInt(1)})
-	}, SMPEventCheated, 0, "")
+	}, EventCheated)
 }
 
 func Test_smp1Message_receivedMessage_abortsSMPIfFailsToVerifyMessage1(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.state = smpStateExpect1{}
+	c := newEngine(fixtureRand())
+	c.state = smpStateExpect1{}
 	m := smp1Message{g2a: big.NewInt(1)}
 	ret, err := m.receivedMessage(c)
 
@@ -339,15 +338,10 @@ func Test_smp1Message_receivedMessage_abortsSMPIfFailsToVerifyMessage1(t *testin
 }
 
 func Test_smpStateWaitingForSecret_continueMessage1_abortsSMPIfgenerateSMP2Fails(t *testing.T) {
-	c := bobContextAfterAKE()
-	c.Rand = fixedRand([]string{"ABCD"})
-	c.msgState = encrypted
-	c.ssid = [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
-	c.ourKey = bobPrivateKey
-	c.theirKey = &alicePrivateKey.PublicKey
-	c.smp.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
+	c := newEngine(fixedRand([]string{"ABCD"}))
+	c.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
 
-	s, m, err := smpStateWaitingForSecret{msg: fixtureMessage1()}.continueMessage1(c, []byte("hello world"))
+	s, m, err := smpStateWaitingForSecret{msg: fixtureMessage1()}.continueMessage1(c, fixtureInputs(), []byte("hello world"))
 
 	assertNil(t, err)
 	assertEquals(t, s, smpStateExpect1{})
@@ -355,9 +349,9 @@ func Test_smpStateWaitingForSecret_continueMessage1_abortsSMPIfgenerateSMP2Fails
 }
 
 func Test_smpStateExpect2_receiveMessage2_abortsSMPIfVerifySMPReturnsError(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.s1 = fixtureSmp1()
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c := newEngine(fixtureRand())
+	c.s1 = fixtureSmp1()
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 	s, m, err := smpStateExpect2{}.receiveMessage2(c, smp2Message{g2b: big.NewInt(1)})
 
 	assertNil(t, err)
@@ -366,10 +360,10 @@ func Test_smpStateExpect2_receiveMessage2_abortsSMPIfVerifySMPReturnsError(t *te
 }
 
 func Test_smp2Message_receivedMessage_abortsSMPIfUnderlyingPrimitiveHasErrors(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.state = smpStateExpect2{}
-	c.smp.s1 = fixtureSmp1()
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c := newEngine(fixtureRand())
+	c.state = smpStateExpect2{}
+	c.s1 = fixtureSmp1()
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 	ret, err := smp2Message{g2b: big.NewInt(1)}.receivedMessage(c)
 
 	assertNil(t, err)
@@ -377,9 +371,9 @@ func Test_smp2Message_receivedMessage_abortsSMPIfUnderlyingPrimitiveHasErrors(t
 }
 
 func Test_smpStateExpect2_receiveMessage2_abortsSMPIfgenerateSMPFails(t *testing.T) {
-	c := newConversation(otrV3{}, fixedRand([]string{"ABCD"}))
-	c.smp.s1 = fixtureSmp1()
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c := newEngine(fixedRand([]string{"ABCD"}))
+	c.s1 = fixtureSmp1()
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 	s, m, err := smpStateExpect2{}.receiveMessage2(c, fixtureMessage2())
 
 	assertNil(t, err)
@@ -388,9 +382,9 @@ func Test_smpStateExpect2_receiveMessage2_abortsSMPIfgenerateSMPFails(t *testing
 }
 
 func Test_smpStateExpect3_receiveMessage3_abortsSMPIfVerifySMPReturnsError(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
-	c.smp.s2 = fixtureSmp2()
+	c := newEngine(fixtureRand())
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c.s2 = fixtureSmp2()
 	s, m, err := smpStateExpect3{}.receiveMessage3(c, smp3Message{pa: big.NewInt(1)})
 
 	assertNil(t, err)
@@ -399,44 +393,45 @@ func Test_smpStateExpect3_receiveMessage3_abortsSMPIfVerifySMPReturnsError(t *te
 }
 
 func Test_smp3Message_receivedMessage_abortsSMPIfUnderlyingPrimitiveDoes(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.state = smpStateExpect3{}
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
-	c.smp.s2 = fixtureSmp2()
+	c := newEngine(fixtureRand())
+	c.state = smpStateExpect3{}
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c.s2 = fixtureSmp2()
 	ret, err := smp3Message{pa: big.NewInt(1)}.receivedMessage(c)
 
 	assertNil(t, err)
 	assertDeepEquals(t, ret, smpMessageAbort{})
 }
 
-func Test_smpStateExpect3_receiveMessage3_abortsSMPIfProtocolFails(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
-	c.smp.s2 = fixtureSmp2()
-	c.smp.s2.b3 = sub(c.smp.s2.b3, big.NewInt(1))
+func Test_smpStateExpect3_receiveMessage3_sendsTheLastMessageEvenIfProtocolFails(t *testing.T) {
+	c := newEngine(fixtureRand())
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c.s2 = fixtureSmp2()
+	c.s2.b3 = sub(c.s2.b3, big.NewInt(1))
 	s, m, err := smpStateExpect3{}.receiveMessage3(c, fixtureMessage3())
 
 	assertNil(t, err)
 	assertEquals(t, s, smpStateExpect1{})
-	assertEquals(t, m, smpMessageAbort{})
+	_, isSMP4 := m.(smp4Message)
+	assertEquals(t, isSMP4, true)
 }
 
 func Test_smpStateExpect3_receiveMessage3_willSendAnSMPNotificationOnProtocolFailure(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
-	c.smp.s2 = fixtureSmp2()
-	c.smp.s2.b3 = sub(c.smp.s2.b3, big.NewInt(1))
+	c := newEngine(fixtureRand())
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c.s2 = fixtureSmp2()
+	c.s2.b3 = sub(c.s2.b3, big.NewInt(1))
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		smpStateExpect3{}.receiveMessage3(c, fixtureMessage3())
-	}, SMPEventFailure, 100, "")
+	}, EventFailure)
 
 }
 
 func Test_smpStateExpect3_receiveMessage3_abortsSMPIfCantGenerateFinalParameters(t *testing.T) {
-	c := newConversation(otrV3{}, fixedRand([]string{"ABCD"}))
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
-	c.smp.s2 = fixtureSmp2()
+	c := newEngine(fixedRand([]string{"ABCD"}))
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c.s2 = fixtureSmp2()
 	s, m, err := smpStateExpect3{}.receiveMessage3(c, fixtureMessage3())
 
 	assertNil(t, err)
@@ -445,9 +440,9 @@ func Test_smpStateExpect3_receiveMessage3_abortsSMPIfCantGenerateFinalParameters
 }
 
 func Test_smpStateExpect4_receiveMessage4_abortsSMPIfVerifySMPReturnsError(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.s1 = fixtureSmp1()
-	c.smp.s3 = fixtureSmp3()
+	c := newEngine(fixtureRand())
+	c.s1 = fixtureSmp1()
+	c.s3 = fixtureSmp3()
 	s, m, err := smpStateExpect4{}.receiveMessage4(c, smp4Message{rb: big.NewInt(1)})
 
 	assertNil(t, err)
@@ -455,34 +450,34 @@ func Test_smpStateExpect4_receiveMessage4_abortsSMPIfVerifySMPReturnsError(t *te
 	assertDeepEquals(t, m, smpMessageAbort{})
 }
 
-func Test_smpStateExpect4_receiveMessage4_abortsSMPIfProtocolFails(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.s1 = fixtureSmp1()
-	c.smp.s3 = fixtureSmp3()
-	c.smp.s3.papb = sub(c.smp.s3.papb, big.NewInt(1))
+func Test_smpStateExpect4_receiveMessage4_restartsWithoutAbortingIfProtocolFails(t *testing.T) {
+	c := newEngine(fixtureRand())
+	c.s1 = fixtureSmp1()
+	c.s3 = fixtureSmp3()
+	c.s3.papb = sub(c.s3.papb, big.NewInt(1))
 	s, m, err := smpStateExpect4{}.receiveMessage4(c, fixtureMessage4())
 
 	assertNil(t, err)
 	assertEquals(t, s, smpStateExpect1{})
-	assertEquals(t, m, smpMessageAbort{})
+	assertNil(t, m)
 }
 
 func Test_smpStateExpect4_receiveMessage4_willSendAnSMPNotificationOnProtocolFailure(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.s1 = fixtureSmp1()
-	c.smp.s3 = fixtureSmp3()
-	c.smp.s3.papb = sub(c.smp.s3.papb, big.NewInt(1))
+	c := newEngine(fixtureRand())
+	c.s1 = fixtureSmp1()
+	c.s3 = fixtureSmp3()
+	c.s3.papb = sub(c.s3.papb, big.NewInt(1))
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		smpStateExpect4{}.receiveMessage4(c, fixtureMessage4())
-	}, SMPEventFailure, 100, "")
+	}, EventFailure)
 }
 
 func Test_smp4Message_receivedMessage_abortsSMPIfTheUnderlyingPrimitiveDoes(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.state = smpStateExpect4{}
-	c.smp.s1 = fixtureSmp1()
-	c.smp.s3 = fixtureSmp3()
+	c := newEngine(fixtureRand())
+	c.state = smpStateExpect4{}
+	c.s1 = fixtureSmp1()
+	c.s3 = fixtureSmp3()
 
 	ret, err := smp4Message{rb: big.NewInt(1)}.receivedMessage(c)
 	assertNil(t, err)
@@ -491,14 +486,14 @@ func Test_smp4Message_receivedMessage_abortsSMPIfTheUnderlyingPrimitiveDoes(t *t
 
 func Test_receive_returnsAnyErrorThatOccurs(t *testing.T) {
 	m := fixtureMessage2()
-	c := newConversation(otrV3{}, fixedRand([]string{"ABCD"}))
-	c.smp.s1 = fixtureSmp1()
-	c.smp.state = smpStateExpect2{}
-	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c := newEngine(fixedRand([]string{"ABCD"}))
+	c.s1 = fixtureSmp1()
+	c.state = smpStateExpect2{}
+	c.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
-	ret, err := c.receiveSMP(m)
+	ret, _, err := c.Receive(m.serialize())
 	assertNil(t, err)
-	assertDeepEquals(t, *ret, smpMessageAbort{}.tlv())
+	assertDeepEquals(t, ret, smpMessageAbort{}.serialize())
 }
 
 func Test_smpStateExpect1_String_returnsTheCorrectString(t *testing.T) {
@@ -518,19 +513,19 @@ func Test_smpStateExpect4_String_returnsTheCorrectString(t *testing.T) {
 }
 
 func Test_smpMessageAbort_receivedMessage_setsTheNewState(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.state = smpStateExpect2{}
+	c := newEngine(fixtureRand())
+	c.state = smpStateExpect2{}
 	ret, err := smpMessageAbort{}.receivedMessage(c)
 	assertDeepEquals(t, ret, nil)
 	assertDeepEquals(t, err, nil)
-	assertDeepEquals(t, c.smp.state, smpStateExpect1{})
+	assertDeepEquals(t, c.state, smpStateExpect1{})
 }
 
 func Test_smpMessageAbort_receivedMessage_sendsAnSMPEventAboutTheAbort(t *testing.T) {
-	c := newConversation(otrV3{}, fixtureRand())
-	c.smp.state = smpStateExpect2{}
+	c := newEngine(fixtureRand())
+	c.state = smpStateExpect2{}
 
-	c.expectSMPEvent(t, func() {
+	c.expectEvent(t, func() {
 		smpMessageAbort{}.receivedMessage(c)
-	}, SMPEventAbort, 0, "")
+	}, EventAbort)
 }
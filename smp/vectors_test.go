@@ -0,0 +1,109 @@
+package smp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+// testVector is a complete run of the protocol with fixed randomness. The same vectors
+// are used by the tests of the otr3 package, to check that conversations produce them too.
+type testVector struct {
+	Name             string   `json:"name"`
+	ExponentSize     int      `json:"exponentSize"`
+	AliceFingerprint string   `json:"aliceFingerprint"`
+	BobFingerprint   string   `json:"bobFingerprint"`
+	SessionID        string   `json:"sessionID"`
+	Question         string   `json:"question"`
+	AliceSecret      string   `json:"aliceSecret"`
+	BobSecret        string   `json:"bobSecret"`
+	AliceRand        string   `json:"aliceRand"`
+	BobRand          string   `json:"bobRand"`
+	Messages         []string `json:"messages"`
+	Success          bool     `json:"success"`
+}
+
+func loadTestVectors(t *testing.T) []testVector {
+	data, err := ioutil.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var vectors []testVector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	return vectors
+}
+
+func (v testVector) message(i int) []byte {
+	return bytesFromHex(v.Messages[i])
+}
+
+func (v testVector) aliceInputs() Inputs {
+	return Inputs{
+		OurFingerprint:   bytesFromHex(v.AliceFingerprint),
+		TheirFingerprint: bytesFromHex(v.BobFingerprint),
+		SessionID:        bytesFromHex(v.SessionID),
+	}
+}
+
+func (v testVector) bobInputs() Inputs {
+	return Inputs{
+		OurFingerprint:   bytesFromHex(v.BobFingerprint),
+		TheirFingerprint: bytesFromHex(v.AliceFingerprint),
+		SessionID:        bytesFromHex(v.SessionID),
+	}
+}
+
+func assertMessage(t *testing.T, v testVector, actual []byte, i int) {
+	if !bytes.Equal(actual, v.message(i)) {
+		t.Errorf("%s: message %d differs from the vector:\n%s", v.Name, i+1, hex.EncodeToString(actual))
+	}
+}
+
+func Test_testVectors_areProducedByBothSides(t *testing.T) {
+	for _, v := range loadTestVectors(t) {
+		alice := &Engine{Rand: bytes.NewReader(bytesFromHex(v.AliceRand)), ExponentSize: v.ExponentSize}
+		bob := &Engine{Rand: bytes.NewReader(bytesFromHex(v.BobRand)), ExponentSize: v.ExponentSize}
+
+		toSend, err := alice.Start(v.aliceInputs(), v.Question, []byte(v.AliceSecret))
+		assertNil(t, err)
+		assertEquals(t, len(toSend), 1)
+		assertMessage(t, v, toSend[0], 0)
+
+		_, ev, _ := bob.Receive(v.message(0))
+		question, _ := bob.Question()
+		assertEquals(t, question, v.Question)
+		if v.Question == "" {
+			assertEquals(t, ev, EventAskForSecret)
+		} else {
+			assertEquals(t, ev, EventAskForAnswer)
+		}
+
+		msg, _, err := bob.ProvideSecret(v.bobInputs(), []byte(v.BobSecret))
+		assertNil(t, err)
+		assertMessage(t, v, msg, 1)
+
+		msg, ev, _ = alice.Receive(v.message(1))
+		assertEquals(t, ev, EventInProgress)
+		assertMessage(t, v, msg, 2)
+
+		msg, ev, _ = bob.Receive(v.message(2))
+		assertMessage(t, v, msg, 3)
+
+		_, ev2, _ := alice.Receive(v.message(3))
+		if v.Success {
+			assertEquals(t, ev, EventSuccess)
+			assertEquals(t, ev2, EventSuccess)
+		} else {
+			assertEquals(t, ev, EventFailure)
+			assertEquals(t, ev2, EventFailure)
+		}
+
+		assertEquals(t, alice.Status(), StatusExpect1)
+		assertEquals(t, bob.Status(), StatusExpect1)
+	}
+}
@@ -0,0 +1,290 @@
+package otr3
+
+import (
+	"sync"
+
+	"github.com/twstrike/otr3/smp"
+)
+
+// SMPInjectionHandler is notified when SMP computations running in the background have finished, and their messages
+// are ready to be sent to the peer.
+type SMPInjectionHandler interface {
+	// HandleSMPInjection is called from the worker goroutine, so it must not use the Conversation. It should arrange
+	// for PendingSMPMessages to be called from the goroutine that uses the Conversation, and send what it returns.
+	HandleSMPInjection()
+}
+
+type dynamicSMPInjectionHandler struct {
+	f func()
+}
+
+func (d dynamicSMPInjectionHandler) HandleSMPInjection() {
+	d.f()
+}
+
+// EnableAsyncSMP moves the modular exponentiations of the Socialist Millionaires' Protocol to a worker goroutine.
+// Receive, StartAuthenticate and ProvideAuthenticationSecret return without the SMP messages; the messages are
+// returned by PendingSMPMessages once they are ready, or injected into the result of the next Send or Receive.
+// SMP events are still signaled to the SMPEventHandler, from the goroutine that collects the messages.
+// AbortAuthentication and End cancel any computation that hasn't been collected.
+// While the worker is running, it reads from Rand concurrently with the Conversation, so Rand must be safe for
+// concurrent use, as crypto/rand.Reader is.
+func (c *Conversation) EnableAsyncSMP(h SMPInjectionHandler) {
+	if c.smp.async != nil {
+		c.smp.async.setHandler(h)
+		return
+	}
+
+	c.smp.async = newSMPWorker(h, c.smp.Clone())
+}
+
+// DisableAsyncSMP goes back to computing the SMP messages inside the calls that cause them.
+// Computations that haven't been collected are cancelled, and the authentication they belonged to is forgotten.
+func (c *Conversation) DisableAsyncSMP() {
+	if c.smp.async == nil {
+		return
+	}
+
+	if c.smp.async.cancel() {
+		c.smp.Engine.Wipe()
+	}
+	c.smp.async = nil
+}
+
+// PendingSMPMessages returns the messages of the SMP computations that have finished since it was last called, and
+// signals the SMP events they caused. It is only useful after EnableAsyncSMP.
+func (c *Conversation) PendingSMPMessages() ([]ValidMessage, error) {
+	if c.smp.async == nil {
+		return nil, nil
+	}
+
+	var toSend []ValidMessage
+	results := c.smp.async.takeResults()
+	for i, r := range results {
+		msgs, err := c.deliverSMPResult(r)
+		if err != nil {
+			releaseSMPResults(results[i+1:])
+			return toSend, err
+		}
+		toSend = append(toSend, msgs...)
+	}
+
+	return toSend, nil
+}
+
+func (c *Conversation) potentialSMPInjections() {
+	toSend, err := c.PendingSMPMessages()
+	if err != nil {
+		// There is no caller waiting for this error, since the SMP message that caused it was received earlier
+		c.smpEvent(SMPEventError, 0)
+	}
+
+	for _, m := range toSend {
+		c.injectMessage(m)
+	}
+}
+
+func (c *Conversation) deliverSMPResult(r smpResult) ([]ValidMessage, error) {
+	replaced := c.smp.Engine
+	c.smp.Engine = r.engine
+	replaced.Release()
+
+	c.signalSMPEvent(r.event)
+	if r.err != nil {
+		return nil, c.smpError(r.err)
+	}
+
+	tlvs, err := smpTLVs(r.toSend)
+	if err != nil || len(tlvs) == 0 {
+		return nil, err
+	}
+
+	if r.started {
+		tlvs = c.announceSMPNormalization(r.normalization, tlvs)
+	}
+
+	c.updateLastSMPActivity()
+
+	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, tlvs)
+	return msgs, err
+}
+
+// startSMPAsync, receiveSMPAsync and continueSMPAsync capture everything they need from the Conversation before
+// handing the work to the worker, since the Conversation can change while the worker runs
+func (c *Conversation) startSMPAsync(question string, mutualSecret []byte) {
+	in := c.smpAsyncInputs()
+	n := c.smp.normalization
+	secret := n.apply(makeCopy(mutualSecret))
+
+	c.smpAsync(func(e *smp.Engine) *smpResult {
+		toSend, err := e.Start(in, question, secret)
+		return &smpResult{toSend: toSend, err: err, started: true, normalization: n}
+	})
+}
+
+func (c *Conversation) receiveSMPAsync(t tlv) {
+	msg := t.serialize()
+
+	c.smpAsync(func(e *smp.Engine) *smpResult {
+		toSend, ev, err := e.Receive(msg)
+		return &smpResult{toSend: [][]byte{toSend}, event: ev, err: err}
+	})
+}
+
+func (c *Conversation) continueSMPAsync(mutualSecret []byte) {
+	in := c.smpAsyncInputs()
+	secret := c.smp.responderNormalization().apply(makeCopy(mutualSecret))
+
+	c.smpAsync(func(e *smp.Engine) *smpResult {
+		toSend, ev, err := e.ProvideSecret(in, secret)
+		return &smpResult{toSend: [][]byte{toSend}, event: ev, err: err}
+	})
+}
+
+func (c *Conversation) smpAsync(f func(*smp.Engine) *smpResult) {
+	r := c.rand()
+	exponentSize := c.version.parameterLength()
+	skipGroupElementChecks := !c.version.checksGroupElements()
+
+	c.smp.async.enqueue(func(e *smp.Engine) *smpResult {
+		e.Rand = r
+		e.ExponentSize = exponentSize
+		e.SkipGroupElementChecks = skipGroupElementChecks
+		return f(e)
+	})
+}
+
+func (c *Conversation) smpAsyncInputs() smp.Inputs {
+	in := c.smpInputs()
+	in.SessionID = makeCopy(in.SessionID)
+	return in
+}
+
+type smpResult struct {
+	engine smp.Engine
+	toSend [][]byte
+	event  smp.Event
+	err    error
+
+	// started is set for the result of starting an authentication, which announces our normalization rules
+	started       bool
+	normalization SMPNormalization
+}
+
+// releaseSMPResults releases the engines of results that are discarded
+func releaseSMPResults(results []smpResult) {
+	for i := range results {
+		results[i].engine.Release()
+	}
+}
+
+type smpJob struct {
+	generation int
+	run        func(*smp.Engine) *smpResult
+}
+
+// smpWorker runs the SMP computations of a Conversation, in order, on a goroutine that only exists while there is work
+// to do. The worker has its own Engine, and hands a clone of it to the Conversation together with every result.
+type smpWorker struct {
+	sync.Mutex
+
+	handler SMPInjectionHandler
+
+	// generation changes every time the pending work is cancelled, so results of cancelled jobs can be discarded
+	generation int
+	jobs       []smpJob
+	results    []smpResult
+	running    bool
+
+	// engine is only used by the goroutine that runs the jobs
+	engine smp.Engine
+}
+
+func newSMPWorker(h SMPInjectionHandler, e smp.Engine) *smpWorker {
+	return &smpWorker{
+		handler: h,
+		engine:  e,
+	}
+}
+
+func (w *smpWorker) setHandler(h SMPInjectionHandler) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.handler = h
+}
+
+func (w *smpWorker) enqueue(f func(*smp.Engine) *smpResult) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.jobs = append(w.jobs, smpJob{generation: w.generation, run: f})
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+}
+
+// cancel discards the pending jobs and results, and wipes the Engine of the worker as soon as the job it might be
+// running has finished. It returns true if there was anything to cancel.
+func (w *smpWorker) cancel() bool {
+	w.Lock()
+	hadWork := w.running || len(w.jobs) > 0 || len(w.results) > 0
+	w.generation++
+	w.jobs = nil
+	releaseSMPResults(w.results)
+	w.results = nil
+	w.Unlock()
+
+	w.enqueue(func(e *smp.Engine) *smpResult {
+		e.Wipe()
+		return nil
+	})
+
+	return hadWork
+}
+
+func (w *smpWorker) takeResults() []smpResult {
+	w.Lock()
+	defer w.Unlock()
+
+	results := w.results
+	w.results = nil
+	return results
+}
+
+func (w *smpWorker) run() {
+	for {
+		w.Lock()
+		if len(w.jobs) == 0 {
+			w.running = false
+			w.Unlock()
+			return
+		}
+		j := w.jobs[0]
+		w.jobs = w.jobs[1:]
+		w.Unlock()
+
+		r := j.run(&w.engine)
+		if r == nil {
+			continue
+		}
+		r.engine = w.engine.Clone()
+
+		w.Lock()
+		current := j.generation == w.generation
+		if current {
+			w.results = append(w.results, *r)
+		}
+		h := w.handler
+		w.Unlock()
+
+		if !current {
+			r.engine.Release()
+		}
+
+		if current && h != nil {
+			h.HandleSMPInjection()
+		}
+	}
+}
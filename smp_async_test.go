@@ -0,0 +1,283 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+// blockingReader blocks every read until it is released, so tests can observe a computation while it is running
+type blockingReader struct {
+	release chan struct{}
+	// reading receives a value every time a read starts
+	reading chan struct{}
+}
+
+func newBlockingReader() blockingReader {
+	return blockingReader{make(chan struct{}), make(chan struct{}, 100)}
+}
+
+func (r blockingReader) Read(p []byte) (int, error) {
+	r.reading <- struct{}{}
+	<-r.release
+	return rand.Reader.Read(p)
+}
+
+func injectionNotifier() (SMPInjectionHandler, chan struct{}) {
+	ready := make(chan struct{}, 10)
+	return dynamicSMPInjectionHandler{func() { ready <- struct{}{} }}, ready
+}
+
+func waitForInjection(t *testing.T, ready chan struct{}) {
+	select {
+	case <-ready:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the SMP worker didn't finish in time")
+	}
+}
+
+func waitForSMPWorker(w *smpWorker) {
+	for {
+		w.Lock()
+		running := w.running
+		w.Unlock()
+		if !running {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func Test_StartAuthenticate_returnsBeforeTheMessageIsComputedWhenAsync(t *testing.T) {
+	alice, _ := encryptedConversations(t)
+	h, ready := injectionNotifier()
+	alice.EnableAsyncSMP(h)
+
+	toSend, err := alice.StartAuthenticate("", []byte("secret"))
+	assertNil(t, err)
+	assertNil(t, toSend)
+
+	waitForInjection(t, ready)
+
+	toSend, err = alice.PendingSMPMessages()
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+	assertEquals(t, alice.SMPStatus(), SMPStatusExpect2)
+}
+
+func Test_SMP_completesWhenBothSidesAreAsync(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	aliceHandler, aliceReady := injectionNotifier()
+	bobHandler, bobReady := injectionNotifier()
+	alice.EnableAsyncSMP(aliceHandler)
+	bob.EnableAsyncSMP(bobHandler)
+
+	var aliceEvents, bobEvents []SMPEvent
+	alice.smpEventHandler = dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		aliceEvents = append(aliceEvents, event)
+	}}
+	bob.smpEventHandler = dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		bobEvents = append(bobEvents, event)
+	}}
+
+	alice.StartAuthenticate("Where did we meet?", []byte("secret"))
+	waitForInjection(t, aliceReady)
+	msgs, _ := alice.PendingSMPMessages()
+
+	_, toSend, err := bob.Receive(msgs[0])
+	assertNil(t, err)
+	assertNil(t, toSend)
+	waitForInjection(t, bobReady)
+	bob.PendingSMPMessages()
+	question, _ := bob.SMPQuestion()
+	assertEquals(t, question, "Where did we meet?")
+
+	bob.ProvideAuthenticationSecret([]byte("secret"))
+	waitForInjection(t, bobReady)
+	msgs, _ = bob.PendingSMPMessages()
+
+	alice.Receive(msgs[0])
+	waitForInjection(t, aliceReady)
+	msgs, _ = alice.PendingSMPMessages()
+
+	bob.Receive(msgs[0])
+	waitForInjection(t, bobReady)
+	msgs, _ = bob.PendingSMPMessages()
+
+	alice.Receive(msgs[0])
+	waitForInjection(t, aliceReady)
+	msgs, _ = alice.PendingSMPMessages()
+
+	assertEquals(t, len(msgs), 0)
+	assertDeepEquals(t, aliceEvents, []SMPEvent{SMPEventInProgress, SMPEventSuccess})
+	assertDeepEquals(t, bobEvents, []SMPEvent{SMPEventAskForAnswer, SMPEventSuccess})
+	assertEquals(t, alice.SMPStatus(), SMPStatusExpect1)
+	assertEquals(t, bob.SMPStatus(), SMPStatusExpect1)
+}
+
+func Test_SMP_releasesTheLockedMemoryOfEveryEngineWhenAsync(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	aliceHandler, aliceReady := injectionNotifier()
+	bobHandler, bobReady := injectionNotifier()
+	alice.EnableAsyncSMP(aliceHandler)
+	bob.EnableAsyncSMP(bobHandler)
+	// The memory of the pool for the keys of the data messages is never released
+	sessionKeysPool.Put(sessionKeysPool.Get())
+	before := collectGarbage()
+
+	alice.StartAuthenticate("", []byte("secret"))
+	waitForInjection(t, aliceReady)
+	msgs, _ := alice.PendingSMPMessages()
+	bob.Receive(msgs[0])
+	waitForInjection(t, bobReady)
+	bob.PendingSMPMessages()
+	bob.ProvideAuthenticationSecret([]byte("secret"))
+	waitForInjection(t, bobReady)
+	msgs, _ = bob.PendingSMPMessages()
+	alice.Receive(msgs[0])
+	waitForInjection(t, aliceReady)
+	msgs, _ = alice.PendingSMPMessages()
+	bob.Receive(msgs[0])
+	waitForInjection(t, bobReady)
+	msgs, _ = bob.PendingSMPMessages()
+	alice.Receive(msgs[0])
+	waitForInjection(t, aliceReady)
+	alice.PendingSMPMessages()
+
+	assertEquals(t, collectGarbage(), before)
+	assertEquals(t, alice.SMPStatus(), SMPStatusExpect1)
+	assertEquals(t, bob.SMPStatus(), SMPStatusExpect1)
+}
+
+func Test_AbortAuthentication_releasesTheLockedMemoryOfTheDiscardedResults(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	h, ready := injectionNotifier()
+	alice.EnableAsyncSMP(h)
+	before := collectGarbage()
+
+	alice.StartAuthenticate("", []byte("secret"))
+	waitForInjection(t, ready)
+	r := newBlockingReader()
+	alice.Rand = r
+	alice.StartAuthenticate("", []byte("another secret"))
+	<-r.reading
+
+	alice.AbortAuthentication()
+	close(r.release)
+	waitForSMPWorker(alice.smp.async)
+
+	assertEquals(t, collectGarbage(), before)
+	assertEquals(t, alice.SMPStatus(), SMPStatusExpect1)
+	assertEquals(t, bob.SMPStatus(), SMPStatusExpect1)
+}
+
+func Test_Send_injectsTheFinishedSMPMessages(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	h, ready := injectionNotifier()
+	alice.EnableAsyncSMP(h)
+
+	alice.StartAuthenticate("", []byte("secret"))
+	waitForInjection(t, ready)
+
+	toSend, err := alice.Send(ValidMessage("hello"))
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 2)
+
+	bob.expectSMPEvent(t, func() {
+		bob.Receive(toSend[1])
+	}, SMPEventAskForSecret, 25, "")
+}
+
+func Test_AbortAuthentication_cancelsTheComputationInProgress(t *testing.T) {
+	alice, _ := encryptedConversations(t)
+	h, ready := injectionNotifier()
+	alice.EnableAsyncSMP(h)
+	r := newBlockingReader()
+	alice.Rand = r
+
+	alice.StartAuthenticate("", []byte("secret"))
+	toSend, err := alice.AbortAuthentication()
+	close(r.release)
+	waitForSMPWorker(alice.smp.async)
+
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+	assertEquals(t, len(ready), 0)
+	assertEquals(t, len(alice.smp.async.takeResults()), 0)
+	assertEquals(t, alice.SMPStatus(), SMPStatusExpect1)
+}
+
+func Test_End_cancelsTheComputationInProgress(t *testing.T) {
+	alice, _ := encryptedConversations(t)
+	h, ready := injectionNotifier()
+	alice.EnableAsyncSMP(h)
+	r := newBlockingReader()
+	alice.Rand = r
+
+	alice.StartAuthenticate("", []byte("secret"))
+	alice.End()
+	close(r.release)
+	waitForSMPWorker(alice.smp.async)
+
+	assertEquals(t, len(ready), 0)
+	assertEquals(t, len(alice.smp.async.takeResults()), 0)
+}
+
+func Test_PendingSMPMessages_returnsTheErrorOfAComputation(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	h, ready := injectionNotifier()
+	c.EnableAsyncSMP(h)
+
+	c.processSMPTLV(tlv{tlvType: tlvTypeSMP1, tlvLength: 1, tlvValue: []byte{0x01}}, dataMessageExtra{})
+	waitForInjection(t, ready)
+
+	toSend, err := c.PendingSMPMessages()
+	assertNil(t, toSend)
+	assertEquals(t, err, errCorruptDataMessage)
+}
+
+func Test_ProvideAuthenticationSecret_returnsAnErrorIfNotWaitingForASecretWhenAsync(t *testing.T) {
+	alice, _ := encryptedConversations(t)
+	alice.EnableAsyncSMP(nil)
+
+	toSend, err := alice.ProvideAuthenticationSecret([]byte("secret"))
+
+	assertNil(t, toSend)
+	assertEquals(t, err, errNotWaitingForSMPSecret)
+}
+
+func Test_PendingSMPMessages_doesNothingWhenNotAsync(t *testing.T) {
+	c := &Conversation{}
+	toSend, err := c.PendingSMPMessages()
+	assertNil(t, toSend)
+	assertNil(t, err)
+}
+
+func Test_DisableAsyncSMP_computesTheMessagesSynchronouslyAgain(t *testing.T) {
+	alice, _ := encryptedConversations(t)
+	alice.EnableAsyncSMP(nil)
+	alice.DisableAsyncSMP()
+
+	toSend, err := alice.StartAuthenticate("", []byte("secret"))
+
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+	assertNil(t, alice.smp.async)
+}
+
+func Test_DisableAsyncSMP_forgetsTheAuthenticationThatWasBeingComputed(t *testing.T) {
+	alice, _ := encryptedConversations(t)
+	alice.EnableAsyncSMP(nil)
+	r := newBlockingReader()
+	alice.Rand = r
+
+	alice.StartAuthenticate("", []byte("secret"))
+	w := alice.smp.async
+	alice.DisableAsyncSMP()
+	close(r.release)
+	waitForSMPWorker(w)
+
+	assertEquals(t, alice.SMPStatus(), SMPStatusExpect1)
+	assertEquals(t, len(w.takeResults()), 0)
+}
@@ -22,6 +22,9 @@ const (
 	SMPEventSuccess
 	// SMPEventFailure means update the auth progress dialog with progress_percent
 	SMPEventFailure
+	// SMPEventNormalizationMismatch means the peer normalizes its secret with other rules than ours, so the
+	// authentication fails unless both secrets are typed in the same way
+	SMPEventNormalizationMismatch
 )
 
 // SMPEventHandler handles SMPEvents
@@ -68,6 +71,8 @@ func (s SMPEvent) String() string {
 		return "SMPEventSuccess"
 	case SMPEventFailure:
 		return "SMPEventFailure"
+	case SMPEventNormalizationMismatch:
+		return "SMPEventNormalizationMismatch"
 	default:
 		return "SMP EVENT: (THIS SHOULD NEVER HAPPEN)"
 	}
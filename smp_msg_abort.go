@@ -1,7 +0,0 @@
-package otr3
-
-type smpMessageAbort struct{}
-
-func (m smpMessageAbort) tlv() tlv {
-	return genSMPTLV(tlvTypeSMPAbort)
-}
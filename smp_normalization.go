@@ -0,0 +1,130 @@
+package otr3
+
+import (
+	"bytes"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// SMPNormalization describes the rules used to normalize an SMP secret before it is used in the authentication.
+// Different clients, keyboards and input methods can produce different bytes for what the user considers
+// the same secret, which makes the authentication fail. Normalizing the secret on both sides avoids that.
+// The rules can be combined, for example SMPNormalizeNFKC | SMPTrimWhitespace | SMPFoldCase.
+type SMPNormalization uint16
+
+const (
+	// SMPNormalizeNFC applies Unicode canonical composition to the secret
+	SMPNormalizeNFC SMPNormalization = 1 << iota
+	// SMPNormalizeNFKC applies Unicode compatibility composition to the secret. It takes precedence over SMPNormalizeNFC
+	SMPNormalizeNFKC
+	// SMPTrimWhitespace removes leading and trailing Unicode whitespace from the secret
+	SMPTrimWhitespace
+	// SMPFoldCase applies Unicode case folding to the secret, so that "Gopher" and "GOPHER" are the same secret
+	SMPFoldCase
+	// SMPFollowPeerNormalization is not a rule. When the peer starts an authentication and announces its rules, our
+	// secret is normalized with the peer's rules instead of ours, so that both secrets are normalized the same way.
+	// It lets the peer choose rules that make our secret easier to guess, for example by folding its case, so it
+	// should only be used when matching differently typed secrets matters more than that.
+	SMPFollowPeerNormalization
+)
+
+const smpNormalizationMask = SMPNormalizeNFC | SMPNormalizeNFKC | SMPTrimWhitespace | SMPFoldCase
+
+// SetSMPSecretNormalization sets the rules used to normalize the secrets given to StartAuthenticate and
+// ProvideAuthenticationSecret. No normalization is done by default.
+// When the policies allow private TLVs, the rules are sent to the peer together with the first SMP message of an
+// authentication we start. Our secret is normalized with our own rules, unless SMPFollowPeerNormalization is set and
+// the peer announced its rules when it started the authentication. SMPEventNormalizationMismatch is signaled when
+// the peer starts an authentication with other rules than ours, and we don't follow them.
+func (c *Conversation) SetSMPSecretNormalization(n SMPNormalization) {
+	c.smp.normalization = n & smpNormalizationMask
+	c.smp.followPeerNormalization = n&SMPFollowPeerNormalization == SMPFollowPeerNormalization
+}
+
+func (n SMPNormalization) apply(secret []byte) []byte {
+	result := n.normalize(secret)
+
+	if n&SMPTrimWhitespace == SMPTrimWhitespace {
+		result = bytes.TrimFunc(result, unicode.IsSpace)
+	}
+
+	if n&SMPFoldCase == SMPFoldCase {
+		result = cases.Fold().Bytes(result)
+		// Case folding can produce unnormalized text, so we normalize again
+		result = n.normalize(result)
+	}
+
+	return result
+}
+
+func (n SMPNormalization) normalize(secret []byte) []byte {
+	switch {
+	case n&SMPNormalizeNFKC == SMPNormalizeNFKC:
+		return norm.NFKC.Bytes(secret)
+	case n&SMPNormalizeNFC == SMPNormalizeNFC:
+		return norm.NFC.Bytes(secret)
+	}
+	return secret
+}
+
+// announce adds the TLV with the rules to the TLVs that start an authentication.
+// The rules have to arrive before the first SMP message, which is always the last TLV
+func (n SMPNormalization) announce(tlvs []tlv) []tlv {
+	if n == 0 || len(tlvs) == 0 {
+		return tlvs
+	}
+
+	last := len(tlvs) - 1
+	return append(tlvs[:last:last], n.tlv(), tlvs[last])
+}
+
+func (n SMPNormalization) tlv() tlv {
+	return tlv{
+		tlvType:   tlvTypeSMPSecretNormalization,
+		tlvLength: 2,
+		tlvValue:  appendShort(nil, uint16(n)),
+	}
+}
+
+func (c *Conversation) announceSMPNormalization(n SMPNormalization, tlvs []tlv) []tlv {
+	if !c.Policies.has(allowPrivateTLVs) {
+		return tlvs
+	}
+	return n.announce(tlvs)
+}
+
+// processSMPSecretNormalizationTLV keeps the peer's rules for the authentication that starts with the next SMP
+// message, which is in the same data message
+func (c *Conversation) processSMPSecretNormalizationTLV(t tlv, x dataMessageExtra) (toSend *tlv, err error) {
+	if !c.Policies.has(allowPrivateTLVs) {
+		return nil, nil
+	}
+
+	_, n, ok := extractShort(t.tlvValue[:t.tlvLength])
+	if !ok {
+		return nil, nil
+	}
+
+	rules := SMPNormalization(n) & smpNormalizationMask
+	c.smp.announcedNormalization = &rules
+	if rules != c.smp.normalization && !c.smp.followPeerNormalization {
+		c.smpEvent(SMPEventNormalizationMismatch, 0)
+	}
+	return nil, nil
+}
+
+// receivedSMP1 makes the rules announced with an authentication the peer starts the rules of that authentication.
+// An authentication that starts without them forgets the rules of the previous one
+func (s *smpContext) receivedSMP1() {
+	s.peerNormalization, s.announcedNormalization = s.announcedNormalization, nil
+}
+
+// responderNormalization returns the rules for the secret we provide in an authentication the peer started
+func (s *smpContext) responderNormalization() SMPNormalization {
+	if s.followPeerNormalization && s.peerNormalization != nil {
+		return *s.peerNormalization
+	}
+	return s.normalization
+}
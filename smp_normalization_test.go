@@ -0,0 +1,259 @@
+package otr3
+
+import "testing"
+
+func Test_SMPNormalization_apply_doesNothingByDefault(t *testing.T) {
+	secret := []byte(" Gopheŕ ")
+	assertDeepEquals(t, SMPNormalization(0).apply(secret), secret)
+}
+
+func Test_SMPNormalization_apply_normalizesMultilingualSecrets(t *testing.T) {
+	cases := []struct {
+		n        SMPNormalization
+		secret   string
+		expected string
+	}{
+		// French: e followed by a combining acute accent is composed into a single é
+		{SMPNormalizeNFC, "cafe\u0301", "caf\u00e9"},
+		// Korean: conjoining jamo are composed into a Hangul syllable
+		{SMPNormalizeNFC, "\u1112\u1161\u11ab\u1100\u1173\u11af", "\ud55c\uae00"},
+		// NFC keeps compatibility characters as they are
+		{SMPNormalizeNFC, "ﬁle", "ﬁle"},
+		// NFKC replaces ligatures and full width forms
+		{SMPNormalizeNFKC, "ﬁle", "file"},
+		{SMPNormalizeNFKC, "Ｇｏｐｈｅｒ", "Gopher"},
+		// Japanese: half width katakana become full width
+		{SMPNormalizeNFKC, "ｶﾀｶﾅ", "カタカナ"},
+		// NFKC takes precedence over NFC
+		{SMPNormalizeNFC | SMPNormalizeNFKC, "Ｇｏｐｈｅｒ", "Gopher"},
+		// Unicode whitespace, including no-break and ideographic spaces, is trimmed from both ends only
+		{SMPTrimWhitespace, " \t my secret\u00a0\u3000\n", "my secret"},
+		// German: folding turns ß into ss
+		{SMPFoldCase, "STRASSE", "strasse"},
+		{SMPFoldCase, "Straße", "strasse"},
+		// Greek: the final sigma folds into the same letter as the capital sigma
+		{SMPFoldCase, "ΣΊΣΥΦΟΣ", "σίσυφοσ"},
+		{SMPFoldCase, "σίσυφος", "σίσυφοσ"},
+		// Russian
+		{SMPFoldCase, "ПРИВЕТ", "привет"},
+		{SMPNormalizeNFKC | SMPTrimWhitespace | SMPFoldCase, "  Ｇｏｐｈｅｒ ", "gopher"},
+		{SMPNormalizeNFC | SMPFoldCase, "CAFE\u0301", "caf\u00e9"},
+	}
+
+	for _, cs := range cases {
+		assertEquals(t, string(cs.n.apply([]byte(cs.secret))), cs.expected)
+	}
+}
+
+func Test_SetSMPSecretNormalization_ignoresUnknownRules(t *testing.T) {
+	c := &Conversation{}
+	c.SetSMPSecretNormalization(SMPFoldCase | 0x8000)
+	assertEquals(t, c.smp.normalization, SMPFoldCase)
+	assertEquals(t, c.smp.followPeerNormalization, false)
+}
+
+func Test_SetSMPSecretNormalization_keepsWhetherToFollowThePeerApartFromTheRules(t *testing.T) {
+	c := &Conversation{}
+	c.SetSMPSecretNormalization(SMPFoldCase | SMPFollowPeerNormalization)
+	assertEquals(t, c.smp.normalization, SMPFoldCase)
+	assertEquals(t, c.smp.followPeerNormalization, true)
+}
+
+func Test_processSMPSecretNormalizationTLV_signalsWhenThePeersRulesAreDifferent(t *testing.T) {
+	c := &Conversation{}
+	c.Policies.AllowPrivateTLVs()
+	c.SetSMPSecretNormalization(SMPTrimWhitespace)
+
+	c.expectSMPEvent(t, func() {
+		toSend, err := c.processSMPSecretNormalizationTLV(SMPNormalizeNFKC.tlv(), dataMessageExtra{})
+		assertNil(t, err)
+		assertNil(t, toSend)
+	}, SMPEventNormalizationMismatch, 0, "")
+}
+
+func Test_processSMPSecretNormalizationTLV_signalsWhenWeDidntOptIn(t *testing.T) {
+	c := &Conversation{}
+	c.Policies.AllowPrivateTLVs()
+
+	c.expectSMPEvent(t, func() {
+		c.processSMPSecretNormalizationTLV(SMPFoldCase.tlv(), dataMessageExtra{})
+	}, SMPEventNormalizationMismatch, 0, "")
+}
+
+func Test_processSMPSecretNormalizationTLV_doesntSignalWhenTheRulesAreTheSame(t *testing.T) {
+	c := &Conversation{}
+	c.Policies.AllowPrivateTLVs()
+	c.SetSMPSecretNormalization(SMPTrimWhitespace | SMPFoldCase)
+
+	c.doesntExpectSMPEvent(t, func() {
+		c.processSMPSecretNormalizationTLV((SMPTrimWhitespace | SMPFoldCase).tlv(), dataMessageExtra{})
+	})
+}
+
+func Test_processSMPSecretNormalizationTLV_doesntSignalWhenWeFollowThePeer(t *testing.T) {
+	c := &Conversation{}
+	c.Policies.AllowPrivateTLVs()
+	c.SetSMPSecretNormalization(SMPTrimWhitespace | SMPFollowPeerNormalization)
+
+	c.doesntExpectSMPEvent(t, func() {
+		c.processSMPSecretNormalizationTLV(SMPNormalizeNFKC.tlv(), dataMessageExtra{})
+	})
+}
+
+func Test_processSMPSecretNormalizationTLV_ignoresTheTLVWithoutThePolicy(t *testing.T) {
+	c := &Conversation{}
+	c.SetSMPSecretNormalization(SMPTrimWhitespace)
+
+	c.doesntExpectSMPEvent(t, func() {
+		c.processSMPSecretNormalizationTLV(SMPNormalizeNFKC.tlv(), dataMessageExtra{})
+	})
+}
+
+func Test_processSMPSecretNormalizationTLV_ignoresAMalformedTLV(t *testing.T) {
+	c := &Conversation{}
+	c.Policies.AllowPrivateTLVs()
+	c.SetSMPSecretNormalization(SMPTrimWhitespace)
+
+	c.doesntExpectSMPEvent(t, func() {
+		c.processSMPSecretNormalizationTLV(tlv{tlvType: tlvTypeSMPSecretNormalization, tlvLength: 1, tlvValue: []byte{0x01}}, dataMessageExtra{})
+	})
+}
+
+func Test_StartAuthenticate_sendsTheNormalizationRulesBeforeTheFirstSMPMessage(t *testing.T) {
+	v := fixtureSMPVector(t)
+	c := v.asAlice(newConversation(otrV3{}, nil))
+	_, c.keys = fixtureDataMsg(plainDataMsg{})
+	c.Policies.AllowPrivateTLVs()
+	c.SetSMPSecretNormalization(SMPTrimWhitespace)
+
+	msg, _ := c.StartAuthenticate(v.Question, []byte("  "+v.AliceSecret+" "))
+
+	dec, _ := c.decode(encodedMessage(msg[0]))
+	tlvs := fixtureDecryptDataMsg(dec).tlvs
+	assertDeepEquals(t, tlvs[0], SMPTrimWhitespace.tlv())
+	assertDeepEquals(t, tlvs[1], v.tlv(0))
+}
+
+func Test_StartAuthenticate_doesNotSendTheNormalizationRulesWithoutThePolicy(t *testing.T) {
+	v := fixtureSMPVector(t)
+	c := v.asAlice(newConversation(otrV3{}, nil))
+	_, c.keys = fixtureDataMsg(plainDataMsg{})
+	c.SetSMPSecretNormalization(SMPTrimWhitespace)
+
+	msg, _ := c.StartAuthenticate(v.Question, []byte("  "+v.AliceSecret+" "))
+
+	dec, _ := c.decode(encodedMessage(msg[0]))
+	tlvs := fixtureDecryptDataMsg(dec).tlvs
+	assertDeepEquals(t, tlvs[0], v.tlv(0))
+}
+
+func Test_StartAuthenticate_doesNotSendTheNormalizationRulesByDefault(t *testing.T) {
+	v := fixtureSMPVector(t)
+	c := v.asAlice(newConversation(otrV3{}, nil))
+	_, c.keys = fixtureDataMsg(plainDataMsg{})
+	c.Policies.AllowPrivateTLVs()
+
+	msg, _ := c.StartAuthenticate(v.Question, []byte(v.AliceSecret))
+
+	dec, _ := c.decode(encodedMessage(msg[0]))
+	tlvs := fixtureDecryptDataMsg(dec).tlvs
+	assertDeepEquals(t, tlvs[0], v.tlv(0))
+	assertEquals(t, tlvs[1].tlvType, tlvTypePadding)
+}
+
+func Test_ProvideAuthenticationSecret_usesOurNormalizationRulesAndNotThePeers(t *testing.T) {
+	v := fixtureSMPVector(t)
+	c := v.asBob(newConversation(otrV3{}, nil))
+	_, c.keys = fixtureDataMsg(plainDataMsg{})
+	c.Policies.AllowPrivateTLVs()
+	c.SetSMPSecretNormalization(SMPTrimWhitespace)
+	c.processSMPSecretNormalizationTLV((SMPTrimWhitespace | SMPFoldCase).tlv(), dataMessageExtra{})
+	c.processSMPTLV(v.tlv(0), dataMessageExtra{})
+
+	msg, err := c.ProvideAuthenticationSecret([]byte("\t" + v.BobSecret + "  "))
+	assertNil(t, err)
+
+	dec, _ := c.decode(encodedMessage(msg[0]))
+	assertDeepEquals(t, fixtureDecryptDataMsg(dec).tlvs[0], v.tlv(1))
+}
+
+func authenticateWithNormalization(t *testing.T, aliceRules, bobRules SMPNormalization, aliceSecret, bobSecret string) []SMPEvent {
+	alice, bob := encryptedConversations(t)
+	alice.Policies.AllowPrivateTLVs()
+	bob.Policies.AllowPrivateTLVs()
+	alice.SetSMPSecretNormalization(aliceRules)
+	bob.SetSMPSecretNormalization(bobRules)
+	return authenticate(t, alice, bob, aliceSecret, bobSecret)
+}
+
+// authenticate runs an authentication started by alice, and returns the events bob got
+func authenticate(t *testing.T, alice, bob *Conversation, aliceSecret, bobSecret string) []SMPEvent {
+	var bobEvents []SMPEvent
+	bob.smpEventHandler = dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		bobEvents = append(bobEvents, event)
+	}}
+
+	var aliceMessages, bobMessages []ValidMessage
+	var err error
+	aliceMessages, err = alice.StartAuthenticate("", []byte(aliceSecret))
+	assertNil(t, err)
+	_, _, err = bob.Receive(aliceMessages[0])
+	assertNil(t, err)
+	bobMessages, err = bob.ProvideAuthenticationSecret([]byte(bobSecret))
+	assertNil(t, err)
+	_, aliceMessages, err = alice.Receive(bobMessages[0])
+	assertNil(t, err)
+	_, bobMessages, err = bob.Receive(aliceMessages[0])
+	assertNil(t, err)
+	_, _, err = alice.Receive(bobMessages[0])
+	assertNil(t, err)
+
+	return bobEvents
+}
+
+func Test_SMP_succeedsWithDifferentlyTypedSecretsWhenBothNormalizeTheSameWay(t *testing.T) {
+	rules := SMPNormalizeNFKC | SMPTrimWhitespace | SMPFoldCase
+	evs := authenticateWithNormalization(t, rules, rules, "Ｇｏｐｈｅｒ ", "gopher")
+	assertDeepEquals(t, evs, []SMPEvent{SMPEventAskForSecret, SMPEventSuccess})
+}
+
+func Test_SMP_doesntApplyTheInitiatorsRulesToOurSecret(t *testing.T) {
+	evs := authenticateWithNormalization(t, SMPNormalizeNFKC|SMPTrimWhitespace|SMPFoldCase, 0, "Ｇｏｐｈｅｒ ", "Gopher")
+	assertDeepEquals(t, evs, []SMPEvent{SMPEventNormalizationMismatch, SMPEventAskForSecret, SMPEventFailure})
+
+	evs = authenticateWithNormalization(t, SMPNormalizeNFC, SMPFoldCase, "Cafe\u0301", "Caf\u00e9")
+	assertDeepEquals(t, evs, []SMPEvent{SMPEventNormalizationMismatch, SMPEventAskForSecret, SMPEventFailure})
+}
+
+func Test_SMP_failsWithDifferentlyTypedSecretsWithoutNormalization(t *testing.T) {
+	evs := authenticateWithNormalization(t, 0, 0, "Gopher ", "gopher")
+	assertDeepEquals(t, evs, []SMPEvent{SMPEventAskForSecret, SMPEventFailure})
+}
+
+func Test_SMP_succeedsWithDifferentRulesWhenTheResponderFollowsThePeer(t *testing.T) {
+	evs := authenticateWithNormalization(t, SMPNormalizeNFKC|SMPTrimWhitespace|SMPFoldCase, SMPFollowPeerNormalization, "Ｇｏｐｈｅｒ ", "Gopher")
+	assertDeepEquals(t, evs, []SMPEvent{SMPEventAskForSecret, SMPEventSuccess})
+
+	evs = authenticateWithNormalization(t, SMPNormalizeNFC, SMPFoldCase|SMPFollowPeerNormalization, "Cafe\u0301", "Cafe\u0301")
+	assertDeepEquals(t, evs, []SMPEvent{SMPEventAskForSecret, SMPEventSuccess})
+}
+
+func Test_SMP_followingThePeerUsesOurRulesWhenThePeerDidntAnnounceAny(t *testing.T) {
+	evs := authenticateWithNormalization(t, 0, SMPTrimWhitespace|SMPFollowPeerNormalization, "Gopher", "Gopher ")
+	assertDeepEquals(t, evs, []SMPEvent{SMPEventAskForSecret, SMPEventSuccess})
+}
+
+func Test_SMP_followingThePeerForgetsTheRulesOfThePreviousAuthentication(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	alice.Policies.AllowPrivateTLVs()
+	bob.Policies.AllowPrivateTLVs()
+	alice.SetSMPSecretNormalization(SMPFoldCase)
+	bob.SetSMPSecretNormalization(SMPFollowPeerNormalization)
+
+	evs := authenticate(t, alice, bob, "Gopher", "GOPHER")
+	assertDeepEquals(t, evs, []SMPEvent{SMPEventAskForSecret, SMPEventSuccess})
+
+	alice.SetSMPSecretNormalization(0)
+	evs = authenticate(t, alice, bob, "Gopher", "GOPHER")
+	assertDeepEquals(t, evs, []SMPEvent{SMPEventAskForSecret, SMPEventFailure})
+}
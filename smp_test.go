@@ -2,22 +2,13 @@ package otr3
 
 import "testing"
 
-func Test_generateSMPSecretGeneratesASecret(t *testing.T) {
-	aliceFingerprint := bytesFromHex("0102030405060708090A0B0C0D0E0F1011121314")
-	bobFingerprint := bytesFromHex("3132333435363738393A3B3C3D3E3F4041424344")
-	ssid := bytesFromHex("FFF1D1E412345668")
-	secret := []byte("this is something secret")
-	result := generateSMPSecret(aliceFingerprint, bobFingerprint, ssid, secret)
-	assertDeepEquals(t, result, bnFromHex("D9B2E56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3"))
-}
-
 func Test_SMPQuestion_returnsTheCurrentSMPQuestion(t *testing.T) {
 	c := newConversation(otrV3{}, fixtureRand())
-	q := "Are all greeks liars?"
-	c.smp.question = &q
+	v := fixtureSMPVector(t)
+	v.moveSMPTo(c, SMPStatusWaitingForSecret)
 	res, ok := c.SMPQuestion()
 	assertEquals(t, ok, true)
-	assertDeepEquals(t, res, "Are all greeks liars?")
+	assertDeepEquals(t, res, v.Question)
 }
 
 func Test_SMPQuestion_returnsNotOKIfThereIsNoQuestion(t *testing.T) {
@@ -25,3 +16,42 @@ func Test_SMPQuestion_returnsNotOKIfThereIsNoQuestion(t *testing.T) {
 	_, ok := c.SMPQuestion()
 	assertEquals(t, ok, false)
 }
+
+func Test_SMPStatus_returnsExpect1IfTheStateMachineHasNotStarted(t *testing.T) {
+	c := &Conversation{}
+	assertEquals(t, c.SMPStatus(), SMPStatusExpect1)
+}
+
+func Test_SMPStatus_returnsTheStepOfTheCurrentState(t *testing.T) {
+	v := fixtureSMPVector(t)
+
+	for _, s := range []SMPStatus{SMPStatusWaitingForSecret, SMPStatusExpect2, SMPStatusExpect3, SMPStatusExpect4} {
+		c := newConversation(otrV3{}, fixtureRand())
+		v.moveSMPTo(c, s)
+		assertEquals(t, c.SMPStatus(), s)
+	}
+}
+
+func Test_SMPStatus_hasStringRepresentation(t *testing.T) {
+	assertEquals(t, SMPStatusExpect1.String(), "SMPStatusExpect1")
+	assertEquals(t, SMPStatusWaitingForSecret.String(), "SMPStatusWaitingForSecret")
+	assertEquals(t, SMPStatusExpect2.String(), "SMPStatusExpect2")
+	assertEquals(t, SMPStatusExpect3.String(), "SMPStatusExpect3")
+	assertEquals(t, SMPStatusExpect4.String(), "SMPStatusExpect4")
+	assertEquals(t, SMPStatus(99).String(), "SMP STATUS: (THIS SHOULD NEVER HAPPEN)")
+}
+
+func Test_SMP_signalsAFailureInsteadOfAnAbortToTheInitiatorWhenTheSecretsDontMatch(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	var aliceEvents []SMPEvent
+	alice.smpEventHandler = dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		aliceEvents = append(aliceEvents, event)
+	}}
+
+	bobEvents := authenticate(t, alice, bob, "tom", "jerry")
+
+	assertDeepEquals(t, bobEvents, []SMPEvent{SMPEventAskForSecret, SMPEventFailure})
+	assertDeepEquals(t, aliceEvents, []SMPEvent{SMPEventInProgress, SMPEventFailure})
+	assertEquals(t, alice.SMPStatus(), SMPStatusExpect1)
+	assertEquals(t, bob.SMPStatus(), SMPStatusExpect1)
+}
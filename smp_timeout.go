@@ -0,0 +1,38 @@
+package otr3
+
+import "time"
+
+// SetSMPTimeout sets how long an authentication can wait for its next step before it is aborted.
+// When an authentication times out, an abort message is sent to the peer and SMPEventAbort is signaled. If the abort
+// message can't be created, MessageEventEncryptionError is signaled with the error, and the peer will notice the
+// abort the next time it sends an SMP message.
+// The timeout is checked every time Send or Receive is called. A zero duration, the default, disables it.
+func (c *Conversation) SetSMPTimeout(d time.Duration) {
+	c.smp.timeout = d
+}
+
+func (c *Conversation) updateLastSMPActivity() {
+	c.smp.lastActivity = c.now()
+}
+
+func (c *Conversation) smpHasTimedOut() bool {
+	return c.smp.timeout > 0 &&
+		c.smp.InProgress() &&
+		c.smp.lastActivity.Before(c.now().Add(-c.smp.timeout))
+}
+
+func (c *Conversation) potentialSMPTimeout() {
+	if !c.smpHasTimedOut() {
+		return
+	}
+
+	toSend, err := c.AbortAuthentication()
+	if err != nil {
+		c.messageEventWithError(MessageEventEncryptionError, err)
+	}
+	for _, m := range toSend {
+		c.injectMessage(m)
+	}
+
+	c.smpEvent(SMPEventAbort, 0)
+}
@@ -0,0 +1,89 @@
+package otr3
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_potentialSMPTimeout_doesNothingIfNoTimeoutIsSet(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusExpect2)
+	c.smp.lastActivity = time.Now().Add(-time.Hour)
+
+	c.potentialSMPTimeout()
+
+	assertEquals(t, c.SMPStatus(), SMPStatusExpect2)
+	assertEquals(t, len(c.injections.messages), 0)
+}
+
+func Test_potentialSMPTimeout_doesNothingIfTheTimeoutHasNotPassed(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusExpect2)
+	c.SetSMPTimeout(time.Minute)
+	c.updateLastSMPActivity()
+
+	c.potentialSMPTimeout()
+
+	assertEquals(t, c.SMPStatus(), SMPStatusExpect2)
+	assertEquals(t, len(c.injections.messages), 0)
+}
+
+func Test_potentialSMPTimeout_abortsTheAuthenticationAndSignalsAnAbortEvent(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusExpect3)
+	c.SetSMPTimeout(time.Minute)
+	c.smp.lastActivity = time.Now().Add(-2 * time.Minute)
+
+	c.expectSMPEvent(t, func() {
+		c.potentialSMPTimeout()
+	}, SMPEventAbort, 0, "")
+
+	assertEquals(t, c.SMPStatus(), SMPStatusExpect1)
+	assertEquals(t, len(c.injections.messages), 1)
+}
+
+func Test_potentialSMPTimeout_signalsAnEncryptionErrorWhenTheAbortMessageCantBeCreated(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusExpect3)
+	c.SetSMPTimeout(time.Minute)
+	c.smp.lastActivity = time.Now().Add(-2 * time.Minute)
+	c.keys.theirKeyID = 0
+
+	c.expectMessageEvent(t, func() {
+		c.potentialSMPTimeout()
+	}, MessageEventEncryptionError, nil, newOtrConflictError("invalid key id for remote peer"))
+
+	assertEquals(t, c.SMPStatus(), SMPStatusExpect1)
+	assertEquals(t, len(c.injections.messages), 0)
+}
+
+func Test_Send_injectsTheAbortMessageWhenTheAuthenticationHasTimedOut(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.Policies = policies(allowV3)
+	fixtureSMPVector(t).moveSMPTo(c, SMPStatusExpect4)
+	c.SetSMPTimeout(time.Second)
+	c.smp.lastActivity = time.Now().Add(-time.Minute)
+
+	toSend, err := c.Send(ValidMessage("hello"))
+
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 2)
+	assertEquals(t, c.SMPStatus(), SMPStatusExpect1)
+}
+
+func Test_StartAuthenticate_updatesTheLastSMPActivity(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.ourKey = bobPrivateKey
+	c.theirKey = &alicePrivateKey.PublicKey
+
+	before := time.Now()
+	c.StartAuthenticate("", []byte("hello world"))
+
+	assertFalse(t, c.smp.lastActivity.Before(before))
+}
@@ -1,7 +1,5 @@
 package otr3
 
-import "bytes"
-
 const tlvHeaderLength = 4
 
 const (
@@ -16,9 +14,19 @@ const (
 	tlvTypeExtraSymmetricKey = uint16(0x08)
 )
 
+// The TLVs this package adds to the OTR specification use types from privateTLVTypes up, far from the small numbers
+// the specification assigns, so they don't clash with the TLVs a later version of it defines. They are only sent and
+// read with the AllowPrivateTLVs policy, and clients that don't know them will ignore them.
+const (
+	privateTLVTypes = uint16(0xF000)
+
+	tlvTypeKeyTransition          = privateTLVTypes + 0x01
+	tlvTypeSMPSecretNormalization = privateTLVTypes + 0x02
+)
+
 type tlvHandler func(*Conversation, tlv, dataMessageExtra) (*tlv, error)
 
-var tlvHandlers = make([]tlvHandler, 9)
+var tlvHandlers = make(map[uint16]tlvHandler)
 
 func initTLVHandlers() {
 	tlvHandlers[tlvTypePadding] = func(c *Conversation, t tlv, x dataMessageExtra) (*tlv, error) {
@@ -48,13 +56,20 @@ func initTLVHandlers() {
 	tlvHandlers[tlvTypeExtraSymmetricKey] = func(c *Conversation, t tlv, x dataMessageExtra) (*tlv, error) {
 		return c.processExtraSymmetricKeyTLV(t, x)
 	}
+	tlvHandlers[tlvTypeSMPSecretNormalization] = func(c *Conversation, t tlv, x dataMessageExtra) (*tlv, error) {
+		return c.processSMPSecretNormalizationTLV(t, x)
+	}
+	tlvHandlers[tlvTypeKeyTransition] = func(c *Conversation, t tlv, x dataMessageExtra) (*tlv, error) {
+		return c.processKeyTransitionTLV(t, x)
+	}
 }
 
 func messageHandlerForTLV(t tlv) (tlvHandler, error) {
-	if t.tlvType >= uint16(len(tlvHandlers)) {
+	h, ok := tlvHandlers[t.tlvType]
+	if !ok {
 		return nil, newOtrError("unexpected TLV type")
 	}
-	return tlvHandlers[t.tlvType], nil
+	return h, nil
 }
 
 type tlv struct {
@@ -85,103 +100,3 @@ func (c *tlv) deserialize(tlvsBytes []byte) error {
 	c.tlvValue = tlvsBytes[:int(c.tlvLength)]
 	return nil
 }
-
-func (c tlv) isSMPMessage() bool {
-	return c.tlvType >= tlvTypeSMP1 && c.tlvType <= tlvTypeSMP1WithQuestion
-}
-
-func (c tlv) smpMessage() (smpMessage, bool) {
-	switch c.tlvType {
-	case tlvTypeSMP1:
-		return toSmpMessage1(c)
-	case tlvTypeSMP1WithQuestion:
-		return toSmpMessage1Q(c)
-	case tlvTypeSMP2:
-		return toSmpMessage2(c)
-	case tlvTypeSMP3:
-		return toSmpMessage3(c)
-	case tlvTypeSMP4:
-		return toSmpMessage4(c)
-	case tlvTypeSMPAbort:
-		return toSmpMessageAbort(c)
-	}
-
-	return nil, false
-}
-
-func toSmpMessage1(t tlv) (msg smp1Message, ok bool) {
-	_, mpis, ok := extractMPIs(t.tlvValue)
-	if !ok || len(mpis) < 6 {
-		return msg, false
-	}
-	msg.g2a = mpis[0]
-	msg.c2 = mpis[1]
-	msg.d2 = mpis[2]
-	msg.g3a = mpis[3]
-	msg.c3 = mpis[4]
-	msg.d3 = mpis[5]
-	return msg, true
-}
-
-func toSmpMessage1Q(t tlv) (msg smp1Message, ok bool) {
-	nulPos := bytes.IndexByte(t.tlvValue, 0)
-	if nulPos == -1 {
-		return msg, false
-	}
-	question := string(t.tlvValue[:nulPos])
-	t.tlvValue = t.tlvValue[(nulPos + 1):]
-	msg, ok = toSmpMessage1(t)
-	msg.hasQuestion = true
-	msg.question = question
-	return msg, ok
-}
-
-func toSmpMessage2(t tlv) (msg smp2Message, ok bool) {
-	_, mpis, ok := extractMPIs(t.tlvValue)
-	if !ok || len(mpis) < 11 {
-		return msg, false
-	}
-	msg.g2b = mpis[0]
-	msg.c2 = mpis[1]
-	msg.d2 = mpis[2]
-	msg.g3b = mpis[3]
-	msg.c3 = mpis[4]
-	msg.d3 = mpis[5]
-	msg.pb = mpis[6]
-	msg.qb = mpis[7]
-	msg.cp = mpis[8]
-	msg.d5 = mpis[9]
-	msg.d6 = mpis[10]
-	return msg, true
-}
-
-func toSmpMessage3(t tlv) (msg smp3Message, ok bool) {
-	_, mpis, ok := extractMPIs(t.tlvValue)
-	if !ok || len(mpis) < 8 {
-		return msg, false
-	}
-	msg.pa = mpis[0]
-	msg.qa = mpis[1]
-	msg.cp = mpis[2]
-	msg.d5 = mpis[3]
-	msg.d6 = mpis[4]
-	msg.ra = mpis[5]
-	msg.cr = mpis[6]
-	msg.d7 = mpis[7]
-	return msg, true
-}
-
-func toSmpMessage4(t tlv) (msg smp4Message, ok bool) {
-	_, mpis, ok := extractMPIs(t.tlvValue)
-	if !ok || len(mpis) < 3 {
-		return msg, false
-	}
-	msg.rb = mpis[0]
-	msg.cr = mpis[1]
-	msg.d7 = mpis[2]
-	return msg, true
-}
-
-func toSmpMessageAbort(t tlv) (msg smpMessageAbort, ok bool) {
-	return msg, true
-}
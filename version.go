@@ -1,14 +1,11 @@
 package otr3
 
-import (
-	"bytes"
-	"math/big"
-)
+import "bytes"
 
 type otrVersion interface {
 	protocolVersion() uint16
 	parameterLength() int
-	isGroupElement(n *big.Int) bool
+	checksGroupElements() bool
 	isFragmented(data []byte) bool
 	parseFragmentPrefix(c *Conversation, data []byte) (rest []byte, ignore bool, ok bool)
 	fragmentPrefix(n, total int, itags uint32, itagr uint32) []byte
@@ -1,6 +1,9 @@
 package otr3
 
-import "math/big"
+import (
+	"math/big"
+	"unsafe"
+)
 
 func (p *dhKeyPair) wipe() {
 	if p == nil {
@@ -11,6 +14,8 @@ func (p *dhKeyPair) wipe() {
 	wipeBigInt(p.priv)
 	p.pub = nil
 	p.priv = nil
+	p.privMemory.Release()
+	p.privMemory = nil
 }
 
 func (k *akeKeys) wipe() {
@@ -23,6 +28,24 @@ func (k *akeKeys) wipe() {
 	wipeBytes(k.m2[:])
 }
 
+func (k *lockedSessionKeys) wipe() {
+	if k == nil {
+		return
+	}
+
+	sessionKeysPool.Put(unsafe.Pointer(k.sessionKeys))
+	k.sessionKeys = nil
+}
+
+func (k *lockedAKEKeys) wipe() {
+	if k == nil {
+		return
+	}
+
+	k.mem.Release()
+	*k = lockedAKEKeys{}
+}
+
 func (a *ake) wipe(wipeKeys bool) {
 	if a == nil {
 		return
@@ -40,8 +63,7 @@ func (a *ake) wipe(wipeKeys bool) {
 	wipeBytes(a.r[:])
 
 	a.wipeGX()
-	a.revealKey.wipe()
-	a.sigKey.wipe()
+	a.akeKeys.wipe()
 
 	if wipeKeys {
 		a.keys.wipe()
@@ -88,6 +88,49 @@ func Test_akeKeys_wipe_HandlesNilWell(t *testing.T) {
 	(*akeKeys)(nil).wipe()
 }
 
+func Test_lockedSessionKeys_wipe_HandlesNilWell(t *testing.T) {
+	(*lockedSessionKeys)(nil).wipe()
+}
+
+func Test_lockedSessionKeys_wipe_wipesTheKeysAndReturnsTheirMemoryToThePool(t *testing.T) {
+	keys := calculateDHSessionKeys(fixedX(), fixedGX(), fixedGY())
+	sk := keys.sessionKeys
+
+	keys.wipe()
+
+	assertDeepEquals(t, *sk, sessionKeys{})
+	assertNil(t, keys.sessionKeys)
+	assertEquals(t, newLockedSessionKeys().sessionKeys, sk)
+}
+
+func Test_calculateDHSessionKeys_doesntAllocateMemoryForEveryMessage(t *testing.T) {
+	keys := calculateDHSessionKeys(fixedX(), fixedGX(), fixedGY())
+	keys.wipe()
+	before := collectGarbage()
+
+	for i := 0; i < 100; i++ {
+		keys := calculateDHSessionKeys(fixedX(), fixedGX(), fixedGY())
+		keys.wipe()
+	}
+
+	assertEquals(t, collectGarbage(), before)
+}
+
+func Test_lockedAKEKeys_wipe_HandlesNilWell(t *testing.T) {
+	(*lockedAKEKeys)(nil).wipe()
+}
+
+func Test_lockedAKEKeys_wipe_releasesTheMemory(t *testing.T) {
+	keys := newLockedAKEKeys()
+	mem := keys.mem
+	keys.revealSigKeys.c[0] = 1
+
+	keys.wipe()
+
+	assertNil(t, mem.Bytes())
+	assertDeepEquals(t, keys, lockedAKEKeys{})
+}
+
 func Test_ake_wipe_HandlesNilWell(t *testing.T) {
 	(*ake)(nil).wipe(true)
 }